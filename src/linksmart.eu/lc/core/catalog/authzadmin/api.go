@@ -0,0 +1,161 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authzadmin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"linksmart.eu/lc/sec/auth/validator"
+	"linksmart.eu/lc/sec/authz"
+)
+
+// ErrorResponseFunc writes an error in the format of the API
+type ErrorResponseFunc func(w http.ResponseWriter, code int, msgs ...string)
+
+// Collection of the rules, in the format of the authorization config
+type Collection struct {
+	Rules []authz.Rule `json:"rules"`
+}
+
+// CheckResult answers whether a request would be authorized
+type CheckResult struct {
+	Authorized bool `json:"authorized"`
+	// The access depends on the conditions of the rules on the accessed entries
+	Conditional bool `json:"conditional"`
+}
+
+// API serves the rules of a Manager
+type API struct {
+	manager       *Manager
+	errorResponse ErrorResponseFunc
+}
+
+// NewAPI creates the admin API of a manager
+// Errors are answered using errorResponse
+func NewAPI(manager *Manager, errorResponse ErrorResponseFunc) *API {
+	return &API{
+		manager:       manager,
+		errorResponse: errorResponse,
+	}
+}
+
+// Lists the rules
+func (a *API) List(w http.ResponseWriter, req *http.Request) {
+	a.write(w, http.StatusOK, &Collection{Rules: a.manager.Rules()})
+}
+
+// Retrieves a rule
+func (a *API) Get(w http.ResponseWriter, req *http.Request) {
+	rule, err := a.manager.Rule(mux.Vars(req)["id"])
+	if err != nil {
+		a.error(w, err)
+		return
+	}
+	a.write(w, http.StatusOK, rule)
+}
+
+// Adds a rule
+func (a *API) Post(w http.ResponseWriter, req *http.Request) {
+	rule, ok := a.read(w, req)
+	if !ok {
+		return
+	}
+	user, groups := userOf(req)
+	id, err := a.manager.Add(rule, user, groups)
+	if err != nil {
+		a.error(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%s", Location, RulesPath, id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Updates a rule
+func (a *API) Put(w http.ResponseWriter, req *http.Request) {
+	rule, ok := a.read(w, req)
+	if !ok {
+		return
+	}
+	user, groups := userOf(req)
+	if err := a.manager.Update(mux.Vars(req)["id"], rule, user, groups); err != nil {
+		a.error(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Deletes a rule
+func (a *API) Delete(w http.ResponseWriter, req *http.Request) {
+	user, groups := userOf(req)
+	if err := a.manager.Remove(mux.Vars(req)["id"], user, groups); err != nil {
+		a.error(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Checks whether a request would be authorized by the rules in effect (dry-run)
+// The query parameters give the resource, method, user and groups (repeated) of the request
+func (a *API) Check(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	resource, method := query.Get(ParamResource), query.Get(ParamMethod)
+	if resource == "" || method == "" {
+		a.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Query parameters %s and %s are required", ParamResource, ParamMethod))
+		return
+	}
+	var result CheckResult
+	result.Authorized, result.Conditional = a.manager.Check(resource, method, query.Get(ParamUser), query[ParamGroup])
+	a.write(w, http.StatusOK, &result)
+}
+
+// Returns the rule in the body of a request, or answers with an error
+func (a *API) read(w http.ResponseWriter, req *http.Request) (authz.Rule, bool) {
+	var rule authz.Rule
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		a.errorResponse(w, http.StatusBadRequest, err.Error())
+		return rule, false
+	}
+	if err := json.Unmarshal(body, &rule); err != nil {
+		a.errorResponse(w, http.StatusBadRequest, "Error processing the request:", err.Error())
+		return rule, false
+	}
+	return rule, true
+}
+
+func (a *API) write(w http.ResponseWriter, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		a.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func (a *API) error(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *NotFoundError:
+		a.errorResponse(w, http.StatusNotFound, err.Error())
+	case *ConflictError:
+		a.errorResponse(w, http.StatusConflict, err.Error())
+	case *BadRequestError:
+		a.errorResponse(w, http.StatusBadRequest, "Invalid rule:", err.Error())
+	default:
+		a.errorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Returns the user and groups of a request, anonymous requests belong to the anonymous group
+func userOf(req *http.Request) (string, []string) {
+	if profile := validator.GetUserProfile(req); profile != nil {
+		return profile.Username, profile.Groups
+	}
+	return "", []string{"anonymous"}
+}
@@ -0,0 +1,25 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authzadmin
+
+const (
+	// Location of the admin API
+	Location = "/authz"
+	// RulesPath lists and manages the rules (Location/rules and Location/rules/{id})
+	RulesPath = "/rules"
+	// CheckPath answers whether a request would be authorized (Location/check)
+	CheckPath = "/check"
+	// Id of a rule in the paths checked against self-lockout
+	sampleID = "sample"
+	// Suffix of the path of the LevelDB database persisting the rules, next to the catalog database
+	levelDBSuffix = ".authz"
+	logComponent  = "authzadmin"
+)
+
+// Query parameters of the check
+const (
+	ParamResource = "resource"
+	ParamMethod   = "method"
+	ParamUser     = "user"
+	ParamGroup    = "group"
+)
@@ -0,0 +1,9 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+// Package authzadmin manages the authorization rules of a service at runtime.
+//
+// The rules of the configuration are replaced by the managed rules once they are changed through the
+// admin API, which persists them next to the catalog storage to survive restarts. Access to the API is
+// itself controlled by the authorization rules; changes revoking the access of the requesting user
+// to the API are rejected, so that administrators cannot lock themselves out.
+package authzadmin
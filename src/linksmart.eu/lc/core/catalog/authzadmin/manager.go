@@ -0,0 +1,163 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authzadmin
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pborman/uuid"
+	"linksmart.eu/lc/sec/authz"
+)
+
+// Routes of the admin API with the methods they accept, whose access must not be revoked by a change of the rules
+// The routes of single rules are checked with a sample id
+var adminRoutes = []struct {
+	path    string
+	methods []string
+}{
+	{Location + RulesPath, []string{"GET", "POST"}},
+	{Location + RulesPath + "/" + sampleID, []string{"GET", "PUT", "DELETE"}},
+	{Location + CheckPath, []string{"GET"}},
+}
+
+// Config of the admin API
+type Config struct {
+	// Admin API switch, requires authentication with authorization rules
+	Enabled bool `json:"enabled"`
+}
+
+// Manager changes the authorization rules in effect at runtime and persists them in a Store
+type Manager struct {
+	sync.Mutex
+	conf  *authz.Conf
+	store Store
+}
+
+// NewManager manages the rules of conf, which are replaced by the stored ones if any have been stored
+// Rules without id, e.g. those of the configuration, are given one
+func NewManager(conf *authz.Conf, store Store) (*Manager, error) {
+	rules, stored, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("Error loading the authorization rules: %s", err)
+	}
+	if stored {
+		logger.Infof("Loaded %d authorization rules from the storage, replacing the configured ones", len(rules))
+	} else {
+		rules = conf.GetRules()
+	}
+	for i := range rules {
+		if rules[i].Id == "" {
+			rules[i].Id = uuid.New()
+		}
+	}
+	if err := conf.SetRules(rules); err != nil {
+		return nil, fmt.Errorf("Invalid authorization rules: %s", err)
+	}
+
+	return &Manager{
+		conf:  conf,
+		store: store,
+	}, nil
+}
+
+// Rules returns the rules in effect
+func (m *Manager) Rules() []authz.Rule {
+	return m.conf.GetRules()
+}
+
+// Rule returns the rule with the given id
+func (m *Manager) Rule(id string) (*authz.Rule, error) {
+	rules := m.conf.GetRules()
+	i := index(rules, id)
+	if i == -1 {
+		return nil, &NotFoundError{fmt.Sprintf("Rule %s is not found", id)}
+	}
+	return &rules[i], nil
+}
+
+// Add adds a rule on behalf of the given user and returns its id, which is generated if not given
+func (m *Manager) Add(rule authz.Rule, user string, groups []string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	rules := m.conf.GetRules()
+	if rule.Id == "" {
+		rule.Id = uuid.New()
+	} else if index(rules, rule.Id) != -1 {
+		return "", &ConflictError{fmt.Sprintf("Rule id %s is not unique", rule.Id)}
+	}
+	return rule.Id, m.apply(append(rules, rule), user, groups)
+}
+
+// Update replaces the rule with the given id on behalf of the given user
+func (m *Manager) Update(id string, rule authz.Rule, user string, groups []string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	rules := m.conf.GetRules()
+	i := index(rules, id)
+	if i == -1 {
+		return &NotFoundError{fmt.Sprintf("Rule %s is not found", id)}
+	}
+	if rule.Id != "" && rule.Id != id {
+		return &ConflictError{"Rule id cannot be changed"}
+	}
+	rule.Id = id
+	rules[i] = rule
+	return m.apply(rules, user, groups)
+}
+
+// Remove removes the rule with the given id on behalf of the given user
+func (m *Manager) Remove(id string, user string, groups []string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	rules := m.conf.GetRules()
+	i := index(rules, id)
+	if i == -1 {
+		return &NotFoundError{fmt.Sprintf("Rule %s is not found", id)}
+	}
+	return m.apply(append(rules[:i], rules[i+1:]...), user, groups)
+}
+
+// Check answers whether a user/group would be authorized to access resource using a specific method
+// and whether the access depends on the conditions of the rules on the accessed entries
+func (m *Manager) Check(resource, method, user string, groups []string) (authorized, conditional bool) {
+	return m.conf.Authorized(resource, method, user, groups), m.conf.Conditional(resource, method, user, groups)
+}
+
+// Validates, persists and puts the rules into effect
+// The rules must keep the access of the user to the admin API with the methods it is currently authorized to use
+func (m *Manager) apply(rules []authz.Rule, user string, groups []string) error {
+	candidate := &authz.Conf{Rules: rules}
+	if err := candidate.Validate(); err != nil {
+		return &BadRequestError{err.Error()}
+	}
+	for _, route := range adminRoutes {
+		for _, method := range route.methods {
+			if m.conf.Authorized(route.path, method, user, groups) && !candidate.Authorized(route.path, method, user, groups) {
+				return &ConflictError{fmt.Sprintf("The change would revoke the %s access of the user to %s", method, route.path)}
+			}
+		}
+	}
+
+	if err := m.store.Save(rules); err != nil {
+		return fmt.Errorf("Error storing the rules: %s", err)
+	}
+	if err := m.conf.SetRules(rules); err != nil {
+		return &BadRequestError{err.Error()}
+	}
+	logger.With("user", user, "rules", len(rules)).Infof("Authorization rules changed")
+	return nil
+}
+
+// Returns the index of the rule with the given id, or -1
+func index(rules []authz.Rule, id string) int {
+	for i := range rules {
+		if rules[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
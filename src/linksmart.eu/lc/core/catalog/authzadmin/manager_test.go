@@ -0,0 +1,255 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authzadmin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"linksmart.eu/lc/sec/auth/validator"
+	"linksmart.eu/lc/sec/authz"
+)
+
+// Validates tickets of the form user:group1,group2
+type testDriver struct{}
+
+func (testDriver) Validate(serverAddr, serviceID, ticket string) (bool, *validator.UserProfile, error) {
+	parts := strings.SplitN(ticket, ":", 2)
+	profile := &validator.UserProfile{Username: parts[0]}
+	if len(parts) == 2 {
+		profile.Groups = strings.Split(parts[1], ",")
+	}
+	return true, profile, nil
+}
+
+func init() {
+	validator.Register("authzadmin-test", testDriver{})
+}
+
+func testConf() *authz.Conf {
+	return &authz.Conf{Rules: []authz.Rule{
+		{Resources: []string{Location}, Methods: []string{authz.AnyMethod}, Groups: []string{"admins"}},
+		{Resources: []string{"/rc"}, Methods: []string{"GET"}, Users: []string{"alice"}},
+	}}
+}
+
+func TestManager(t *testing.T) {
+	conf := testConf()
+	m, err := NewManager(conf, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rules := m.Rules()
+	if len(rules) != 2 || rules[0].Id == "" || rules[1].Id == "" {
+		t.Fatalf("Expected the configured rules with ids, got %+v", rules)
+	}
+	admin := []string{"admins"}
+
+	// Add
+	id, err := m.Add(authz.Rule{Id: "bob", Resources: []string{"/sc"}, Methods: []string{"GET"}, Users: []string{"bob"}}, "root", admin)
+	if err != nil || id != "bob" {
+		t.Fatalf("Unexpected result adding a rule: %s %v", id, err)
+	}
+	if !conf.Authorized("/sc", "GET", "bob", nil) {
+		t.Fatal("Expected the added rule to be in effect")
+	}
+	if _, err := m.Add(authz.Rule{Id: "bob", Resources: []string{"/sc"}, Methods: []string{"GET"}, Users: []string{"eve"}}, "root", admin); err == nil {
+		t.Fatal("Expected an error adding a rule with a duplicate id")
+	} else if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("Expected a conflict for a duplicate id, got %T", err)
+	}
+	if _, err := m.Add(authz.Rule{Resources: []string{"/sc"}, Users: []string{"eve"}}, "root", admin); err == nil {
+		t.Fatal("Expected an error adding an invalid rule")
+	} else if _, ok := err.(*BadRequestError); !ok {
+		t.Fatalf("Expected a bad request for an invalid rule, got %T", err)
+	}
+
+	// Update
+	if err := m.Update("bob", authz.Rule{Resources: []string{"/sc"}, Methods: []string{"PUT"}, Users: []string{"bob"}}, "root", admin); err != nil {
+		t.Fatal(err.Error())
+	}
+	if conf.Authorized("/sc", "GET", "bob", nil) || !conf.Authorized("/sc", "PUT", "bob", nil) {
+		t.Fatal("Expected the updated rule to be in effect")
+	}
+	if err := m.Update("unknown", authz.Rule{Resources: []string{"/sc"}, Methods: []string{"PUT"}, Users: []string{"bob"}}, "root", admin); err == nil {
+		t.Fatal("Expected an error updating an unknown rule")
+	} else if _, ok := err.(*NotFoundError); !ok {
+		t.Fatalf("Expected not found for an unknown rule, got %T", err)
+	}
+
+	// Lockout protection
+	if err := m.Remove(rules[0].Id, "root", admin); err == nil {
+		t.Fatal("Expected an error removing the access of the admin")
+	} else if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("Expected a conflict removing the access of the admin, got %T", err)
+	}
+	restricted := rules[0]
+	restricted.Methods = []string{"GET"}
+	if err := m.Update(rules[0].Id, restricted, "root", admin); err == nil {
+		t.Fatal("Expected an error restricting the access of the admin")
+	}
+	denyRule := authz.Rule{Resources: []string{Location + RulesPath + "/*"}, Methods: []string{authz.AnyMethod}, Groups: admin, Deny: true}
+	if _, err := m.Add(denyRule, "root", admin); err == nil {
+		t.Fatal("Expected an error denying the admin the access to single rules")
+	} else if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("Expected a conflict denying the admin the access to single rules, got %T", err)
+	}
+	denyRule.Resources = []string{Location + CheckPath}
+	if _, err := m.Add(denyRule, "root", admin); err == nil {
+		t.Fatal("Expected an error denying the admin the access to the check")
+	}
+	// Access of other users is not protected
+	if err := m.Remove(rules[1].Id, "root", admin); err != nil {
+		t.Fatal(err.Error())
+	}
+	if conf.Authorized("/rc", "GET", "alice", nil) {
+		t.Fatal("Expected the removed rule to be out of effect")
+	}
+
+	// Dry-run
+	if authorized, conditional := m.Check("/sc/service_1", "PUT", "bob", nil); !authorized || conditional {
+		t.Errorf("Expected unconditional access, got %t %t", authorized, conditional)
+	}
+	if authorized, _ := m.Check("/sc/service_1", "PUT", "eve", nil); authorized {
+		t.Error("Expected no access")
+	}
+}
+
+func TestLevelDBStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authzadmin")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	dsn := "file://" + filepath.ToSlash(filepath.Join(dir, "catalog.ldb"))
+
+	store, err := NewLevelDBStore(dsn)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	m, err := NewManager(testConf(), store)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := m.Add(authz.Rule{Id: "bob", Resources: []string{"/sc"}, Methods: []string{"GET"}, Users: []string{"bob"}}, "root", []string{"admins"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := m.Rules()
+	store.Close()
+
+	// The stored rules replace the configured ones after a restart
+	store, err = NewLevelDBStore(dsn)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	conf := testConf()
+	m, err = NewManager(conf, store)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rules := m.Rules()
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d stored rules, got %d", len(expected), len(rules))
+	}
+	for i := range rules {
+		if rules[i].Id != expected[i].Id {
+			t.Errorf("Expected rule %s, got %s", expected[i].Id, rules[i].Id)
+		}
+	}
+	if !conf.Authorized("/sc", "GET", "bob", nil) {
+		t.Error("Expected the stored rules to be in effect")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	conf := testConf()
+	m, err := NewManager(conf, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	v, err := validator.Setup("authzadmin-test", "", "", false, conf)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	errorResponse := func(w http.ResponseWriter, code int, msgs ...string) {
+		http.Error(w, strings.Join(msgs, " "), code)
+	}
+	api := NewAPI(m, errorResponse)
+
+	r := mux.NewRouter()
+	r.Methods("GET").Path(Location + RulesPath).Handler(v.Handler(http.HandlerFunc(api.List)))
+	r.Methods("POST").Path(Location + RulesPath).Handler(v.Handler(http.HandlerFunc(api.Post)))
+	r.Methods("GET").Path(Location + RulesPath + "/{id}").Handler(v.Handler(http.HandlerFunc(api.Get)))
+	r.Methods("PUT").Path(Location + RulesPath + "/{id}").Handler(v.Handler(http.HandlerFunc(api.Put)))
+	r.Methods("DELETE").Path(Location + RulesPath + "/{id}").Handler(v.Handler(http.HandlerFunc(api.Delete)))
+	r.Methods("GET").Path(Location + CheckPath).Handler(v.Handler(http.HandlerFunc(api.Check)))
+
+	request := func(method, path, ticket string, body interface{}) *httptest.ResponseRecorder {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+ticket)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Only admins may manage the rules
+	if w := request("GET", Location+RulesPath, "alice", nil); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected %d listing the rules as non-admin, got %d", http.StatusForbidden, w.Code)
+	}
+	w := request("GET", Location+RulesPath, "root:admins", nil)
+	var coll Collection
+	if err := json.Unmarshal(w.Body.Bytes(), &coll); err != nil || len(coll.Rules) != 2 {
+		t.Fatalf("Expected the 2 configured rules, got %d: %s", w.Code, w.Body)
+	}
+
+	// Add, retrieve, update and delete
+	rule := authz.Rule{Resources: []string{"/sc"}, Methods: []string{"GET"}, Users: []string{"bob"}}
+	w = request("POST", Location+RulesPath, "root:admins", rule)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected %d adding a rule, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if w := request("GET", location, "root:admins", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected %d retrieving the added rule at %s, got %d", http.StatusOK, location, w.Code)
+	}
+	rule.Methods = []string{"PUT"}
+	if w := request("PUT", location, "root:admins", rule); w.Code != http.StatusOK {
+		t.Fatalf("Expected %d updating the rule, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	// Dry-run
+	var result CheckResult
+	w = request("GET", fmt.Sprintf("%s%s?resource=/sc/s1&method=PUT&user=bob", Location, CheckPath), "root:admins", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || !result.Authorized {
+		t.Fatalf("Expected bob to be authorized by the updated rule, got %d: %s", w.Code, w.Body)
+	}
+	if w := request("GET", Location+CheckPath+"?user=bob", "root:admins", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected %d checking without resource, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := request("DELETE", location, "root:admins", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected %d deleting the rule, got %d", http.StatusOK, w.Code)
+	}
+	if w := request("GET", location, "root:admins", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected %d retrieving the deleted rule, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Lockout
+	if w := request("DELETE", Location+RulesPath+"/"+coll.Rules[0].Id, "root:admins", nil); w.Code != http.StatusConflict {
+		t.Fatalf("Expected %d deleting the rule of the admins, got %d", http.StatusConflict, w.Code)
+	}
+}
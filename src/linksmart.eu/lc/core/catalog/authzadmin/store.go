@@ -0,0 +1,98 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authzadmin
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"linksmart.eu/lc/sec/authz"
+)
+
+// Store persists the managed authorization rules
+type Store interface {
+	// Load returns the stored rules and whether any have been stored
+	Load() ([]authz.Rule, bool, error)
+	Save(rules []authz.Rule) error
+	Close() error
+}
+
+// MemoryStore keeps the rules in memory, they are lost on restart
+type MemoryStore struct {
+	sync.Mutex
+	rules  []authz.Rule
+	stored bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() ([]authz.Rule, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	return append([]authz.Rule(nil), s.rules...), s.stored, nil
+}
+
+func (s *MemoryStore) Save(rules []authz.Rule) error {
+	s.Lock()
+	defer s.Unlock()
+	s.rules, s.stored = append([]authz.Rule(nil), rules...), true
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Key of the rules in the database
+var rulesKey = []byte("rules")
+
+// LevelDBStore persists the rules in a LevelDB database
+type LevelDBStore struct {
+	db *leveldb.DB
+}
+
+// NewLevelDBStore opens the database of the rules next to the catalog database with the given DSN
+// (at its path with the suffix .authz)
+func NewLevelDBStore(dsn string) (*LevelDBStore, error) {
+	url, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := leveldb.OpenFile(url.Path+levelDBSuffix, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBStore{db: db}, nil
+}
+
+func (s *LevelDBStore) Load() ([]authz.Rule, bool, error) {
+	b, err := s.db.Get(rulesKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var rules []authz.Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, false, err
+	}
+	return rules, true, nil
+}
+
+func (s *LevelDBStore) Save(rules []authz.Rule) error {
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(rulesKey, b, nil)
+}
+
+func (s *LevelDBStore) Close() error {
+	return s.db.Close()
+}
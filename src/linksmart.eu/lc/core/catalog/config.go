@@ -0,0 +1,267 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Suffix of the configuration keys and environment variables referring to secret files
+const (
+	secretFileKeySuffix = "File"
+	secretFileEnvSuffix = "_FILE"
+)
+
+var envReference = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// UnmarshalConfig parses a JSON configuration into v, applying the environment before and after parsing:
+// ${NAME} references are expanded (see ExpandEnv) and the values are overridden (see OverrideConfig)
+func UnmarshalConfig(data []byte, prefix string, v interface{}) error {
+	data, err := ExpandEnv(data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	return OverrideConfig(data, prefix, v)
+}
+
+// ExpandEnv replaces ${NAME} references in a JSON document with the values of environment variables
+// Values inside JSON strings are escaped, other values are inserted as they are (e.g. "port": ${PORT})
+// It is an error to reference an unset variable. $${ is replaced with a literal ${
+func ExpandEnv(data []byte) ([]byte, error) {
+	var (
+		out      = make([]byte, 0, len(data))
+		inString bool
+		escaped  bool
+	)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case c == '$' && i+2 < len(data) && data[i+1] == '$' && data[i+2] == '{':
+			out = append(out, '$', '{')
+			i += 2
+			continue
+		case c == '$':
+			m := envReference.FindSubmatch(data[i:])
+			if m == nil {
+				break
+			}
+			name := string(m[1])
+			value, found := os.LookupEnv(name)
+			if !found {
+				return nil, fmt.Errorf("Environment variable %s is not set", name)
+			}
+			if inString {
+				b, _ := json.Marshal(value)
+				value = string(b[1 : len(b)-1])
+			}
+			out = append(out, value...)
+			i += len(m[0]) - 1
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// OverrideConfig overrides the values of a configuration parsed from the JSON document data into v
+// Each value can be set by:
+//  1. a secret file, given by the sibling key <key>File in the JSON document (e.g. "passwordFile")
+//  2. an environment variable named after the path of keys: <PREFIX>_<KEY>_<KEY>..., upper-cased,
+//     with indices of arrays as keys (e.g. RC_SERVICECATALOG_0_AUTH_PASSWORD)
+//  3. a secret file, given by the environment variable <PREFIX>_<KEY>..._FILE
+//
+// where later sources take precedence. Trailing newlines are removed from the contents of secret files
+func OverrideConfig(data []byte, prefix string, v interface{}) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Configuration must be a non-nil pointer, got %T", v)
+	}
+	return overrideValue(rv.Elem(), raw, strings.ToUpper(prefix))
+}
+
+// Overrides a value and its children, raw is the corresponding part of the JSON document
+func overrideValue(v reflect.Value, raw interface{}, name string) error {
+	if !v.CanSet() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return overrideValue(v.Elem(), raw, name)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		// The value of an interface is not settable
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := overrideValue(elem, raw, name); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+
+	case reflect.Struct:
+		return overrideStruct(v, raw, name)
+
+	case reflect.Map:
+		object, _ := raw.(map[string]interface{})
+		for _, key := range v.MapKeys() {
+			// The value of a map entry is not settable
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			k := fmt.Sprint(key.Interface())
+			if err := overrideValue(elem, object[k], name+"_"+strings.ToUpper(k)); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Raw bytes
+			return nil
+		}
+		array, _ := raw.([]interface{})
+		for i := 0; i < v.Len(); i++ {
+			var elem interface{}
+			if i < len(array) {
+				elem = array[i]
+			}
+			if err := overrideValue(v.Index(i), elem, name+"_"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if value, found := os.LookupEnv(name); found {
+		if err := setValue(v, value); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	if v.Kind() == reflect.String {
+		if path, found := os.LookupEnv(name + secretFileEnvSuffix); found {
+			if err := setSecret(v, path); err != nil {
+				return fmt.Errorf("%s: %s", name+secretFileEnvSuffix, err)
+			}
+		}
+	}
+	return nil
+}
+
+func overrideStruct(v reflect.Value, raw interface{}, name string) error {
+	object, _ := raw.(map[string]interface{})
+	t := v.Type()
+
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		keys[jsonKey(t.Field(i))] = true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := jsonKey(field)
+		if key == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		// Fields of embedded structs are at the same level of the document
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			if err := overrideValue(v.Field(i), raw, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := v.Field(i)
+		if f.Kind() == reflect.String && !keys[key+secretFileKeySuffix] {
+			if path, ok := object[key+secretFileKeySuffix].(string); ok && path != "" {
+				if err := setSecret(f, path); err != nil {
+					return fmt.Errorf("%s: %s", key+secretFileKeySuffix, err)
+				}
+			}
+		}
+		if err := overrideValue(f, object[key], name+"_"+strings.ToUpper(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the key of a struct field in JSON documents
+func jsonKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("json"), ",")[0]
+	if key == "" {
+		return field.Name
+	}
+	return key
+}
+
+// Sets a scalar value from its string representation
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("Cannot set a value of type %s", v.Type())
+	}
+	return nil
+}
+
+// Sets a string value to the content of a secret file
+func setSecret(v reflect.Value, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	v.SetString(strings.TrimRight(string(b), "\r\n"))
+	return nil
+}
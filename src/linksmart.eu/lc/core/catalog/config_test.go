@@ -0,0 +1,119 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testAuthConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type testProtocol struct {
+	Password string `json:"password"`
+	CAFile   string `json:"caFile"`
+}
+
+type testConfig struct {
+	Name      string                  `json:"name"`
+	BindPort  int                     `json:"bindPort"`
+	Enabled   bool                    `json:"enabled"`
+	Auth      *testAuthConfig         `json:"auth"`
+	Catalogs  []testAuthConfig        `json:"catalogs"`
+	Protocols map[string]testProtocol `json:"protocols"`
+	Meta      map[string]interface{}  `json:"meta"`
+}
+
+func setenv(t *testing.T, env map[string]string) func() {
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	defer setenv(t, map[string]string{
+		"TEST_PORT":     "8080",
+		"TEST_PASSWORD": `se"cr\et`,
+	})()
+
+	data, err := ExpandEnv([]byte(`{"port": ${TEST_PORT}, "password": "${TEST_PASSWORD}", "literal": "$${TEST_PORT} $x"}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"port": 8080, "password": "se\"cr\\et", "literal": "${TEST_PORT} $x"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	if _, err := ExpandEnv([]byte(`{"password": "${TEST_UNSET}"}`)); err == nil {
+		t.Error("Expected an error for an unset variable")
+	}
+}
+
+func TestOverrideConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lc-config")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer setenv(t, map[string]string{
+		"TEST_BINDPORT":                     "9000",
+		"TEST_ENABLED":                      "true",
+		"TEST_AUTH_USERNAME":                "admin",
+		"TEST_CATALOGS_0_PASSWORD":          "from-env",
+		"TEST_PROTOCOLS_MQTT_PASSWORD_FILE": secret,
+		"TEST_META_FLOOR":                   "2",
+	})()
+
+	data := []byte(`{
+		"name": "test",
+		"bindPort": 8000,
+		"auth": {"username": "user", "passwordFile": "` + secret + `"},
+		"catalogs": [{"password": "from-config"}, {"password": "unchanged"}],
+		"protocols": {"MQTT": {"password": "from-config", "caFile": "/ca.pem"}},
+		"meta": {"location": "lab", "floor": 1}
+	}`)
+	config := new(testConfig)
+	if err := UnmarshalConfig(data, "test", config); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if config.Name != "test" || config.BindPort != 9000 || !config.Enabled {
+		t.Errorf("Unexpected scalar values: %+v", config)
+	}
+	if config.Auth.Username != "admin" || config.Auth.Password != "from-file" {
+		t.Errorf("Unexpected auth values: %+v", config.Auth)
+	}
+	if config.Catalogs[0].Password != "from-env" || config.Catalogs[1].Password != "unchanged" {
+		t.Errorf("Unexpected catalog values: %+v", config.Catalogs)
+	}
+	mqtt := config.Protocols["MQTT"]
+	if mqtt.Password != "from-file" || mqtt.CAFile != "/ca.pem" {
+		t.Errorf("Unexpected protocol values: %+v", mqtt)
+	}
+	if config.Meta["location"] != "lab" || config.Meta["floor"] != 2.0 {
+		t.Errorf("Unexpected meta values: %+v", config.Meta)
+	}
+
+	defer setenv(t, map[string]string{"TEST_BINDPORT": "invalid"})()
+	if err := UnmarshalConfig(data, "test", &testConfig{}); err == nil {
+		t.Error("Expected an error for an invalid number")
+	}
+}
@@ -6,5 +6,9 @@ const (
 	CatalogBackendMemory  = "memory"
 	CatalogBackendLevelDB = "leveldb"
 	StaticLocation        = "/static"
-	loggerPrefix          = "[catalog] "
+	OpenAPILocation       = "/openapi.json"
+	MetricsLocation       = "/metrics"
+	LoggingLocation       = "/logging"
+	HeartbeatPath         = "heartbeat"
+	logComponent          = "catalog"
 )
@@ -0,0 +1,28 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import "fmt"
+
+// NetworkError is returned by catalog clients when a catalog could not be reached,
+// e.g. connection failures, timeouts or a cancelled context
+type NetworkError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+// APIError is returned by catalog clients when a catalog responds with an unexpected status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string { return e.Message }
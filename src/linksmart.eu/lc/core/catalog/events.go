@@ -0,0 +1,146 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of change events
+const (
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+const (
+	// Number of events kept for watching clients
+	DefaultEventLogSize = 1000
+	// Default and maximum time a request for events waits for new ones
+	DefaultEventWait = 30 * time.Second
+	MaxEventWait     = 60 * time.Second
+	// Delays between attempts of a watcher to reconnect
+	minWatchBackoff = time.Second
+	maxWatchBackoff = 30 * time.Second
+)
+
+// LoggedEvent is a change of a registration in the EventLog
+type LoggedEvent struct {
+	Seq    uint64
+	Type   string
+	Id     string
+	Object interface{}
+}
+
+// EventLog keeps the latest changes of a catalog for watching clients
+// Events are numbered sequentially within an epoch, which changes when the log is re-created
+// (e.g. on restart of the catalog)
+type EventLog struct {
+	sync.Mutex
+	epoch  string
+	size   int
+	events []LoggedEvent
+	last   uint64
+	// closed and replaced on every append to wake up waiting readers
+	notify chan struct{}
+}
+
+func NewEventLog(size int) *EventLog {
+	return &EventLog{
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:   size,
+		notify: make(chan struct{}),
+	}
+}
+
+// Append adds an event of a registration (given by its id and object)
+func (l *EventLog) Append(eventType, id string, object interface{}) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.last++
+	l.events = append(l.events, LoggedEvent{l.last, eventType, id, object})
+	// Drop old events, copying the remaining ones only once in a while
+	if len(l.events) >= 2*l.size {
+		l.events = append([]LoggedEvent(nil), l.events[len(l.events)-l.size:]...)
+	}
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// Since returns the events following seq in the given epoch
+// If there are none, it waits up to the given duration for new events
+// Returns the epoch, the sequence number of the last event in the log,
+// and whether events following seq are no longer available (gap)
+func (l *EventLog) Since(ctx context.Context, epoch string, seq uint64, wait time.Duration) (
+	events []LoggedEvent, currentEpoch string, last uint64, gap bool) {
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		l.Lock()
+		if epoch != l.epoch || seq > l.last || (len(l.events) > 0 && seq+1 < l.events[0].Seq) {
+			last = l.last
+			l.Unlock()
+			return nil, l.epoch, last, true
+		}
+		if seq < l.last {
+			i := len(l.events) - int(l.last-seq)
+			events = append([]LoggedEvent(nil), l.events[i:]...)
+			last = l.last
+			l.Unlock()
+			return events, l.epoch, last, false
+		}
+		notify := l.notify
+		l.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, l.epoch, seq, false
+		case <-ctx.Done():
+			return nil, l.epoch, seq, false
+		}
+	}
+}
+
+// WatchBackoff returns the delay before the next reconnection attempt of a watcher
+func WatchBackoff(attempt int) time.Duration {
+	delay := minWatchBackoff << uint(attempt)
+	if delay > maxWatchBackoff || delay <= 0 {
+		delay = maxWatchBackoff
+	}
+	return delay
+}
+
+// ParseEventParams parses the since and wait query parameters of a request for events
+// The wait duration is given in seconds and limited to MaxEventWait
+func ParseEventParams(sinceStr, waitStr string) (uint64, time.Duration, error) {
+	var since uint64
+	if sinceStr != "" {
+		var err error
+		since, err = strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid value for %s: %s", GetParamSince, sinceStr)
+		}
+	}
+
+	wait := DefaultEventWait
+	if waitStr != "" {
+		seconds, err := strconv.Atoi(waitStr)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("Invalid value for %s: %s", GetParamWait, waitStr)
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > MaxEventWait {
+			wait = MaxEventWait
+		}
+	}
+	return since, wait, nil
+}
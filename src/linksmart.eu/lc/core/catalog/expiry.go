@@ -0,0 +1,230 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"container/heap"
+	"time"
+)
+
+// ExpiryIndex keeps the expiry times of catalog entries in a min-heap with the position of each entry by id
+// Adding, updating and removing an entry is O(log n), getting the earliest expiry time is O(1)
+// The index is not safe for concurrent use: the caller must synchronize access
+type ExpiryIndex struct {
+	h expiryHeap
+}
+
+type expiryEntry struct {
+	id      string
+	expires time.Time
+}
+
+// Min-heap of entries ordered by expiry time, then id
+type expiryHeap struct {
+	entries []expiryEntry
+	// position of each entry in entries by id
+	positions map[string]int
+}
+
+// NewExpiryIndex creates an empty ExpiryIndex
+func NewExpiryIndex() *ExpiryIndex {
+	return &ExpiryIndex{
+		h: expiryHeap{positions: make(map[string]int)},
+	}
+}
+
+// Set adds an entry or changes its expiry time
+func (x *ExpiryIndex) Set(id string, expires time.Time) {
+	if i, found := x.h.positions[id]; found {
+		x.h.entries[i].expires = expires
+		heap.Fix(&x.h, i)
+		return
+	}
+	heap.Push(&x.h, expiryEntry{id, expires})
+}
+
+// Remove removes an entry, returning false if it is not in the index
+func (x *ExpiryIndex) Remove(id string) bool {
+	i, found := x.h.positions[id]
+	if !found {
+		return false
+	}
+	heap.Remove(&x.h, i)
+	return true
+}
+
+// Get returns the expiry time of an entry
+func (x *ExpiryIndex) Get(id string) (time.Time, bool) {
+	i, found := x.h.positions[id]
+	if !found {
+		return time.Time{}, false
+	}
+	return x.h.entries[i].expires, true
+}
+
+// Len returns the number of entries
+func (x *ExpiryIndex) Len() int {
+	return len(x.h.entries)
+}
+
+// Next returns the earliest expiry time, or false if the index is empty
+func (x *ExpiryIndex) Next() (time.Time, bool) {
+	if len(x.h.entries) == 0 {
+		return time.Time{}, false
+	}
+	return x.h.entries[0].expires, true
+}
+
+// PopExpired removes the entries which expire at or before t and returns their ids in the order of expiry
+// Removing k entries is O(k log n)
+func (x *ExpiryIndex) PopExpired(t time.Time) []string {
+	var ids []string
+	for len(x.h.entries) > 0 && !x.h.entries[0].expires.After(t) {
+		ids = append(ids, heap.Pop(&x.h).(expiryEntry).id)
+	}
+	return ids
+}
+
+// Before returns the ids of the entries which expire at or before t in the order of expiry
+// The heap is traversed from the root, visiting k entries in O(k log k)
+func (x *ExpiryIndex) Before(t time.Time) []string {
+	var ids []string
+	if len(x.h.entries) == 0 {
+		return ids
+	}
+	// Positions of the next candidates: the children of the visited entries
+	candidates := &positionHeap{h: &x.h, positions: []int{0}}
+	for candidates.Len() > 0 {
+		i := heap.Pop(candidates).(int)
+		if x.h.entries[i].expires.After(t) {
+			// The remaining candidates and their children expire later
+			break
+		}
+		ids = append(ids, x.h.entries[i].id)
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(x.h.entries) {
+				heap.Push(candidates, child)
+			}
+		}
+	}
+	return ids
+}
+
+// heap.Interface
+func (h expiryHeap) Len() int { return len(h.entries) }
+
+func (h expiryHeap) Less(i, j int) bool {
+	if h.entries[i].expires.Equal(h.entries[j].expires) {
+		return h.entries[i].id < h.entries[j].id
+	}
+	return h.entries[i].expires.Before(h.entries[j].expires)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.positions[h.entries[i].id] = i
+	h.positions[h.entries[j].id] = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(expiryEntry)
+	h.positions[e.id] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	last := len(h.entries) - 1
+	e := h.entries[last]
+	h.entries = h.entries[:last]
+	delete(h.positions, e.id)
+	return e
+}
+
+// Min-heap of positions in an expiryHeap, ordered like the entries at these positions
+type positionHeap struct {
+	h         *expiryHeap
+	positions []int
+}
+
+func (p positionHeap) Len() int            { return len(p.positions) }
+func (p positionHeap) Less(i, j int) bool  { return p.h.Less(p.positions[i], p.positions[j]) }
+func (p positionHeap) Swap(i, j int)       { p.positions[i], p.positions[j] = p.positions[j], p.positions[i] }
+func (p *positionHeap) Push(x interface{}) { p.positions = append(p.positions, x.(int)) }
+
+func (p *positionHeap) Pop() interface{} {
+	last := len(p.positions) - 1
+	i := p.positions[last]
+	p.positions = p.positions[:last]
+	return i
+}
+
+// ExpiryTimer calls a function when the earliest expiry time of a catalog is reached
+// Instead of polling, it sleeps until the next expiry time, which is given by a function
+type ExpiryTimer struct {
+	next   func() (time.Time, bool)
+	expire func(now time.Time)
+	reset  chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewExpiryTimer starts an ExpiryTimer
+// next returns the earliest expiry time or false if there is none, expire handles the expired entries
+// Both are called from the goroutine of the timer
+func NewExpiryTimer(next func() (time.Time, bool), expire func(now time.Time)) *ExpiryTimer {
+	t := &ExpiryTimer{
+		next:   next,
+		expire: expire,
+		reset:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Reset makes the timer get the next expiry time again, after it changed
+// It does not block and can be called while holding a lock required by next
+func (t *ExpiryTimer) Reset() {
+	select {
+	case t.reset <- struct{}{}:
+	default:
+		// A reset is already pending
+	}
+}
+
+// Stop stops the timer and waits for a running expire call to return
+func (t *ExpiryTimer) Stop() {
+	close(t.stop)
+	<-t.done
+}
+
+func (t *ExpiryTimer) run() {
+	defer close(t.done)
+	for {
+		var (
+			timer *time.Timer
+			fire  <-chan time.Time
+		)
+		if next, ok := t.next(); ok {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+
+		select {
+		case now := <-fire:
+			t.expire(now.UTC())
+		case <-t.reset:
+		case <-t.stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+	}
+}
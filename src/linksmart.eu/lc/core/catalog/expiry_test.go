@@ -0,0 +1,203 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiryIndex(t *testing.T) {
+	x := NewExpiryIndex()
+	if _, ok := x.Next(); ok {
+		t.Error("Expected no next expiry time of an empty index")
+	}
+
+	base := time.Now().UTC()
+	x.Set("c", base.Add(3*time.Second))
+	x.Set("a", base.Add(1*time.Second))
+	x.Set("b", base.Add(2*time.Second))
+	// Same expiry times
+	x.Set("b2", base.Add(2*time.Second))
+	x.Set("b1", base.Add(2*time.Second))
+
+	if next, _ := x.Next(); !next.Equal(base.Add(time.Second)) {
+		t.Errorf("Expected the next expiry time %v, got %v", base.Add(time.Second), next)
+	}
+	if ids := x.Before(base.Add(2 * time.Second)); !reflect.DeepEqual(ids, []string{"a", "b", "b1", "b2"}) {
+		t.Errorf("Expected a, b, b1, b2 to expire within 2s, got %v", ids)
+	}
+
+	// Update and remove
+	x.Set("a", base.Add(4*time.Second))
+	if !x.Remove("b1") || x.Remove("b1") {
+		t.Error("Expected b1 to be removed once")
+	}
+	if expires, ok := x.Get("a"); !ok || !expires.Equal(base.Add(4*time.Second)) {
+		t.Errorf("Expected the updated expiry time of a, got %v", expires)
+	}
+	if _, ok := x.Get("b1"); ok {
+		t.Error("Expected b1 to be removed")
+	}
+	if ids := x.Before(base.Add(time.Hour)); !reflect.DeepEqual(ids, []string{"b", "b2", "c", "a"}) {
+		t.Errorf("Expected the order b, b2, c, a, got %v", ids)
+	}
+	if x.Len() != 4 {
+		t.Errorf("Expected 4 entries, got %d", x.Len())
+	}
+
+	if ids := x.PopExpired(base.Add(3 * time.Second)); !reflect.DeepEqual(ids, []string{"b", "b2", "c"}) {
+		t.Errorf("Expected b, b2, c to expire, got %v", ids)
+	}
+	if x.Len() != 1 {
+		t.Errorf("Expected a to remain, got %d entries", x.Len())
+	}
+	if ids := x.PopExpired(base); len(ids) != 0 {
+		t.Errorf("Expected no expired entries, got %v", ids)
+	}
+}
+
+func TestExpiryIndexOrder(t *testing.T) {
+	x := NewExpiryIndex()
+	base := time.Now().UTC()
+	expected := make([]string, 1000)
+	for i := range expected {
+		expected[i] = fmt.Sprintf("%04d", i)
+	}
+	for _, i := range rand.Perm(len(expected)) {
+		x.Set(expected[i], base.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	if ids := x.Before(base.Add(time.Hour)); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected the entries in the order of expiry, got %v", ids)
+	}
+	if ids := x.PopExpired(base.Add(time.Hour)); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected to pop the entries in the order of expiry, got %v", ids)
+	}
+}
+
+func TestExpiryTimer(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		x       = NewExpiryIndex()
+		expired = make(chan []string, 10)
+	)
+	next := func() (time.Time, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return x.Next()
+	}
+	expire := func(now time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		expired <- x.PopExpired(now)
+	}
+
+	timer := NewExpiryTimer(next, expire)
+	defer timer.Stop()
+
+	start := time.Now()
+	mutex.Lock()
+	x.Set("later", start.Add(time.Hour))
+	x.Set("soon", start.Add(50*time.Millisecond))
+	mutex.Unlock()
+	timer.Reset()
+
+	select {
+	case ids := <-expired:
+		if !reflect.DeepEqual(ids, []string{"soon"}) {
+			t.Errorf("Expected soon to expire, got %v", ids)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expired too early, after %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timer did not fire at the next expiry time")
+	}
+}
+
+func TestExpiryTimerStop(t *testing.T) {
+	timer := NewExpiryTimer(
+		func() (time.Time, bool) { return time.Time{}, false },
+		func(time.Time) { t.Error("Unexpected expiry without expiry times") },
+	)
+	timer.Reset()
+	stopped := make(chan struct{})
+	go func() {
+		timer.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timer did not stop")
+	}
+}
+
+// Sizes of the indices in benchmarks: the time per operation grows logarithmically
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+// Returns the ids and an index of n entries with the same expiry time, or with distinct times
+func benchmarkIndex(n int, same bool) ([]string, *ExpiryIndex) {
+	base := time.Now().UTC()
+	ids := make([]string, n)
+	x := NewExpiryIndex()
+	for i := range ids {
+		ids[i] = fmt.Sprintf("urn:ls_device:%x", i)
+		if same {
+			x.Set(ids[i], base)
+		} else {
+			x.Set(ids[i], base.Add(time.Duration(rand.Int63n(int64(time.Hour)))))
+		}
+	}
+	return ids, x
+}
+
+func BenchmarkExpiryIndexRemove(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, same := range []bool{true, false} {
+			ids, x := benchmarkIndex(n, same)
+			b.Run(fmt.Sprintf("n=%d/same=%t", n, same), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					// Remove and re-add an entry anywhere in the index
+					id := ids[(i*7919)%n]
+					expires, _ := x.Get(id)
+					x.Remove(id)
+					x.Set(id, expires)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkExpiryIndexSet(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		ids, x := benchmarkIndex(n, false)
+		base := time.Now().UTC()
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Renew an entry (e.g. on a heartbeat)
+				x.Set(ids[(i*7919)%n], base.Add(time.Duration(i)*time.Millisecond))
+			}
+		})
+	}
+}
+
+func BenchmarkExpiryIndexPopExpired(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		_, x := benchmarkIndex(n, false)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Expire the earliest entry and register it again, keeping the size of the index
+				expires, _ := x.Next()
+				for _, id := range x.PopExpired(expires) {
+					x.Set(id, expires.Add(time.Hour))
+				}
+			}
+		})
+	}
+}
@@ -3,11 +3,17 @@
 package catalog
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"io"
+	"math/rand"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"linksmart.eu/lc/sec/auth/obtainer"
 	"fmt"
@@ -66,12 +72,12 @@ func HTTPDoAuth(req *http.Request, ticket *obtainer.Client) (*http.Response, err
 
 	if res.StatusCode == http.StatusUnauthorized {
 		// Get a new ticket and retry again
-		logger.Println("HTTPDoAuth() Invalid authentication ticket.")
+		logger.Info("HTTPDoAuth() Invalid authentication ticket.")
 		bearer, err = ticket.Renew()
 		if err != nil {
 			return nil, err
 		}
-		logger.Println("HTTPDoAuth() Ticket was renewed.")
+		logger.Info("HTTPDoAuth() Ticket was renewed.")
 
 		// Reset the header and try again
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearer))
@@ -80,3 +86,205 @@ func HTTPDoAuth(req *http.Request, ticket *obtainer.Client) (*http.Response, err
 
 	return res, nil
 }
+
+// ClientOptions configures the HTTP communication of the remote catalog clients
+type ClientOptions struct {
+	// HTTP client used to submit requests
+	// A client with the configured Timeout and TLSConfig is created if not set
+	HTTPClient *http.Client
+	// Configuration of TLS connections, e.g. with custom CAs and client certificates
+	// (see ClientTLSConfig)
+	TLSConfig *tls.Config
+	// Time limit of each request attempt (zero means no timeout)
+	Timeout time.Duration
+	// Number of times idempotent requests (GET, PUT, DELETE) are retried
+	// after network failures or 429, 502, 503 and 504 responses
+	MaxRetries int
+	// Delay before the first retry, doubled on each following retry
+	Backoff time.Duration
+	// Upper bound of the delay between retries
+	MaxBackoff time.Duration
+}
+
+// DefaultClientOptions returns the options used by remote catalog clients unless configured otherwise
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout:    10 * time.Second,
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+}
+
+// HTTPClient submits requests to a catalog API
+type HTTPClient struct {
+	client  *http.Client
+	ticket  *obtainer.Client
+	options ClientOptions
+}
+
+// NewHTTPClient creates an HTTPClient doing authenticated requests if ticket client is provided
+func NewHTTPClient(ticket *obtainer.Client, options ClientOptions) *HTTPClient {
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: options.Timeout}
+		if options.TLSConfig != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = options.TLSConfig
+			client.Transport = transport
+		}
+	}
+	return &HTTPClient{
+		client:  client,
+		ticket:  ticket,
+		options: options,
+	}
+}
+
+// EventWait returns the time a request for events may wait for new ones within the request timeout
+func (c *HTTPClient) EventWait() time.Duration {
+	timeout := c.client.Timeout
+	if timeout == 0 || timeout > 2*DefaultEventWait {
+		return DefaultEventWait
+	}
+	wait := (timeout / 2).Truncate(time.Second)
+	if wait < time.Second {
+		// no waiting, the request returns immediately
+		return 0
+	}
+	return wait
+}
+
+// Do constructs and submits an HTTP request and returns the response
+// Idempotent requests are retried with exponential backoff
+// Failures to get a response are returned as *NetworkError
+func (c *HTTPClient) Do(ctx context.Context, method string, url string, headers map[string][]string,
+	body []byte) (*http.Response, error) {
+
+	var retries int
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		retries = c.options.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.do(ctx, method, url, headers, body)
+		if attempt >= retries || !retriable(res, err) || ctx.Err() != nil {
+			return res, err
+		}
+
+		delay := c.backoff(attempt, res)
+		if err != nil {
+			logger.Warnf("HTTPClient.Do() %s %s failed: %s. Retrying in %v", method, url, err, delay)
+		} else {
+			logger.Infof("HTTPClient.Do() %s %s returned %s. Retrying in %v", method, url, res.Status, delay)
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, &NetworkError{method, url, ctx.Err()}
+		}
+	}
+}
+
+// Submits a single request
+func (c *HTTPClient) do(ctx context.Context, method string, url string, headers map[string][]string,
+	body []byte) (*http.Response, error) {
+
+	newRequest := func() (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, url, reader)
+		if err != nil {
+			return nil, err
+		}
+		// Set headers
+		for key, val := range headers {
+			req.Header.Set(key, strings.Join(val, ";"))
+		}
+		return req.WithContext(ctx), nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	// No auth
+	if c.ticket == nil {
+		res, err := c.client.Do(req)
+		if err != nil {
+			return nil, &NetworkError{method, url, err}
+		}
+		return res, nil
+	}
+
+	bearer, err := c.ticket.Obtain()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearer))
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &NetworkError{method, url, err}
+	}
+	if res.StatusCode != http.StatusUnauthorized {
+		return res, nil
+	}
+	res.Body.Close()
+
+	// Get a new ticket and retry again
+	logger.Info("HTTPClient.do() Invalid authentication ticket.")
+	bearer, err = c.ticket.Renew()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("HTTPClient.do() Ticket was renewed.")
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearer))
+	res, err = c.client.Do(req)
+	if err != nil {
+		return nil, &NetworkError{method, url, err}
+	}
+	return res, nil
+}
+
+// Checks whether a request may succeed if submitted again
+func retriable(res *http.Response, err error) bool {
+	if err != nil {
+		_, isNetworkError := err.(*NetworkError)
+		return isNetworkError
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Returns the delay before a retry
+// The delay requested by the server using Retry-After is honored up to MaxBackoff
+func (c *HTTPClient) backoff(attempt int, res *http.Response) time.Duration {
+	delay := c.options.Backoff << uint(attempt)
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		}
+	}
+	if c.options.MaxBackoff > 0 && (delay > c.options.MaxBackoff || delay < 0) {
+		delay = c.options.MaxBackoff
+	}
+	// Add up to 10% jitter to spread the retries of multiple clients
+	if delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(delay)/10 + 1))
+	}
+	return delay
+}
@@ -0,0 +1,312 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// Types of id generators
+const (
+	IDGeneratorTimestamp = "timestamp"
+	IDGeneratorUUID      = "uuid"
+	IDGeneratorULID      = "ulid"
+	IDGeneratorCounter   = "counter"
+	IDGeneratorTemplate  = "template"
+)
+
+// Placeholders in the templates of ids
+const (
+	idPlaceholderKind    = "{kind}"
+	idPlaceholderCounter = "{counter}"
+	idPlaceholderUUID    = "{uuid}"
+	idPlaceholderULID    = "{ulid}"
+)
+
+// Maximum number of ids generated to find one which is not in use
+const maxIDAttempts = 100
+
+// IDGenerator generates the ids of new catalog entries
+type IDGenerator interface {
+	// NewID returns a new id for an entry of the given kind (e.g. device, resource or service)
+	NewID(kind string) (string, error)
+}
+
+// IDGeneratorConfig configures the generator of the ids of catalog entries
+type IDGeneratorConfig struct {
+	// Type of the generator: timestamp (default), uuid, ulid, counter or template
+	Type string `json:"type"`
+	// Template of the ids (template type) with the placeholders {kind}, {counter}, {uuid} and {ulid}
+	// e.g. urn:site:{counter}
+	Template string `json:"template"`
+	// File persisting the counter (required by the counter type, and by {counter} in a template)
+	CounterFile string `json:"counterFile"`
+}
+
+// Validate checks the configuration of the generator
+func (c IDGeneratorConfig) Validate() error {
+	switch c.Type {
+	case "", IDGeneratorTimestamp, IDGeneratorUUID, IDGeneratorULID:
+	case IDGeneratorCounter:
+		if c.CounterFile == "" {
+			return errors.New("counterFile must be defined to persist the counter")
+		}
+	case IDGeneratorTemplate:
+		if !strings.Contains(c.Template, idPlaceholderCounter) &&
+			!strings.Contains(c.Template, idPlaceholderUUID) &&
+			!strings.Contains(c.Template, idPlaceholderULID) {
+			return fmt.Errorf("template must contain one of %s, %s or %s",
+				idPlaceholderCounter, idPlaceholderUUID, idPlaceholderULID)
+		}
+		if strings.Contains(c.Template, "/") {
+			return errors.New("template must not contain slashes")
+		}
+		if strings.Contains(c.Template, idPlaceholderCounter) && c.CounterFile == "" {
+			return fmt.Errorf("counterFile must be defined to persist the %s of the template", idPlaceholderCounter)
+		}
+	default:
+		return fmt.Errorf("Unknown id generator type %q", c.Type)
+	}
+	return nil
+}
+
+// NewIDGenerator creates the id generator of a configuration
+// The ids are URNs of the form urn:ls_<kind>:<id>, unless a custom template is given
+func NewIDGenerator(c IDGeneratorConfig) (IDGenerator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case "", IDGeneratorTimestamp:
+		return NewTimestampIDGenerator(), nil
+	case IDGeneratorUUID:
+		return NewTemplateIDGenerator("urn:ls_{kind}:{uuid}", nil), nil
+	case IDGeneratorULID:
+		return NewTemplateIDGenerator("urn:ls_{kind}:{ulid}", nil), nil
+	case IDGeneratorCounter:
+		counter, err := NewPersistentCounter(c.CounterFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewTemplateIDGenerator("urn:ls_{kind}:{counter}", counter), nil
+	default:
+		var counter *PersistentCounter
+		if c.CounterFile != "" {
+			var err error
+			counter, err = NewPersistentCounter(c.CounterFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return NewTemplateIDGenerator(c.Template, counter), nil
+	}
+}
+
+// NewUniqueID generates ids until one is found which is not in use, as reported by exists
+func NewUniqueID(g IDGenerator, kind string, exists func(id string) (bool, error)) (string, error) {
+	for i := 0; i < maxIDAttempts; i++ {
+		id, err := g.NewID(kind)
+		if err != nil {
+			return "", err
+		}
+		found, err := exists(id)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("No unique %s id generated after %d attempts", kind, maxIDAttempts)
+}
+
+// TimestampIDGenerator generates ids from the start time of the process (in seconds) plus a counter in hex
+// This is the original format of the ids, which may collide with ids generated before a restart
+type TimestampIDGenerator struct {
+	sync.Mutex
+	startTime int64
+	counter   int64
+}
+
+// NewTimestampIDGenerator creates a TimestampIDGenerator starting at the current time
+func NewTimestampIDGenerator() *TimestampIDGenerator {
+	return &TimestampIDGenerator{startTime: time.Now().UTC().Unix()}
+}
+
+// NewID returns an id of the format urn:ls_<kind>:<startTime+counter in hex>
+func (g *TimestampIDGenerator) NewID(kind string) (string, error) {
+	g.Lock()
+	defer g.Unlock()
+	g.counter++
+	return fmt.Sprintf("urn:ls_%s:%x", kind, g.startTime+g.counter), nil
+}
+
+// TemplateIDGenerator generates ids by replacing the placeholders of a template:
+// {kind} with the kind of entry, {counter} with the next value of a counter,
+// {uuid} with a random (version 4) UUID and {ulid} with a ULID
+type TemplateIDGenerator struct {
+	template string
+	counter  *PersistentCounter
+	ulid     *ulidSource
+}
+
+// NewTemplateIDGenerator creates a TemplateIDGenerator
+// The counter may be nil, then {counter} starts at 1 and is not persisted
+func NewTemplateIDGenerator(template string, counter *PersistentCounter) *TemplateIDGenerator {
+	if counter == nil {
+		counter = &PersistentCounter{}
+	}
+	return &TemplateIDGenerator{
+		template: template,
+		counter:  counter,
+		ulid:     &ulidSource{entropy: rand.Reader},
+	}
+}
+
+// NewID returns the template with the placeholders replaced
+func (g *TemplateIDGenerator) NewID(kind string) (string, error) {
+	id := strings.Replace(g.template, idPlaceholderKind, kind, -1)
+	if strings.Contains(id, idPlaceholderCounter) {
+		n, err := g.counter.Next()
+		if err != nil {
+			return "", err
+		}
+		id = strings.Replace(id, idPlaceholderCounter, strconv.FormatUint(n, 10), -1)
+	}
+	if strings.Contains(id, idPlaceholderUUID) {
+		id = strings.Replace(id, idPlaceholderUUID, uuid.New(), -1)
+	}
+	if strings.Contains(id, idPlaceholderULID) {
+		ulid, err := g.ulid.next(time.Now())
+		if err != nil {
+			return "", err
+		}
+		id = strings.Replace(id, idPlaceholderULID, ulid, -1)
+	}
+	return id, nil
+}
+
+// PersistentCounter is a counter whose value is written to a file, to continue after a restart
+type PersistentCounter struct {
+	sync.Mutex
+	path  string
+	value uint64
+}
+
+// NewPersistentCounter creates a counter persisted in the file at path, starting at its current value
+func NewPersistentCounter(path string) (*PersistentCounter, error) {
+	c := &PersistentCounter{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.value, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid counter in %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Next increments the counter and returns its value after it is persisted
+func (c *PersistentCounter) Next() (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.path != "" {
+		if err := writeFileAtomic(c.path, []byte(strconv.FormatUint(c.value+1, 10)+"\n")); err != nil {
+			return 0, fmt.Errorf("Error persisting the counter: %s", err)
+		}
+	}
+	c.value++
+	return c.value, nil
+}
+
+// Writes a file by renaming a temporary file, so that it is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ULID: 48-bit timestamp in milliseconds followed by 80 random bits, encoded in 26 characters of Crockford's base32
+// The ids of a source are monotonic: within the same millisecond, the random bits are incremented
+type ulidSource struct {
+	sync.Mutex
+	entropy io.Reader
+	last    [16]byte
+	lastMs  uint64
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (s *ulidSource) next(t time.Time) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	var id [16]byte
+	if ms <= s.lastMs {
+		// Same millisecond (or a clock going backwards): increment the previous id
+		id = s.last
+		for i := len(id) - 1; i >= 6; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+			if i == 6 {
+				return "", errors.New("ULID random bits overflow within a millisecond")
+			}
+		}
+	} else {
+		for i := 0; i < 6; i++ {
+			id[i] = byte(ms >> uint(8*(5-i)))
+		}
+		if _, err := io.ReadFull(s.entropy, id[6:]); err != nil {
+			return "", err
+		}
+		s.lastMs = ms
+	}
+	s.last = id
+
+	// 130 bits with 2 leading zero bits, 5 bits per character
+	var b [26]byte
+	for i := range b {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			v <<= 1
+			if bit >= 0 {
+				v |= (id[bit/8] >> uint(7-bit%8)) & 1
+			}
+		}
+		b[i] = crockfordBase32[v]
+	}
+	return string(b[:]), nil
+}
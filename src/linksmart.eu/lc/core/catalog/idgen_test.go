@@ -0,0 +1,141 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewIDGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	cases := map[string]struct {
+		config  IDGeneratorConfig
+		pattern string
+	}{
+		"default":   {IDGeneratorConfig{}, `^urn:ls_device:[0-9a-f]+$`},
+		"timestamp": {IDGeneratorConfig{Type: IDGeneratorTimestamp}, `^urn:ls_device:[0-9a-f]+$`},
+		"uuid":      {IDGeneratorConfig{Type: IDGeneratorUUID}, `^urn:ls_device:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		"ulid":      {IDGeneratorConfig{Type: IDGeneratorULID}, `^urn:ls_device:[0-9A-HJKMNP-TV-Z]{26}$`},
+		"counter": {IDGeneratorConfig{Type: IDGeneratorCounter, CounterFile: filepath.Join(dir, "counter")},
+			`^urn:ls_device:1$`},
+		"template": {IDGeneratorConfig{Type: IDGeneratorTemplate, Template: "urn:site:{kind}-{counter}",
+			CounterFile: filepath.Join(dir, "template-counter")},
+			`^urn:site:device-1$`},
+	}
+	for name, c := range cases {
+		g, err := NewIDGenerator(c.config)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		id, err := g.NewID("device")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		if !regexp.MustCompile(c.pattern).MatchString(id) {
+			t.Errorf("%s: expected an id matching %s, got %s", name, c.pattern, id)
+		}
+	}
+}
+
+func TestIDGeneratorConfigValidate(t *testing.T) {
+	for _, c := range []IDGeneratorConfig{
+		{Type: "random"},
+		{Type: IDGeneratorCounter},
+		{Type: IDGeneratorTemplate, Template: "urn:site:fixed"},
+		{Type: IDGeneratorTemplate, Template: "site/{uuid}"},
+		{Type: IDGeneratorTemplate, Template: "urn:site:{counter}"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
+
+func TestPersistentCounter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "counter")
+
+	c, err := NewPersistentCounter(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < 3; i++ {
+		c.Next()
+	}
+
+	// Continues after a restart
+	c, err = NewPersistentCounter(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n, err := c.Next(); err != nil || n != 4 {
+		t.Errorf("Expected the counter to continue at 4, got %d (%v)", n, err)
+	}
+
+	ioutil.WriteFile(path, []byte("invalid"), 0600)
+	if _, err := NewPersistentCounter(path); err == nil {
+		t.Error("Expected an error for an invalid counter file")
+	}
+}
+
+func TestULID(t *testing.T) {
+	s := &ulidSource{entropy: bytes.NewReader(bytes.Repeat([]byte{0xff}, 20))}
+	now := time.Unix(1469918176, 385000000)
+
+	first, err := s.next(now)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if first != "01ARYZ6S41ZZZZZZZZZZZZZZZZ" {
+		t.Errorf("Expected 01ARYZ6S41ZZZZZZZZZZZZZZZZ, got %s", first)
+	}
+	// Random bits overflow within the same millisecond
+	if _, err := s.next(now); err == nil {
+		t.Error("Expected an error on overflow")
+	}
+
+	// Monotonic within the same millisecond
+	s = &ulidSource{entropy: bytes.NewReader(make([]byte, 20))}
+	ids := make([]string, 3)
+	for i := range ids {
+		ids[i], _ = s.next(now)
+	}
+	if !sort.StringsAreSorted(ids) || ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Errorf("Expected increasing ids, got %v", ids)
+	}
+	if ids[2] != "01ARYZ6S410000000000000002" {
+		t.Errorf("Expected 01ARYZ6S410000000000000002, got %s", ids[2])
+	}
+}
+
+func TestNewUniqueID(t *testing.T) {
+	g := NewTemplateIDGenerator("id-{counter}", nil)
+	used := map[string]bool{"id-1": true, "id-2": true}
+	id, err := NewUniqueID(g, "device", func(id string) (bool, error) { return used[id], nil })
+	if err != nil || id != "id-3" {
+		t.Errorf("Expected id-3, got %s (%v)", id, err)
+	}
+
+	_, err = NewUniqueID(g, "device", func(id string) (bool, error) { return true, nil })
+	if err == nil {
+		t.Error("Expected an error when all ids are in use")
+	}
+}
@@ -3,18 +3,11 @@
 package catalog
 
 import (
-	"log"
-	"os"
-	"strconv"
+	"linksmart.eu/lc/core/logging"
 )
 
-var logger *log.Logger
+var logger *logging.Logger
 
 func init() {
-	logger = log.New(os.Stdout, loggerPrefix, 0)
-
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(logComponent)
 }
@@ -0,0 +1,45 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package metrics
+
+// CacheMetrics counts the lookups and evictions of a cache and keeps its number of entries
+// It receives the events of the cache of the auth validator (see validator.CacheMetrics)
+type CacheMetrics struct {
+	lookups   *Counter
+	evictions *Counter
+	entries   *Gauge
+}
+
+// NewCacheMetrics creates the metrics of a cache of the given items, named with the given prefix (e.g. auth_cache)
+func NewCacheMetrics(prefix, items string) *CacheMetrics {
+	return &CacheMetrics{
+		lookups: NewCounter(prefix+"_lookups_total",
+			"Number of lookups in the cache of "+items+" by result (hit, miss)", "result"),
+		evictions: NewCounter(prefix+"_evictions_total",
+			"Number of "+items+" evicted from the cache to respect its size"),
+		entries: NewGauge(prefix+"_entries",
+			"Number of cached "+items),
+	}
+}
+
+// AuthCache counts the events of the cache of validation results of the auth validator
+var AuthCache = NewCacheMetrics("auth_cache", "validation results")
+
+// Lookup counts a lookup, found in the cache (hit) or not (miss)
+func (m *CacheMetrics) Lookup(hit bool) {
+	if hit {
+		m.lookups.Inc("hit")
+	} else {
+		m.lookups.Inc("miss")
+	}
+}
+
+// Evicted counts an entry evicted from the cache
+func (m *CacheMetrics) Evicted() {
+	m.evictions.Inc()
+}
+
+// Entries sets the number of entries of the cache
+func (m *CacheMetrics) Entries(n int) {
+	m.entries.Set(float64(n))
+}
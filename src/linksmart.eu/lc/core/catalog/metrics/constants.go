@@ -0,0 +1,9 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package metrics
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds (in seconds) of histogram buckets for latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
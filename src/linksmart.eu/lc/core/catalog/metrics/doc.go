@@ -0,0 +1,5 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+// Package metrics collects counters, gauges and histograms of the catalogs and the device gateway
+// and exposes them in the Prometheus text format.
+package metrics
@@ -0,0 +1,297 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Collector is a metric family that can be registered in a Registry
+type Collector interface {
+	// Name of the metric family
+	Name() string
+	write(w io.Writer) error
+}
+
+// family keeps the series of a metric, one for each combination of label values
+type family struct {
+	sync.Mutex
+	name       string
+	help       string
+	metricType string
+	labels     []string
+	series     map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// sum of observations and cumulative counts of histogram buckets
+	sum     float64
+	buckets []uint64
+}
+
+func newFamily(name, help, metricType string, labels []string) *family {
+	return &family{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labels:     labels,
+		series:     make(map[string]*series),
+	}
+}
+
+// Name returns the name of the metric
+func (f *family) Name() string {
+	return f.name
+}
+
+// Returns the series of the given label values
+// WARNING: the caller must obtain the lock before calling
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, found := f.series[key]
+	if !found {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Returns the series sorted by their label values
+// WARNING: the caller must obtain the lock before calling
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, f.series[k])
+	}
+	return list
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.metricType)
+	return err
+}
+
+func (f *family) write(w io.Writer) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.writeHeader(w); err != nil {
+		return err
+	}
+	for _, s := range f.sorted() {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter is a metric that only increases, e.g. the number of requests
+type Counter struct {
+	*family
+}
+
+// NewCounter creates a counter with the given label names and registers it in the DefaultRegistry
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	if len(labels) == 0 {
+		c.get(nil)
+	}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// Inc increments the counter of the given label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter of the given label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+	c.Lock()
+	c.get(labelValues).value += v
+	c.Unlock()
+}
+
+// Gauge is a metric that can go up and down, e.g. the number of registrations
+type Gauge struct {
+	*family
+}
+
+// NewGauge creates a gauge with the given label names and registers it in the DefaultRegistry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	if len(labels) == 0 {
+		g.get(nil)
+	}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+// Set sets the gauge of the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.Lock()
+	g.get(labelValues).value = v
+	g.Unlock()
+}
+
+// Add adds v (which may be negative) to the gauge of the given label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.Lock()
+	g.get(labelValues).value += v
+	g.Unlock()
+}
+
+// GaugeFunc is a gauge whose value is obtained from a function when collected
+type GaugeFunc struct {
+	*family
+	fn func() float64
+}
+
+// NewGaugeFunc creates a GaugeFunc and registers it in the DefaultRegistry
+// The function must be safe for concurrent use
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{newFamily(name, help, "gauge", nil), fn}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.fn()))
+	return err
+}
+
+// Histogram counts observations (e.g. latencies) in configurable buckets
+type Histogram struct {
+	*family
+	// upper bounds of the buckets in increasing order
+	bounds []float64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds and label names
+// and registers it in the DefaultRegistry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &Histogram{
+		family: newFamily(name, help, "histogram", labels),
+		bounds: bounds,
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.Lock()
+	defer h.Unlock()
+
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.bounds))
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+	// value keeps the number of observations
+	s.value++
+	s.sum += v
+}
+
+// ObserveSince observes the time elapsed since start in seconds
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, s := range h.sorted() {
+		bucketValues := append(append([]string(nil), s.labelValues...), "")
+		for i, bound := range h.bounds {
+			bucketValues[len(s.labelValues)] = formatValue(bound)
+			_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, bucketValues), s.buckets[i])
+			if err != nil {
+				return err
+			}
+		}
+		bucketValues[len(s.labelValues)] = "+Inf"
+		labels := formatLabels(h.labels, s.labelValues)
+		_, err := fmt.Fprintf(w, "%s_bucket%s %s\n%s_sum%s %s\n%s_count%s %s\n",
+			h.name, formatLabels(bucketLabels, bucketValues), formatValue(s.value),
+			h.name, labels, formatValue(s.sum),
+			h.name, labels, formatValue(s.value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Formats label pairs, e.g. {method="GET",code="200"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", names[i], escapeLabelValue(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
@@ -0,0 +1,92 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/negroni"
+)
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+
+	c := NewCounter("test_requests_total", "Requests\nby code", "code")
+	c.Inc("200")
+	c.Add(2, "404")
+	c.Inc("200")
+	r.Register(c)
+
+	g := NewGauge("test_connected", "Connection state")
+	g.Set(1)
+	r.Register(g)
+
+	r.Register(NewGaugeFunc("test_queue", "Queue length", func() float64 { return 7 }))
+
+	h := NewHistogram("test_duration_seconds", "Duration", []float64{1, 0.1}, "path")
+	h.Observe(0.05, `/a"b`)
+	h.Observe(0.5, `/a"b`)
+	h.Observe(2, `/a"b`)
+	r.Register(h)
+
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `# HELP test_connected Connection state
+# TYPE test_connected gauge
+test_connected 1
+# HELP test_duration_seconds Duration
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{path="/a\"b",le="0.1"} 1
+test_duration_seconds_bucket{path="/a\"b",le="1"} 2
+test_duration_seconds_bucket{path="/a\"b",le="+Inf"} 3
+test_duration_seconds_sum{path="/a\"b"} 2.55
+test_duration_seconds_count{path="/a\"b"} 3
+# HELP test_queue Queue length
+# TYPE test_queue gauge
+test_queue 7
+# HELP test_requests_total Requests\nby code
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="404"} 2
+`
+	if b.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := NewMiddleware("test")
+	n := negroni.New(m)
+	n.UseHandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	for _, path := range []string{"/", "/missing", "/"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	w := httptest.NewRecorder()
+	DefaultRegistry.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Expected content type %s, got %s", ContentType, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		`test_http_requests_total{method="GET",code="200"} 2`,
+		`test_http_requests_total{method="GET",code="404"} 1`,
+		`test_http_requests_total{method="OTHER",code="200"} 1`,
+		`test_http_request_duration_seconds_count{method="GET"} 3`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %s in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/negroni"
+)
+
+// Methods reported as they are, others are reported as OTHER to limit the number of series
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// Middleware is a negroni handler counting the HTTP requests and measuring their latency
+type Middleware struct {
+	requests *Counter
+	duration *Histogram
+}
+
+// NewMiddleware creates the middleware with metrics prefixed by the given namespace (e.g. rc)
+func NewMiddleware(namespace string) *Middleware {
+	return &Middleware{
+		requests: NewCounter(namespace+"_http_requests_total",
+			"Number of HTTP requests by method and status code", "method", "code"),
+		duration: NewHistogram(namespace+"_http_request_duration_seconds",
+			"Latency of HTTP requests by method", DefaultBuckets, "method"),
+	}
+}
+
+func (m *Middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	next(rw, req)
+
+	method := req.Method
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	status := http.StatusOK
+	if res, ok := rw.(negroni.ResponseWriter); ok && res.Written() {
+		status = res.Status()
+	}
+	m.requests.Inc(method, strconv.Itoa(status))
+	m.duration.ObserveSince(start, method)
+}
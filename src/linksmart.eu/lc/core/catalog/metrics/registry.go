@@ -0,0 +1,73 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Registry is a set of metrics exposed together
+type Registry struct {
+	sync.RWMutex
+	collectors map[string]Collector
+}
+
+// DefaultRegistry holds the metrics created with the constructors of this package
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+// Register adds a collector to the registry, replacing a previous one with the same name
+func (r *Registry) Register(c Collector) {
+	r.Lock()
+	defer r.Unlock()
+	r.collectors[c.Name()] = c
+}
+
+// Unregister removes the collector with the given name
+func (r *Registry) Unregister(name string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.collectors, name)
+}
+
+// Write writes all metrics in the Prometheus text format, sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	r.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.RUnlock()
+
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics of the registry
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,8 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package openapi
+
+const (
+	SwaggerVersion = "2.0"
+	logComponent   = "openapi"
+)
@@ -0,0 +1,5 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+// Package openapi serves the OpenAPI (Swagger 2.0) specification of a catalog API,
+// checks it against the registered routes and validates requests, and optionally responses, against it.
+package openapi
@@ -0,0 +1,231 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const testDocument = `{
+	"swagger": "2.0",
+	"info": {"title": "Test API", "version": "1.0.0"},
+	"basePath": "/api",
+	"paths": {
+		"/items": {
+			"get": {
+				"parameters": [{"$ref": "#/parameters/ParamPage"}],
+				"responses": {"200": {"description": "OK"}}
+			},
+			"post": {
+				"parameters": [{"name": "item", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Item"}}],
+				"responses": {"201": {"description": "Created"}}
+			}
+		},
+		"/items/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "type": "string"}],
+			"get": {"responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/Item"}}, "404": {"$ref": "#/responses/NotFound"}}},
+			"delete": {"responses": {"200": {"description": "OK"}}}
+		}
+	},
+	"responses": {
+		"NotFound": {"description": "Not Found", "schema": {"$ref": "#/definitions/Error"}}
+	},
+	"parameters": {
+		"ParamPage": {"name": "page", "in": "query", "required": false, "type": "number", "format": "integer", "minimum": 1}
+	},
+	"definitions": {
+		"Item": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string"},
+				"ttl": {"type": "integer"},
+				"tags": {"type": "array", "items": {"type": "string"}}
+			}
+		},
+		"Error": {
+			"type": "object",
+			"required": ["code"],
+			"properties": {"code": {"type": "integer"}}
+		}
+	}
+}`
+
+func testSpec(t *testing.T) *Spec {
+	var document map[string]interface{}
+	err := json.Unmarshal([]byte(testDocument), &document)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	spec, err := newSpec(document)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return spec
+}
+
+func TestNormalizePath(t *testing.T) {
+	for template, expected := range map[string]string{
+		"/rc/resources/{id:[^/]+/?[^/]*}":    "/rc/resources/{id}",
+		"/rc/devices/{path}/{op}/{value:.*}": "/rc/devices/{path}/{op}/{value}",
+		"/rc/devices/":                       "/rc/devices",
+		"/x/{id:[a-z]{2}}":                   "/x/{id}",
+		"/":                                  "/",
+		"":                                   "/",
+	} {
+		if path := normalizePath(template); path != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, template, path)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	spec := testSpec(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/api/items").Handler(handler)
+	r.Methods("POST").Path("/api/items/").Handler(handler)
+	r.Methods("GET").Path("/api/items/{id:[^/]+}").Handler(handler)
+	r.Methods("PUT").Path("/api/items/{id:[^/]+}").Handler(handler)
+	r.Methods("GET").Path("/static").Handler(handler)
+
+	routes, err := RouterRoutes(r, "/api")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectedRoutes := []Route{{"GET", "/items"}, {"POST", "/items"}, {"GET", "/items/{id}"}, {"PUT", "/items/{id}"}}
+	if !reflect.DeepEqual(routes, expectedRoutes) {
+		t.Fatalf("Expected routes %v, got %v", expectedRoutes, routes)
+	}
+
+	problems := spec.Check(routes)
+	expected := []string{
+		"DELETE /items/{id} is documented but not routed",
+		"PUT /items/{id} is not documented",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Expected problems %v, got %v", expected, problems)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	routes := []Route{{"GET", "/items"}, {"GET", "/items/{id}"}}
+	spec := Generate("Test API", "1.0.0", "/api", routes)
+
+	if !reflect.DeepEqual(spec.Routes(), routes) {
+		t.Errorf("Expected routes %v, got %v", routes, spec.Routes())
+	}
+	if problems := spec.Check(routes); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+	op := spec.operations["/items/{id}"]["get"]
+	if len(op.parameters) != 1 || op.parameters[0]["name"] != "id" {
+		t.Errorf("Expected path parameter id, got %v", op.parameters)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	spec := testSpec(t)
+	spec.SetBasePath("/catalog")
+
+	errorResponse := func(w http.ResponseWriter, code int, msgs ...string) {
+		w.WriteHeader(code)
+		w.Write([]byte(strings.Join(msgs, " ")))
+	}
+	handler := spec.Validator(errorResponse, false)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/catalog/items").Handler(handler)
+	r.Methods("POST").Path("/catalog/items").Handler(handler)
+	r.Methods("GET").Path("/catalog/other").Handler(handler)
+
+	for _, c := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{"GET", "/catalog/items", "", http.StatusOK},
+		{"GET", "/catalog/items?page=2", "", http.StatusOK},
+		{"GET", "/catalog/items?page=two", "", http.StatusBadRequest},
+		{"GET", "/catalog/items?page=1.5", "", http.StatusBadRequest},
+		{"GET", "/catalog/items?page=0", "", http.StatusBadRequest},
+		{"POST", "/catalog/items", `{"name": "a", "ttl": 10, "tags": ["x"]}`, http.StatusOK},
+		{"POST", "/catalog/items", `{"name": "a", "tags": null}`, http.StatusOK},
+		{"POST", "/catalog/items", `{"ttl": 10}`, http.StatusBadRequest},
+		{"POST", "/catalog/items", `{"name": "a", "ttl": "10"}`, http.StatusBadRequest},
+		{"POST", "/catalog/items", `{"name": "a", "tags": [1]}`, http.StatusBadRequest},
+		{"POST", "/catalog/items", `{"name": `, http.StatusBadRequest},
+		{"POST", "/catalog/items", "", http.StatusBadRequest},
+		// undocumented
+		{"GET", "/catalog/other?page=two", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", c.method, c.url, c.body, c.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStrictValidator(t *testing.T) {
+	spec := testSpec(t)
+	spec.SetBasePath("/catalog")
+
+	errorResponse := func(w http.ResponseWriter, code int, msgs ...string) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(code)
+		w.Write([]byte(strings.Join(msgs, " ")))
+	}
+	// Responses of the items by id
+	responses := map[string]struct {
+		status      int
+		contentType string
+		body        string
+	}{
+		"valid":     {http.StatusOK, "application/json", `{"name": "a", "ttl": 10}`},
+		"ld":        {http.StatusOK, "application/ld+json", `{"name": "a"}`},
+		"invalid":   {http.StatusOK, "application/json", `{"ttl": "10"}`},
+		"malformed": {http.StatusOK, "application/json", `{"name": `},
+		"text":      {http.StatusOK, "text/plain", `{"ttl": "10"}`},
+		"missing":   {http.StatusNotFound, "application/json", `{"code": 404}`},
+		"error":     {http.StatusNotFound, "application/json", `{"code": "404"}`},
+	}
+	handler := spec.Validator(errorResponse, true)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r := responses[mux.Vars(req)["id"]]
+		w.Header().Set("Content-Type", r.contentType)
+		w.WriteHeader(r.status)
+		w.Write([]byte(r.body))
+	}))
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/catalog/items/{id}").Handler(handler)
+
+	for id, expected := range map[string]int{
+		"valid":     http.StatusOK,
+		"ld":        http.StatusOK,
+		"invalid":   http.StatusInternalServerError,
+		"malformed": http.StatusInternalServerError,
+		"text":      http.StatusOK,
+		"missing":   http.StatusNotFound,
+		"error":     http.StatusInternalServerError,
+	} {
+		req, _ := http.NewRequest("GET", "/catalog/items/"+id, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d, got %d: %s", id, expected, w.Code, w.Body.String())
+			continue
+		}
+		if expected != http.StatusInternalServerError && w.Body.String() != responses[id].body {
+			t.Errorf("%s: expected the body of the handler, got %s", id, w.Body.String())
+		}
+	}
+}
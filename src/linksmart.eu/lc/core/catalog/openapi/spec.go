@@ -0,0 +1,351 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// HTTP methods that may describe an operation in a Swagger path item
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// Spec is an OpenAPI (Swagger 2.0) document of a catalog API
+type Spec struct {
+	document map[string]interface{}
+	basePath string
+	// operations indexed by path (relative to basePath) and lower-case method
+	operations map[string]map[string]*operation
+}
+
+type operation struct {
+	parameters []map[string]interface{}
+	responses  map[string]interface{}
+}
+
+// Route is an API endpoint with a path relative to the API location
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	return fmt.Sprintf("%s %s", r.Method, r.Path)
+}
+
+// Load reads a Swagger 2.0 document from a JSON file
+func Load(path string) (*Spec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	err = json.Unmarshal(b, &document)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid OpenAPI document %s: %s", path, err)
+	}
+	return newSpec(document)
+}
+
+// Generate creates a skeleton Swagger 2.0 document describing the given routes
+func Generate(title, version, basePath string, routes []Route) *Spec {
+	paths := make(map[string]interface{})
+	for _, r := range routes {
+		item, ok := paths[r.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[r.Path] = item
+		}
+		parameters := []interface{}{}
+		for _, name := range pathParameters(r.Path) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"type":     "string",
+			})
+		}
+		item[strings.ToLower(r.Method)] = map[string]interface{}{
+			"parameters": parameters,
+			"responses": map[string]interface{}{
+				"default": map[string]interface{}{"description": "Response of the API"},
+			},
+		}
+	}
+
+	spec, _ := newSpec(map[string]interface{}{
+		"swagger":  SwaggerVersion,
+		"info":     map[string]interface{}{"title": title, "version": version},
+		"basePath": basePath,
+		"paths":    paths,
+	})
+	return spec
+}
+
+// Parses a Swagger document and indexes its operations
+func newSpec(document map[string]interface{}) (*Spec, error) {
+	if v, _ := document["swagger"].(string); v != SwaggerVersion {
+		return nil, fmt.Errorf("Unsupported OpenAPI document version: %v", document["swagger"])
+	}
+
+	s := &Spec{
+		document:   document,
+		operations: make(map[string]map[string]*operation),
+	}
+	s.basePath, _ = document["basePath"].(string)
+
+	paths, _ := document["paths"].(map[string]interface{})
+	for path, v := range paths {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid path item %s", path)
+		}
+		path = normalizePath(path)
+		if s.operations[path] == nil {
+			s.operations[path] = make(map[string]*operation)
+		}
+
+		common, err := s.parameters(item["parameters"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for _, method := range operationMethods {
+			o, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parameters, err := s.parameters(o["parameters"])
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %s", strings.ToUpper(method), path, err)
+			}
+			responses, _ := o["responses"].(map[string]interface{})
+			s.operations[path][method] = &operation{
+				parameters: mergeParameters(common, parameters),
+				responses:  responses,
+			}
+		}
+	}
+	return s, nil
+}
+
+// Resolves the parameter objects of a path item or operation
+func (s *Spec) parameters(v interface{}) ([]map[string]interface{}, error) {
+	list, _ := v.([]interface{})
+	parameters := make([]map[string]interface{}, 0, len(list))
+	for _, p := range list {
+		param, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter %v", p)
+		}
+		if ref, ok := param["$ref"].(string); ok {
+			resolved, ok := s.resolve(ref).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("unresolved reference %s", ref)
+			}
+			param = resolved
+		}
+		parameters = append(parameters, param)
+	}
+	return parameters, nil
+}
+
+// Resolves a local JSON reference, e.g. #/definitions/Device
+func (s *Spec) resolve(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var v interface{} = s.document
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		v = m[token]
+	}
+	return v
+}
+
+// Operation parameters override the path item parameters with the same name and location
+func mergeParameters(common, parameters []map[string]interface{}) []map[string]interface{} {
+	merged := append([]map[string]interface{}{}, parameters...)
+	for _, c := range common {
+		overridden := false
+		for _, p := range parameters {
+			if p["name"] == c["name"] && p["in"] == c["in"] {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+// SetBasePath sets the base path of the API, e.g. the configured API location
+func (s *Spec) SetBasePath(basePath string) {
+	if basePath == "" {
+		basePath = "/"
+	}
+	s.basePath = basePath
+	s.document["basePath"] = basePath
+}
+
+// Routes returns the operations documented in the spec
+func (s *Spec) Routes() []Route {
+	var routes []Route
+	for path, operations := range s.operations {
+		for method := range operations {
+			routes = append(routes, Route{strings.ToUpper(method), path})
+		}
+	}
+	sortRoutes(routes)
+	return routes
+}
+
+// Check compares the spec against the registered routes
+// and returns the differences between the two
+func (s *Spec) Check(routes []Route) []string {
+	var problems []string
+
+	registered := make(map[Route]bool)
+	for _, r := range routes {
+		registered[r] = true
+		if s.operations[r.Path][strings.ToLower(r.Method)] == nil {
+			problems = append(problems, fmt.Sprintf("%s is not documented", r))
+		}
+	}
+	for _, r := range s.Routes() {
+		if !registered[r] {
+			problems = append(problems, fmt.Sprintf("%s is documented but not routed", r))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// ServeHTTP serves the OpenAPI document
+func (s *Spec) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b, err := json.Marshal(s.document)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// RouterRoutes returns the routes of a router that are located under the basePath
+func RouterRoutes(router *mux.Router, basePath string) ([]Route, error) {
+	var routes []Route
+	seen := make(map[Route]bool)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path, ok := relativePath(template, basePath)
+		if !ok {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, m := range methods {
+			r := Route{strings.ToUpper(m), path}
+			if !seen[r] {
+				seen[r] = true
+				routes = append(routes, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortRoutes(routes)
+	return routes, nil
+}
+
+// Returns the path of a route template relative to the basePath
+func relativePath(template, basePath string) (string, bool) {
+	path := normalizePath(template)
+	basePath = normalizePath(basePath)
+	if basePath == "/" {
+		return path, true
+	}
+	if path == basePath {
+		return "/", true
+	}
+	if !strings.HasPrefix(path, basePath+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(path, basePath), true
+}
+
+// Removes variable patterns and the trailing slash from a path template
+// e.g. /resources/{id:[^/]+/?[^/]*}/ -> /resources/{id}
+func normalizePath(template string) string {
+	var b strings.Builder
+	depth := 0
+	skip := false
+	for _, c := range template {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				b.WriteRune(c)
+				continue
+			}
+		case c == '}':
+			depth--
+			if depth == 0 {
+				skip = false
+				b.WriteRune(c)
+				continue
+			}
+		case c == ':' && depth == 1:
+			skip = true
+		}
+		if !skip {
+			b.WriteRune(c)
+		}
+	}
+
+	path := strings.TrimSuffix(b.String(), "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// Returns the names of the variables in a path template
+func pathParameters(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.Trim(segment, "{}"))
+		}
+	}
+	return names
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
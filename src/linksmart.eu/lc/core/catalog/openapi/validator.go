@@ -0,0 +1,389 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrorResponseFunc writes an error in the format of the API
+type ErrorResponseFunc func(w http.ResponseWriter, code int, msgs ...string)
+
+// Validator returns a middleware that rejects requests not conforming to the spec
+// The middleware has to be used with routed handlers (e.g. in the chain of a mux route)
+// Requests to undocumented routes are passed through
+// Responses with status codes that are not documented for the operation are logged
+// In strict mode, JSON responses are buffered and their bodies validated against the schema documented
+// for their status code; non-conforming responses are replaced with an Internal Server Error (for development)
+func (s *Spec) Validator(errorResponse ErrorResponseFunc, strict bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			op, path := s.operation(req)
+			if op == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if errs := s.validateRequest(op, req); len(errs) > 0 {
+				errorResponse(w, http.StatusBadRequest,
+					"Request does not conform to the API specification:", strings.Join(errs, "; "))
+				return
+			}
+
+			rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK, buffer: strict}
+			next.ServeHTTP(rw, req)
+			if !op.documents(rw.status) {
+				logger.Warnf("Response status %d of %s %s is not documented", rw.status, req.Method, path)
+			}
+			if !rw.buffered() {
+				return
+			}
+
+			if errs := s.validateResponse(op, rw.status, rw.body.Bytes()); len(errs) > 0 {
+				logger.Warnf("Response of %s %s does not conform to the API specification: %s",
+					req.Method, path, strings.Join(errs, "; "))
+				w.Header().Del("Content-Length")
+				errorResponse(w, http.StatusInternalServerError,
+					"Response does not conform to the API specification:", strings.Join(errs, "; "))
+				return
+			}
+			w.WriteHeader(rw.status)
+			w.Write(rw.body.Bytes())
+		})
+	}
+}
+
+// Finds the documented operation of a routed request
+func (s *Spec) operation(req *http.Request) (*operation, string) {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return nil, ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil, ""
+	}
+	path, ok := relativePath(template, s.basePath)
+	if !ok {
+		return nil, ""
+	}
+	return s.operations[path][strings.ToLower(req.Method)], path
+}
+
+// Checks whether a response status is documented for the operation
+func (o *operation) documents(status int) bool {
+	if _, found := o.responses[strconv.Itoa(status)]; found {
+		return true
+	}
+	_, found := o.responses["default"]
+	return found
+}
+
+// Validates the parameters and the body of a request
+func (s *Spec) validateRequest(op *operation, req *http.Request) []string {
+	var errs []string
+	vars := mux.Vars(req)
+	query := req.URL.Query()
+
+	for _, p := range op.parameters {
+		name, _ := p["name"].(string)
+		required, _ := p["required"].(bool)
+
+		switch p["in"] {
+		case "path":
+			if v, found := vars[name]; found {
+				errs = append(errs, validateParameter(p, "path parameter "+name, v)...)
+			}
+		case "query":
+			values, found := query[name]
+			if !found {
+				if required {
+					errs = append(errs, fmt.Sprintf("query parameter %s is required", name))
+				}
+				continue
+			}
+			for _, v := range values {
+				errs = append(errs, validateParameter(p, "query parameter "+name, v)...)
+			}
+		case "header":
+			v := req.Header.Get(name)
+			if v == "" {
+				if required {
+					errs = append(errs, fmt.Sprintf("header %s is required", name))
+				}
+				continue
+			}
+			errs = append(errs, validateParameter(p, "header "+name, v)...)
+		case "body":
+			body, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("unable to read body: %s", err))
+				continue
+			}
+			// Restore the body for the next handler
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			if len(bytes.TrimSpace(body)) == 0 {
+				if required {
+					errs = append(errs, "body is required")
+				}
+				continue
+			}
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+			var v interface{}
+			if err := decoder.Decode(&v); err != nil {
+				errs = append(errs, fmt.Sprintf("body is not valid JSON: %s", err))
+				continue
+			}
+			schema, _ := p["schema"].(map[string]interface{})
+			errs = append(errs, s.validateSchema(schema, v, "body")...)
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// Validates the body of a response against the schema documented for its status code
+func (s *Spec) validateResponse(op *operation, status int, body []byte) []string {
+	response, found := op.responses[strconv.Itoa(status)]
+	if !found {
+		response = op.responses["default"]
+	}
+	r, _ := response.(map[string]interface{})
+	if ref, ok := r["$ref"].(string); ok {
+		r, _ = s.resolve(ref).(map[string]interface{})
+	}
+	schema, _ := r["schema"].(map[string]interface{})
+	if schema == nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return []string{fmt.Sprintf("response body is not valid JSON: %s", err)}
+	}
+	errs := s.validateSchema(schema, v, "response body")
+	sort.Strings(errs)
+	return errs
+}
+
+// Validates the string value of a non-body parameter
+func validateParameter(p map[string]interface{}, name, value string) []string {
+	var v interface{} = value
+	switch p["type"] {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return []string{fmt.Sprintf("%s must be an integer", name)}
+		}
+		v = json.Number(value)
+	case "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return []string{fmt.Sprintf("%s must be a number", name)}
+		}
+		if isIntegerFormat(p["format"]) && f != math.Trunc(f) {
+			return []string{fmt.Sprintf("%s must be an integer", name)}
+		}
+		v = json.Number(value)
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return []string{fmt.Sprintf("%s must be a boolean", name)}
+		}
+		return nil
+	case "array":
+		items, _ := p["items"].(map[string]interface{})
+		var errs []string
+		for _, item := range strings.Split(value, ",") {
+			errs = append(errs, validateParameter(items, name, item)...)
+		}
+		return errs
+	}
+	return validateConstraints(p, v, name)
+}
+
+// Validates a decoded JSON value against a schema object
+// JSON null is accepted for any schema since Swagger 2.0 cannot express nullable values
+func (s *Spec) validateSchema(schema map[string]interface{}, v interface{}, name string) []string {
+	if schema == nil || v == nil {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, ok := s.resolve(ref).(map[string]interface{})
+		if !ok {
+			logger.Warnf("Unresolved schema reference %s", ref)
+			return nil
+		}
+		return s.validateSchema(resolved, v, name)
+	}
+
+	var errs []string
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			subSchema, _ := sub.(map[string]interface{})
+			errs = append(errs, s.validateSchema(subSchema, v, name)...)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf("%s must be an object", name))
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, r := range required {
+			key, _ := r.(string)
+			if _, found := obj[key]; !found {
+				errs = append(errs, fmt.Sprintf("%s.%s is required", name, key))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, value := range obj {
+			property, ok := properties[key].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			errs = append(errs, s.validateSchema(property, value, name+"."+key)...)
+		}
+		return errs
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf("%s must be an array", name))
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range list {
+			errs = append(errs, s.validateSchema(items, item, fmt.Sprintf("%s[%d]", name, i))...)
+		}
+		return errs
+	case "string":
+		if _, ok := v.(string); !ok {
+			return append(errs, fmt.Sprintf("%s must be a string", name))
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s must be an integer", name))
+		}
+		if _, err := n.Int64(); err != nil {
+			return append(errs, fmt.Sprintf("%s must be an integer", name))
+		}
+	case "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s must be a number", name))
+		}
+		if f, _ := n.Float64(); isIntegerFormat(schema["format"]) && f != math.Trunc(f) {
+			return append(errs, fmt.Sprintf("%s must be an integer", name))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return append(errs, fmt.Sprintf("%s must be a boolean", name))
+		}
+	}
+	return append(errs, validateConstraints(schema, v, name)...)
+}
+
+// Validates the enum, minimum, maximum and pattern keywords of a schema
+func validateConstraints(schema map[string]interface{}, v interface{}, name string) []string {
+	var errs []string
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s must be one of %v", name, enum))
+		}
+	}
+	if n, ok := v.(json.Number); ok {
+		f, _ := n.Float64()
+		if min, ok := schema["minimum"].(float64); ok && f < min {
+			errs = append(errs, fmt.Sprintf("%s must be at least %v", name, min))
+		}
+		if max, ok := schema["maximum"].(float64); ok && f > max {
+			errs = append(errs, fmt.Sprintf("%s must be at most %v", name, max))
+		}
+	}
+	if str, ok := v.(string); ok {
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err == nil && !re.MatchString(str) {
+				errs = append(errs, fmt.Sprintf("%s must match %s", name, pattern))
+			}
+		}
+	}
+	return errs
+}
+
+func isIntegerFormat(format interface{}) bool {
+	return format == "integer" || format == "int32" || format == "int64"
+}
+
+// statusRecorder keeps the status code written by a handler
+// If buffer is set, JSON responses are kept in body instead of being written
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	buffer      bool
+	wroteHeader bool
+	body        *bytes.Buffer
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = code
+	if r.buffer && isJSON(r.Header().Get("Content-Type")) {
+		r.body = new(bytes.Buffer)
+		return
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if r.body != nil {
+		return r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush sends the written data to the client, unless the response is buffered
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok && r.body == nil {
+		f.Flush()
+	}
+}
+
+// Checks whether the response has been buffered
+func (r *statusRecorder) buffered() bool {
+	return r.body != nil
+}
+
+// Checks whether a content type is JSON, e.g. application/json or application/ld+json
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,145 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"fmt"
+
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// OwnershipPolicy restricts the modification of catalog entries to their owners
+// An entry is owned by the authenticated user who created it. It may only be updated, renewed or deleted by its owner,
+// the members of its owner groups and the administrators. Entries created anonymously have no owner.
+// A zero value (disabled) records no owners and imposes no restrictions
+type OwnershipPolicy struct {
+	// Ownership switch
+	Enabled bool `json:"enabled"`
+	// Groups whose members share the entries of each other
+	// The groups of the creator of an entry among these become its owner groups
+	OwnerGroups []string `json:"ownerGroups"`
+	// Users and groups allowed to modify and transfer any entry
+	AdminUsers  []string `json:"adminUsers"`
+	AdminGroups []string `json:"adminGroups"`
+}
+
+// Validate checks the policy for consistency
+func (p OwnershipPolicy) Validate() error {
+	var errs ConfigErrors
+	for key, names := range map[string][]string{"ownerGroups": p.OwnerGroups, "adminUsers": p.AdminUsers, "adminGroups": p.AdminGroups} {
+		for _, name := range names {
+			if name == "" {
+				errs.Addf("%s: name must not be empty", key)
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// Claim returns the owner and owner groups of an entry created by the given user (nil if anonymous)
+// The requested owner and groups default to the user and its groups among the OwnerGroups
+// Only administrators may create entries owned by others or shared with groups they are not a member of
+func (p OwnershipPolicy) Claim(user *validator.UserProfile, owner string, groups []string) (string, []string, error) {
+	if !p.Enabled || user == nil {
+		return "", nil, nil
+	}
+	if owner == "" {
+		owner = user.Username
+	}
+	if groups == nil {
+		groups = intersect(user.Groups, p.OwnerGroups)
+	}
+	if p.isAdmin(user) {
+		return owner, groups, nil
+	}
+	if owner != user.Username {
+		return "", nil, fmt.Errorf("User %s may not create entries owned by %s", user.Username, owner)
+	}
+	for _, group := range groups {
+		if !contains(user.Groups, group) {
+			return "", nil, fmt.Errorf("User %s may not share entries with group %s", user.Username, group)
+		}
+	}
+	return owner, groups, nil
+}
+
+// CheckModify checks that the given user (nil if anonymous) may update, renew or delete an entry with the given owners
+func (p OwnershipPolicy) CheckModify(user *validator.UserProfile, owner string, groups []string) error {
+	if !p.Enabled || owner == "" {
+		return nil
+	}
+	if user != nil && (user.Username == owner || len(intersect(user.Groups, groups)) > 0 || p.isAdmin(user)) {
+		return nil
+	}
+	return fmt.Errorf("The entry is owned by %s", owner)
+}
+
+// Transfer returns the owner and owner groups of an entry updated by the given user (nil if anonymous)
+// The current owners are kept unless others are requested. Only the owner and the administrators may transfer
+// owned entries; entries without owner are claimed by requesting owners (see Claim)
+// As in Claim, only administrators may share entries with groups they are not a member of
+func (p OwnershipPolicy) Transfer(user *validator.UserProfile, owner string, groups []string, newOwner string, newGroups []string) (string, []string, error) {
+	if !p.Enabled {
+		return owner, groups, nil
+	}
+	if newOwner == "" {
+		newOwner = owner
+	}
+	if newGroups == nil {
+		newGroups = groups
+	}
+	if newOwner == owner && equal(newGroups, groups) {
+		return owner, groups, nil
+	}
+	if owner == "" {
+		return p.Claim(user, newOwner, newGroups)
+	}
+	if user == nil || (user.Username != owner && !p.isAdmin(user)) {
+		return "", nil, fmt.Errorf("Only the owner %s may transfer the entry", owner)
+	}
+	if !p.isAdmin(user) {
+		// Groups the entry is already shared with may be kept
+		for _, group := range newGroups {
+			if !contains(groups, group) && !contains(user.Groups, group) {
+				return "", nil, fmt.Errorf("User %s may not share entries with group %s", user.Username, group)
+			}
+		}
+	}
+	return newOwner, newGroups, nil
+}
+
+func (p OwnershipPolicy) isAdmin(user *validator.UserProfile) bool {
+	return contains(p.AdminUsers, user.Username) || len(intersect(user.Groups, p.AdminGroups)) > 0
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the elements of a which are also in b
+func intersect(a, b []string) []string {
+	var both []string
+	for _, v := range a {
+		if contains(b, v) {
+			both = append(both, v)
+		}
+	}
+	return both
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
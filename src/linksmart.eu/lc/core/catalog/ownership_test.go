@@ -0,0 +1,72 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"reflect"
+	"testing"
+
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+func TestOwnershipPolicy(t *testing.T) {
+	p := OwnershipPolicy{Enabled: true, OwnerGroups: []string{"team-a"}, AdminUsers: []string{"root"}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Unexpected error validating the policy: %s", err)
+	}
+	alice := &validator.UserProfile{Username: "alice", Groups: []string{"team-a", "staff"}}
+	bob := &validator.UserProfile{Username: "bob", Groups: []string{"team-a"}}
+	eve := &validator.UserProfile{Username: "eve"}
+	root := &validator.UserProfile{Username: "root"}
+
+	owner, groups, err := p.Claim(alice, "", nil)
+	if err != nil || owner != "alice" || !reflect.DeepEqual(groups, []string{"team-a"}) {
+		t.Errorf("Expected alice to own the entry with team-a, got %s, %v (%v)", owner, groups, err)
+	}
+	if owner, _, _ := p.Claim(nil, "alice", nil); owner != "" {
+		t.Errorf("Expected anonymous entries to have no owner, got %s", owner)
+	}
+	if _, _, err := p.Claim(alice, "eve", nil); err == nil {
+		t.Error("Expected an error claiming an entry for another user")
+	}
+	if owner, _, err := p.Claim(root, "eve", nil); err != nil || owner != "eve" {
+		t.Errorf("Expected root to create an entry of eve, got %s (%v)", owner, err)
+	}
+
+	for user, allowed := range map[*validator.UserProfile]bool{alice: true, bob: true, root: true, eve: false, nil: false} {
+		if err := p.CheckModify(user, "alice", []string{"team-a"}); (err == nil) != allowed {
+			t.Errorf("Expected modification by %v to be allowed: %t, got %v", user, allowed, err)
+		}
+	}
+	if err := p.CheckModify(eve, "", nil); err != nil {
+		t.Errorf("Expected an entry without owner to be modifiable, got %v", err)
+	}
+
+	// Transfers
+	if owner, groups, err := p.Transfer(bob, "alice", []string{"team-a"}, "", nil); err != nil || owner != "alice" || len(groups) != 1 {
+		t.Errorf("Expected the owners to be kept, got %s, %v (%v)", owner, groups, err)
+	}
+	if _, _, err := p.Transfer(bob, "alice", []string{"team-a"}, "bob", nil); err == nil {
+		t.Error("Expected an error on transfer by a member of the owner groups")
+	}
+	if owner, _, err := p.Transfer(alice, "alice", []string{"team-a"}, "eve", nil); err != nil || owner != "eve" {
+		t.Errorf("Expected the entry to be transferred to eve, got %s (%v)", owner, err)
+	}
+	if _, _, err := p.Transfer(alice, "alice", []string{"team-a"}, "", []string{"team-a", "team-b"}); err == nil {
+		t.Error("Expected an error sharing an entry with a group the owner is not a member of")
+	}
+	if _, groups, err := p.Transfer(alice, "alice", []string{"team-a"}, "", []string{"staff"}); err != nil || !reflect.DeepEqual(groups, []string{"staff"}) {
+		t.Errorf("Expected the entry to be shared with staff, got %v (%v)", groups, err)
+	}
+	if _, _, err := p.Transfer(alice, "alice", []string{"team-b"}, "eve", nil); err != nil {
+		t.Errorf("Expected the current owner groups to be kept on transfer, got %v", err)
+	}
+	if _, groups, err := p.Transfer(root, "alice", []string{"team-a"}, "", []string{"team-b"}); err != nil || !reflect.DeepEqual(groups, []string{"team-b"}) {
+		t.Errorf("Expected root to share the entry with team-b, got %v (%v)", groups, err)
+	}
+
+	// Disabled
+	if owner, _, _ := (OwnershipPolicy{}).Claim(alice, "", nil); owner != "" {
+		t.Errorf("Expected no owner to be recorded if disabled, got %s", owner)
+	}
+}
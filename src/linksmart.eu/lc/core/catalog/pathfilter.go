@@ -41,7 +41,7 @@ func recursiveMatch(data interface{}, path []string) interface{} {
 		}
 	default:
 		//TODO->logger.Println("Unknown type for", data)
-		logger.Println("Unknown type for", data)
+		logger.Warn("Unknown type for", data)
 	}
 
 	return nil
@@ -0,0 +1,11 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package ratelimit
+
+import "time"
+
+const (
+	// Buckets of clients idle for this duration are removed
+	idleTimeout  = 10 * time.Minute
+	logComponent = "ratelimit"
+)
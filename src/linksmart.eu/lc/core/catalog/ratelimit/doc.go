@@ -0,0 +1,9 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+// Package ratelimit limits the rate of requests of each client to the catalog and gateway APIs.
+//
+// Clients are identified by the user authenticated by the ticket validator, or else by the
+// source IP address. Each client has separate token buckets for reads (GET, HEAD, OPTIONS) and
+// writes (other methods). Requests exceeding the budget are rejected with 429 Too Many Requests
+// and a Retry-After header.
+package ratelimit
@@ -0,0 +1,13 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package ratelimit
+
+import (
+	"linksmart.eu/lc/core/logging"
+)
+
+var logger *logging.Logger
+
+func init() {
+	logger = logging.New(logComponent)
+}
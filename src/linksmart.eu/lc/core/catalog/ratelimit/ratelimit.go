@@ -0,0 +1,214 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Budget is the rate of requests allowed for a client
+type Budget struct {
+	// Sustained number of requests per second (zero means unlimited)
+	Rate float64 `json:"rate"`
+	// Number of requests that can be submitted at once (defaults to the rate, at least 1)
+	Burst int `json:"burst"`
+}
+
+func (b Budget) validate() error {
+	if b.Rate < 0 || b.Burst < 0 {
+		return fmt.Errorf("rate and burst must not be negative")
+	}
+	return nil
+}
+
+// Returns the capacity of the bucket
+func (b Budget) capacity() float64 {
+	if b.Burst > 0 {
+		return float64(b.Burst)
+	}
+	return math.Max(1, math.Ceil(b.Rate))
+}
+
+// Limits are the budgets of a client for reads (GET, HEAD, OPTIONS) and writes (other methods)
+type Limits struct {
+	Read  Budget `json:"read"`
+	Write Budget `json:"write"`
+}
+
+func (l Limits) validate() error {
+	if err := l.Read.validate(); err != nil {
+		return fmt.Errorf("read: %s", err)
+	}
+	if err := l.Write.validate(); err != nil {
+		return fmt.Errorf("write: %s", err)
+	}
+	return nil
+}
+
+// Config of the rate limiting
+type Config struct {
+	// Rate limiting switch
+	Enabled bool `json:"enabled"`
+	// Budgets of each client
+	Limits
+	// Budgets of specific clients (usernames or IP addresses) replacing the above
+	Clients map[string]Limits `json:"clients"`
+}
+
+// Validate checks the budgets
+func (c Config) Validate() error {
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+	for client, limits := range c.Clients {
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("client %s: %s", client, err)
+		}
+	}
+	return nil
+}
+
+// ErrorResponseFunc writes an error in the format of the API
+type ErrorResponseFunc func(w http.ResponseWriter, code int, msgs ...string)
+
+// Limiter keeps the token buckets of the clients
+type Limiter struct {
+	sync.Mutex
+	config        Config
+	errorResponse ErrorResponseFunc
+	buckets       map[bucketKey]*bucket
+	lastSweep     time.Time
+	// current time (replaced in tests)
+	now func() time.Time
+}
+
+type bucketKey struct {
+	client string
+	write  bool
+}
+
+// NewLimiter creates a Limiter with the given configuration
+// Rejected requests are answered using errorResponse
+func NewLimiter(config Config, errorResponse ErrorResponseFunc) *Limiter {
+	return &Limiter{
+		config:        config,
+		errorResponse: errorResponse,
+		buckets:       make(map[bucketKey]*bucket),
+		lastSweep:     time.Now(),
+		now:           time.Now,
+	}
+}
+
+// Handler is a middleware rejecting the requests of clients exceeding their budget
+// It must follow the ticket validator to identify clients by the authenticated user
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		client := clientOf(req)
+		write := isWrite(req.Method)
+
+		wait, allowed := l.allow(client, write)
+		if !allowed {
+			seconds := int(math.Ceil(wait.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			logger.With("client", client, "method", req.Method, "path", req.URL.Path).
+				Debugf("Rate limit exceeded. Retry after %ds", seconds)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			l.errorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded. Retry after", strconv.Itoa(seconds), "seconds.")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Takes a token of the client
+// Returns whether the request is allowed, or else the time until a token is available
+func (l *Limiter) allow(client string, write bool) (time.Duration, bool) {
+	limits, found := l.config.Clients[client]
+	if !found {
+		limits = l.config.Limits
+	}
+	budget := limits.Read
+	if write {
+		budget = limits.Write
+	}
+	if budget.Rate == 0 {
+		// unlimited
+		return 0, true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > idleTimeout {
+		l.sweep(now)
+	}
+
+	key := bucketKey{client, write}
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: budget.capacity(), last: now}
+		l.buckets[key] = b
+	}
+	return b.take(budget, now)
+}
+
+// Removes the buckets of idle clients
+// WARNING: the caller must obtain the lock before calling
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// bucket holds the tokens of a client, refilled at the rate of the budget
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Takes a token if available, or else returns the time until one is available
+func (b *bucket) take(budget Budget, now time.Time) (time.Duration, bool) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(budget.capacity(), b.tokens+elapsed.Seconds()*budget.Rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / budget.Rate * float64(time.Second)), false
+}
+
+// Returns the client of a request: the authenticated user, or else the source IP address
+func clientOf(req *http.Request) string {
+	if profile := validator.GetUserProfile(req); profile != nil && profile.Username != "" {
+		return profile.Username
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Validator driver accepting tokens named after the user
+type testDriver struct{}
+
+func (testDriver) Validate(serverAddr, serviceID, ticket string) (bool, *validator.UserProfile, error) {
+	return true, &validator.UserProfile{Username: ticket}, nil
+}
+
+func init() {
+	validator.Register("ratelimit-test", testDriver{})
+}
+
+func errorResponse(w http.ResponseWriter, code int, msgs ...string) {
+	http.Error(w, strings.Join(msgs, " "), code)
+}
+
+// Returns a handler limited by the given config and a function to advance its clock
+func setupLimiter(t *testing.T, config Config) (http.Handler, func(time.Duration)) {
+	v, err := validator.Setup("ratelimit-test", "", "", false, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	now := time.Now()
+	l := NewLimiter(config, errorResponse)
+	l.now = func() time.Time { return now }
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Authenticate requests with a token, others are anonymous
+		if req.Header.Get("Authorization") != "" {
+			v.Handler(l.Handler(ok)).ServeHTTP(w, req)
+			return
+		}
+		l.Handler(ok).ServeHTTP(w, req)
+	})
+	return handler, func(d time.Duration) { now = now.Add(d) }
+}
+
+func request(h http.Handler, method, remoteAddr, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/rc/devices", nil)
+	req.RemoteAddr = remoteAddr
+	if user != "" {
+		req.Header.Set("Authorization", "Bearer "+user)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestBudgets(t *testing.T) {
+	h, advance := setupLimiter(t, Config{
+		Enabled: true,
+		Limits: Limits{
+			Read:  Budget{Rate: 10, Burst: 2},
+			Write: Budget{Rate: 0.5},
+		},
+	})
+	const client = "10.0.0.1:1234"
+
+	for i := 0; i < 2; i++ {
+		if w := request(h, "GET", client, ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected read %d within the burst to be allowed, got %d", i, w.Code)
+		}
+	}
+	w := request(h, "GET", client, "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %s", w.Header().Get("Retry-After"))
+	}
+
+	// Writes have a separate budget
+	if w := request(h, "PUT", client, ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first write to be allowed, got %d", w.Code)
+	}
+	w = request(h, "DELETE", client, "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected status 429 with Retry-After 2, got %d and %s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Other clients are not affected
+	if w := request(h, "GET", "10.0.0.2:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a read of another client to be allowed, got %d", w.Code)
+	}
+
+	// Tokens are refilled
+	advance(100 * time.Millisecond)
+	if w := request(h, "GET", client, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a read to be allowed after refill, got %d", w.Code)
+	}
+	advance(2 * time.Second)
+	if w := request(h, "POST", client, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a write to be allowed after refill, got %d", w.Code)
+	}
+}
+
+func TestClients(t *testing.T) {
+	h, _ := setupLimiter(t, Config{
+		Enabled: true,
+		Limits: Limits{
+			Read: Budget{Rate: 1},
+		},
+		Clients: map[string]Limits{
+			"admin": {},
+		},
+	})
+
+	// Authenticated users are limited independently of their address
+	if w := request(h, "GET", "10.0.0.1:1", "alice"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := request(h, "GET", "10.0.0.2:1", "alice"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for the same user, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w := request(h, "GET", "10.0.0.1:1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for an anonymous client, got %d", http.StatusOK, w.Code)
+	}
+
+	// Unlimited user
+	for i := 0; i < 10; i++ {
+		if w := request(h, "GET", "10.0.0.1:1", "admin"); w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for an unlimited user, got %d", http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Limits: Limits{Read: Budget{Rate: -1}}},
+		{Clients: map[string]Limits{"alice": {Write: Budget{Burst: -1}}}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
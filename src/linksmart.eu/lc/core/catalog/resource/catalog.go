@@ -3,10 +3,13 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
 	"time"
+
+	"linksmart.eu/lc/sec/auth/validator"
 )
 
 // STRUCTS
@@ -19,6 +22,7 @@ type Device struct {
 	Id          string                 `json:"id"`
 	URL         string                 `json:"url"`
 	Type        string                 `json:"type"`
+	Tenant      string                 `json:"tenant,omitempty"` // namespace of the device, set by the catalog
 	Name        string                 `json:"name,omitempty"`
 	Meta        map[string]interface{} `json:"meta,omitempty"`
 	Description string                 `json:"description,omitempty"`
@@ -26,6 +30,9 @@ type Device struct {
 	Created     time.Time              `json:"created"`
 	Updated     time.Time              `json:"updated"`
 	Expires     *time.Time             `json:"expires,omitempty"`
+	Stale       bool                   `json:"stale,omitempty"` // expired, to be removed after the grace period
+	Owner       string                 `json:"owner,omitempty"` // user who created the device, see catalog.OwnershipPolicy
+	OwnerGroups []string               `json:"ownerGroups,omitempty"`
 	Resources   Resources              `json:"resources"`
 }
 
@@ -135,33 +142,47 @@ func (devices Devices) simplify() []SimpleDevice {
 // INTERFACES
 
 // Controller interface
+// Devices are added and updated in the namespace of their Tenant, the other operations
+// take the tenant explicitly (tenancy.All for the queries across all tenants)
+// Modifications are made on behalf of the given authenticated user (nil if anonymous) according to the ownership policy
 type CatalogController interface {
 	// Devices
-	add(d Device) (string, error)
-	get(id string) (*SimpleDevice, error)
-	update(id string, d Device) error
-	delete(id string) error
-	list(page, perPage int) ([]SimpleDevice, int, error)
-	filter(path, op, value string, page, perPage int) ([]SimpleDevice, int, error)
-	total() (int, error)
-	cleanExpired()
+	add(d Device, user *validator.UserProfile) (string, error)
+	get(tenant, id string) (*SimpleDevice, error)
+	update(id string, d Device, user *validator.UserProfile) error
+	delete(tenant, id string, user *validator.UserProfile) error
+	heartbeat(tenant, id string, user *validator.UserProfile) error
+	list(tenant string, page, perPage int) ([]SimpleDevice, int, error)
+	expiring(tenant string, within time.Duration, page, perPage int) ([]SimpleDevice, int, error)
+	checkTTL(ttl uint, user string) error
+	filter(tenant, path, op, value string, page, perPage int) ([]SimpleDevice, int, error)
+	total(tenant string) (int, error)
+	cleanExpired(now time.Time)
+
+	// Events
+	events(ctx context.Context, tenant, epoch string, since uint64, wait time.Duration) (*EventCollection, error)
+
+	// Thing Descriptions
+	getThingDescription(tenant, id string) (*ThingDescription, error)
+	listThingDescriptions(tenant string, page, perPage int) ([]ThingDescription, int, error)
 
 	// Resources
-	getResource(id string) (*Resource, error)
-	listResources(page, perPage int) ([]Resource, int, error)
-	filterResources(path, op, value string, page, perPage int) ([]Resource, int, error)
-	totalResources() (int, error)
+	getResource(tenant, id string) (*Resource, error)
+	listResources(tenant string, page, perPage int) ([]Resource, int, error)
+	filterResources(tenant, path, op, value string, page, perPage int) ([]Resource, int, error)
+	totalResources(tenant string) (int, error)
 
 	Stop() error
 }
 
 // Storage interface
+// Devices are stored in the namespace of their Tenant, partitioned by tenant
 type CatalogStorage interface {
 	add(d *Device) error
 	update(id string, d *Device) error
-	delete(id string) error
-	get(id string) (*Device, error)
-	list(page, perPage int) (Devices, int, error)
-	total() (int, error)
+	delete(tenant, id string) error
+	get(tenant, id string) (*Device, error)
+	list(tenant string, page, perPage int) (Devices, int, error)
+	total(tenant string) (int, error)
 	Close() error
 }
@@ -6,15 +6,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/sec/auth/validator"
 )
 
 const (
 	TypeDevices   = "devices"
 	TypeResources = "resources"
+	TypeThings    = "things"
+	TypeEvents    = "events"
 	CtxPath       = "/ctx/rc.jsonld"
 )
 
@@ -28,6 +34,19 @@ type DeviceCollection struct {
 	Total   int            `json:"total"`
 }
 
+// EventCollection is a batch of events following a position in the catalog's event log
+type EventCollection struct {
+	Context string `json:"@context,omitempty"`
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Epoch   string `json:"epoch"`
+	// Sequence number of the last event, to be used as the position of the next request
+	Last uint64 `json:"last"`
+	// Events following the requested position are no longer available
+	Resync bool    `json:"resync"`
+	Events []Event `json:"events"`
+}
+
 type ResourceCollection struct {
 	Context   string     `json:"@context,omitempty"`
 	Id        string     `json:"id"`
@@ -38,6 +57,15 @@ type ResourceCollection struct {
 	Total     int        `json:"total"`
 }
 
+type ThingDescriptionCollection struct {
+	Id      string             `json:"id"`
+	Type    string             `json:"type"`
+	Things  []ThingDescription `json:"things"`
+	Page    int                `json:"page"`
+	PerPage int                `json:"per_page"`
+	Total   int                `json:"total"`
+}
+
 type JSONLDSimpleDevice struct {
 	Context string `json:"@context"`
 	*SimpleDevice
@@ -78,16 +106,34 @@ func NewWritableCatalogAPI(controller CatalogController, apiLocation, staticLoca
 
 // Index of API
 func (a *ReadableCatalogAPI) Index(w http.ResponseWriter, req *http.Request) {
-	total, err := a.controller.total()
+	tenant := tenancy.Get(req)
+	total, err := a.controller.total(tenant)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "Error counting devices:", err.Error())
 		return
 	}
-	totalResources, err := a.controller.totalResources()
+	totalResources, err := a.controller.totalResources(tenant)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "Error counting resources:", err.Error())
 		return
 	}
+	// Count the accessible entries only
+	if allowed := validator.EntryFilter(req); allowed != nil {
+		_, total, err = authorizedDevices(func(page, perPage int) ([]SimpleDevice, int, error) {
+			return a.controller.list(tenant, page, perPage)
+		}, allowed, 1, 1)
+		if err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "Error counting devices:", err.Error())
+			return
+		}
+		_, totalResources, err = authorizedResources(func(page, perPage int) ([]Resource, int, error) {
+			return a.controller.listResources(tenant, page, perPage)
+		}, allowed, 1, 1)
+		if err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "Error counting resources:", err.Error())
+			return
+		}
+	}
 
 	index := map[string]interface{}{
 		"description":     a.description,
@@ -127,10 +173,23 @@ func (a *WritableCatalogAPI) Post(w http.ResponseWriter, req *http.Request) {
 		ErrorResponse(w, http.StatusBadRequest, "Creating a device with defined ID is not possible using a POST request.")
 		return
 	}
+	d.Tenant = tenancy.Get(req)
+
+	if err := a.controller.checkTTL(d.Ttl, userOf(req)); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid device registration:", err.Error())
+		return
+	}
+	if !accessible(req, &d) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
 
-	id, err := a.controller.add(d)
+	id, err := a.controller.add(d, validator.GetUserProfile(req))
 	if err != nil {
 		switch err.(type) {
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
 		case *ConflictError:
 			ErrorResponse(w, http.StatusConflict, "Error creating the registration:", err.Error())
 			return
@@ -148,11 +207,15 @@ func (a *WritableCatalogAPI) Post(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
-// Gets a single Device
+// Gets a single Device (or its Thing Description if requested in the Accept header)
 func (a *ReadableCatalogAPI) Get(w http.ResponseWriter, req *http.Request) {
+	if acceptsThingDescription(req) {
+		a.GetThingDescription(w, req)
+		return
+	}
 	params := mux.Vars(req)
 
-	d, err := a.controller.get(params["id"])
+	d, err := a.controller.get(tenancy.Get(req), params["id"])
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -163,6 +226,10 @@ func (a *ReadableCatalogAPI) Get(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 	}
+	if !accessible(req, d) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
 
 	ldd := JSONLDSimpleDevice{
 		Context:      a.ctxPath,
@@ -183,6 +250,7 @@ func (a *ReadableCatalogAPI) Get(w http.ResponseWriter, req *http.Request) {
 // If the device does not exist, a new one will be created with the given id (Response: StatusCreated)
 func (a *WritableCatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
+	user := validator.GetUserProfile(req)
 
 	body, err := ioutil.ReadAll(req.Body)
 	req.Body.Close()
@@ -196,15 +264,30 @@ func (a *WritableCatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 		ErrorResponse(w, http.StatusBadRequest, "Error processing the request:", err.Error())
 		return
 	}
+	d.Tenant = tenancy.Get(req)
 
-	err = a.controller.update(params["id"], d)
+	if err := a.controller.checkTTL(d.Ttl, userOf(req)); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid device registration:", err.Error())
+		return
+	}
+	// Both the stored and the updated device must be accessible
+	if !accessible(req, &d) || !a.accessibleDevice(req, params["id"]) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
+
+	err = a.controller.update(params["id"], d, user)
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
 			// Create a new device with the given id
 			d.Id = params["id"]
-			id, err := a.controller.add(d)
+			id, err := a.controller.add(d, user)
 			if err != nil {
+				if _, forbidden := err.(*ForbiddenError); forbidden {
+					ErrorResponse(w, http.StatusForbidden, err.Error())
+					return
+				}
 				ErrorResponse(w, http.StatusInternalServerError, "Error creating the registration:", err.Error())
 				return
 			}
@@ -212,6 +295,9 @@ func (a *WritableCatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 			w.Header().Set("Location", fmt.Sprintf("%s/%s/%s", a.apiLocation, TypeDevices, id))
 			w.WriteHeader(http.StatusCreated)
 			return
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
 		case *ConflictError:
 			ErrorResponse(w, http.StatusConflict, "Error updating the device:", err.Error())
 			return
@@ -232,12 +318,20 @@ func (a *WritableCatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 func (a *WritableCatalogAPI) Delete(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 
-	err := a.controller.delete(params["id"])
+	if !a.accessibleDevice(req, params["id"]) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
+
+	err := a.controller.delete(tenancy.Get(req), params["id"], validator.GetUserProfile(req))
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
 			ErrorResponse(w, http.StatusNotFound, err.Error())
 			return
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
 		default:
 			ErrorResponse(w, http.StatusInternalServerError, "Error deleting the device:", err.Error())
 			return
@@ -248,6 +342,34 @@ func (a *WritableCatalogAPI) Delete(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Renews the registration of a device, extending its expiry time by the TTL
+func (a *WritableCatalogAPI) Heartbeat(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+
+	if !a.accessibleDevice(req, params["id"]) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
+
+	err := a.controller.heartbeat(tenancy.Get(req), params["id"], validator.GetUserProfile(req))
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			ErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
+		default:
+			ErrorResponse(w, http.StatusInternalServerError, "Error renewing the registration:", err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/ld+json;version="+ApiVersion)
+	w.WriteHeader(http.StatusOK)
+}
+
 // Lists devices in a DeviceCollection
 func (a *ReadableCatalogAPI) List(w http.ResponseWriter, req *http.Request) {
 	err := req.ParseForm()
@@ -262,7 +384,24 @@ func (a *ReadableCatalogAPI) List(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	simpleDevices, total, err := a.controller.list(page, perPage)
+	var (
+		simpleDevices []SimpleDevice
+		total         int
+	)
+	if expiring := req.Form.Get(catalog.GetParamExpiring); expiring != "" {
+		within, parseErr := catalog.ParseExpiringParam(expiring)
+		if parseErr != nil {
+			ErrorResponse(w, http.StatusBadRequest, "Error parsing query parameters:", parseErr.Error())
+			return
+		}
+		simpleDevices, total, err = a.listDevices(req, func(page, perPage int) ([]SimpleDevice, int, error) {
+			return a.controller.expiring(tenancy.Get(req), within, page, perPage)
+		}, page, perPage)
+	} else {
+		simpleDevices, total, err = a.listDevices(req, func(page, perPage int) ([]SimpleDevice, int, error) {
+			return a.controller.list(tenancy.Get(req), page, perPage)
+		}, page, perPage)
+	}
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -307,7 +446,9 @@ func (a *ReadableCatalogAPI) Filter(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	simpleDevices, total, err := a.controller.filter(path, op, value, page, perPage)
+	simpleDevices, total, err := a.listDevices(req, func(page, perPage int) ([]SimpleDevice, int, error) {
+		return a.controller.filter(tenancy.Get(req), path, op, value, page, perPage)
+	}, page, perPage)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -333,13 +474,311 @@ func (a *ReadableCatalogAPI) Filter(w http.ResponseWriter, req *http.Request) {
 	w.Write(b)
 }
 
+// Lists the changes of the catalog following a position in its event log
+// Waits for new events (long-polling) if there are none
+func (a *ReadableCatalogAPI) Events(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error parsing the query:", err.Error())
+		return
+	}
+	since, wait, err := catalog.ParseEventParams(
+		req.Form.Get(catalog.GetParamSince), req.Form.Get(catalog.GetParamWait))
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error parsing query parameters:", err.Error())
+		return
+	}
+
+	coll, err := a.controller.events(req.Context(), tenancy.Get(req), req.Form.Get(catalog.GetParamEpoch), since, wait)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	coll.Context = a.ctxPath
+	coll.Id = fmt.Sprintf("%s/%s", a.apiLocation, TypeEvents)
+	if allowed := validator.EntryFilter(req); allowed != nil {
+		events := make([]Event, 0, len(coll.Events))
+		for _, e := range coll.Events {
+			if allowed(e.Device) {
+				events = append(events, e)
+			}
+		}
+		coll.Events = events
+	}
+
+	b, err := json.Marshal(coll)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/ld+json;version="+ApiVersion)
+	w.Write(b)
+}
+
+// THING DESCRIPTIONS
+
+// Gets the Thing Description of a single Device
+func (a *ReadableCatalogAPI) GetThingDescription(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+
+	td, err := a.controller.getThingDescription(tenancy.Get(req), params["id"])
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			ErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		default:
+			ErrorResponse(w, http.StatusInternalServerError, "Error retrieving the device:", err.Error())
+			return
+		}
+	}
+	if !accessible(req, td) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
+
+	b, err := json.Marshal(td)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", TDMediaType)
+	w.Write(b)
+}
+
+// Lists Thing Descriptions of devices in a ThingDescriptionCollection (TD directory)
+func (a *ReadableCatalogAPI) ListThingDescriptions(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error parsing the query:", err.Error())
+		return
+	}
+	page, perPage, err := catalog.ParsePagingParams(
+		req.Form.Get(catalog.GetParamPage), req.Form.Get(catalog.GetParamPerPage), MaxPerPage)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error parsing query parameters:", err.Error())
+		return
+	}
+
+	fetch := func(page, perPage int) ([]ThingDescription, int, error) {
+		return a.controller.listThingDescriptions(tenancy.Get(req), page, perPage)
+	}
+	var (
+		tds   []ThingDescription
+		total int
+	)
+	if allowed := validator.EntryFilter(req); allowed != nil {
+		tds, total, err = authorizedThings(fetch, allowed, page, perPage)
+	} else {
+		tds, total, err = fetch(page, perPage)
+	}
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	coll := &ThingDescriptionCollection{
+		Id:      fmt.Sprintf("%s/%s", a.apiLocation, TypeThings),
+		Type:    ApiThingCollectionType,
+		Things:  tds,
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	}
+
+	b, err := json.Marshal(coll)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;version="+ApiVersion)
+	w.Write(b)
+}
+
+// Registers or updates a device given its Thing Description
+// Responds with a ThingImportReport (StatusCreated for new devices, StatusOK for updated ones)
+func (a *WritableCatalogAPI) ImportThingDescription(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var td ThingDescription
+	if err := json.Unmarshal(body, &td); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error processing the request:", err.Error())
+		return
+	}
+
+	if err := a.controller.checkTTL(importedTTL(a.controller, tenancy.Get(req), &td), userOf(req)); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid thing description:", err.Error())
+		return
+	}
+	// Both the stored and the imported device must be accessible
+	if !accessible(req, &td) || (td.Id != "" && !a.accessibleDevice(req, td.Id)) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the device")
+		return
+	}
+
+	report, err := importThingDescription(a.controller, tenancy.Get(req), &td, validator.GetUserProfile(req))
+	if err != nil {
+		switch err.(type) {
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
+		case *ConflictError:
+			ErrorResponse(w, http.StatusConflict, "Error importing the thing description:", err.Error())
+			return
+		case *BadRequestError:
+			ErrorResponse(w, http.StatusBadRequest, "Invalid thing description:", err.Error())
+			return
+		default:
+			ErrorResponse(w, http.StatusInternalServerError, "Error importing the thing description:", err.Error())
+			return
+		}
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;version="+ApiVersion)
+	if report.Created {
+		w.Header().Set("Location", report.URL)
+		w.WriteHeader(http.StatusCreated)
+	}
+	w.Write(b)
+}
+
+// Checks whether a Thing Description is requested via the Accept header
+func acceptsThingDescription(req *http.Request) bool {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == TDMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the authenticated user of a request, or an empty string if authentication is disabled
+func userOf(req *http.Request) string {
+	if profile := validator.GetUserProfile(req); profile != nil {
+		return profile.Username
+	}
+	return ""
+}
+
+// Checks whether the entry is accessible according to the conditions of the authorization rules
+func accessible(req *http.Request, entry interface{}) bool {
+	allowed := validator.EntryFilter(req)
+	return allowed == nil || allowed(entry)
+}
+
+// Checks whether a stored device is accessible, if it exists
+func (a *ReadableCatalogAPI) accessibleDevice(req *http.Request, id string) bool {
+	d, err := a.controller.get(tenancy.Get(req), id)
+	if err != nil {
+		// not found and other errors are reported by the controller
+		return true
+	}
+	return accessible(req, d)
+}
+
+// Returns a page of devices, filtered by the conditions of the authorization rules if needed
+func (a *ReadableCatalogAPI) listDevices(req *http.Request, fetch func(page, perPage int) ([]SimpleDevice, int, error),
+	page, perPage int) ([]SimpleDevice, int, error) {
+	if allowed := validator.EntryFilter(req); allowed != nil {
+		return authorizedDevices(fetch, allowed, page, perPage)
+	}
+	return fetch(page, perPage)
+}
+
+// Returns a page of resources, filtered by the conditions of the authorization rules if needed
+func (a *ReadableCatalogAPI) listResources(req *http.Request, fetch func(page, perPage int) ([]Resource, int, error),
+	page, perPage int) ([]Resource, int, error) {
+	if allowed := validator.EntryFilter(req); allowed != nil {
+		return authorizedResources(fetch, allowed, page, perPage)
+	}
+	return fetch(page, perPage)
+}
+
+// Fetches all devices, keeps the allowed ones and returns the requested page of them
+func authorizedDevices(fetch func(page, perPage int) ([]SimpleDevice, int, error), allowed func(entry interface{}) bool,
+	page, perPage int) ([]SimpleDevice, int, error) {
+	entries, total, err := catalog.FilterPage(func(page, perPage int) ([]interface{}, int, error) {
+		devices, total, err := fetch(page, perPage)
+		entries := make([]interface{}, len(devices))
+		for i := range devices {
+			entries[i] = &devices[i]
+		}
+		return entries, total, err
+	}, allowed, page, perPage, MaxPerPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	devices := make([]SimpleDevice, len(entries))
+	for i, entry := range entries {
+		devices[i] = *entry.(*SimpleDevice)
+	}
+	return devices, total, nil
+}
+
+// Fetches all resources, keeps the allowed ones and returns the requested page of them
+func authorizedResources(fetch func(page, perPage int) ([]Resource, int, error), allowed func(entry interface{}) bool,
+	page, perPage int) ([]Resource, int, error) {
+	entries, total, err := catalog.FilterPage(func(page, perPage int) ([]interface{}, int, error) {
+		resources, total, err := fetch(page, perPage)
+		entries := make([]interface{}, len(resources))
+		for i := range resources {
+			entries[i] = &resources[i]
+		}
+		return entries, total, err
+	}, allowed, page, perPage, MaxPerPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	resources := make([]Resource, len(entries))
+	for i, entry := range entries {
+		resources[i] = *entry.(*Resource)
+	}
+	return resources, total, nil
+}
+
+// Fetches all Thing Descriptions, keeps the allowed ones and returns the requested page of them
+func authorizedThings(fetch func(page, perPage int) ([]ThingDescription, int, error), allowed func(entry interface{}) bool,
+	page, perPage int) ([]ThingDescription, int, error) {
+	entries, total, err := catalog.FilterPage(func(page, perPage int) ([]interface{}, int, error) {
+		tds, total, err := fetch(page, perPage)
+		entries := make([]interface{}, len(tds))
+		for i := range tds {
+			entries[i] = &tds[i]
+		}
+		return entries, total, err
+	}, allowed, page, perPage, MaxPerPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	tds := make([]ThingDescription, len(entries))
+	for i, entry := range entries {
+		tds[i] = *entry.(*ThingDescription)
+	}
+	return tds, total, nil
+}
+
 // RESOURCES
 
 // Gets a single Resource
 func (a *ReadableCatalogAPI) GetResource(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 
-	r, err := a.controller.getResource(params["id"])
+	r, err := a.controller.getResource(tenancy.Get(req), params["id"])
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -350,6 +789,10 @@ func (a *ReadableCatalogAPI) GetResource(w http.ResponseWriter, req *http.Reques
 			return
 		}
 	}
+	if !accessible(req, r) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the resource")
+		return
+	}
 
 	ldr := JSONLDResource{
 		Context:  a.ctxPath,
@@ -380,7 +823,9 @@ func (a *ReadableCatalogAPI) ListResources(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	resources, total, err := a.controller.listResources(page, perPage)
+	resources, total, err := a.listResources(req, func(page, perPage int) ([]Resource, int, error) {
+		return a.controller.listResources(tenancy.Get(req), page, perPage)
+	}, page, perPage)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -425,7 +870,9 @@ func (a *ReadableCatalogAPI) FilterResources(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	resources, total, err := a.controller.filterResources(path, op, value, page, perPage)
+	resources, total, err := a.listResources(req, func(page, perPage int) ([]Resource, int, error) {
+		return a.controller.filterResources(tenancy.Get(req), path, op, value, page, perPage)
+	}, page, perPage)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "Error processing the request:", err.Error())
 		return
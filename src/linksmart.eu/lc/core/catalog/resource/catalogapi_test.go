@@ -17,6 +17,8 @@ import (
 	"github.com/pborman/uuid"
 	"io/ioutil"
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/sec/auth/validator"
+	"linksmart.eu/lc/sec/authz"
 )
 
 func setupRouter() (*mux.Router, func(), error) {
@@ -57,11 +59,17 @@ func setupRouter() (*mux.Router, func(), error) {
 	r.Methods("DELETE").Path(TestApiLocation + "/devices/{id}").HandlerFunc(api.Delete)
 	// Listing, filtering
 	r.Methods("GET").Path(TestApiLocation + "/devices").HandlerFunc(api.List)
+	r.Methods("GET").Path(TestApiLocation + "/devices/{id}/td").HandlerFunc(api.GetThingDescription)
 	r.Methods("GET").Path(TestApiLocation + "/devices/{path}/{op}/{value:.*}").HandlerFunc(api.Filter)
+	// Thing Descriptions
+	r.Methods("GET").Path(TestApiLocation + "/things").HandlerFunc(api.ListThingDescriptions)
+	r.Methods("POST").Path(TestApiLocation + "/things").HandlerFunc(api.ImportThingDescription)
 	// Resources
 	r.Methods("GET").Path(TestApiLocation + "/resources").HandlerFunc(api.ListResources)
-	r.Methods("GET").Path(TestApiLocation + "/resources/{id}").HandlerFunc(api.GetResource)
+	r.Methods("GET").Path(TestApiLocation + "/resources/{id:[^/]+/?[^/]*}").HandlerFunc(api.GetResource)
 	r.Methods("GET").Path(TestApiLocation + "/resources/{path}/{op}/{value:.*}").HandlerFunc(api.FilterResources)
+	// Events
+	r.Methods("GET").Path(TestApiLocation + "/events").HandlerFunc(api.Events)
 
 	return r, func() {
 		controller.Stop()
@@ -457,6 +465,355 @@ func TestFilter(t *testing.T) {
 	}
 }
 
+func TestEvents(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	getEvents := func(query string) *EventCollection {
+		url := ts.URL + TestApiLocation + "/events" + query
+		t.Log("Calling GET", url)
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Server should return %v, got instead: %v (%s)", http.StatusOK, res.StatusCode, res.Status)
+		}
+		var coll EventCollection
+		err = json.NewDecoder(res.Body).Decode(&coll)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return &coll
+	}
+
+	d := mockedDevice("1", "10")
+	d.Id = ""
+	b, _ := json.Marshal(d)
+	_, err = http.Post(ts.URL+TestApiLocation+"/devices/", "application/ld+json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Unknown epoch
+	coll := getEvents("")
+	if !coll.Resync || coll.Last != 1 || len(coll.Events) != 0 {
+		t.Fatalf("Expected a resync at position 1, got %+v", coll)
+	}
+
+	coll = getEvents(fmt.Sprintf("?%s=%s&%s=0", utils.GetParamEpoch, coll.Epoch, utils.GetParamSince))
+	if coll.Resync || coll.Last != 1 || len(coll.Events) != 1 {
+		t.Fatalf("Expected 1 event, got %+v", coll)
+	}
+	e := coll.Events[0]
+	if e.Seq != 1 || e.Type != utils.EventAdded || e.Device == nil || e.Id != e.Device.Id || e.Device.Name != d.Name {
+		t.Fatalf("Unexpected event: %+v", e)
+	}
+
+	// No new events
+	coll = getEvents(fmt.Sprintf("?%s=%s&%s=1&%s=0", utils.GetParamEpoch, coll.Epoch, utils.GetParamSince, utils.GetParamWait))
+	if coll.Resync || coll.Last != 1 || len(coll.Events) != 0 {
+		t.Fatalf("Expected no events, got %+v", coll)
+	}
+
+	res, err := http.Get(ts.URL + TestApiLocation + "/events?" + utils.GetParamSince + "=-1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Server should return %v for an invalid position, got instead: %v", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+// THING DESCRIPTIONS
+
+func TestRetrieveThingDescription(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	mockedDevice := mockedDevice("1", "10")
+	b, _ := json.Marshal(mockedDevice)
+
+	// Create
+	url := ts.URL + TestApiLocation + "/devices/" + mockedDevice.Id
+	t.Log("Calling PUT", url)
+	_, err = httpPut(url, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Retrieve via the td endpoint and via content negotiation
+	for _, accept := range []string{"", TDMediaType} {
+		tdURL := url + "/td"
+		if accept != "" {
+			tdURL = url
+		}
+		t.Log("Calling GET", tdURL, "Accept:", accept)
+		req, _ := http.NewRequest("GET", tdURL, nil)
+		req.Header.Set("Accept", accept)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Server should return %v, got instead: %v (%s)", http.StatusOK, res.StatusCode, res.Status)
+		}
+
+		if !strings.HasPrefix(res.Header.Get("Content-Type"), TDMediaType) {
+			t.Fatalf("Response should have Content-Type: %s, got instead %s", TDMediaType, res.Header.Get("Content-Type"))
+		}
+
+		var td ThingDescription
+		err = json.NewDecoder(res.Body).Decode(&td)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if td.Id != mockedDevice.Id || td.Title != mockedDevice.Name {
+			t.Fatalf("TD id/title do not match the device: %v/%v", td.Id, td.Title)
+		}
+		p, found := td.Properties[mockedDevice.Resources[0].Name]
+		if !found {
+			t.Fatalf("TD has no property for resource %s: %v", mockedDevice.Resources[0].Name, td.Properties)
+		}
+		if len(p.Forms) != 1 || p.Forms[0].Href != "http://localhost:9000/rest/device/resource" ||
+			p.Forms[0].Op[0] != TDOpReadProperty || p.Forms[0].ContentType != "application/senml+json" {
+			t.Fatalf("Unexpected property forms: %v", p.Forms)
+		}
+		if !p.ReadOnly {
+			t.Fatal("Property of a resource with only GET method should be readOnly")
+		}
+	}
+
+	// Non-existing device
+	res, err := http.Get(ts.URL + TestApiLocation + "/devices/some_id/td")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("Server should return %v, got instead: %v (%s)", http.StatusNotFound, res.StatusCode, res.Status)
+	}
+}
+
+func TestListThingDescriptions(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	// Create 3 devices
+	url := ts.URL + TestApiLocation + "/devices/"
+	for i := 0; i < 3; i++ {
+		d := mockedDevice(fmt.Sprint(i), fmt.Sprint(i*10))
+		d.Id = ""
+		b, _ := json.Marshal(d)
+
+		_, err := http.Post(url, "application/ld+json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	url = ts.URL + TestApiLocation + "/things"
+	t.Log("Calling GET", url)
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Server should return %v, got instead: %v (%s)", http.StatusOK, res.StatusCode, res.Status)
+	}
+
+	var collection *ThingDescriptionCollection
+	decoder := json.NewDecoder(res.Body)
+	defer res.Body.Close()
+
+	err = decoder.Decode(&collection)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if collection.Total != 3 || len(collection.Things) != 3 {
+		t.Fatal("Server should return a collection of *3* thing descriptions, but got total", collection.Total)
+	}
+}
+
+func TestImportThingDescription(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	td := []byte(`{
+		"@context": "https://www.w3.org/2019/wot/td/v1",
+		"id": "lamp_1",
+		"title": "Lamp",
+		"base": "http://lamp.local:8080/",
+		"securityDefinitions": {"nosec_sc": {"scheme": "nosec"}},
+		"security": "nosec_sc",
+		"properties": {
+			"status": {
+				"forms": [
+					{"href": "status", "op": ["readproperty", "writeproperty"]},
+					{"href": "mqtt://broker:1883/lamp/status", "op": "observeproperty"}
+				]
+			}
+		},
+		"actions": {
+			"toggle": {"forms": [{"href": "toggle"}]}
+		},
+		"events": {
+			"overheating": {"forms": [{"href": "coap://lamp.local/oh", "op": "subscribeevent"}]}
+		}
+	}`)
+
+	url := ts.URL + TestApiLocation + "/things"
+	for i, expected := range []int{http.StatusCreated, http.StatusOK} {
+		t.Log("Calling POST", url)
+		res, err := http.Post(url, TDMediaType, bytes.NewReader(td))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if res.StatusCode != expected {
+			t.Fatalf("Server should return %v, got instead: %v (%s)", expected, res.StatusCode, res.Status)
+		}
+
+		var report ThingImportReport
+		err = json.NewDecoder(res.Body).Decode(&report)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if report.Id != "lamp_1" || report.Created != (i == 0) {
+			t.Fatalf("Unexpected import report: %+v", report)
+		}
+		// the CoAP form and thus the event cannot be mapped
+		if len(report.Unmapped) != 2 {
+			t.Fatalf("Expected 2 unmapped parts, got: %v", report.Unmapped)
+		}
+	}
+
+	// Retrieve the created resource
+	res, err := http.Get(ts.URL + TestApiLocation + "/resources/lamp_1/status")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var r Resource
+	err = json.NewDecoder(res.Body).Decode(&r)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(r.Protocols) != 2 {
+		t.Fatalf("Expected REST and MQTT protocols, got: %v", r.Protocols)
+	}
+	rest, mqtt := r.Protocols[0], r.Protocols[1]
+	if rest.Endpoint["url"] != "http://lamp.local:8080/status" || !reflect.DeepEqual(rest.Methods, []string{"GET", "PUT"}) {
+		t.Fatalf("Unexpected REST protocol: %v", rest)
+	}
+	if mqtt.Endpoint["url"] != "tcp://broker:1883" || mqtt.Endpoint["pub_topic"] != "lamp/status" {
+		t.Fatalf("Unexpected MQTT protocol: %v", mqtt)
+	}
+
+	// Action without op defaults to invokeaction
+	res, err = http.Get(ts.URL + TestApiLocation + "/resources/lamp_1/toggle")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = json.NewDecoder(res.Body).Decode(&r)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(r.Protocols) != 1 || !reflect.DeepEqual(r.Protocols[0].Methods, []string{"POST"}) {
+		t.Fatalf("Unexpected protocols of action: %v", r.Protocols)
+	}
+}
+
+// Validates tickets in the form of user names
+type testDriver struct{}
+
+func (testDriver) Validate(serverAddr, serviceID, ticket string) (bool, *validator.UserProfile, error) {
+	return true, &validator.UserProfile{Username: ticket}, nil
+}
+
+func init() {
+	validator.Register("resource-test", testDriver{})
+}
+
+func TestImportThingDescriptionAuthorized(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	// alice may access the devices with test-id 1, bob all of them
+	rules := &authz.Conf{Rules: []authz.Rule{
+		{Resources: []string{TestApiLocation}, Methods: []string{authz.AnyMethod}, Users: []string{"alice"},
+			Conditions: []authz.Condition{{Field: "meta.test-id", Op: authz.OpEquals, Value: "1"}}},
+		{Resources: []string{TestApiLocation}, Methods: []string{authz.AnyMethod}, Users: []string{"bob"}},
+	}}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err.Error())
+	}
+	v, err := validator.Setup("resource-test", "", "", false, rules)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	handler := v.Handler(router)
+
+	request := func(method, path, user string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+user)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	device := mockedDevice("2", "2")
+	b, _ := json.Marshal(device)
+	if w := request("PUT", TestApiLocation+"/devices/"+device.Id, "bob", b); w.Code != http.StatusCreated {
+		t.Fatalf("Expected %d creating the device, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	// The imported Thing Description fulfills the conditions, but the stored device does not
+	td := []byte(`{"id": "` + device.Id + `", "title": "Lamp", "meta": {"test-id": "1"}}`)
+	if w := request("POST", TestApiLocation+"/things", "alice", td); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected %d overwriting an inaccessible device, got %d: %s", http.StatusForbidden, w.Code, w.Body)
+	}
+	if w := request("GET", TestApiLocation+"/devices/"+device.Id, "bob", nil); !strings.Contains(w.Body.String(), device.Name) {
+		t.Fatalf("Expected the device to be unchanged, got %s", w.Body)
+	}
+
+	td = []byte(`{"id": "lamp_1", "title": "Lamp", "meta": {"test-id": "1"}}`)
+	if w := request("POST", TestApiLocation+"/things", "alice", td); w.Code != http.StatusCreated {
+		t.Fatalf("Expected %d importing an accessible device, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+}
+
 // RESOURCES
 
 func TestRetrieveResource(t *testing.T) {
@@ -2,6 +2,8 @@
 
 package resource
 
+import "context"
+
 // Catalog client
 type CatalogClient interface {
 	// CRUD
@@ -10,6 +12,9 @@ type CatalogClient interface {
 	Update(id string, d *Device) error
 	Delete(id string) error
 
+	// Renews the registration, extending its expiry time by the TTL
+	Heartbeat(id string) error
+
 	// Returns a slice of Devices given:
 	// page - page in the collection
 	// perPage - number of entries per page
@@ -28,4 +33,24 @@ type CatalogClient interface {
 
 	// Returns a slice of Resources given: path, operation, value, page, perPage
 	FilterResources(path, op, value string, page, perPage int) ([]Resource, int, error)
+
+	// Registers or updates the device described by a W3C WoT Thing Description
+	ImportThingDescription(td *ThingDescription) (*ThingImportReport, error)
+
+	// Variants of the above using a context for cancellation and deadlines
+	GetContext(ctx context.Context, id string) (*SimpleDevice, error)
+	AddContext(ctx context.Context, d *Device) (string, error)
+	UpdateContext(ctx context.Context, id string, d *Device) error
+	DeleteContext(ctx context.Context, id string) error
+	HeartbeatContext(ctx context.Context, id string) error
+	ListContext(ctx context.Context, page, perPage int) ([]SimpleDevice, int, error)
+	FilterContext(ctx context.Context, path, op, value string, page, perPage int) ([]SimpleDevice, int, error)
+	GetResourceContext(ctx context.Context, id string) (*Resource, error)
+	ListResourcesContext(ctx context.Context, page, perPage int) ([]Resource, int, error)
+	FilterResourcesContext(ctx context.Context, path, op, value string, page, perPage int) ([]Resource, int, error)
+	ImportThingDescriptionContext(ctx context.Context, td *ThingDescription) (*ThingImportReport, error)
+
+	// Watches the changes of devices matching the filter until ctx is done
+	// Missed changes (e.g. during a disconnection) are recovered by listing the devices
+	Watch(ctx context.Context, filter WatchFilter) (<-chan Event, error)
 }
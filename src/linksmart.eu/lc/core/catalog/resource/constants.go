@@ -11,5 +11,7 @@ const (
 	ApiResourceCollectionType = "Resources"
 	ApiDeviceType             = "Device"
 	ApiResourceType           = "Resource"
-	loggerPrefix              = "[rc] "
+	ApiThingCollectionType    = "ThingDescriptions"
+	ApiEventCollectionType    = "Events"
+	logComponent              = "rc"
 )
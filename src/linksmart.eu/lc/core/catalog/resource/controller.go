@@ -3,6 +3,7 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -11,6 +12,9 @@ import (
 
 	avl "github.com/ancientlore/go-avltree"
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/metrics"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/sec/auth/validator"
 )
 
 type Controller struct {
@@ -18,25 +22,55 @@ type Controller struct {
 	sync.RWMutex
 	storage     CatalogStorage
 	apiLocation string
-	ticker      *time.Ticker
-
-	// startTime and counter for ID generation
-	startTime int64
-	counter   int64
+	ttlPolicy   catalog.TTLPolicy
+	ownership   catalog.OwnershipPolicy
+
+	// generator of the ids of devices and resources
+	idGenerator catalog.IDGenerator
+
+	// sorted resourceID->deviceID maps of each tenant
+	rid_did map[string]*avl.Tree
+	// expiry times of devices by storage key (see tenancy.Key)
+	expiry *catalog.ExpiryIndex
+	// removal times of stale devices (expiry time + grace period) by storage key
+	staleExpiry *catalog.ExpiryIndex
+	// runs cleanExpired at the next expiry or removal time
+	expiryTimer *catalog.ExpiryTimer
+
+	// latest changes for watching clients
+	eventLog *catalog.EventLog
+}
 
-	// sorted resourceID->deviceID maps
-	rid_did *avl.Tree
-	// sorted expiryTime->deviceID maps
-	exp_did *avl.Tree
+// ControllerOptions are the optional settings of a Controller
+type ControllerOptions struct {
+	// Policy for the TTL of the registrations
+	TTLPolicy catalog.TTLPolicy
+	// Policy for the modification of the registrations of other users
+	Ownership catalog.OwnershipPolicy
+	// Generator of the ids of devices and resources, by default a catalog.TimestampIDGenerator
+	IDGenerator catalog.IDGenerator
 }
 
 func NewController(storage CatalogStorage, apiLocation string) (CatalogController, error) {
+	return NewControllerWithOptions(storage, apiLocation, ControllerOptions{})
+}
+
+// NewControllerWithOptions creates a Controller with the given options
+func NewControllerWithOptions(storage CatalogStorage, apiLocation string, options ControllerOptions) (CatalogController, error) {
 	c := Controller{
 		storage:     storage,
 		apiLocation: apiLocation,
-		rid_did:     avl.New(stringKeys, 0),
-		exp_did:     avl.New(timeKeys, avl.AllowDuplicates), // allows more than one device with the same expiry time
-		startTime:   time.Now().UTC().Unix(),
+		ttlPolicy:   options.TTLPolicy,
+		ownership:   options.Ownership,
+		rid_did:     make(map[string]*avl.Tree),
+		expiry:      catalog.NewExpiryIndex(),
+		staleExpiry: catalog.NewExpiryIndex(),
+		idGenerator: options.IDGenerator,
+		eventLog:    catalog.NewEventLog(catalog.DefaultEventLogSize),
+	}
+
+	if c.idGenerator == nil {
+		c.idGenerator = catalog.NewTimestampIDGenerator()
 	}
 
 	// Initialize secondary indices (if a persistent storage backend is present)
@@ -45,30 +79,47 @@ func NewController(storage CatalogStorage, apiLocation string) (CatalogControlle
 		return nil, err
 	}
 
-	c.ticker = time.NewTicker(5 * time.Second)
-	go c.cleanExpired()
+	c.expiryTimer = catalog.NewExpiryTimer(c.nextExpiry, c.cleanExpired)
+
+	metrics.NewGaugeFunc(metricPrefix+"registrations", "Number of registered devices", func() float64 {
+		total, _ := c.total(tenancy.All)
+		return float64(total)
+	})
 
 	return &c, nil
 }
 
 // DEVICES
 
-func (c *Controller) add(d Device) (string, error) {
+func (c *Controller) add(d Device, user *validator.UserProfile) (id string, err error) {
+	defer func() { observeOperation("add", err) }()
+
 	if err := d.validate(); err != nil {
 		return "", &BadRequestError{err.Error()}
 	}
+	if err := c.applyTTLPolicy(&d); err != nil {
+		return "", err
+	}
+	d.Owner, d.OwnerGroups, err = c.ownership.Claim(user, d.Owner, d.OwnerGroups)
+	if err != nil {
+		return "", &ForbiddenError{err.Error()}
+	}
 
 	c.Lock()
 	defer c.Unlock()
 
 	if d.Id == "" {
 		// System generated id
-		d.Id = c.newDeviceURN()
+		d.Id, err = c.newDeviceID(d.Tenant)
+		if err != nil {
+			return "", err
+		}
 	}
 	d.URL = fmt.Sprintf("%s/%s/%s", c.apiLocation, TypeDevices, d.Id)
 	d.Type = ApiDeviceType
 	d.Created = time.Now().UTC()
 	d.Updated = d.Created
+	d.Stale = false
 	if d.Ttl == 0 {
 		d.Expires = nil
 	} else {
@@ -80,10 +131,13 @@ func (c *Controller) add(d Device) (string, error) {
 
 		if d.Resources[i].Id == "" {
 			// System generated id
-			d.Resources[i].Id = c.newResourceURN()
+			d.Resources[i].Id, err = c.newResourceID(d.Tenant)
+			if err != nil {
+				return "", err
+			}
 		} else {
 			// User-defined id, check for uniqueness
-			if match := c.rid_did.Find(Map{key: d.Resources[i].Id}); match != nil {
+			if match := c.findResource(d.Tenant, d.Resources[i].Id); match != nil {
 				return "", &ConflictError{fmt.Sprintf("Resource id %s is not unique", d.Resources[i].Id)}
 			}
 		}
@@ -93,7 +147,7 @@ func (c *Controller) add(d Device) (string, error) {
 	}
 	sort.Sort(d.Resources)
 
-	err := c.storage.add(&d)
+	err = c.storage.add(&d)
 	if err != nil {
 		return "", err
 	}
@@ -101,11 +155,13 @@ func (c *Controller) add(d Device) (string, error) {
 	// Add secondary indices
 	c.addIndices(&d)
 
+	c.eventLog.Append(catalog.EventAdded, d.Id, d.simplify())
+
 	return d.Id, nil
 }
 
-func (c *Controller) get(id string) (*SimpleDevice, error) {
-	d, err := c.storage.get(id)
+func (c *Controller) get(tenant, id string) (*SimpleDevice, error) {
+	d, err := c.storage.get(tenant, id)
 	if err != nil {
 		return nil, err
 	}
@@ -113,10 +169,15 @@ func (c *Controller) get(id string) (*SimpleDevice, error) {
 	return d.simplify(), nil
 }
 
-func (c *Controller) update(id string, d Device) error {
+func (c *Controller) update(id string, d Device, user *validator.UserProfile) (err error) {
+	defer func() { observeOperation("update", err) }()
+
 	if err := d.validate(); err != nil {
 		return &BadRequestError{err.Error()}
 	}
+	if err := c.applyTTLPolicy(&d); err != nil {
+		return err
+	}
 
 	c.Lock()
 	defer c.Unlock()
@@ -125,19 +186,35 @@ func (c *Controller) update(id string, d Device) error {
 	for _, r := range d.Resources {
 		// User-defined
 		if r.Id != "" {
-			if match := c.rid_did.Find(Map{key: r.Id}); match != nil {
+			if match := c.findResource(d.Tenant, r.Id); match != nil {
 				if match.(Map).value.(string) != id {
 					return &ConflictError{fmt.Sprintf("Resource id %s is not unique", r.Id)}
 				}
 			}
 		}
 	}
+	for i := range d.Resources {
+		// System generated resource id
+		if d.Resources[i].Id == "" {
+			d.Resources[i].Id, err = c.newResourceID(d.Tenant)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	// Get the stored device
-	sd, err := c.storage.get(id)
+	sd, err := c.storage.get(d.Tenant, id)
 	if err != nil {
 		return err
 	}
+	if err := c.ownership.CheckModify(user, sd.Owner, sd.OwnerGroups); err != nil {
+		return &ForbiddenError{err.Error()}
+	}
+	owner, ownerGroups, err := c.ownership.Transfer(user, sd.Owner, sd.OwnerGroups, d.Owner, d.OwnerGroups)
+	if err != nil {
+		return &ForbiddenError{err.Error()}
+	}
 
 	// Partially deep copy
 	var cp Device = *sd
@@ -150,19 +227,18 @@ func (c *Controller) update(id string, d Device) error {
 	sd.Meta = d.Meta
 	sd.Ttl = d.Ttl
 	sd.Updated = time.Now().UTC()
+	sd.Stale = false
 	if sd.Ttl == 0 {
 		sd.Expires = nil
 	} else {
 		expires := sd.Updated.Add(time.Duration(sd.Ttl) * time.Second)
 		sd.Expires = &expires
 	}
+	sd.Owner = owner
+	sd.OwnerGroups = ownerGroups
 	sd.Resources = d.Resources
 
 	for i := range sd.Resources {
-		// System generated resource id
-		if sd.Resources[i].Id == "" {
-			sd.Resources[i].Id = c.newResourceURN()
-		}
 		sd.Resources[i].URL = fmt.Sprintf("%s/%s/%s", c.apiLocation, TypeResources, sd.Resources[i].Id)
 		sd.Resources[i].Type = ApiResourceType
 		sd.Resources[i].Device = sd.URL
@@ -178,19 +254,26 @@ func (c *Controller) update(id string, d Device) error {
 	c.removeIndices(&cp)
 	c.addIndices(sd)
 
+	c.eventLog.Append(catalog.EventUpdated, id, sd.simplify())
+
 	return nil
 }
 
-func (c *Controller) delete(id string) error {
+func (c *Controller) delete(tenant, id string, user *validator.UserProfile) (err error) {
+	defer func() { observeOperation("delete", err) }()
+
 	c.Lock()
 	defer c.Unlock()
 
-	oldDevice, err := c.storage.get(id)
+	oldDevice, err := c.storage.get(tenant, id)
 	if err != nil {
 		return err
 	}
+	if err := c.ownership.CheckModify(user, oldDevice.Owner, oldDevice.OwnerGroups); err != nil {
+		return &ForbiddenError{err.Error()}
+	}
 
-	err = c.storage.delete(id)
+	err = c.storage.delete(tenant, id)
 	if err != nil {
 		return err
 	}
@@ -198,11 +281,90 @@ func (c *Controller) delete(id string) error {
 	// Remove secondary indices
 	c.removeIndices(oldDevice)
 
+	c.eventLog.Append(catalog.EventDeleted, id, oldDevice.simplify())
+
+	return nil
+}
+
+// Renews the registration of a device by extending its expiry time by the TTL
+// Unlike update, the device is neither validated nor re-indexed and no event is logged, unless the device was stale
+func (c *Controller) heartbeat(tenant, id string, user *validator.UserProfile) (err error) {
+	defer func() { observeOperation("heartbeat", err) }()
+
+	c.Lock()
+	defer c.Unlock()
+
+	d, err := c.storage.get(tenant, id)
+	if err != nil {
+		return err
+	}
+	if err := c.ownership.CheckModify(user, d.Owner, d.OwnerGroups); err != nil {
+		return &ForbiddenError{err.Error()}
+	}
+	if d.Ttl == 0 {
+		// Never expires
+		return nil
+	}
+
+	expires := time.Now().UTC().Add(time.Duration(d.Ttl) * time.Second)
+	d.Expires = &expires
+	stale := d.Stale
+	d.Stale = false
+
+	err = c.storage.update(id, d)
+	if err != nil {
+		return err
+	}
+
+	c.indexExpiry(d)
+
+	if stale {
+		c.eventLog.Append(catalog.EventUpdated, id, d.simplify())
+	}
+
 	return nil
 }
 
-func (c *Controller) list(page, perPage int) ([]SimpleDevice, int, error) {
-	devices, total, err := c.storage.list(page, perPage)
+// Returns the devices which expire within the given duration (including the stale ones) in the order of expiry
+func (c *Controller) expiring(tenant string, within time.Duration, page, perPage int) ([]SimpleDevice, int, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	// The stale devices have expired already, followed by the others
+	until := time.Now().UTC().Add(within)
+	var keys []string
+	for _, key := range append(c.staleExpiry.Before(until.Add(c.ttlPolicy.Grace())), c.expiry.Before(until)...) {
+		if t, _ := tenancy.SplitKey(key); tenancy.Matches(tenant, t) {
+			keys = append(keys, key)
+		}
+	}
+
+	// Pagination
+	offset, limit, err := catalog.GetPagingAttr(len(keys), page, perPage, MaxPerPage)
+	if err != nil {
+		return nil, 0, &BadRequestError{fmt.Sprintf("Unable to paginate: %s", err)}
+	}
+	devices := make([]SimpleDevice, 0, limit)
+	for _, key := range keys[offset : offset+limit] {
+		d, err := c.storage.get(tenancy.SplitKey(key))
+		if err != nil {
+			return nil, 0, err
+		}
+		devices = append(devices, *d.simplify())
+	}
+	return devices, len(keys), nil
+}
+
+// Checks that a user is allowed to register a device with the given ttl
+func (c *Controller) checkTTL(ttl uint, user string) error {
+	if err := c.ttlPolicy.CheckUser(ttl, user); err != nil {
+		return &BadRequestError{err.Error()}
+	}
+	return nil
+}
+
+func (c *Controller) list(tenant string, page, perPage int) ([]SimpleDevice, int, error) {
+	devices, total, err := c.storage.list(tenant, page, perPage)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -210,14 +372,16 @@ func (c *Controller) list(page, perPage int) ([]SimpleDevice, int, error) {
 	return devices.simplify(), total, nil
 }
 
-func (c *Controller) filter(path, op, value string, page, perPage int) ([]SimpleDevice, int, error) {
+func (c *Controller) filter(tenant, path, op, value string, page, perPage int) ([]SimpleDevice, int, error) {
+	defer metricFilterDuration.ObserveSince(time.Now(), TypeDevices)
+
 	c.RLock()
 	defer c.RUnlock()
 
 	matches := make([]SimpleDevice, 0)
 	pp := MaxPerPage
 	for p := 1; ; p++ {
-		slice, t, err := c.storage.list(p, pp)
+		slice, t, err := c.storage.list(tenant, p, pp)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -246,60 +410,140 @@ func (c *Controller) filter(path, op, value string, page, perPage int) ([]Simple
 	return matches[offset : offset+limit], len(matches), nil
 }
 
-func (c *Controller) total() (int, error) {
-	return c.storage.total()
+func (c *Controller) total(tenant string) (int, error) {
+	return c.storage.total(tenant)
 }
 
-func (c *Controller) cleanExpired() {
-	for t := range c.ticker.C {
-		c.Lock()
+// Returns the events following a position in the event log, waiting for new ones if there are none
+// Only the events of the devices of the given tenant (or all tenants) are returned
+func (c *Controller) events(ctx context.Context, tenant, epoch string, since uint64, wait time.Duration) (*EventCollection, error) {
+	logged, epoch, last, resync := c.eventLog.Since(ctx, epoch, since, wait)
 
-		var expiredList []Map
-		for m := range c.exp_did.Iter() {
-			if !m.(Map).key.(time.Time).After(t.UTC()) {
-				expiredList = append(expiredList, m.(Map))
-			} else {
-				// exp_did is sorted by time ascendingly: its elements expire in order
-				break
-			}
+	events := make([]Event, 0, len(logged))
+	for _, e := range logged {
+		if !tenancy.Matches(tenant, e.Object.(*SimpleDevice).Tenant) {
+			continue
 		}
+		events = append(events, Event{
+			Seq:    e.Seq,
+			Type:   e.Type,
+			Id:     e.Id,
+			Device: e.Object.(*SimpleDevice),
+		})
+	}
+	return &EventCollection{
+		Type:   ApiEventCollectionType,
+		Epoch:  epoch,
+		Last:   last,
+		Resync: resync,
+		Events: events,
+	}, nil
+}
 
-		for _, m := range expiredList {
-			id := m.value.(string)
-			logger.Printf("cleanExpired() Registration %v has expired\n", id)
+// Handles the devices which have expired at the given time: marks them as stale during the grace period
+// or removes them, and removes the stale devices at the end of the grace period
+// Called by the expiry timer
+func (c *Controller) cleanExpired(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
 
-			oldDevice, err := c.storage.get(id)
-			if err != nil {
-				logger.Printf("cleanExpired() Error retrieving device %v: %v\n", id, err.Error())
-				break
-			}
+	for _, key := range c.expiry.PopExpired(now) {
+		tenant, id := tenancy.SplitKey(key)
+		d, err := c.storage.get(tenant, id)
+		if err != nil {
+			logger.Errorf("cleanExpired() Error retrieving device %v: %v", id, err.Error())
+			continue
+		}
 
-			err = c.storage.delete(id)
+		// Keep the device as stale during the grace period
+		if d.Expires.Add(c.ttlPolicy.Grace()).After(now) {
+			logger.Infof("cleanExpired() Registration %v has expired and is stale", id)
+			d.Stale = true
+			err = c.storage.update(id, d)
 			if err != nil {
-				logger.Printf("cleanExpired() Error removing device %v: %v\n", id, err.Error())
-				break
+				logger.Errorf("cleanExpired() Error updating device %v: %v", id, err.Error())
+				continue
 			}
-			// Remove secondary indices
-			c.removeIndices(oldDevice)
+			c.indexExpiry(d)
+			c.eventLog.Append(catalog.EventUpdated, id, d.simplify())
+			continue
+		}
+		c.removeExpired(d)
+	}
+
+	for _, key := range c.staleExpiry.PopExpired(now) {
+		tenant, id := tenancy.SplitKey(key)
+		d, err := c.storage.get(tenant, id)
+		if err != nil {
+			logger.Errorf("cleanExpired() Error retrieving device %v: %v", id, err.Error())
+			continue
 		}
+		c.removeExpired(d)
+	}
+}
+
+// Removes an expired device
+// WARNING: the caller must obtain the lock before calling
+func (c *Controller) removeExpired(d *Device) {
+	logger.Infof("cleanExpired() Registration %v has expired", d.Id)
 
-		c.Unlock()
+	err := c.storage.delete(d.Tenant, d.Id)
+	if err != nil {
+		logger.Errorf("cleanExpired() Error removing device %v: %v", d.Id, err.Error())
+		return
 	}
+	// Remove secondary indices
+	c.removeIndices(d)
+
+	c.eventLog.Append(catalog.EventDeleted, d.Id, d.simplify())
+	metricExpired.Inc()
+}
+
+// Returns the earliest expiry time of a device or removal time of a stale device
+func (c *Controller) nextExpiry() (time.Time, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	next, found := c.expiry.Next()
+	if removal, ok := c.staleExpiry.Next(); ok && (!found || removal.Before(next)) {
+		return removal, true
+	}
+	return next, found
+}
+
+// THING DESCRIPTIONS
+
+func (c *Controller) getThingDescription(tenant, id string) (*ThingDescription, error) {
+	d, err := c.storage.get(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.thingDescription(), nil
+}
+
+func (c *Controller) listThingDescriptions(tenant string, page, perPage int) ([]ThingDescription, int, error) {
+	devices, total, err := c.storage.list(tenant, page, perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return devices.thingDescriptions(), total, nil
 }
 
 // RESOURCES
 
-func (c *Controller) getResource(id string) (*Resource, error) {
+func (c *Controller) getResource(tenant, id string) (*Resource, error) {
 	c.RLock()
 	defer c.RUnlock()
 
-	res := c.rid_did.Find(Map{key: id})
+	res := c.findResource(tenant, id)
 	if res == nil {
 		return nil, &NotFoundError{"Resource not found"}
 	}
 	deviceID := res.(Map).value.(string)
 
-	device, err := c.storage.get(deviceID)
+	device, err := c.storage.get(tenant, deviceID)
 	if err != nil {
 		return nil, err
 	}
@@ -314,19 +558,20 @@ func (c *Controller) getResource(id string) (*Resource, error) {
 
 }
 
-func (c *Controller) listResources(page, perPage int) ([]Resource, int, error) {
+func (c *Controller) listResources(tenant string, page, perPage int) ([]Resource, int, error) {
 	c.RLock()
 	defer c.RUnlock()
 
-	total := c.rid_did.Len()
-
-	// Retrieve resourceID->deviceID (s) from the tree
-	resourceIDs := make([]string, total)
-	deviceIDs := make([]string, total)
-	for i, x := range c.rid_did.Data() {
-		resourceIDs[i] = x.(Map).key.(string)
-		deviceIDs[i] = x.(Map).value.(string)
+	// Retrieve resourceID->deviceID (s) from the trees, ordered by tenant
+	var tenants, resourceIDs, deviceIDs []string
+	for _, t := range c.resourceTenants(tenant) {
+		for _, x := range c.rid_did[t].Data() {
+			tenants = append(tenants, t)
+			resourceIDs = append(resourceIDs, x.(Map).key.(string))
+			deviceIDs = append(deviceIDs, x.(Map).value.(string))
+		}
 	}
+	total := len(resourceIDs)
 	// Pagination
 	offset, limit, err := catalog.GetPagingAttr(total, page, perPage, MaxPerPage)
 	if err != nil {
@@ -342,17 +587,17 @@ func (c *Controller) listResources(page, perPage int) ([]Resource, int, error) {
 	devices := make(map[string]*Device)
 	resources := make([]Resource, 0)
 	for i := offset; i < offset+limit; i++ {
-		did := deviceIDs[i]
+		key := tenancy.Key(tenants[i], deviceIDs[i])
 		rid := resourceIDs[i]
 
 		var err error
-		d, exists := devices[did]
+		d, exists := devices[key]
 		if !exists {
-			d, err = c.storage.get(did)
+			d, err = c.storage.get(tenants[i], deviceIDs[i])
 			if err != nil {
 				return nil, total, err
 			}
-			devices[did] = d
+			devices[key] = d
 		}
 
 		for r := range d.Resources {
@@ -365,36 +610,40 @@ func (c *Controller) listResources(page, perPage int) ([]Resource, int, error) {
 	return resources, total, nil
 }
 
-func (c *Controller) filterResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
+func (c *Controller) filterResources(tenant, path, op, value string, page, perPage int) ([]Resource, int, error) {
+	defer metricFilterDuration.ObserveSince(time.Now(), TypeResources)
+
 	c.RLock()
 	defer c.RUnlock()
 
 	// Retrieve resources from devices
-	devices := make(map[string]*Device)
 	matches := make([]Resource, 0)
-	for x := range c.rid_did.Iter() {
-		resourceID := x.(Map).key.(string)
-		deviceID := x.(Map).value.(string)
-
-		var err error
-		d, exists := devices[deviceID]
-		if !exists {
-			d, err = c.storage.get(deviceID)
-			if err != nil {
-				return nil, 0, err
-			}
-			devices[deviceID] = d
-		}
-
-		for i := range d.Resources {
-			if d.Resources[i].Id == resourceID {
-
-				matched, err := catalog.MatchObject(d.Resources[i], strings.Split(path, "."), op, value)
+	for _, t := range c.resourceTenants(tenant) {
+		devices := make(map[string]*Device)
+		for _, x := range c.rid_did[t].Data() {
+			resourceID := x.(Map).key.(string)
+			deviceID := x.(Map).value.(string)
+
+			var err error
+			d, exists := devices[deviceID]
+			if !exists {
+				d, err = c.storage.get(t, deviceID)
 				if err != nil {
 					return nil, 0, err
 				}
-				if matched {
-					matches = append(matches, d.Resources[i])
+				devices[deviceID] = d
+			}
+
+			for i := range d.Resources {
+				if d.Resources[i].Id == resourceID {
+
+					matched, err := catalog.MatchObject(d.Resources[i], strings.Split(path, "."), op, value)
+					if err != nil {
+						return nil, 0, err
+					}
+					if matched {
+						matches = append(matches, d.Resources[i])
+					}
 				}
 			}
 		}
@@ -408,47 +657,64 @@ func (c *Controller) filterResources(path, op, value string, page, perPage int)
 	return matches[offset : offset+limit], len(matches), nil
 }
 
-func (c *Controller) totalResources() (int, error) {
+func (c *Controller) totalResources(tenant string) (int, error) {
 	c.RLock()
 	defer c.RUnlock()
 
-	return c.rid_did.Len(), nil
+	total := 0
+	for _, t := range c.resourceTenants(tenant) {
+		total += c.rid_did[t].Len()
+	}
+	return total, nil
 }
 
 // Stop the controller
 func (c *Controller) Stop() error {
-	c.ticker.Stop()
+	c.expiryTimer.Stop()
 	return c.storage.Close()
 }
 
 // UTILITY FUNCTIONS
 
+// Applies the TTL policy to a device: sets the default ttl and checks its bounds
+func (c *Controller) applyTTLPolicy(d *Device) error {
+	d.Ttl = c.ttlPolicy.TTL(d.Ttl)
+	if err := c.ttlPolicy.Check(d.Ttl); err != nil {
+		return &BadRequestError{err.Error()}
+	}
+	return nil
+}
+
 // Sorting operators
 func (s Resources) Len() int           { return len(s) }
 func (s Resources) Less(i, j int) bool { return s[i].Id < s[j].Id }
 func (s Resources) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
-// Generate a new unique urn for device
-// Format: urn:ls_device:id, where id is the timestamp(s) of the controller startTime+counter in hex
+// Generate a new unique id for device, e.g. urn:ls_device:id (see catalog.IDGenerator)
 // WARNING: the caller must obtain the lock before calling
-func (c *Controller) newDeviceURN() string {
-	c.counter++
-	return fmt.Sprintf("urn:ls_device:%x", c.startTime+c.counter)
+func (c *Controller) newDeviceID(tenant string) (string, error) {
+	return catalog.NewUniqueID(c.idGenerator, "device", func(id string) (bool, error) {
+		_, err := c.storage.get(tenant, id)
+		if _, notFound := err.(*NotFoundError); notFound {
+			return false, nil
+		}
+		return err == nil, err
+	})
 }
 
-// Generate a new unique urn for resource
-// Format: urn:ls_resource:id, where id is the timestamp(s) of the controller startTime+counter in hex
+// Generate a new unique id for resource, e.g. urn:ls_resource:id (see catalog.IDGenerator)
 // WARNING: the caller must obtain the lock before calling
-func (c *Controller) newResourceURN() string {
-	c.counter++
-	return fmt.Sprintf("urn:ls_resource:%x", c.startTime+c.counter)
+func (c *Controller) newResourceID(tenant string) (string, error) {
+	return catalog.NewUniqueID(c.idGenerator, "resource", func(id string) (bool, error) {
+		return c.findResource(tenant, id) != nil, nil
+	})
 }
 
 // Initialize secondary indices (from a persistent storage backend)
 func (c *Controller) initIndices() error {
 	perPage := MaxPerPage
 	for page := 1; ; page++ {
-		devices, total, err := c.storage.list(page, perPage)
+		devices, total, err := c.storage.list(tenancy.All, page, perPage)
 		if err != nil {
 			return err
 		}
@@ -467,50 +733,83 @@ func (c *Controller) initIndices() error {
 // Creates secondary indices
 // WARNING: the caller must obtain the lock before calling
 func (c *Controller) addIndices(d *Device) {
+	if len(d.Resources) > 0 && c.rid_did[d.Tenant] == nil {
+		c.rid_did[d.Tenant] = avl.New(stringKeys, 0)
+	}
 	for _, r := range d.Resources {
-		c.rid_did.Add(Map{r.Id, d.Id})
+		c.rid_did[d.Tenant].Add(Map{r.Id, d.Id})
 	}
 
 	// Add expiry time index
-	if d.Ttl != 0 {
-		c.exp_did.Add(Map{*d.Expires, d.Id})
-	}
+	c.indexExpiry(d)
 }
 
 // Removes secondary indices
 // WARNING: the caller must obtain the lock before calling
 func (c *Controller) removeIndices(d *Device) {
 	// Remove resource indices
-	for _, r := range d.Resources {
-		c.rid_did.Remove(Map{key: r.Id})
+	if resources, found := c.rid_did[d.Tenant]; found {
+		for _, r := range d.Resources {
+			resources.Remove(Map{key: r.Id})
+		}
+		if resources.Len() == 0 {
+			delete(c.rid_did, d.Tenant)
+		}
 	}
 
 	// Remove the expiry time index
-	// INFO:
-	// More than one device can have the same expiry time (i.e. map's key)
-	//	which leads to non-unique keys in the maps.
-	// This code removes keys with that expiry time (keeping them in a temp) until the
-	// 	desired target is reached. It then adds the items in the temp back to the tree.
-	if d.Ttl != 0 {
-		var temp []Map
-		for m := range c.exp_did.Iter() {
-			id := m.(Map).value.(string)
-			if id == d.Id {
-				for { // go through all duplicates (same expiry times)
-					r := c.exp_did.Remove(m)
-					if r == nil {
-						break
-					}
-					if id != d.Id {
-						temp = append(temp, r.(Map))
-					}
-				}
-				break
-			}
-		}
-		for _, r := range temp {
-			c.exp_did.Add(r)
+	key := tenancy.Key(d.Tenant, d.Id)
+	c.expiry.Remove(key)
+	c.staleExpiry.Remove(key)
+}
+
+// Finds the resourceID->deviceID node of a resource of a tenant
+// WARNING: the caller must obtain the lock before calling
+func (c *Controller) findResource(tenant, id string) interface{} {
+	resources, found := c.rid_did[tenant]
+	if !found {
+		return nil
+	}
+	return resources.Find(Map{key: id})
+}
+
+// Returns the sorted tenants with resources selected by a tenant (or all tenants)
+// WARNING: the caller must obtain the lock before calling
+func (c *Controller) resourceTenants(tenant string) []string {
+	if tenant != tenancy.All {
+		if _, found := c.rid_did[tenant]; found {
+			return []string{tenant}
 		}
+		return nil
+	}
+	tenants := make([]string, 0, len(c.rid_did))
+	for t := range c.rid_did {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Indexes the expiry time of a device, or its removal time if it is stale
+// WARNING: the caller must obtain the lock before calling
+func (c *Controller) indexExpiry(d *Device) {
+	key := tenancy.Key(d.Tenant, d.Id)
+	c.expiry.Remove(key)
+	c.staleExpiry.Remove(key)
+	if d.Ttl == 0 {
+		// Never expires
+		return
+	}
+
+	index, t := c.expiry, *d.Expires
+	if d.Stale {
+		index, t = c.staleExpiry, t.Add(c.ttlPolicy.Grace())
+	}
+	index.Set(key, t)
+
+	// Wake up the timer if the device is the next to expire (not started yet while initializing the indices)
+	if next, _ := index.Next(); next.Equal(t) && c.expiryTimer != nil {
+		c.expiryTimer.Reset()
 	}
 }
 
@@ -531,13 +830,3 @@ func stringKeys(a interface{}, b interface{}) int {
 	}
 	return 0
 }
-
-// Operator for Time-type key
-func timeKeys(a interface{}, b interface{}) int {
-	if a.(Map).key.(time.Time).Before(b.(Map).key.(time.Time)) {
-		return -1
-	} else if a.(Map).key.(time.Time).After(b.(Map).key.(time.Time)) {
-		return 1
-	}
-	return 0
-}
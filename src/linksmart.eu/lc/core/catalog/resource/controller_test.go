@@ -3,6 +3,7 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
@@ -11,12 +12,19 @@ import (
 
 	"github.com/pborman/uuid"
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/core/logging"
+	"linksmart.eu/lc/sec/auth/validator"
 	"time"
 )
 
 // DEVICES
 
 func setup() (CatalogController, func(), error) {
+	return setupWithOptions(ControllerOptions{})
+}
+
+func setupWithOptions(options ControllerOptions) (CatalogController, func(), error) {
 	var (
 		storage CatalogStorage
 		err     error
@@ -33,7 +41,7 @@ func setup() (CatalogController, func(), error) {
 		}
 	}
 
-	controller, err := NewController(storage, TestApiLocation)
+	controller, err := NewControllerWithOptions(storage, TestApiLocation, options)
 	if err != nil {
 		storage.Close()
 		return nil, nil, err
@@ -60,7 +68,7 @@ func TestControllerAdd(t *testing.T) {
 		Ttl:  100,
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error on add: %v", err.Error())
 	}
@@ -68,7 +76,7 @@ func TestControllerAdd(t *testing.T) {
 		t.Fatalf("User defined ID is not returned. Getting %v instead of %v\n", id, d.Id)
 	}
 
-	_, err = controller.add(d)
+	_, err = controller.add(d, nil)
 	if err == nil {
 		t.Error("Didn't get any error when adding a service with non-unique id.")
 	}
@@ -79,7 +87,7 @@ func TestControllerAdd(t *testing.T) {
 		Ttl:  100,
 	}
 
-	id, err = controller.add(d2)
+	id, err = controller.add(d2, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error on add: %v", err.Error())
 	}
@@ -103,12 +111,12 @@ func TestControllerGet(t *testing.T) {
 		Ttl:         100,
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatal("Error adding a device:", err.Error())
 	}
 
-	sd, err := controller.get(id)
+	sd, err := controller.get(tenancy.Default, id)
 	if err != nil {
 		t.Fatal("Error retrieving device:", err.Error())
 	}
@@ -123,7 +131,7 @@ func TestControllerGet(t *testing.T) {
 		t.Fatalf("Added and retrieved devices are not equal:\n Added:\n%v\n Retrieved:\n%v\n", *d.simplify(), *sd)
 	}
 
-	_, err = controller.get("some_id")
+	_, err = controller.get(tenancy.Default, "some_id")
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -151,7 +159,7 @@ func TestControllerUpdate(t *testing.T) {
 		Ttl:         100,
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatal("Error adding a device:", err.Error())
 	}
@@ -164,12 +172,12 @@ func TestControllerUpdate(t *testing.T) {
 	d.Description = "changed"
 	d.Ttl = 110
 
-	err = controller.update(d.Id, d)
+	err = controller.update(d.Id, d, nil)
 	if err != nil {
 		t.Fatal("Error updating device:", err.Error())
 	}
 
-	sd, err := controller.get(id)
+	sd, err := controller.get(tenancy.Default, id)
 	if err != nil {
 		t.Fatal("Error retrieving device:", err.Error())
 	}
@@ -198,17 +206,17 @@ func TestControllerDelete(t *testing.T) {
 		Ttl:         100,
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatal("Error adding a device:", err.Error())
 	}
 
-	err = controller.delete(id)
+	err = controller.delete(tenancy.Default, id, nil)
 	if err != nil {
 		t.Fatal("Error deleting device:", err.Error())
 	}
 
-	err = controller.delete(id)
+	err = controller.delete(tenancy.Default, id, nil)
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -220,7 +228,7 @@ func TestControllerDelete(t *testing.T) {
 		t.Fatal("No error when deleting a deleted device:", err.Error())
 	}
 
-	_, err = controller.get(id)
+	_, err = controller.get(tenancy.Default, id)
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -249,11 +257,11 @@ func TestControllerList(t *testing.T) {
 			Description: "description",
 		}
 
-		id, err := controller.add(d)
+		id, err := controller.add(d, nil)
 		if err != nil {
 			t.Fatal("Error adding a device:", err.Error())
 		}
-		sd, err := controller.get(id)
+		sd, err := controller.get(tenancy.Default, id)
 		if err != nil {
 			t.Fatal("Error retrieving device:", err.Error())
 		}
@@ -264,7 +272,7 @@ func TestControllerList(t *testing.T) {
 	var catalogedDevices []SimpleDevice
 	perPage := 3
 	for page := 1; ; page++ {
-		devicesInPage, total, err := controller.list(page, perPage)
+		devicesInPage, total, err := controller.list(tenancy.Default, page, perPage)
 		if err != nil {
 			t.Fatal("Error getting list of devices:", err.Error())
 		}
@@ -313,7 +321,7 @@ func TestControllerFilter(t *testing.T) {
 			Description: "description",
 		}
 
-		_, err := controller.add(d)
+		_, err := controller.add(d, nil)
 		if err != nil {
 			t.Fatal("Error adding a device:", err.Error())
 		}
@@ -323,14 +331,14 @@ func TestControllerFilter(t *testing.T) {
 		Name:        "my_device",
 		Meta:        map[string]interface{}{"k": "v"},
 		Description: "interesting",
-	})
+	}, nil)
 	controller.add(Device{
 		Name:        "my_device",
 		Meta:        map[string]interface{}{"k": "v"},
 		Description: "interesting",
-	})
+	}, nil)
 
-	devices, total, err := controller.filter("description", "equals", "interesting", 1, 10)
+	devices, total, err := controller.filter(tenancy.Default, "description", "equals", "interesting", 1, 10)
 	if err != nil {
 		t.Fatal("Error filtering devices:", err.Error())
 	}
@@ -357,13 +365,13 @@ func TestControllerTotal(t *testing.T) {
 			Name: "my_device",
 		}
 
-		_, err := controller.add(d)
+		_, err := controller.add(d, nil)
 		if err != nil {
 			t.Fatal("Error adding a device:", err.Error())
 		}
 	}
 
-	total, err := controller.total()
+	total, err := controller.total(tenancy.Default)
 	if err != nil {
 		t.Fatal("Error getting total of devices:", err.Error())
 	}
@@ -391,7 +399,7 @@ func TestControllerCleanExpired(t *testing.T) {
 		},
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatal("Error adding a device:", err.Error())
 	}
@@ -400,7 +408,7 @@ func TestControllerCleanExpired(t *testing.T) {
 	time.Sleep(6 * time.Second)
 
 	checkingTime := time.Now()
-	dd, err := controller.get(id)
+	dd, err := controller.get(tenancy.Default, id)
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -419,7 +427,7 @@ func TestControllerCleanExpired(t *testing.T) {
 	}
 
 	// Make sure that resource is removed
-	_, err = controller.getResource("my_resource_id")
+	_, err = controller.getResource(tenancy.Default, "my_resource_id")
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -432,8 +440,527 @@ func TestControllerCleanExpired(t *testing.T) {
 	}
 }
 
+func TestControllerHeartbeat(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setup()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	var d = Device{
+		Name: "my_device",
+		Ttl:  30,
+		Resources: []Resource{
+			Resource{
+				Id:        "my_resource_id",
+				Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
+			},
+		},
+	}
+	id, err := controller.add(d, nil)
+	if err != nil {
+		t.Fatal("Error adding a device:", err.Error())
+	}
+	added, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the device:", err.Error())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	err = controller.heartbeat(tenancy.Default, id, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error on heartbeat: %v", err)
+	}
+
+	renewed, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the device:", err.Error())
+	}
+	if !renewed.Expires.After(*added.Expires) {
+		t.Errorf("Expected the expiry time to be extended, got %v (was %v)", renewed.Expires, added.Expires)
+	}
+	if !renewed.Updated.Equal(added.Updated) {
+		t.Errorf("Expected the update time to remain %v, got %v", added.Updated, renewed.Updated)
+	}
+	if len(renewed.Resources) != 1 {
+		t.Errorf("Expected the resources to remain, got %v", renewed.Resources)
+	}
+
+	// The expiry index holds the new expiry time only
+	c := controller.(*Controller)
+	if expires, _ := c.expiry.Get(id); c.expiry.Len() != 1 || !expires.Equal(*renewed.Expires) {
+		t.Errorf("Expected the expiry index to hold %v, got %v", renewed.Expires, expires)
+	}
+
+	err = controller.heartbeat(tenancy.Default, "unknown", nil)
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("Expected NotFoundError for an unknown device, got %v", err)
+	}
+}
+
+func TestControllerTTLPolicy(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{MinTTL: 10, MaxTTL: 100, DefaultTTL: 60, ForbidNoExpiry: []string{"guest"}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	// Default ttl
+	id, err := controller.add(Device{Name: "my_device"}, nil)
+	if err != nil {
+		t.Fatal("Error adding a device:", err.Error())
+	}
+	d, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the device:", err.Error())
+	}
+	if d.Ttl != 60 || d.Expires == nil {
+		t.Errorf("Expected the default ttl of 60 with an expiry time, got %d and %v", d.Ttl, d.Expires)
+	}
+
+	// Bounds
+	for _, ttl := range []uint{5, 101} {
+		_, err = controller.add(Device{Name: "my_device", Ttl: ttl}, nil)
+		if _, ok := err.(*BadRequestError); !ok {
+			t.Errorf("Expected BadRequestError for ttl %d, got %v", ttl, err)
+		}
+		err = controller.update(id, Device{Name: "my_device", Ttl: ttl}, nil)
+		if _, ok := err.(*BadRequestError); !ok {
+			t.Errorf("Expected BadRequestError when updating to ttl %d, got %v", ttl, err)
+		}
+	}
+
+	// Non-expiring registrations are replaced by the default ttl
+	if err := controller.checkTTL(0, "guest"); err != nil {
+		t.Errorf("Expected the default ttl to be allowed, got %v", err)
+	}
+}
+
+func TestControllerForbidNoExpiry(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{ForbidNoExpiry: []string{"guest"}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	if _, ok := controller.checkTTL(0, "guest").(*BadRequestError); !ok {
+		t.Error("Expected BadRequestError for a non-expiring registration of a forbidden user")
+	}
+	if err := controller.checkTTL(30, "guest"); err != nil {
+		t.Errorf("Expected an expiring registration to be allowed, got %v", err)
+	}
+	if err := controller.checkTTL(0, "admin"); err != nil {
+		t.Errorf("Expected a non-expiring registration of another user to be allowed, got %v", err)
+	}
+}
+
+func TestControllerStale(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{GracePeriod: 60},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	id, err := controller.add(Device{Name: "my_device", Ttl: 1}, nil)
+	if err != nil {
+		t.Fatal("Error adding a device:", err.Error())
+	}
+
+	time.Sleep(6 * time.Second)
+
+	d, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatalf("Expected the expired device to be kept during the grace period, got %v", err)
+	}
+	if !d.Stale {
+		t.Error("Expected the expired device to be stale")
+	}
+	// Events following the registration
+	coll, _ := controller.events(context.Background(), tenancy.Default, "", 0, 0)
+	coll, _ = controller.events(context.Background(), tenancy.Default, coll.Epoch, 1, 0)
+	if len(coll.Events) != 1 || coll.Events[0].Type != utils.EventUpdated || !coll.Events[0].Device.Stale {
+		t.Errorf("Expected an update event of the stale device, got %+v", coll.Events)
+	}
+
+	// Renewed by a heartbeat
+	err = controller.heartbeat(tenancy.Default, id, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error on heartbeat: %v", err)
+	}
+	d, err = controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the device:", err.Error())
+	}
+	if d.Stale {
+		t.Error("Expected the device to be no longer stale after a heartbeat")
+	}
+}
+
+func TestControllerExpiring(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setup()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	for _, d := range []Device{
+		{Id: "late", Ttl: 300},
+		{Id: "never"},
+		{Id: "soon", Ttl: 30},
+		{Id: "sooner", Ttl: 20},
+	} {
+		if _, err := controller.add(d, nil); err != nil {
+			t.Fatal("Error adding a device:", err.Error())
+		}
+	}
+
+	devices, total, err := controller.expiring(tenancy.Default, 60*time.Second, 1, MaxPerPage)
+	if err != nil {
+		t.Fatal("Error listing expiring devices:", err.Error())
+	}
+	if total != 2 || len(devices) != 2 || devices[0].Id != "sooner" || devices[1].Id != "soon" {
+		t.Errorf("Expected devices sooner and soon, got %d: %v", total, devices)
+	}
+
+	devices, total, err = controller.expiring(tenancy.Default, 60*time.Second, 2, 1)
+	if err != nil {
+		t.Fatal("Error listing expiring devices:", err.Error())
+	}
+	if total != 2 || len(devices) != 1 || devices[0].Id != "soon" {
+		t.Errorf("Expected the second page to hold soon, got %d: %v", total, devices)
+	}
+}
+
+func TestImportThingDescriptionTTL(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{ForbidNoExpiry: []string{"guest"}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	id, err := controller.add(Device{Id: "lamp_1", Name: "Lamp", Ttl: 100}, nil)
+	if err != nil {
+		t.Fatal("Error adding a device:", err.Error())
+	}
+
+	// The stored ttl is kept unless the TD provides one
+	for _, c := range []struct{ ttl, expected uint }{{0, 100}, {50, 50}} {
+		td := &ThingDescription{Id: id, Title: "Lamp", Ttl: c.ttl}
+		if _, err := importThingDescription(controller, tenancy.Default, td, nil); err != nil {
+			t.Fatal("Error importing the Thing Description:", err.Error())
+		}
+		sd, err := controller.get(tenancy.Default, id)
+		if err != nil {
+			t.Fatal("Error retrieving device:", err.Error())
+		}
+		if sd.Ttl != c.expected || sd.Expires == nil {
+			t.Errorf("Expected ttl %d with an expiry after importing a TD with ttl %d, got %d and %v", c.expected, c.ttl, sd.Ttl, sd.Expires)
+		}
+	}
+
+	// The ttl to be stored is checked against the policy
+	for _, c := range []struct {
+		td      ThingDescription
+		allowed bool
+	}{
+		{ThingDescription{Id: id}, true},
+		{ThingDescription{Id: "lamp_2"}, false},
+		{ThingDescription{Id: "lamp_2", Ttl: 30}, true},
+		{ThingDescription{}, false},
+	} {
+		ttl := importedTTL(controller, tenancy.Default, &c.td)
+		if err := controller.checkTTL(ttl, "guest"); (err == nil) != c.allowed {
+			t.Errorf("Expected the import of %+v by guest to be allowed: %t, got %v", c.td, c.allowed, err)
+		}
+	}
+}
+
+// Expires one device among n registered devices per operation
+func BenchmarkControllerCleanExpired(b *testing.B) {
+	// Silence the logging of expired registrations
+	logging.SetLevel(logComponent, logging.WarnLevel)
+	defer logging.SetLevel(logComponent, logging.InfoLevel)
+
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("%s/n=%d", TestStorageType, n), func(b *testing.B) {
+			controller, shutdown, err := setup()
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+			defer shutdown()
+			c := controller.(*Controller)
+
+			for i := 0; i < n; i++ {
+				if _, err := c.add(Device{Ttl: 3600}, nil); err != nil {
+					b.Fatal("Error adding a device:", err.Error())
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id, err := c.add(Device{Ttl: 1}, nil)
+				if err != nil {
+					b.Fatal("Error adding a device:", err.Error())
+				}
+				c.cleanExpired(time.Now().UTC().Add(2 * time.Second))
+				if _, err := c.storage.get(tenancy.Default, id); err == nil {
+					b.Fatal("Expected the device to be removed")
+				}
+			}
+		})
+	}
+}
+
 // RESOURCES
 
+// Returns the given ids in sequence, to simulate collisions
+type sequenceIDGenerator struct {
+	ids []string
+}
+
+func (g *sequenceIDGenerator) NewID(kind string) (string, error) {
+	if len(g.ids) == 0 {
+		return "", fmt.Errorf("No more ids")
+	}
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return "urn:ls_" + kind + ":" + id, nil
+}
+
+func TestControllerIDGenerator(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		IDGenerator: &sequenceIDGenerator{ids: []string{"a", "r1", "a", "b", "r1", "r2"}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	id1, err := controller.add(Device{Name: "device_1", Resources: []Resource{{
+		Name:      "resource_1",
+		Protocols: []Protocol{{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
+	}}}, nil)
+	if err != nil {
+		t.Fatal("Unexpected error on add:", err.Error())
+	}
+	if id1 != "urn:ls_device:a" {
+		t.Errorf("Expected id urn:ls_device:a, got %s", id1)
+	}
+
+	// Generated ids which are in use are skipped
+	id2, err := controller.add(Device{Name: "device_2", Resources: []Resource{{
+		Name:      "resource_2",
+		Protocols: []Protocol{{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
+	}}}, nil)
+	if err != nil {
+		t.Fatal("Unexpected error on add:", err.Error())
+	}
+	if id2 != "urn:ls_device:b" {
+		t.Errorf("Expected id urn:ls_device:b, got %s", id2)
+	}
+	d, err := controller.get(tenancy.Default, id2)
+	if err != nil {
+		t.Fatal("Unexpected error on get:", err.Error())
+	}
+	if !strings.HasSuffix(d.Resources[0], "/urn:ls_resource:r2") {
+		t.Errorf("Expected resource id urn:ls_resource:r2, got %s", d.Resources[0])
+	}
+
+	// Errors of the generator are returned
+	if _, err := controller.add(Device{Name: "device_3"}, nil); err == nil {
+		t.Error("Expected an error when no id can be generated")
+	}
+}
+
+func TestControllerTenants(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setup()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	// The same ids in the default namespace and two tenants
+	for _, tenant := range []string{tenancy.Default, "site-a", "site-b"} {
+		_, err := controller.add(Device{
+			Id:     "device_1",
+			Tenant: tenant,
+			Name:   "device of " + tenant,
+			Ttl:    30,
+			Resources: []Resource{{
+				Id:        "device_1/resource_1",
+				Protocols: []Protocol{{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
+			}},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error adding the device of %q: %s", tenant, err)
+		}
+	}
+	if _, err := controller.add(Device{Name: "device_2", Tenant: "site-a"}, nil); err != nil {
+		t.Fatal("Unexpected error on add:", err.Error())
+	}
+
+	d, err := controller.get("site-b", "device_1")
+	if err != nil {
+		t.Fatal("Unexpected error on get:", err.Error())
+	}
+	if d.Tenant != "site-b" || d.Name != "device of site-b" {
+		t.Errorf("Expected the device of site-b, got %+v", d)
+	}
+	if _, err := controller.get("site-c", "device_1"); err == nil {
+		t.Error("Expected the device not to be found in another tenant")
+	}
+	if r, err := controller.getResource("site-a", "device_1/resource_1"); err != nil || r.Device != d.URL {
+		t.Errorf("Expected the resource of site-a, got %v (%v)", r, err)
+	}
+
+	// Scoped lists and counts
+	counts := map[string][2]int{
+		tenancy.Default: {1, 1},
+		"site-a":        {2, 1},
+		"site-b":        {1, 1},
+		"site-c":        {0, 0},
+		tenancy.All:     {4, 3},
+	}
+	for tenant, count := range counts {
+		if total, _ := controller.total(tenant); total != count[0] {
+			t.Errorf("Expected %d devices of %q, got %d", count[0], tenant, total)
+		}
+		if _, total, _ := controller.list(tenant, 1, 10); total != count[0] {
+			t.Errorf("Expected to list %d devices of %q, got %d", count[0], tenant, total)
+		}
+		if total, _ := controller.totalResources(tenant); total != count[1] {
+			t.Errorf("Expected %d resources of %q, got %d", count[1], tenant, total)
+		}
+		if _, total, _ := controller.listResources(tenant, 1, 10); total != count[1] {
+			t.Errorf("Expected to list %d resources of %q, got %d", count[1], tenant, total)
+		}
+		if _, total, _ := controller.expiring(tenant, time.Minute, 1, 10); total != count[1] {
+			t.Errorf("Expected %d devices of %q to expire, got %d", count[1], tenant, total)
+		}
+	}
+	if _, total, _ := controller.filter("site-a", "name", "prefix", "device", 1, 10); total != 2 {
+		t.Errorf("Expected to filter 2 devices of site-a, got %d", total)
+	}
+
+	// Updates and deletions stay within the tenant
+	err = controller.update("device_1", Device{Tenant: "site-a", Name: "updated"}, nil)
+	if err != nil {
+		t.Fatal("Unexpected error on update:", err.Error())
+	}
+	if d, _ := controller.get(tenancy.Default, "device_1"); d.Name != "device of " {
+		t.Errorf("Expected the device of the default namespace to be unchanged, got %s", d.Name)
+	}
+	if err := controller.delete("site-b", "device_1", nil); err != nil {
+		t.Fatal("Unexpected error on delete:", err.Error())
+	}
+	if _, err := controller.get("site-a", "device_1"); err != nil {
+		t.Error("Expected the device of site-a to remain:", err)
+	}
+
+	// Events of the tenant only
+	coll, _ := controller.events(context.Background(), "site-b", "", 0, 0)
+	coll, _ = controller.events(context.Background(), "site-b", coll.Epoch, 0, 0)
+	if len(coll.Events) != 2 || coll.Events[0].Type != utils.EventAdded || coll.Events[1].Type != utils.EventDeleted {
+		t.Errorf("Expected the events of site-b, got %+v", coll.Events)
+	}
+}
+
+func TestControllerOwnership(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{Ownership: utils.OwnershipPolicy{
+		Enabled:     true,
+		OwnerGroups: []string{"team-a", "team-b"},
+		AdminGroups: []string{"admins"},
+	}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	alice := &validator.UserProfile{Username: "alice", Groups: []string{"team-a", "staff"}}
+	bob := &validator.UserProfile{Username: "bob", Groups: []string{"team-a"}}
+	eve := &validator.UserProfile{Username: "eve", Groups: []string{"team-b"}}
+	root := &validator.UserProfile{Username: "root", Groups: []string{"admins"}}
+
+	id, err := controller.add(Device{Name: "device_1", Ttl: 30}, alice)
+	if err != nil {
+		t.Fatal("Unexpected error on add:", err.Error())
+	}
+	d, _ := controller.get(tenancy.Default, id)
+	if d.Owner != "alice" || !reflect.DeepEqual(d.OwnerGroups, []string{"team-a"}) {
+		t.Errorf("Expected the device to be owned by alice and team-a, got %s and %v", d.Owner, d.OwnerGroups)
+	}
+
+	// Members of the owner groups and admins may modify, others not
+	for user, allowed := range map[*validator.UserProfile]bool{alice: true, bob: true, root: true, eve: false, nil: false} {
+		err := controller.update(id, Device{Name: "updated", Ttl: 30}, user)
+		if _, forbidden := err.(*ForbiddenError); forbidden == allowed {
+			t.Errorf("Expected update by %v to be allowed: %t, got %v", user, allowed, err)
+		}
+		err = controller.heartbeat(tenancy.Default, id, user)
+		if _, forbidden := err.(*ForbiddenError); forbidden == allowed {
+			t.Errorf("Expected heartbeat by %v to be allowed: %t, got %v", user, allowed, err)
+		}
+	}
+	if err := controller.delete(tenancy.Default, id, eve); err == nil {
+		t.Error("Expected deletion by another user to be forbidden")
+	}
+	if d, _ := controller.get(tenancy.Default, id); d.Owner != "alice" {
+		t.Errorf("Expected updates to keep the owner, got %s", d.Owner)
+	}
+
+	// Creating entries of others
+	if _, err := controller.add(Device{Name: "device_2", Owner: "eve"}, alice); err == nil {
+		t.Error("Expected a registration owned by another user to be forbidden")
+	}
+	if _, err := controller.add(Device{Name: "device_2", OwnerGroups: []string{"team-b"}}, alice); err == nil {
+		t.Error("Expected a registration shared with a foreign group to be forbidden")
+	}
+	if _, err := controller.add(Device{Name: "device_2", Owner: "eve"}, root); err != nil {
+		t.Error("Expected admins to register devices of others, got", err)
+	}
+
+	// Transfer
+	if err := controller.update(id, Device{Name: "updated", Owner: "bob"}, bob); err == nil {
+		t.Error("Expected transfer by a member of the owner groups to be forbidden")
+	}
+	if err := controller.update(id, Device{Name: "updated", Owner: "eve", OwnerGroups: []string{}}, alice); err != nil {
+		t.Fatal("Unexpected error on transfer:", err.Error())
+	}
+	d, _ = controller.get(tenancy.Default, id)
+	if d.Owner != "eve" || len(d.OwnerGroups) != 0 {
+		t.Errorf("Expected the device to be transferred to eve, got %s and %v", d.Owner, d.OwnerGroups)
+	}
+	if err := controller.delete(tenancy.Default, id, alice); err == nil {
+		t.Error("Expected deletion by the previous owner to be forbidden")
+	}
+	if err := controller.delete(tenancy.Default, id, eve); err != nil {
+		t.Error("Unexpected error on delete:", err.Error())
+	}
+
+	// Anonymous registrations have no owner
+	id, _ = controller.add(Device{Name: "device_3"}, nil)
+	if err := controller.update(id, Device{Name: "updated"}, eve); err != nil {
+		t.Error("Expected a device without owner to be modifiable, got", err)
+	}
+}
+
 func TestControllerGetResources(t *testing.T) {
 	t.Log(TestStorageType)
 	controller, shutdown, err := setup()
@@ -459,12 +986,12 @@ func TestControllerGetResources(t *testing.T) {
 		},
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatal("Error adding a device:", err.Error())
 	}
 
-	resource, err := controller.getResource("my_resource_id")
+	resource, err := controller.getResource(tenancy.Default, "my_resource_id")
 	if err != nil {
 		t.Fatal("Error retrieving a resource:", err.Error())
 	}
@@ -478,7 +1005,7 @@ func TestControllerGetResources(t *testing.T) {
 	}
 
 	// Test NotFoundError
-	_, err = controller.getResource("some_id")
+	_, err = controller.getResource(tenancy.Default, "some_id")
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -491,11 +1018,11 @@ func TestControllerGetResources(t *testing.T) {
 	}
 
 	// Test deletion of resource
-	err = controller.delete(id)
+	err = controller.delete(tenancy.Default, id, nil)
 	if err != nil {
 		t.Fatal("Error deleting a device:", err.Error())
 	}
-	_, err = controller.getResource("my_resource_id")
+	_, err = controller.getResource(tenancy.Default, "my_resource_id")
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -536,7 +1063,7 @@ func TestControllerListResources(t *testing.T) {
 			},
 		}
 
-		id, err := controller.add(d)
+		id, err := controller.add(d, nil)
 		if err != nil {
 			t.Fatal("Error adding a device:", err.Error())
 		}
@@ -551,7 +1078,7 @@ func TestControllerListResources(t *testing.T) {
 	var catalogedResources []Resource
 	perPage := 4
 	for page := 1; ; page++ {
-		resourcesInPage, total, err := controller.listResources(page, perPage)
+		resourcesInPage, total, err := controller.listResources(tenancy.Default, page, perPage)
 		if err != nil {
 			t.Fatal("Error getting list of devices:", err.Error())
 		}
@@ -601,7 +1128,7 @@ func TestControllerFilterResources(t *testing.T) {
 					Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
 				},
 			},
-		})
+		}, nil)
 		if err != nil {
 			t.Fatal("Error adding a device:", err.Error())
 		}
@@ -614,7 +1141,7 @@ func TestControllerFilterResources(t *testing.T) {
 				Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
 			},
 		},
-	})
+	}, nil)
 	controller.add(Device{
 		Resources: []Resource{
 			Resource{
@@ -622,9 +1149,9 @@ func TestControllerFilterResources(t *testing.T) {
 				Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
 			},
 		},
-	})
+	}, nil)
 
-	resources, total, err := controller.filterResources("name", "prefix", "interesting", 1, 10)
+	resources, total, err := controller.filterResources(tenancy.Default, "name", "prefix", "interesting", 1, 10)
 	if err != nil {
 		t.Fatal("Error filtering resources:", err.Error())
 	}
@@ -654,13 +1181,13 @@ func TestControllerTotalResources(t *testing.T) {
 					Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": ""}}},
 				},
 			},
-		})
+		}, nil)
 		if err != nil {
 			t.Fatal("Error adding a device:", err.Error())
 		}
 	}
 
-	total, err := controller.totalResources()
+	total, err := controller.totalResources(tenancy.Default)
 	if err != nil {
 		t.Fatal("Error getting total of resources:", err.Error())
 	}
@@ -23,6 +23,11 @@ type BadRequestError struct{ s string }
 
 func (e *BadRequestError) Error() string { return e.s }
 
+// Forbidden (modification of an entry of another owner)
+type ForbiddenError struct{ s string }
+
+func (e *ForbiddenError) Error() string { return e.s }
+
 // Error describes an API error (serializable in JSON)
 type Error struct {
 	// Code is the (http) code of the error
@@ -39,7 +44,7 @@ func ErrorResponse(w http.ResponseWriter, code int, msgs ...string) {
 		msg,
 	}
 	if code >= 500 {
-		logger.Println("ERROR:", msg)
+		logger.Error(msg)
 	}
 	b, _ := json.Marshal(e)
 	w.Header().Set("Content-Type", "application/json;version="+ApiVersion)
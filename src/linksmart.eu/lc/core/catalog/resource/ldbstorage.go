@@ -10,8 +10,10 @@ import (
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
 )
 
 // LevelDB storage
@@ -43,14 +45,15 @@ func (s *LevelDBStorage) add(d *Device) error {
 		return err
 	}
 
-	_, err = s.db.Get([]byte(d.Id), nil)
+	key := []byte(tenancy.Key(d.Tenant, d.Id))
+	_, err = s.db.Get(key, nil)
 	if err == nil {
 		return &ConflictError{"Device id is not unique."}
 	} else if err != leveldb.ErrNotFound {
 		return err
 	}
 
-	err = s.db.Put([]byte(d.Id), bytes, nil)
+	err = s.db.Put(key, bytes, nil)
 	if err != nil {
 		return err
 	}
@@ -58,9 +61,9 @@ func (s *LevelDBStorage) add(d *Device) error {
 	return nil
 }
 
-func (s *LevelDBStorage) get(id string) (*Device, error) {
+func (s *LevelDBStorage) get(tenant, id string) (*Device, error) {
 
-	bytes, err := s.db.Get([]byte(id), nil)
+	bytes, err := s.db.Get([]byte(tenancy.Key(tenant, id)), nil)
 	if err == leveldb.ErrNotFound {
 		return nil, &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
 	} else if err != nil {
@@ -82,7 +85,7 @@ func (s *LevelDBStorage) update(id string, d *Device) error {
 	if err != nil {
 		return err
 	}
-	err = s.db.Put([]byte(id), bytes, nil)
+	err = s.db.Put([]byte(tenancy.Key(d.Tenant, id)), bytes, nil)
 	if err == leveldb.ErrNotFound {
 		return &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
 	} else if err != nil {
@@ -92,9 +95,9 @@ func (s *LevelDBStorage) update(id string, d *Device) error {
 	return nil
 }
 
-func (s *LevelDBStorage) delete(id string) error {
+func (s *LevelDBStorage) delete(tenant, id string) error {
 
-	err := s.db.Delete([]byte(id), nil)
+	err := s.db.Delete([]byte(tenancy.Key(tenant, id)), nil)
 	if err == leveldb.ErrNotFound {
 		return &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
 	} else if err != nil {
@@ -104,9 +107,9 @@ func (s *LevelDBStorage) delete(id string) error {
 	return nil
 }
 
-func (s *LevelDBStorage) list(page int, perPage int) (Devices, int, error) {
+func (s *LevelDBStorage) list(tenant string, page int, perPage int) (Devices, int, error) {
 
-	total, err := s.total()
+	total, err := s.total(tenant)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -119,7 +122,7 @@ func (s *LevelDBStorage) list(page int, perPage int) (Devices, int, error) {
 	// github.com/syndtr/goleveldb/leveldb/iterator
 	devices := make([]Device, limit)
 	s.wg.Add(1)
-	iter := s.db.NewIterator(nil, nil)
+	iter := s.db.NewIterator(keyRange(tenant), nil)
 	i := 0
 	for iter.Next() {
 		var d Device
@@ -145,10 +148,10 @@ func (s *LevelDBStorage) list(page int, perPage int) (Devices, int, error) {
 	return devices, total, nil
 }
 
-func (s *LevelDBStorage) total() (int, error) {
+func (s *LevelDBStorage) total(tenant string) (int, error) {
 	c := 0
 	s.wg.Add(1)
-	iter := s.db.NewIterator(nil, nil)
+	iter := s.db.NewIterator(keyRange(tenant), nil)
 	for iter.Next() {
 		c++
 	}
@@ -165,3 +168,9 @@ func (s *LevelDBStorage) Close() error {
 	s.wg.Wait()
 	return s.db.Close()
 }
+
+// Returns the range of the keys of a tenant (or all tenants)
+func keyRange(tenant string) *util.Range {
+	start, limit := tenancy.KeyRange(tenant)
+	return &util.Range{Start: start, Limit: limit}
+}
@@ -2,6 +2,13 @@
 
 package resource
 
+import (
+	"context"
+
+	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+)
+
 type LocalCatalogClient struct {
 	controller CatalogController
 }
@@ -14,37 +21,138 @@ func NewLocalCatalogClient(controller CatalogController) CatalogClient {
 
 // Adds a device and returns its id
 func (self *LocalCatalogClient) Add(r *Device) (string, error) {
-	return self.controller.add(*r)
+	return self.controller.add(*r, nil)
 }
 
 func (self *LocalCatalogClient) Update(id string, r *Device) error {
-	return self.controller.update(id, *r)
+	return self.controller.update(id, *r, nil)
 }
 
 func (self *LocalCatalogClient) Delete(id string) error {
-	return self.controller.delete(id)
+	return self.controller.delete(tenancy.Default, id, nil)
+}
+
+func (self *LocalCatalogClient) Heartbeat(id string) error {
+	return self.controller.heartbeat(tenancy.Default, id, nil)
 }
 
 func (self *LocalCatalogClient) Get(id string) (*SimpleDevice, error) {
-	return self.controller.get(id)
+	return self.controller.get(tenancy.Default, id)
 }
 
 func (self *LocalCatalogClient) List(page int, perPage int) ([]SimpleDevice, int, error) {
-	return self.controller.list(page, perPage)
+	return self.controller.list(tenancy.Default, page, perPage)
 }
 
 func (self *LocalCatalogClient) GetResource(id string) (*Resource, error) {
-	return self.controller.getResource(id)
+	return self.controller.getResource(tenancy.Default, id)
 }
 
 func (self *LocalCatalogClient) ListResources(page int, perPage int) ([]Resource, int, error) {
-	return self.controller.listResources(page, perPage)
+	return self.controller.listResources(tenancy.Default, page, perPage)
 }
 
 func (self *LocalCatalogClient) Filter(path, op, value string, page, perPage int) ([]SimpleDevice, int, error) {
-	return self.controller.filter(path, op, value, page, perPage)
+	return self.controller.filter(tenancy.Default, path, op, value, page, perPage)
 }
 
 func (self *LocalCatalogClient) FilterResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
-	return self.controller.filterResources(path, op, value, page, perPage)
+	return self.controller.filterResources(tenancy.Default, path, op, value, page, perPage)
+}
+
+func (self *LocalCatalogClient) ImportThingDescription(td *ThingDescription) (*ThingImportReport, error) {
+	return importThingDescription(self.controller, tenancy.Default, td, nil)
+}
+
+// Context variants
+// The local catalog is not reached over the network, the context is only checked before each call
+
+func (self *LocalCatalogClient) AddContext(ctx context.Context, r *Device) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return self.Add(r)
+}
+
+func (self *LocalCatalogClient) UpdateContext(ctx context.Context, id string, r *Device) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return self.Update(id, r)
+}
+
+func (self *LocalCatalogClient) DeleteContext(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return self.Delete(id)
+}
+
+func (self *LocalCatalogClient) HeartbeatContext(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return self.Heartbeat(id)
+}
+
+func (self *LocalCatalogClient) GetContext(ctx context.Context, id string) (*SimpleDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return self.Get(id)
+}
+
+func (self *LocalCatalogClient) ListContext(ctx context.Context, page int, perPage int) ([]SimpleDevice, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return self.List(page, perPage)
+}
+
+func (self *LocalCatalogClient) GetResourceContext(ctx context.Context, id string) (*Resource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return self.GetResource(id)
+}
+
+func (self *LocalCatalogClient) ListResourcesContext(ctx context.Context, page int, perPage int) ([]Resource, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return self.ListResources(page, perPage)
+}
+
+func (self *LocalCatalogClient) FilterContext(ctx context.Context, path, op, value string, page, perPage int) ([]SimpleDevice, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return self.Filter(path, op, value, page, perPage)
+}
+
+func (self *LocalCatalogClient) FilterResourcesContext(ctx context.Context, path, op, value string, page, perPage int) ([]Resource, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return self.FilterResources(path, op, value, page, perPage)
+}
+
+func (self *LocalCatalogClient) ImportThingDescriptionContext(ctx context.Context, td *ThingDescription) (*ThingImportReport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return self.ImportThingDescription(td)
+}
+
+func (self *LocalCatalogClient) Watch(ctx context.Context, filter WatchFilter) (<-chan Event, error) {
+	poll := func(ctx context.Context, epoch string, since uint64) (*EventCollection, error) {
+		return self.controller.events(ctx, tenancy.Default, epoch, since, catalog.DefaultEventWait)
+	}
+	list := func(ctx context.Context, page, perPage int) ([]SimpleDevice, int, error) {
+		if filter.Path != "" {
+			return self.FilterContext(ctx, filter.Path, filter.Op, filter.Value, page, perPage)
+		}
+		return self.ListContext(ctx, page, perPage)
+	}
+	return watch(ctx, filter, poll, list), nil
 }
@@ -4,22 +4,25 @@ package resource
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	avl "github.com/ancientlore/go-avltree"
 
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
 )
 
 // In-memory storage
 type MemoryStorage struct {
 	sync.RWMutex
-	devices *avl.Tree
+	// devices of each tenant
+	devices map[string]*avl.Tree
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	storage := &MemoryStorage{
-		devices: avl.New(operator, 0),
+		devices: make(map[string]*avl.Tree),
 	}
 
 	return storage
@@ -40,7 +43,12 @@ func (s *MemoryStorage) add(d *Device) error {
 	s.Lock()
 	defer s.Unlock()
 
-	_, duplicate := s.devices.Add(*d)
+	devices, found := s.devices[d.Tenant]
+	if !found {
+		devices = avl.New(operator, 0)
+		s.devices[d.Tenant] = devices
+	}
+	_, duplicate := devices.Add(*d)
 	if duplicate {
 		return &ConflictError{fmt.Sprintf("Device id %s is not unique", d.Id)}
 	}
@@ -48,11 +56,15 @@ func (s *MemoryStorage) add(d *Device) error {
 	return nil
 }
 
-func (s *MemoryStorage) get(id string) (*Device, error) {
+func (s *MemoryStorage) get(tenant, id string) (*Device, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	d := s.devices.Find(Device{Id: id})
+	devices, found := s.devices[tenant]
+	if !found {
+		return nil, &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
+	}
+	d := devices.Find(Device{Id: id})
 	if d == nil {
 		return nil, &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
 	}
@@ -65,33 +77,36 @@ func (s *MemoryStorage) update(id string, d *Device) error {
 	s.Lock()
 	defer s.Unlock()
 
-	r := s.devices.Remove(Device{Id: id})
-	if r == nil {
+	devices, found := s.devices[d.Tenant]
+	if !found || devices.Remove(Device{Id: id}) == nil {
 		return &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
 	}
 
-	s.devices.Add(*d)
+	devices.Add(*d)
 
 	return nil
 }
 
-func (s *MemoryStorage) delete(id string) error {
+func (s *MemoryStorage) delete(tenant, id string) error {
 	s.Lock()
 	defer s.Unlock()
 
-	r := s.devices.Remove(Device{Id: id})
-	if r == nil {
+	devices, found := s.devices[tenant]
+	if !found || devices.Remove(Device{Id: id}) == nil {
 		return &NotFoundError{fmt.Sprintf("Device with id %s is not found", id)}
 	}
+	if devices.Len() == 0 {
+		delete(s.devices, tenant)
+	}
 
 	return nil
 }
 
-func (s *MemoryStorage) list(page int, perPage int) (Devices, int, error) {
+func (s *MemoryStorage) list(tenant string, page int, perPage int) (Devices, int, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	total := s.devices.Len()
+	total := s.count(tenant)
 	offset, limit, err := catalog.GetPagingAttr(total, page, perPage, MaxPerPage)
 	if err != nil {
 		return nil, 0, &BadRequestError{fmt.Sprintf("Unable to paginate: %s", err)}
@@ -102,8 +117,12 @@ func (s *MemoryStorage) list(page int, perPage int) (Devices, int, error) {
 		return []Device{}, 0, nil
 	}
 
+	// Devices ordered by tenant, then id
+	var data []interface{}
+	for _, t := range s.tenants(tenant) {
+		data = append(data, s.devices[t].Data()...)
+	}
 	devices := make([]Device, limit)
-	data := s.devices.Data()
 	for i := 0; i < limit; i++ {
 		devices[i] = data[i+offset].(Device)
 	}
@@ -111,13 +130,40 @@ func (s *MemoryStorage) list(page int, perPage int) (Devices, int, error) {
 	return devices, total, nil
 }
 
-func (s *MemoryStorage) total() (int, error) {
+func (s *MemoryStorage) total(tenant string) (int, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.devices.Len(), nil
+	return s.count(tenant), nil
 }
 
 func (s *MemoryStorage) Close() error {
 	return nil
 }
+
+// Returns the number of devices of a tenant (or all tenants)
+// WARNING: the caller must obtain the lock before calling
+func (s *MemoryStorage) count(tenant string) int {
+	total := 0
+	for _, t := range s.tenants(tenant) {
+		total += s.devices[t].Len()
+	}
+	return total
+}
+
+// Returns the sorted tenants with devices selected by a tenant (or all tenants)
+// WARNING: the caller must obtain the lock before calling
+func (s *MemoryStorage) tenants(tenant string) []string {
+	if tenant != tenancy.All {
+		if _, found := s.devices[tenant]; found {
+			return []string{tenant}
+		}
+		return nil
+	}
+	tenants := make([]string, 0, len(s.devices))
+	for t := range s.devices {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
@@ -0,0 +1,26 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package resource
+
+import "linksmart.eu/lc/core/catalog/metrics"
+
+const metricPrefix = "rc_"
+
+var (
+	metricOperations = metrics.NewCounter(metricPrefix+"operations_total",
+		"Number of registration operations by operation (add, update, delete) and result (success, error)",
+		"operation", "result")
+	metricExpired = metrics.NewCounter(metricPrefix+"expired_total",
+		"Number of registrations removed after expiring")
+	metricFilterDuration = metrics.NewHistogram(metricPrefix+"filter_duration_seconds",
+		"Latency of filtering by collection (devices, resources)", metrics.DefaultBuckets, "collection")
+)
+
+// Counts an operation on the registrations with its result
+func observeOperation(operation string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metricOperations.Inc(operation, result)
+}
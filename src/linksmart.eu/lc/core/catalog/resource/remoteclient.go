@@ -3,7 +3,7 @@
 package resource
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -16,10 +16,16 @@ import (
 
 type RemoteCatalogClient struct {
 	serverEndpoint *url.URL
-	ticket         *obtainer.Client
+	client         *catalog.HTTPClient
 }
 
 func NewRemoteCatalogClient(serverEndpoint string, ticket *obtainer.Client) (CatalogClient, error) {
+	return NewRemoteCatalogClientWithOptions(serverEndpoint, ticket, catalog.DefaultClientOptions())
+}
+
+// Creates a client with the given timeout, HTTP client and retry options
+func NewRemoteCatalogClientWithOptions(serverEndpoint string, ticket *obtainer.Client,
+	options catalog.ClientOptions) (CatalogClient, error) {
 	// Check if serverEndpoint is a correct URL
 	endpointUrl, err := url.Parse(serverEndpoint)
 	if err != nil {
@@ -28,17 +34,21 @@ func NewRemoteCatalogClient(serverEndpoint string, ticket *obtainer.Client) (Cat
 
 	return &RemoteCatalogClient{
 		serverEndpoint: endpointUrl,
-		ticket:         ticket,
+		client:         catalog.NewHTTPClient(ticket, options),
 	}, nil
 }
 
 // Retrieves a device
 func (c *RemoteCatalogClient) Get(id string) (*SimpleDevice, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.GetContext(context.Background(), id)
+}
+
+// GetContext is like Get but uses ctx for the requests
+func (c *RemoteCatalogClient) GetContext(ctx context.Context, id string) (*SimpleDevice, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeDevices, id),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, err
@@ -54,7 +64,7 @@ func (c *RemoteCatalogClient) Get(id string) (*SimpleDevice, error) {
 		return nil, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf(ErrorMsg(res))
+			return nil, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -70,6 +80,11 @@ func (c *RemoteCatalogClient) Get(id string) (*SimpleDevice, error) {
 
 // Adds a device and returns its id
 func (c *RemoteCatalogClient) Add(d *Device) (string, error) {
+	return c.AddContext(context.Background(), d)
+}
+
+// AddContext is like Add but uses ctx for the requests
+func (c *RemoteCatalogClient) AddContext(ctx context.Context, d *Device) (string, error) {
 	device := *d
 	id := device.Id
 	device.Id = ""
@@ -81,11 +96,10 @@ func (c *RemoteCatalogClient) Add(d *Device) (string, error) {
 	)
 
 	if id == "" { // Let the system generate an id
-		res, err = catalog.HTTPRequest("POST",
+		res, err = c.client.Do(ctx, "POST",
 			fmt.Sprintf("%v/%v/", c.serverEndpoint, TypeDevices),
 			map[string][]string{"Content-Type": []string{"application/ld+json"}},
-			bytes.NewReader(b),
-			c.ticket,
+			b,
 		)
 		if err != nil {
 			return "", err
@@ -95,11 +109,10 @@ func (c *RemoteCatalogClient) Add(d *Device) (string, error) {
 	} else { // User-defined id
 
 		// Check if id is unique
-		resGet, err := catalog.HTTPRequest("GET",
+		resGet, err := c.client.Do(ctx, "GET",
 			fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeDevices, id),
 			nil,
 			nil,
-			c.ticket,
 		)
 		if err != nil {
 			return "", err
@@ -117,16 +130,15 @@ func (c *RemoteCatalogClient) Add(d *Device) (string, error) {
 			return "", &ConflictError{ErrorMsg(resGet)}
 		default:
 			if resGet.StatusCode != http.StatusNotFound {
-				return "", fmt.Errorf(ErrorMsg(resGet))
+				return "", &catalog.APIError{StatusCode: resGet.StatusCode, Message: ErrorMsg(resGet)}
 			}
 		}
 
 		// Now add
-		res, err = catalog.HTTPRequest("PUT",
+		res, err = c.client.Do(ctx, "PUT",
 			fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeDevices, id),
 			map[string][]string{"Content-Type": []string{"application/ld+json"}},
-			bytes.NewReader(b),
-			c.ticket,
+			b,
 		)
 		if err != nil {
 			return "", err
@@ -143,7 +155,7 @@ func (c *RemoteCatalogClient) Add(d *Device) (string, error) {
 		return "", &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusCreated {
-			return "", fmt.Errorf(ErrorMsg(res))
+			return "", &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -158,12 +170,16 @@ func (c *RemoteCatalogClient) Add(d *Device) (string, error) {
 
 // Updates a device
 func (c *RemoteCatalogClient) Update(id string, d *Device) error {
+	return c.UpdateContext(context.Background(), id, d)
+}
+
+// UpdateContext is like Update but uses ctx for the requests
+func (c *RemoteCatalogClient) UpdateContext(ctx context.Context, id string, d *Device) error {
 	// Check if id is found
-	resGet, err := catalog.HTTPRequest("GET",
+	resGet, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeDevices, id),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return err
@@ -179,16 +195,15 @@ func (c *RemoteCatalogClient) Update(id string, d *Device) error {
 		return &NotFoundError{ErrorMsg(resGet)}
 	default:
 		if resGet.StatusCode != http.StatusOK {
-			return fmt.Errorf(ErrorMsg(resGet))
+			return &catalog.APIError{StatusCode: resGet.StatusCode, Message: ErrorMsg(resGet)}
 		}
 	}
 
 	b, _ := json.Marshal(d)
-	res, err := catalog.HTTPRequest("PUT",
+	res, err := c.client.Do(ctx, "PUT",
 		fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeDevices, id),
 		map[string][]string{"Content-Type": []string{"application/ld+json"}},
-		bytes.NewReader(b),
-		c.ticket,
+		b,
 	)
 	if err != nil {
 		return err
@@ -204,7 +219,7 @@ func (c *RemoteCatalogClient) Update(id string, d *Device) error {
 		return &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf(ErrorMsg(res))
+			return &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -213,11 +228,15 @@ func (c *RemoteCatalogClient) Update(id string, d *Device) error {
 
 // Deletes a device
 func (c *RemoteCatalogClient) Delete(id string) error {
-	res, err := catalog.HTTPRequest("DELETE",
+	return c.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is like Delete but uses ctx for the requests
+func (c *RemoteCatalogClient) DeleteContext(ctx context.Context, id string) error {
+	res, err := c.client.Do(ctx, "DELETE",
 		fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeDevices, id),
 		nil,
-		bytes.NewReader([]byte{}),
-		c.ticket,
+		nil,
 	)
 	if err != nil {
 		return err
@@ -233,7 +252,36 @@ func (c *RemoteCatalogClient) Delete(id string) error {
 		return &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf(ErrorMsg(res))
+			return &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
+		}
+	}
+
+	return nil
+}
+
+// Renews the registration of a device, extending its expiry time by the TTL
+func (c *RemoteCatalogClient) Heartbeat(id string) error {
+	return c.HeartbeatContext(context.Background(), id)
+}
+
+// HeartbeatContext is like Heartbeat but uses ctx for the requests
+func (c *RemoteCatalogClient) HeartbeatContext(ctx context.Context, id string) error {
+	res, err := c.client.Do(ctx, "POST",
+		fmt.Sprintf("%v/%v/%v/%v", c.serverEndpoint, TypeDevices, id, catalog.HeartbeatPath),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return &NotFoundError{ErrorMsg(res)}
+	default:
+		if res.StatusCode != http.StatusOK {
+			return &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -242,12 +290,16 @@ func (c *RemoteCatalogClient) Delete(id string) error {
 
 // Retrieves a page from the device collection
 func (c *RemoteCatalogClient) List(page int, perPage int) ([]SimpleDevice, int, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.ListContext(context.Background(), page, perPage)
+}
+
+// ListContext is like List but uses ctx for the requests
+func (c *RemoteCatalogClient) ListContext(ctx context.Context, page int, perPage int) ([]SimpleDevice, int, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v?%v=%v&%v=%v", c.serverEndpoint, TypeDevices,
 			catalog.GetParamPage, page, catalog.GetParamPerPage, perPage),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -263,7 +315,7 @@ func (c *RemoteCatalogClient) List(page int, perPage int) ([]SimpleDevice, int,
 		return nil, 0, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, 0, fmt.Errorf(ErrorMsg(res))
+			return nil, 0, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -279,13 +331,17 @@ func (c *RemoteCatalogClient) List(page int, perPage int) ([]SimpleDevice, int,
 
 // Filters devices
 func (c *RemoteCatalogClient) Filter(path, op, value string, page, perPage int) ([]SimpleDevice, int, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.FilterContext(context.Background(), path, op, value, page, perPage)
+}
+
+// FilterContext is like Filter but uses ctx for the requests
+func (c *RemoteCatalogClient) FilterContext(ctx context.Context, path, op, value string, page, perPage int) ([]SimpleDevice, int, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v/%v/%v/%v?%v=%v&%v=%v",
 			c.serverEndpoint, TypeDevices, path, op, value,
 			catalog.GetParamPage, page, catalog.GetParamPerPage, perPage),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -301,7 +357,7 @@ func (c *RemoteCatalogClient) Filter(path, op, value string, page, perPage int)
 		return nil, 0, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, 0, fmt.Errorf(ErrorMsg(res))
+			return nil, 0, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -317,11 +373,15 @@ func (c *RemoteCatalogClient) Filter(path, op, value string, page, perPage int)
 
 // Retrieves a resource
 func (c *RemoteCatalogClient) GetResource(id string) (*Resource, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.GetResourceContext(context.Background(), id)
+}
+
+// GetResourceContext is like GetResource but uses ctx for the requests
+func (c *RemoteCatalogClient) GetResourceContext(ctx context.Context, id string) (*Resource, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v/%v", c.serverEndpoint, TypeResources, id),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, err
@@ -337,7 +397,7 @@ func (c *RemoteCatalogClient) GetResource(id string) (*Resource, error) {
 		return nil, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf(ErrorMsg(res))
+			return nil, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -353,13 +413,17 @@ func (c *RemoteCatalogClient) GetResource(id string) (*Resource, error) {
 
 // Retrieves a page from the resource collection
 func (c *RemoteCatalogClient) ListResources(page int, perPage int) ([]Resource, int, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.ListResourcesContext(context.Background(), page, perPage)
+}
+
+// ListResourcesContext is like ListResources but uses ctx for the requests
+func (c *RemoteCatalogClient) ListResourcesContext(ctx context.Context, page int, perPage int) ([]Resource, int, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v?%v=%v&%v=%v",
 			c.serverEndpoint, TypeResources,
 			catalog.GetParamPage, page, catalog.GetParamPerPage, perPage),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -375,7 +439,7 @@ func (c *RemoteCatalogClient) ListResources(page int, perPage int) ([]Resource,
 		return nil, 0, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, 0, fmt.Errorf(ErrorMsg(res))
+			return nil, 0, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -391,13 +455,17 @@ func (c *RemoteCatalogClient) ListResources(page int, perPage int) ([]Resource,
 
 // Filter resources
 func (c *RemoteCatalogClient) FilterResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.FilterResourcesContext(context.Background(), path, op, value, page, perPage)
+}
+
+// FilterResourcesContext is like FilterResources but uses ctx for the requests
+func (c *RemoteCatalogClient) FilterResourcesContext(ctx context.Context, path, op, value string, page, perPage int) ([]Resource, int, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v/%v/%v/%v?%v=%v&%v=%v",
 			c.serverEndpoint, TypeResources, path, op, value,
 			catalog.GetParamPage, page, catalog.GetParamPerPage, perPage),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -413,7 +481,7 @@ func (c *RemoteCatalogClient) FilterResources(path, op, value string, page, perP
 		return nil, 0, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, 0, fmt.Errorf(ErrorMsg(res))
+			return nil, 0, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -427,6 +495,93 @@ func (c *RemoteCatalogClient) FilterResources(path, op, value string, page, perP
 	return coll.Resources, coll.Total, nil
 }
 
+// Registers or updates a device given its Thing Description
+func (c *RemoteCatalogClient) ImportThingDescription(td *ThingDescription) (*ThingImportReport, error) {
+	return c.ImportThingDescriptionContext(context.Background(), td)
+}
+
+// ImportThingDescriptionContext is like ImportThingDescription but uses ctx for the requests
+func (c *RemoteCatalogClient) ImportThingDescriptionContext(ctx context.Context, td *ThingDescription) (*ThingImportReport, error) {
+	b, _ := json.Marshal(td)
+	res, err := c.client.Do(ctx, "POST",
+		fmt.Sprintf("%v/%v", c.serverEndpoint, TypeThings),
+		map[string][]string{"Content-Type": []string{TDMediaType}},
+		b,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusBadRequest:
+		return nil, &BadRequestError{ErrorMsg(res)}
+	case http.StatusConflict:
+		return nil, &ConflictError{ErrorMsg(res)}
+	case http.StatusNotFound:
+		return nil, &NotFoundError{ErrorMsg(res)}
+	default:
+		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+			return nil, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
+		}
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	var report ThingImportReport
+	err = decoder.Decode(&report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// Watches devices by polling the events of the catalog
+func (c *RemoteCatalogClient) Watch(ctx context.Context, filter WatchFilter) (<-chan Event, error) {
+	list := func(ctx context.Context, page, perPage int) ([]SimpleDevice, int, error) {
+		if filter.Path != "" {
+			return c.FilterContext(ctx, filter.Path, filter.Op, filter.Value, page, perPage)
+		}
+		return c.ListContext(ctx, page, perPage)
+	}
+	return watch(ctx, filter, c.events, list), nil
+}
+
+// Retrieves the events following a position in the event log of the catalog
+func (c *RemoteCatalogClient) events(ctx context.Context, epoch string, since uint64) (*EventCollection, error) {
+	res, err := c.client.Do(ctx, "GET",
+		fmt.Sprintf("%v/%v?%v=%v&%v=%v&%v=%v", c.serverEndpoint, TypeEvents,
+			catalog.GetParamEpoch, url.QueryEscape(epoch), catalog.GetParamSince, since,
+			catalog.GetParamWait, int(c.client.EventWait().Seconds())),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusBadRequest:
+		return nil, &BadRequestError{ErrorMsg(res)}
+	case http.StatusNotFound:
+		return nil, &NotFoundError{ErrorMsg(res)}
+	default:
+		if res.StatusCode != http.StatusOK {
+			return nil, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
+		}
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	var coll EventCollection
+	err = decoder.Decode(&coll)
+	if err != nil {
+		return nil, err
+	}
+
+	return &coll, nil
+}
+
 // Returns the message field of a resource.Error response
 func ErrorMsg(res *http.Response) string {
 	decoder := json.NewDecoder(res.Body)
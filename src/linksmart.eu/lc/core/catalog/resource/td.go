@@ -0,0 +1,305 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// W3C Web of Things Thing Description context and media type
+	TDContext   = "https://www.w3.org/2019/wot/td/v1"
+	TDMediaType = "application/td+json"
+
+	// Vocabulary used to describe MQTT forms
+	tdMQTTVocabulary = "http://www.example.org/mqtt-binding#"
+	tdNoSecurity     = "nosec_sc"
+)
+
+// ThingDescription is a W3C WoT Thing Description of a Device
+type ThingDescription struct {
+	Context             interface{}                   `json:"@context"`
+	Id                  string                        `json:"id"`
+	Base                string                        `json:"base,omitempty"`
+	Title               string                        `json:"title"`
+	Description         string                        `json:"description,omitempty"`
+	Created             *time.Time                    `json:"created,omitempty"`
+	Modified            *time.Time                    `json:"modified,omitempty"`
+	SecurityDefinitions map[string]SecurityScheme     `json:"securityDefinitions"`
+	Security            StringOrArray                 `json:"security"`
+	Properties          map[string]PropertyAffordance `json:"properties,omitempty"`
+	Actions             map[string]ActionAffordance   `json:"actions,omitempty"`
+	Events              map[string]EventAffordance    `json:"events,omitempty"`
+	Forms               []Form                        `json:"forms,omitempty"`
+	Links               []Link                        `json:"links,omitempty"`
+	Meta                map[string]interface{}        `json:"meta,omitempty"`
+	// Time to live of the registration in seconds (see Device)
+	Ttl uint `json:"ttl,omitempty"`
+}
+
+// SecurityScheme of a Thing Description
+type SecurityScheme struct {
+	Scheme string `json:"scheme"`
+}
+
+// PropertyAffordance exposes the state of a Resource
+type PropertyAffordance struct {
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Unit        string                 `json:"unit,omitempty"`
+	ReadOnly    bool                   `json:"readOnly"`
+	WriteOnly   bool                   `json:"writeOnly"`
+	Observable  bool                   `json:"observable"`
+	Forms       []Form                 `json:"forms"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+}
+
+// ActionAffordance invokes a function of a Resource
+type ActionAffordance struct {
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Forms       []Form                 `json:"forms"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+}
+
+// EventAffordance describes an event source of a Thing
+type EventAffordance struct {
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Forms       []Form                 `json:"forms"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+}
+
+// Form describes how an operation on an affordance is performed
+type Form struct {
+	Href                   string        `json:"href"`
+	Op                     StringOrArray `json:"op,omitempty"`
+	ContentType            string        `json:"contentType,omitempty"`
+	Subprotocol            string        `json:"subprotocol,omitempty"`
+	HTTPMethodName         string        `json:"htv:methodName,omitempty"`
+	MQTTControlPacketValue string        `json:"mqv:controlPacketValue,omitempty"`
+}
+
+// Link to another web resource
+type Link struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// StringOrArray is a list of strings which may be serialized as a single string in a TD
+type StringOrArray []string
+
+func (s *StringOrArray) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*s = StringOrArray{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// TD operation types
+const (
+	TDOpReadProperty    = "readproperty"
+	TDOpWriteProperty   = "writeproperty"
+	TDOpObserveProperty = "observeproperty"
+	TDOpInvokeAction    = "invokeaction"
+	TDOpSubscribeEvent  = "subscribeevent"
+)
+
+// Converts a Device into a ThingDescription
+func (d *Device) thingDescription() *ThingDescription {
+	td := &ThingDescription{
+		Context: []interface{}{
+			TDContext,
+			map[string]string{"htv": "http://www.w3.org/2011/http#", "mqv": tdMQTTVocabulary},
+		},
+		Id:                  d.Id,
+		Title:               d.Name,
+		Description:         d.Description,
+		SecurityDefinitions: map[string]SecurityScheme{tdNoSecurity: {Scheme: "nosec"}},
+		Security:            []string{tdNoSecurity},
+		Properties:          make(map[string]PropertyAffordance),
+		Meta:                d.Meta,
+		Ttl:                 d.Ttl,
+		Links: []Link{
+			{Href: d.URL, Rel: "alternate", Type: "application/ld+json"},
+		},
+	}
+	if td.Title == "" {
+		td.Title = d.Id
+	}
+	if !d.Created.IsZero() {
+		created := d.Created
+		td.Created = &created
+	}
+	if !d.Updated.IsZero() {
+		modified := d.Updated
+		td.Modified = &modified
+	}
+
+	for _, r := range d.Resources {
+		// Resource names are unique within a device, fall back to id otherwise
+		name := r.Name
+		if _, exists := td.Properties[name]; exists || name == "" {
+			name = r.Id
+		}
+		p, a := r.affordances()
+		if len(p.Forms) > 0 || a == nil {
+			td.Properties[name] = p
+		}
+		if a != nil {
+			if td.Actions == nil {
+				td.Actions = make(map[string]ActionAffordance)
+			}
+			td.Actions[name] = *a
+		}
+	}
+
+	return td
+}
+
+// Converts a Resource into a PropertyAffordance and,
+// if the resource accepts invocations, an ActionAffordance
+func (r *Resource) affordances() (PropertyAffordance, *ActionAffordance) {
+	p := PropertyAffordance{
+		Title: r.Name,
+		Meta:  r.Meta,
+		Forms: []Form{},
+	}
+	if unit, ok := r.Meta["unit"].(string); ok {
+		p.Unit = unit
+	}
+
+	var a *ActionAffordance
+	readable, writable := false, false
+	for _, proto := range r.Protocols {
+		for _, f := range proto.forms() {
+			if len(f.Op) == 1 && f.Op[0] == TDOpInvokeAction {
+				if a == nil {
+					a = &ActionAffordance{Title: r.Name, Meta: r.Meta}
+				}
+				a.Forms = append(a.Forms, f)
+				continue
+			}
+			for _, op := range f.Op {
+				switch op {
+				case TDOpReadProperty:
+					readable = true
+				case TDOpObserveProperty:
+					readable = true
+					p.Observable = true
+				case TDOpWriteProperty:
+					writable = true
+				}
+			}
+			p.Forms = append(p.Forms, f)
+		}
+	}
+	p.ReadOnly = readable && !writable
+	p.WriteOnly = writable && !readable
+
+	return p, a
+}
+
+// Converts a Protocol into TD forms:
+// REST - one form per method and content-type
+// MQTT - one form per topic (pub_topic -> observe, sub_topic -> write)
+// Others - a single form pointing to the endpoint url
+func (p *Protocol) forms() []Form {
+	href, _ := p.Endpoint["url"].(string)
+
+	switch strings.ToUpper(p.Type) {
+	case "REST":
+		var forms []Form
+		contentTypes := p.ContentTypes
+		if len(contentTypes) == 0 {
+			contentTypes = []string{""}
+		}
+		for _, m := range p.Methods {
+			var op string
+			switch strings.ToUpper(m) {
+			case "GET":
+				op = TDOpReadProperty
+			case "PUT":
+				op = TDOpWriteProperty
+			case "POST":
+				op = TDOpInvokeAction
+			default:
+				continue
+			}
+			for _, ct := range contentTypes {
+				forms = append(forms, Form{
+					Href:           href,
+					Op:             []string{op},
+					ContentType:    ct,
+					HTTPMethodName: strings.ToUpper(m),
+				})
+			}
+		}
+		return forms
+
+	case "MQTT":
+		var forms []Form
+		contentType := ""
+		if len(p.ContentTypes) > 0 {
+			contentType = p.ContentTypes[0]
+		}
+		if topic, ok := p.Endpoint["pub_topic"].(string); ok && topic != "" {
+			forms = append(forms, Form{
+				Href:                   mqttTopicURL(href, topic),
+				Op:                     []string{TDOpObserveProperty},
+				ContentType:            contentType,
+				MQTTControlPacketValue: "SUBSCRIBE",
+			})
+		}
+		if topic, ok := p.Endpoint["sub_topic"].(string); ok && topic != "" {
+			forms = append(forms, Form{
+				Href:                   mqttTopicURL(href, topic),
+				Op:                     []string{TDOpWriteProperty},
+				ContentType:            contentType,
+				MQTTControlPacketValue: "PUBLISH",
+			})
+		}
+		return forms
+
+	default:
+		if href == "" {
+			return nil
+		}
+		return []Form{{Href: href, Subprotocol: strings.ToLower(p.Type)}}
+	}
+}
+
+// Returns an mqtt(s)://host:port/topic URL given the broker URL and a topic
+func mqttTopicURL(broker, topic string) string {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return topic
+	}
+	scheme := "mqtt"
+	if u.Scheme == "ssl" || u.Scheme == "tls" || u.Scheme == "mqtts" {
+		scheme = "mqtts"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, u.Host, strings.TrimPrefix(topic, "/"))
+}
+
+// Converts Devices into []ThingDescription
+func (devices Devices) thingDescriptions() []ThingDescription {
+	tds := make([]ThingDescription, len(devices))
+	for i := 0; i < len(devices); i++ {
+		tds[i] = *devices[i].thingDescription()
+	}
+	return tds
+}
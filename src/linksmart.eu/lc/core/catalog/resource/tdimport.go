@@ -0,0 +1,330 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package resource
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Default content type of a TD form (W3C WoT TD 1.0)
+const tdDefaultContentType = "application/json"
+
+// ThingImportReport describes the result of importing a Thing Description
+type ThingImportReport struct {
+	Id      string `json:"id"`
+	URL     string `json:"url"`
+	Created bool   `json:"created"`
+	// Unmapped lists the parts of the TD that could not be represented in the registration
+	Unmapped []string `json:"unmapped"`
+}
+
+// Converts a ThingDescription into a Device
+// Returns the device and a list of TD parts that could not be mapped
+func (td *ThingDescription) device() (*Device, []string) {
+	unmapped := []string{}
+
+	d := &Device{
+		Id:          td.Id,
+		Name:        td.Title,
+		Description: td.Description,
+		Meta:        td.Meta,
+		Ttl:         td.Ttl,
+		Resources:   []Resource{},
+	}
+
+	for _, s := range td.Security {
+		if scheme, ok := td.SecurityDefinitions[s]; !ok || scheme.Scheme != "nosec" {
+			unmapped = append(unmapped, fmt.Sprintf("security/%s: security schemes are not represented in registrations", s))
+		}
+	}
+	if len(td.Forms) > 0 {
+		unmapped = append(unmapped, "forms: top-level forms are not supported")
+	}
+
+	// Process affordances in a deterministic order
+	// Forms without op get the default operations of their affordance type
+	type affordance struct {
+		kind       string
+		name       string
+		meta       map[string]interface{}
+		unit       string
+		forms      []Form
+		defaultOps []string
+	}
+	var affordances []affordance
+	for _, name := range sortedKeys(td.Properties) {
+		p := td.Properties[name]
+		var ops []string
+		switch {
+		case p.ReadOnly:
+			ops = []string{TDOpReadProperty}
+		case p.WriteOnly:
+			ops = []string{TDOpWriteProperty}
+		default:
+			ops = []string{TDOpReadProperty, TDOpWriteProperty}
+		}
+		affordances = append(affordances, affordance{"properties", name, p.Meta, p.Unit, p.Forms, ops})
+	}
+	for _, name := range sortedKeys(td.Actions) {
+		a := td.Actions[name]
+		affordances = append(affordances, affordance{"actions", name, a.Meta, "", a.Forms, []string{TDOpInvokeAction}})
+	}
+	for _, name := range sortedKeys(td.Events) {
+		e := td.Events[name]
+		affordances = append(affordances, affordance{"events", name, e.Meta, "", e.Forms, []string{TDOpSubscribeEvent}})
+	}
+
+	resources := make(map[string]int) // resource name -> index
+	for _, a := range affordances {
+		var protocols []Protocol
+		for i, f := range a.forms {
+			if len(f.Op) == 0 {
+				f.Op = a.defaultOps
+			}
+			p, err := td.protocol(f)
+			if err != nil {
+				unmapped = append(unmapped, fmt.Sprintf("%s/%s/forms/%d: %s", a.kind, a.name, i, err))
+				continue
+			}
+			protocols = mergeProtocol(protocols, p)
+		}
+		if len(protocols) == 0 {
+			unmapped = append(unmapped, fmt.Sprintf("%s/%s: no mappable forms", a.kind, a.name))
+			continue
+		}
+
+		// An action or event sharing the name of a property extends its resource
+		if i, exists := resources[a.name]; exists {
+			for j := range protocols {
+				d.Resources[i].Protocols = mergeProtocol(d.Resources[i].Protocols, &protocols[j])
+			}
+			continue
+		}
+
+		r := Resource{
+			Name:      a.name,
+			Meta:      a.meta,
+			Protocols: protocols,
+		}
+		if a.unit != "" {
+			if r.Meta == nil {
+				r.Meta = make(map[string]interface{})
+			}
+			r.Meta["unit"] = a.unit
+		}
+		if d.Id != "" {
+			r.Id = fmt.Sprintf("%s/%s", d.Id, a.name)
+		}
+		resources[a.name] = len(d.Resources)
+		d.Resources = append(d.Resources, r)
+	}
+
+	return d, unmapped
+}
+
+// Converts a TD form into a Protocol
+func (td *ThingDescription) protocol(f Form) (*Protocol, error) {
+	href, err := url.Parse(f.Href)
+	if err != nil {
+		return nil, fmt.Errorf("invalid href %s: %s", f.Href, err)
+	}
+	// Resolve relative URLs against the TD base
+	if !href.IsAbs() {
+		if td.Base == "" {
+			return nil, fmt.Errorf("relative href %s without base", f.Href)
+		}
+		base, err := url.Parse(td.Base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base %s: %s", td.Base, err)
+		}
+		href = base.ResolveReference(href)
+	}
+
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = tdDefaultContentType
+	}
+
+	switch href.Scheme {
+	case "http", "https":
+		p := &Protocol{
+			Type:         "REST",
+			Endpoint:     map[string]interface{}{"url": href.String()},
+			ContentTypes: []string{contentType},
+		}
+		if f.HTTPMethodName != "" {
+			p.Methods = []string{strings.ToUpper(f.HTTPMethodName)}
+			return p, nil
+		}
+		for _, op := range f.Op {
+			switch op {
+			case TDOpReadProperty:
+				p.Methods = append(p.Methods, "GET")
+			case TDOpWriteProperty:
+				p.Methods = append(p.Methods, "PUT")
+			case TDOpInvokeAction:
+				p.Methods = append(p.Methods, "POST")
+			default:
+				return nil, fmt.Errorf("operation %s is not supported over HTTP", op)
+			}
+		}
+		if len(p.Methods) == 0 {
+			return nil, fmt.Errorf("no operation defined")
+		}
+		return p, nil
+
+	case "mqtt", "mqtts":
+		scheme := "tcp"
+		if href.Scheme == "mqtts" {
+			scheme = "ssl"
+		}
+		p := &Protocol{
+			Type:         "MQTT",
+			Endpoint:     map[string]interface{}{"url": fmt.Sprintf("%s://%s", scheme, href.Host)},
+			ContentTypes: []string{contentType},
+		}
+		topic := strings.TrimPrefix(href.Path, "/")
+		if topic == "" {
+			return nil, fmt.Errorf("no MQTT topic in href %s", f.Href)
+		}
+		for _, op := range f.Op {
+			switch op {
+			case TDOpObserveProperty, TDOpSubscribeEvent:
+				p.Endpoint["pub_topic"] = topic
+				p.Methods = append(p.Methods, "PUB")
+			case TDOpWriteProperty, TDOpInvokeAction:
+				p.Endpoint["sub_topic"] = topic
+				p.Methods = append(p.Methods, "SUB")
+			default:
+				return nil, fmt.Errorf("operation %s is not supported over MQTT", op)
+			}
+		}
+		if len(p.Methods) == 0 {
+			return nil, fmt.Errorf("no operation defined")
+		}
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("unsupported protocol scheme %s", href.Scheme)
+}
+
+// Merges a Protocol into a list of protocols
+// Protocols of the same type and url are combined into one
+func mergeProtocol(protocols []Protocol, p *Protocol) []Protocol {
+	for i := range protocols {
+		existing := &protocols[i]
+		if existing.Type != p.Type || existing.Endpoint["url"] != p.Endpoint["url"] {
+			continue
+		}
+		// Topics must not be overwritten
+		conflict := false
+		for k, v := range p.Endpoint {
+			if ev, found := existing.Endpoint[k]; found && ev != v {
+				conflict = true
+			}
+		}
+		if conflict {
+			continue
+		}
+		for k, v := range p.Endpoint {
+			existing.Endpoint[k] = v
+		}
+		existing.Methods = appendUnique(existing.Methods, p.Methods...)
+		existing.ContentTypes = appendUnique(existing.ContentTypes, p.ContentTypes...)
+		return protocols
+	}
+	return append(protocols, *p)
+}
+
+// Appends values that are not already in the slice
+func appendUnique(slice []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, s := range slice {
+			if s == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			slice = append(slice, v)
+		}
+	}
+	return slice
+}
+
+// Returns the keys of an affordances map in ascending order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch affordances := m.(type) {
+	case map[string]PropertyAffordance:
+		for k := range affordances {
+			keys = append(keys, k)
+		}
+	case map[string]ActionAffordance:
+		for k := range affordances {
+			keys = append(keys, k)
+		}
+	case map[string]EventAffordance:
+		for k := range affordances {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the ttl of the device imported from a Thing Description: the ttl of the TD,
+// or that of the stored device if the TD provides none
+func importedTTL(controller CatalogController, tenant string, td *ThingDescription) uint {
+	if td.Ttl != 0 || td.Id == "" {
+		return td.Ttl
+	}
+	if sd, err := controller.get(tenant, td.Id); err == nil {
+		return sd.Ttl
+	}
+	return 0
+}
+
+// Registers or updates the device described by a Thing Description in the namespace of a tenant on behalf of a user
+func importThingDescription(controller CatalogController, tenant string, td *ThingDescription, user *validator.UserProfile) (*ThingImportReport, error) {
+	d, unmapped := td.device()
+	d.Tenant = tenant
+
+	report := &ThingImportReport{
+		Id:       d.Id,
+		Unmapped: unmapped,
+	}
+
+	// Update the device if it exists, keeping its ttl unless the TD provides one
+	var err error = &NotFoundError{}
+	if d.Id != "" {
+		if _, err = controller.get(tenant, d.Id); err == nil {
+			d.Ttl = importedTTL(controller, tenant, td)
+			err = controller.update(d.Id, *d, user)
+		}
+	}
+	if err != nil {
+		if _, notFound := err.(*NotFoundError); !notFound {
+			return report, err
+		}
+		// Register a new device
+		report.Id, err = controller.add(*d, user)
+		if err != nil {
+			return report, err
+		}
+		report.Created = true
+	}
+
+	sd, err := controller.get(tenant, report.Id)
+	if err != nil {
+		return report, err
+	}
+	report.URL = sd.URL
+	return report, nil
+}
@@ -3,6 +3,7 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,8 @@ import (
 
 const (
 	keepaliveRetries = 5
+	// Time limit for removing a registration on shutdown
+	deregistrationTimeout = 5 * time.Second
 )
 
 // Registers device given a configured Catalog Client
@@ -24,16 +27,16 @@ func RegisterDevice(client CatalogClient, d *Device) error {
 			// If not in the catalog - add
 			_, err = client.Add(d)
 			if err != nil {
-				logger.Printf("RegisterDevice() Error adding registration: %v", err)
+				logger.Errorf("RegisterDevice() Error adding registration: %v", err)
 				return err
 			}
-			logger.Printf("RegisterDevice() Added Device registration %v", d.Id)
+			logger.Infof("RegisterDevice() Added Device registration %v", d.Id)
 		default:
-			logger.Printf("RegisterDevice() Error updating registration: %v", err)
+			logger.Errorf("RegisterDevice() Error updating registration: %v", err)
 			return err
 		}
 	} else {
-		logger.Printf("RegisterDevice() Updated Device registration %v\n", d.Id)
+		logger.Infof("RegisterDevice() Updated Device registration %v", d.Id)
 	}
 	return nil
 }
@@ -44,30 +47,36 @@ func RegisterDevice(client CatalogClient, d *Device) error {
 // sigCh: channel for shutdown signalisation from upstream
 func RegisterDeviceWithKeepalive(endpoint string, discover bool, d Device, sigCh <-chan bool, wg *sync.WaitGroup,
 	ticket *obtainer.Client) {
+	RegisterDeviceWithKeepaliveOptions(endpoint, discover, d, sigCh, wg, ticket, utils.DefaultClientOptions())
+}
+
+// Registers device in the remote catalog using a client with the given options (e.g. TLS configuration)
+func RegisterDeviceWithKeepaliveOptions(endpoint string, discover bool, d Device, sigCh <-chan bool, wg *sync.WaitGroup,
+	ticket *obtainer.Client, options utils.ClientOptions) {
 	defer wg.Done()
 	var err error
 	if discover {
 		endpoint, err = utils.DiscoverCatalogEndpoint(DNSSDServiceType)
 		if err != nil {
-			logger.Printf("RegisterDeviceWithKeepalive() ERROR: Failed to discover the endpoint: %v", err.Error())
+			logger.Errorf("RegisterDeviceWithKeepalive() Failed to discover the endpoint: %v", err.Error())
 			return
 		}
 	}
 
 	// Configure client
-	client, err := NewRemoteCatalogClient(endpoint, ticket)
+	client, err := NewRemoteCatalogClientWithOptions(endpoint, ticket, options)
 	if err != nil {
-		logger.Printf("RegisterDeviceWithKeepalive() ERROR: Failed to create remote-catalog client: %v", err.Error())
+		logger.Errorf("RegisterDeviceWithKeepalive() Failed to create remote-catalog client: %v", err.Error())
 		return
 	}
 
 	// Will not keepalive registration without a TTL
 	if d.Ttl == 0 {
-		logger.Println("RegisterDeviceWithKeepalive() WARNING: Registration has ttl <= 0. Will not start the keepalive routine")
+		logger.Warn("RegisterDeviceWithKeepalive() Registration has ttl <= 0. Will not start the keepalive routine")
 		RegisterDevice(client, &d)
 		return
 	}
-	logger.Printf("RegisterDeviceWithKeepalive() Will register and update registration periodically: %v/%v/%v", endpoint, TypeDevices, d.Id)
+	logger.Infof("RegisterDeviceWithKeepalive() Will register and update registration periodically: %v/%v/%v", endpoint, TypeDevices, d.Id)
 
 	// Configure & start the keepalive routine
 	ksigCh := make(chan bool)
@@ -78,33 +87,35 @@ func RegisterDeviceWithKeepalive(endpoint string, discover bool, d Device, sigCh
 		select {
 		// catch an error from the keepAlive routine
 		case e := <-kerrCh:
-			logger.Println("RegisterDeviceWithKeepalive() ERROR:", e)
+			logger.Error("RegisterDeviceWithKeepalive()", e)
 			// Re-discover the endpoint if needed and start over
 			if discover {
 				endpoint, err = utils.DiscoverCatalogEndpoint(DNSSDServiceType)
 				if err != nil {
-					logger.Println("RegisterDeviceWithKeepalive() ERROR:", err.Error())
+					logger.Error("RegisterDeviceWithKeepalive()", err.Error())
 					return
 				}
 			}
-			logger.Println("RegisterDeviceWithKeepalive() Will use the new endpoint:", endpoint)
-			client, err := NewRemoteCatalogClient(endpoint, ticket)
+			logger.Info("RegisterDeviceWithKeepalive() Will use the new endpoint:", endpoint)
+			client, err := NewRemoteCatalogClientWithOptions(endpoint, ticket, options)
 			if err != nil {
-				logger.Printf("RegisterDeviceWithKeepalive() ERROR: Failed to create remote-catalog client: %v", err.Error())
+				logger.Errorf("RegisterDeviceWithKeepalive() Failed to create remote-catalog client: %v", err.Error())
 				return
 			}
 			go keepAlive(client, &d, ksigCh, kerrCh)
 
 		// catch a shutdown signal from the upstream
 		case <-sigCh:
-			logger.Printf("RegisterDeviceWithKeepalive(): Removing the registration %v/%v/%v...", endpoint, TypeDevices, d.Id)
+			logger.Infof("RegisterDeviceWithKeepalive(): Removing the registration %v/%v/%v...", endpoint, TypeDevices, d.Id)
 			// signal shutdown to the keepAlive routine & close channels
 			select {
 			case ksigCh <- true:
 				// delete entry in the remote catalog
-				client.Delete(d.Id)
+				ctx, cancel := context.WithTimeout(context.Background(), deregistrationTimeout)
+				client.DeleteContext(ctx, d.Id)
+				cancel()
 			case <-time.After(1 * time.Second):
-				logger.Printf("RegisterDeviceWithKeepalive(): timeout removing registration %v/%v/%v: catalog unreachable", endpoint, TypeDevices, d.Id)
+				logger.Errorf("RegisterDeviceWithKeepalive(): timeout removing registration %v/%v/%v: catalog unreachable", endpoint, TypeDevices, d.Id)
 			}
 
 			close(ksigCh)
@@ -123,6 +134,8 @@ func keepAlive(client CatalogClient, d *Device, sigCh <-chan bool, errCh chan<-
 	dur := (time.Duration(d.Ttl) * time.Second) / 2
 	ticker := time.NewTicker(dur)
 	errTries := 0
+	// Renew using heartbeats unless the catalog does not support them
+	heartbeats := true
 
 	// Register
 	RegisterDevice(client, d)
@@ -130,27 +143,49 @@ func keepAlive(client CatalogClient, d *Device, sigCh <-chan bool, errCh chan<-
 	for {
 		select {
 		case <-ticker.C:
-			err := client.Update(d.Id, d)
-			if err != nil {
+			update := !heartbeats
+			if heartbeats {
+				err := client.Heartbeat(d.Id)
 				switch err.(type) {
+				case nil:
+					logger.Debugf("keepAlive() Renewed Device registration %v", d.Id)
+					errTries = 0
 				case *NotFoundError:
-					// If not in the catalog - add
-					logger.Printf("keepAlive() ERROR: Registration %v not found in the remote catalog. TTL expired?", d.Id)
-					_, err = client.Add(d)
-					if err != nil {
-						logger.Printf("keepAlive() Error adding registration: %v", err)
-						errTries += 1
-					} else {
-						logger.Printf("keepAlive() Added Device registration %v", d.Id)
-						errTries = 0
-					}
+					// Expired registration or a catalog without heartbeats: update the complete registration
+					update = true
 				default:
-					logger.Printf("keepAlive() Error updating registration: %v", err)
+					logger.Errorf("keepAlive() Error renewing registration: %v", err)
 					errTries += 1
 				}
-			} else {
-				logger.Printf("keepAlive() Updated Device registration %v", d.Id)
-				errTries = 0
+			}
+			if update {
+				err := client.Update(d.Id, d)
+				if err != nil {
+					switch err.(type) {
+					case *NotFoundError:
+						// If not in the catalog - add
+						logger.Errorf("keepAlive() Registration %v not found in the remote catalog. TTL expired?", d.Id)
+						_, err = client.Add(d)
+						if err != nil {
+							logger.Errorf("keepAlive() Error adding registration: %v", err)
+							errTries += 1
+						} else {
+							logger.Infof("keepAlive() Added Device registration %v", d.Id)
+							errTries = 0
+						}
+					default:
+						logger.Errorf("keepAlive() Error updating registration: %v", err)
+						errTries += 1
+					}
+				} else {
+					if heartbeats {
+						// The registration exists but the heartbeat was not found
+						logger.Infof("keepAlive() Catalog does not support heartbeats. Will update the complete registration %v", d.Id)
+						heartbeats = false
+					}
+					logger.Debugf("keepAlive() Updated Device registration %v", d.Id)
+					errTries = 0
+				}
 			}
 			if errTries >= keepaliveRetries {
 				errCh <- fmt.Errorf("Number of retries exceeded")
@@ -0,0 +1,208 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package resource
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"linksmart.eu/lc/core/catalog"
+)
+
+// Event describes a change of a device registration
+type Event struct {
+	// Sequence number of the event in the catalog (zero for changes detected on resync)
+	Seq    uint64        `json:"seq,omitempty"`
+	Type   string        `json:"type"`
+	Id     string        `json:"id"`
+	Device *SimpleDevice `json:"device"`
+}
+
+// WatchFilter selects the watched devices using the path, operation and value of Filter
+// The zero value selects all devices
+type WatchFilter struct {
+	Path  string
+	Op    string
+	Value string
+}
+
+func (f WatchFilter) match(d *SimpleDevice) bool {
+	if f.Path == "" {
+		return true
+	}
+	matched, err := catalog.MatchObject(*d, strings.Split(f.Path, "."), f.Op, f.Value)
+	return err == nil && matched
+}
+
+// Polls the events following a position in the event log
+type eventPoller func(ctx context.Context, epoch string, since uint64) (*EventCollection, error)
+
+// Retrieves a page of the watched devices
+type devicePager func(ctx context.Context, page, perPage int) ([]SimpleDevice, int, error)
+
+// watcher delivers the changes of devices matching a filter
+type watcher struct {
+	filter WatchFilter
+	out    chan Event
+	// last known state of the matching devices
+	known map[string]*SimpleDevice
+}
+
+// Starts a watcher and returns its channel of events
+// Events are polled continuously; on reconnection after failures or when events were missed,
+// the watcher resynchronizes by listing the devices and emits the detected changes
+// The channel is closed when ctx is done
+func watch(ctx context.Context, filter WatchFilter, poll eventPoller, list devicePager) <-chan Event {
+	w := &watcher{
+		filter: filter,
+		out:    make(chan Event),
+		known:  make(map[string]*SimpleDevice),
+	}
+	go w.run(ctx, poll, list)
+	return w.out
+}
+
+func (w *watcher) run(ctx context.Context, poll eventPoller, list devicePager) {
+	defer close(w.out)
+
+	var (
+		epoch    string
+		since    uint64
+		synced   bool
+		failures int
+	)
+	for {
+		coll, err := poll(ctx, epoch, since)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && coll.Resync {
+			epoch, since = coll.Epoch, coll.Last
+			// The initial listing only establishes the known state
+			err = w.resync(ctx, list, synced)
+			if err != nil {
+				// Force another resync
+				epoch = ""
+			} else {
+				synced = true
+			}
+		}
+		if err != nil {
+			delay := catalog.WatchBackoff(failures)
+			failures++
+			logger.Errorf("watch() Error: %v. Will retry in %v", err, delay)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		failures = 0
+		if coll.Resync {
+			continue
+		}
+
+		for _, e := range coll.Events {
+			if !w.emit(ctx, e) {
+				return
+			}
+		}
+		since = coll.Last
+	}
+}
+
+// Lists the matching devices and emits the changes since the known state
+func (w *watcher) resync(ctx context.Context, list devicePager, emitChanges bool) error {
+	current := make(map[string]*SimpleDevice)
+	for page := 1; ; page++ {
+		devices, total, err := list(ctx, page, MaxPerPage)
+		if err != nil {
+			return err
+		}
+		for i := range devices {
+			if w.filter.match(&devices[i]) {
+				current[devices[i].Id] = &devices[i]
+			}
+		}
+		if page*MaxPerPage >= total {
+			break
+		}
+	}
+
+	known := w.known
+	w.known = current
+	if !emitChanges {
+		return nil
+	}
+
+	for id, d := range current {
+		prev, found := known[id]
+		switch {
+		case !found:
+			if !w.send(ctx, Event{Type: catalog.EventAdded, Id: id, Device: d}) {
+				return ctx.Err()
+			}
+		case !unchanged(prev, d):
+			if !w.send(ctx, Event{Type: catalog.EventUpdated, Id: id, Device: d}) {
+				return ctx.Err()
+			}
+		}
+	}
+	for id, d := range known {
+		if _, found := current[id]; !found {
+			if !w.send(ctx, Event{Type: catalog.EventDeleted, Id: id, Device: d}) {
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Emits an event if it concerns a matching device
+// Devices that start or stop matching the filter are reported as added or deleted
+func (w *watcher) emit(ctx context.Context, e Event) bool {
+	prev, known := w.known[e.Id]
+
+	if e.Type == catalog.EventDeleted {
+		if !known && !w.filter.match(e.Device) {
+			return true
+		}
+		delete(w.known, e.Id)
+		return w.send(ctx, e)
+	}
+
+	matches := w.filter.match(e.Device)
+	switch {
+	case !matches && !known:
+		return true
+	case known && unchanged(prev, e.Device):
+		// Already delivered, e.g. by a resync
+		return true
+	case !matches:
+		delete(w.known, e.Id)
+		e.Type = catalog.EventDeleted
+	case !known:
+		w.known[e.Id] = e.Device
+		e.Type = catalog.EventAdded
+	default:
+		w.known[e.Id] = e.Device
+	}
+	return w.send(ctx, e)
+}
+
+// Checks whether a device is in the known state
+// Becoming stale or fresh again does not change the update time
+func unchanged(prev, d *SimpleDevice) bool {
+	return prev.Updated.Equal(d.Updated) && prev.Stale == d.Stale
+}
+
+func (w *watcher) send(ctx context.Context, e Event) bool {
+	select {
+	case w.out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package resource
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+)
+
+func receiveEvent(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for an event")
+	}
+	return Event{}
+}
+
+func expectEvent(t *testing.T, events <-chan Event, eventType, id string) {
+	e := receiveEvent(t, events)
+	if e.Type != eventType || e.Id != id {
+		t.Fatalf("Expected %s event of %s, got %s event of %s", eventType, id, e.Type, e.Id)
+	}
+}
+
+func TestLocalClientWatch(t *testing.T) {
+	controller, shutdown, err := setup()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+	client := NewLocalCatalogClient(controller)
+
+	// Existing device, not reported
+	_, err = client.Add(mockedDevice("1", "10"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.Watch(ctx, WatchFilter{"meta.test-id", utils.FOpPrefix, "test"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// Let the watcher synchronize
+	time.Sleep(100 * time.Millisecond)
+
+	d := mockedDevice("2", "20")
+	d.Meta["test-id"] = "test2"
+	_, err = client.Add(d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvent(t, events, utils.EventAdded, d.Id)
+
+	// Not matching
+	_, err = client.Add(mockedDevice("3", "30"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	d.Name = "Updated"
+	err = client.Update(d.Id, d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	e := receiveEvent(t, events)
+	if e.Type != utils.EventUpdated || e.Device.Name != "Updated" {
+		t.Fatalf("Expected update of the name, got %s event: %+v", e.Type, e.Device)
+	}
+
+	// No longer matching
+	d.Meta["test-id"] = "2"
+	err = client.Update(d.Id, d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvent(t, events, utils.EventDeleted, d.Id)
+
+	cancel()
+	select {
+	case _, open := <-events:
+		if open {
+			t.Fatal("Expected no more events")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Channel was not closed after cancellation")
+	}
+}
+
+func TestLocalClientWatchStale(t *testing.T) {
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{GracePeriod: 60},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+	client := NewLocalCatalogClient(controller)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.Watch(ctx, WatchFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	d := mockedDevice("1", "10")
+	d.Ttl = 1
+	_, err = client.Add(d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvent(t, events, utils.EventAdded, d.Id)
+
+	// Expired, kept during the grace period
+	e := receiveEvent(t, events)
+	if e.Type != utils.EventUpdated || e.Id != d.Id || !e.Device.Stale {
+		t.Fatalf("Expected update of %s to stale, got %s event of %s: %+v", d.Id, e.Type, e.Id, e.Device)
+	}
+
+	// Renewed by a heartbeat
+	err = controller.heartbeat(tenancy.Default, d.Id, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	e = receiveEvent(t, events)
+	if e.Type != utils.EventUpdated || e.Id != d.Id || e.Device.Stale {
+		t.Fatalf("Expected update of %s to fresh, got %s event of %s: %+v", d.Id, e.Type, e.Id, e.Device)
+	}
+}
+
+func TestRemoteClientWatch(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	client, err := NewRemoteCatalogClient(ts.URL+TestApiLocation, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.Watch(ctx, WatchFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	d := mockedDevice("1", "10")
+	_, err = client.Add(d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvent(t, events, utils.EventAdded, d.Id)
+
+	err = client.Delete(d.Id)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvent(t, events, utils.EventDeleted, d.Id)
+}
+
+func TestWatchResync(t *testing.T) {
+	device := func(id string, updated time.Time) SimpleDevice {
+		return SimpleDevice{Device: Device{Id: id, Updated: updated}}
+	}
+	t0 := time.Now()
+	listings := [][]SimpleDevice{
+		{device("a", t0), device("b", t0)},
+		{device("b", t0.Add(time.Second)), device("c", t0)},
+	}
+
+	var polls int
+	poll := func(ctx context.Context, epoch string, since uint64) (*EventCollection, error) {
+		polls++
+		if polls <= len(listings) {
+			// Events were missed
+			return &EventCollection{Epoch: "epoch", Resync: true}, nil
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	list := func(ctx context.Context, page, perPage int) ([]SimpleDevice, int, error) {
+		devices := listings[polls-1]
+		return devices, len(devices), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := watch(ctx, WatchFilter{}, poll, list)
+
+	received := make(map[string]string)
+	for i := 0; i < 3; i++ {
+		e := receiveEvent(t, events)
+		received[e.Id] = e.Type
+	}
+	expected := map[string]string{"a": utils.EventDeleted, "b": utils.EventUpdated, "c": utils.EventAdded}
+	for id, eventType := range expected {
+		if received[id] != eventType {
+			t.Errorf("Expected %s event of %s, got %v", eventType, id, received)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is the time given to a component to shut down unless configured otherwise
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Server is an HTTP(S) server of a component which can be shut down gracefully
+type Server struct {
+	server *http.Server
+	// cancels the base context of all requests
+	cancel context.CancelFunc
+}
+
+// NewServer creates a Server listening on addr, serving HTTPS if enabled in the TLS configuration
+func NewServer(addr string, handler http.Handler, c ServerTLSConfig) (*Server, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		server: &http.Server{
+			Addr:        addr,
+			Handler:     handler,
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		},
+		cancel: cancel,
+	}
+	if c.Enabled {
+		config, err := c.TLSConfig()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		s.server.TLSConfig = config
+	}
+	return s, nil
+}
+
+// ListenAndServe serves requests until the server is shut down (blocking call)
+// Returns nil after Shutdown
+func (s *Server) ListenAndServe() error {
+	var err error
+	if s.server.TLSConfig != nil {
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for the in-flight requests to complete
+// until the context is done. Long-polling requests are ended through their context
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// WaitContext waits for the wait group until the context is done
+func WaitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	// Reserve a port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	started := make(chan bool, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, req *http.Request) {
+		started <- true
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("completed"))
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, req *http.Request) {
+		started <- true
+		<-req.Context().Done()
+		w.Write([]byte("ended"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {})
+
+	s, err := NewServer(addr, mux, ServerTLSConfig{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServe()
+	}()
+	// Wait for the listener
+	for i := 0; ; i++ {
+		res, err := http.Get("http://" + addr)
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("Server did not start: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Submit the in-flight requests
+	bodies := make(map[string]string)
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for _, path := range []string{"/slow", "/poll"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			res, err := http.Get("http://" + addr + path)
+			if err != nil {
+				t.Errorf("Request to %s failed: %s", path, err)
+				return
+			}
+			defer res.Body.Close()
+			b, _ := ioutil.ReadAll(res.Body)
+			mutex.Lock()
+			bodies[path] = string(b)
+			mutex.Unlock()
+		}(path)
+	}
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Unexpected error on shutdown: %s", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected no error after shutdown, got %s", err)
+	}
+	wg.Wait()
+	if bodies["/slow"] != "completed" || bodies["/poll"] != "ended" {
+		t.Errorf("Expected the in-flight requests to complete, got %v", bodies)
+	}
+
+	// No longer accepting requests
+	if res, err := http.Get("http://" + addr); err == nil {
+		res.Body.Close()
+		t.Error("Expected a request after shutdown to fail")
+	}
+}
+
+func TestWaitContext(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := WaitContext(ctx, &wg); err != context.DeadlineExceeded {
+		t.Errorf("Expected %s, got %v", context.DeadlineExceeded, err)
+	}
+
+	wg.Done()
+	if err := WaitContext(context.Background(), &wg); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
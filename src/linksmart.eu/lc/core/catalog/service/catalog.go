@@ -3,8 +3,11 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"time"
+
+	"linksmart.eu/lc/sec/auth/validator"
 )
 
 // Structs
@@ -14,6 +17,7 @@ type Service struct {
 	Id             string                 `json:"id"`
 	URL            string                 `json:"url"`
 	Type           string                 `json:"type"`
+	Tenant         string                 `json:"tenant,omitempty"` // namespace of the service, set by the catalog
 	Name           string                 `json:"name,omitempty"`
 	Description    string                 `json:"description,omitempty"`
 	Meta           map[string]interface{} `json:"meta,omitempty"`
@@ -23,6 +27,9 @@ type Service struct {
 	Created        time.Time              `json:"created"`
 	Updated        time.Time              `json:"updated"`
 	Expires        *time.Time             `json:"expires,omitempty"`
+	Stale          bool                   `json:"stale,omitempty"` // expired, to be removed after the grace period
+	Owner          string                 `json:"owner,omitempty"` // user who created the service, see catalog.OwnershipPolicy
+	OwnerGroups    []string               `json:"ownerGroups,omitempty"`
 }
 
 // Validates the Service configuration
@@ -76,27 +83,35 @@ type Protocol struct {
 // Interfaces
 
 // Controller interface
+// Services are added and updated in the namespace of their Tenant, the other operations
+// take the tenant explicitly (tenancy.All for the queries across all tenants)
+// Modifications are made on behalf of the given authenticated user (nil if anonymous) according to the ownership policy
 type CatalogController interface {
-	add(s Service) (string, error)
-	get(id string) (*Service, error)
-	update(id string, s Service) error
-	delete(id string) error
-	list(page, perPage int) ([]Service, int, error)
-	filter(path, op, value string, page, perPage int) ([]Service, int, error)
-	total() (int, error)
-	cleanExpired()
+	add(s Service, user *validator.UserProfile) (string, error)
+	get(tenant, id string) (*Service, error)
+	update(id string, s Service, user *validator.UserProfile) error
+	delete(tenant, id string, user *validator.UserProfile) error
+	heartbeat(tenant, id string, user *validator.UserProfile) error
+	list(tenant string, page, perPage int) ([]Service, int, error)
+	expiring(tenant string, within time.Duration, page, perPage int) ([]Service, int, error)
+	checkTTL(ttl int, user string) error
+	filter(tenant, path, op, value string, page, perPage int) ([]Service, int, error)
+	total(tenant string) (int, error)
+	cleanExpired(now time.Time)
+	events(ctx context.Context, tenant, epoch string, since uint64, wait time.Duration) (*EventCollection, error)
 
 	Stop() error
 }
 
 // Storage interface
+// Services are stored in the namespace of their Tenant, partitioned by tenant
 type CatalogStorage interface {
 	add(s *Service) error
-	get(id string) (*Service, error)
+	get(tenant, id string) (*Service, error)
 	update(id string, s *Service) error
-	delete(id string) error
-	list(page, perPage int) ([]Service, int, error)
-	total() (int, error)
+	delete(tenant, id string) error
+	list(tenant string, page, perPage int) ([]Service, int, error)
+	total(tenant string) (int, error)
 	Close() error
 }
 
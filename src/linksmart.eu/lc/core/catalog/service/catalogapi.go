@@ -10,10 +10,13 @@ import (
 
 	"github.com/gorilla/mux"
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/sec/auth/validator"
 )
 
 const (
-	CtxPath = "/ctx/sc.jsonld"
+	CtxPath    = "/ctx/sc.jsonld"
+	TypeEvents = "events"
 )
 
 type Collection struct {
@@ -27,6 +30,19 @@ type Collection struct {
 	Total       int       `json:"total"`
 }
 
+// EventCollection is a batch of events following a position in the catalog's event log
+type EventCollection struct {
+	Context string `json:"@context,omitempty"`
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Epoch   string `json:"epoch"`
+	// Sequence number of the last event, to be used as the position of the next request
+	Last uint64 `json:"last"`
+	// Events following the requested position are no longer available
+	Resync bool    `json:"resync"`
+	Events []Event `json:"events"`
+}
+
 type JSONLDService struct {
 	Context string `json:"@context"`
 	*Service
@@ -63,7 +79,24 @@ func (a *CatalogAPI) List(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	services, total, err := a.controller.list(page, perPage)
+	var (
+		services []Service
+		total    int
+	)
+	if expiring := req.Form.Get(catalog.GetParamExpiring); expiring != "" {
+		within, parseErr := catalog.ParseExpiringParam(expiring)
+		if parseErr != nil {
+			ErrorResponse(w, http.StatusBadRequest, "Error parsing query parameters:", parseErr.Error())
+			return
+		}
+		services, total, err = a.listServices(req, func(page, perPage int) ([]Service, int, error) {
+			return a.controller.expiring(tenancy.Get(req), within, page, perPage)
+		}, page, perPage)
+	} else {
+		services, total, err = a.listServices(req, func(page, perPage int) ([]Service, int, error) {
+			return a.controller.list(tenancy.Get(req), page, perPage)
+		}, page, perPage)
+	}
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -109,7 +142,9 @@ func (a *CatalogAPI) Filter(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	services, total, err := a.controller.filter(path, op, value, page, perPage)
+	services, total, err := a.listServices(req, func(page, perPage int) ([]Service, int, error) {
+		return a.controller.filter(tenancy.Get(req), path, op, value, page, perPage)
+	}, page, perPage)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -135,11 +170,52 @@ func (a *CatalogAPI) Filter(w http.ResponseWriter, req *http.Request) {
 	w.Write(b)
 }
 
+// Lists the changes of the catalog following a position in its event log
+// Waits for new events (long-polling) if there are none
+func (a *CatalogAPI) Events(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error parsing the query:", err.Error())
+		return
+	}
+	since, wait, err := catalog.ParseEventParams(
+		req.Form.Get(catalog.GetParamSince), req.Form.Get(catalog.GetParamWait))
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Error parsing query parameters:", err.Error())
+		return
+	}
+
+	coll, err := a.controller.events(req.Context(), tenancy.Get(req), req.Form.Get(catalog.GetParamEpoch), since, wait)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	coll.Context = a.ctxPath
+	coll.Id = fmt.Sprintf("%s/%s", a.apiLocation, TypeEvents)
+	if allowed := validator.EntryFilter(req); allowed != nil {
+		events := make([]Event, 0, len(coll.Events))
+		for _, e := range coll.Events {
+			if allowed(e.Service) {
+				events = append(events, e)
+			}
+		}
+		coll.Events = events
+	}
+
+	b, err := json.Marshal(coll)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/ld+json;version="+ApiVersion)
+	w.Write(b)
+}
+
 // Retrieves a service
 func (a *CatalogAPI) Get(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 
-	s, err := a.controller.get(params["id"])
+	s, err := a.controller.get(tenancy.Get(req), params["id"])
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -150,6 +226,10 @@ func (a *CatalogAPI) Get(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 	}
+	if !accessible(req, s) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the service")
+		return
+	}
 
 	lds := JSONLDService{
 		Context: a.ctxPath,
@@ -185,10 +265,23 @@ func (a *CatalogAPI) Post(w http.ResponseWriter, req *http.Request) {
 		ErrorResponse(w, http.StatusBadRequest, "Creating a service with defined ID is not possible using a POST request.")
 		return
 	}
+	s.Tenant = tenancy.Get(req)
+
+	if err := a.controller.checkTTL(s.Ttl, userOf(req)); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid service registration:", err.Error())
+		return
+	}
+	if !accessible(req, &s) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the service")
+		return
+	}
 
-	id, err := a.controller.add(s)
+	id, err := a.controller.add(s, validator.GetUserProfile(req))
 	if err != nil {
 		switch err.(type) {
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
 		case *ConflictError:
 			ErrorResponse(w, http.StatusConflict, "Error creating the registration:", err.Error())
 			return
@@ -210,6 +303,7 @@ func (a *CatalogAPI) Post(w http.ResponseWriter, req *http.Request) {
 // or creates a new one with the given id (Response: StatusCreated)
 func (a *CatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
+	user := validator.GetUserProfile(req)
 
 	body, err := ioutil.ReadAll(req.Body)
 	req.Body.Close()
@@ -223,15 +317,30 @@ func (a *CatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 		ErrorResponse(w, http.StatusBadRequest, "Error processing the request:", err.Error())
 		return
 	}
+	s.Tenant = tenancy.Get(req)
 
-	err = a.controller.update(params["id"], s)
+	if err := a.controller.checkTTL(s.Ttl, userOf(req)); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid service registration:", err.Error())
+		return
+	}
+	// Both the stored and the updated service must be accessible
+	if !accessible(req, &s) || !a.accessibleService(req, params["id"]) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the service")
+		return
+	}
+
+	err = a.controller.update(params["id"], s, user)
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
 			// Create a new service with the given id
 			s.Id = params["id"]
-			id, err := a.controller.add(s)
+			id, err := a.controller.add(s, user)
 			if err != nil {
+				if _, forbidden := err.(*ForbiddenError); forbidden {
+					ErrorResponse(w, http.StatusForbidden, err.Error())
+					return
+				}
 				ErrorResponse(w, http.StatusInternalServerError, "Error creating the registration:", err.Error())
 				return
 			}
@@ -239,6 +348,9 @@ func (a *CatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 			w.Header().Set("Location", fmt.Sprintf("%s/%s", a.apiLocation, id))
 			w.WriteHeader(http.StatusCreated)
 			return
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
 		case *ConflictError:
 			ErrorResponse(w, http.StatusConflict, "Error updating the service:", err.Error())
 			return
@@ -259,12 +371,20 @@ func (a *CatalogAPI) Put(w http.ResponseWriter, req *http.Request) {
 func (a *CatalogAPI) Delete(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 
-	err := a.controller.delete(params["id"])
+	if !a.accessibleService(req, params["id"]) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the service")
+		return
+	}
+
+	err := a.controller.delete(tenancy.Get(req), params["id"], validator.GetUserProfile(req))
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
 			ErrorResponse(w, http.StatusNotFound, err.Error())
 			return
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
 		default:
 			ErrorResponse(w, http.StatusInternalServerError, "Error deleting the service:", err.Error())
 			return
@@ -274,3 +394,82 @@ func (a *CatalogAPI) Delete(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/ld+json;version="+ApiVersion)
 	w.WriteHeader(http.StatusOK)
 }
+
+// Renews the registration of a service, extending its expiry time by the TTL
+func (a *CatalogAPI) Heartbeat(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+
+	if !a.accessibleService(req, params["id"]) {
+		ErrorResponse(w, http.StatusForbidden, "Access denied to the service")
+		return
+	}
+
+	err := a.controller.heartbeat(tenancy.Get(req), params["id"], validator.GetUserProfile(req))
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			ErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		case *ForbiddenError:
+			ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
+		default:
+			ErrorResponse(w, http.StatusInternalServerError, "Error renewing the registration:", err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/ld+json;version="+ApiVersion)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Returns the name of the authenticated user of a request, or an empty string if authentication is disabled
+func userOf(req *http.Request) string {
+	if profile := validator.GetUserProfile(req); profile != nil {
+		return profile.Username
+	}
+	return ""
+}
+
+// Checks whether the entry is accessible according to the conditions of the authorization rules
+func accessible(req *http.Request, entry interface{}) bool {
+	allowed := validator.EntryFilter(req)
+	return allowed == nil || allowed(entry)
+}
+
+// Checks whether a stored service is accessible, if it exists
+func (a *CatalogAPI) accessibleService(req *http.Request, id string) bool {
+	s, err := a.controller.get(tenancy.Get(req), id)
+	if err != nil {
+		// not found and other errors are reported by the controller
+		return true
+	}
+	return accessible(req, s)
+}
+
+// Returns a page of services, filtered by the conditions of the authorization rules if needed
+// All services are fetched to keep the allowed ones, which are then paginated
+func (a *CatalogAPI) listServices(req *http.Request, fetch func(page, perPage int) ([]Service, int, error),
+	page, perPage int) ([]Service, int, error) {
+	allowed := validator.EntryFilter(req)
+	if allowed == nil {
+		return fetch(page, perPage)
+	}
+
+	entries, total, err := catalog.FilterPage(func(page, perPage int) ([]interface{}, int, error) {
+		services, total, err := fetch(page, perPage)
+		entries := make([]interface{}, len(services))
+		for i := range services {
+			entries[i] = &services[i]
+		}
+		return entries, total, err
+	}, allowed, page, perPage, MaxPerPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	services := make([]Service, len(entries))
+	for i, entry := range entries {
+		services[i] = *entry.(*Service)
+	}
+	return services, total, nil
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pborman/uuid"
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/sec/auth/validator"
+	"linksmart.eu/lc/sec/authz"
 )
 
 func setupRouter() (*mux.Router, func(), error) {
@@ -50,9 +52,11 @@ func setupRouter() (*mux.Router, func(), error) {
 	r := mux.NewRouter().StrictSlash(true)
 	// CRUD
 	r.Methods("POST").Path(TestApiLocation + "/").HandlerFunc(api.Post)
+	r.Methods("GET").Path(TestApiLocation + "/events").HandlerFunc(api.Events)
 	r.Methods("GET").Path(TestApiLocation + "/{id:[^/]+/?[^/]*}").HandlerFunc(api.Get)
 	r.Methods("PUT").Path(TestApiLocation + "/{id:[^/]+/?[^/]*}").HandlerFunc(api.Put)
 	r.Methods("DELETE").Path(TestApiLocation + "/{id:[^/]+/?[^/]*}").HandlerFunc(api.Delete)
+	r.Methods("POST").Path(TestApiLocation + "/{id:[^/]+/?[^/]*}/" + utils.HeartbeatPath).HandlerFunc(api.Heartbeat)
 	// List, Filter
 	r.Methods("GET").Path(TestApiLocation).HandlerFunc(api.List)
 	r.Methods("GET").Path(TestApiLocation + "/{path}/{op}/{value:.*}").HandlerFunc(api.Filter)
@@ -405,6 +409,49 @@ func TestDelete(t *testing.T) {
 
 }
 
+func TestHeartbeat(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	service := mockedService("1")
+	b, _ := json.Marshal(service)
+
+	// Create
+	url := ts.URL + TestApiLocation + "/" + service.Id
+	t.Log("Calling PUT", url)
+	res, err := httpPut(url, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+
+	// Renew
+	t.Log("Calling POST", url+"/heartbeat")
+	res, err = http.Post(url+"/heartbeat", "", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Server should return %v, got instead: %v (%s)", http.StatusOK, res.StatusCode, res.Status)
+	}
+
+	// Unknown service
+	res, err = http.Post(ts.URL+TestApiLocation+"/TestHost/Unknown/heartbeat", "", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("Server should return %v, got instead: %v (%s)", http.StatusNotFound, res.StatusCode, res.Status)
+	}
+}
+
 func TestFilter(t *testing.T) {
 	router, shutdown, err := setupRouter()
 	if err != nil {
@@ -473,6 +520,91 @@ func TestFilter(t *testing.T) {
 	}
 }
 
+// Validates tickets in the form of user names
+type testDriver struct{}
+
+func (testDriver) Validate(serverAddr, serviceID, ticket string) (bool, *validator.UserProfile, error) {
+	return true, &validator.UserProfile{Username: ticket}, nil
+}
+
+func init() {
+	validator.Register("service-test", testDriver{})
+}
+
+func TestAuthorizedEntries(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	// alice may access the services with test-id 1, bob all of them
+	rules := &authz.Conf{Rules: []authz.Rule{
+		{Resources: []string{TestApiLocation}, Methods: []string{authz.AnyMethod}, Users: []string{"alice"},
+			Conditions: []authz.Condition{{Field: "meta.test-id", Op: authz.OpEquals, Value: "1"}}},
+		{Resources: []string{TestApiLocation}, Methods: []string{authz.AnyMethod}, Users: []string{"bob"}},
+	}}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err.Error())
+	}
+	v, err := validator.Setup("service-test", "", "", false, rules)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	handler := v.Handler(router)
+
+	request := func(method, path, user string, body interface{}) *httptest.ResponseRecorder {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+user)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	total := func(w *httptest.ResponseRecorder) int {
+		var coll Collection
+		if err := json.Unmarshal(w.Body.Bytes(), &coll); err != nil {
+			t.Fatal(err.Error())
+		}
+		return coll.Total
+	}
+
+	service1, service2 := mockedService("1"), mockedService("2")
+	if w := request("PUT", TestApiLocation+"/"+service2.Id, "alice", service2); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected %d creating an inaccessible service, got %d", http.StatusForbidden, w.Code)
+	}
+	for _, s := range []*Service{service1, service2} {
+		if w := request("PUT", TestApiLocation+"/"+s.Id, "bob", s); w.Code != http.StatusCreated {
+			t.Fatalf("Expected %d creating %s, got %d: %s", http.StatusCreated, s.Id, w.Code, w.Body)
+		}
+	}
+
+	// Single entries
+	for user, codes := range map[string][2]int{"alice": {http.StatusOK, http.StatusForbidden}, "bob": {http.StatusOK, http.StatusOK}} {
+		for i, s := range []*Service{service1, service2} {
+			if w := request("GET", TestApiLocation+"/"+s.Id, user, nil); w.Code != codes[i] {
+				t.Errorf("Expected %d retrieving %s as %s, got %d", codes[i], s.Id, user, w.Code)
+			}
+		}
+	}
+	if w := request("DELETE", TestApiLocation+"/"+service2.Id, "alice", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected %d deleting an inaccessible service, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Lists and filters
+	for user, expected := range map[string]int{"alice": 1, "bob": 2} {
+		if n := total(request("GET", TestApiLocation, user, nil)); n != expected {
+			t.Errorf("Expected %d services listed for %s, got %d", expected, user, n)
+		}
+		if n := total(request("GET", TestApiLocation+"/name/"+utils.FOpPrefix+"/Test", user, nil)); n != expected {
+			t.Errorf("Expected %d services filtered for %s, got %d", expected, user, n)
+		}
+	}
+}
+
 func httpPut(url string, r *bytes.Reader) (*http.Response, error) {
 	req, err := http.NewRequest("PUT", url, r)
 	if err != nil {
@@ -2,6 +2,8 @@
 
 package service
 
+import "context"
+
 // ServiceConfig is a wrapper for Service to be used by
 // clients to configure a Service (e.g., read from file)
 type ServiceConfig struct {
@@ -26,6 +28,9 @@ type CatalogClient interface {
 	Update(id string, s *Service) error
 	Delete(id string) error
 
+	// Renews the registration, extending its expiry time by the TTL
+	Heartbeat(id string) error
+
 	// Returns a slice of Services given:
 	// page - page in the collection
 	// perPage - number of entries per page
@@ -33,4 +38,17 @@ type CatalogClient interface {
 
 	// Returns a slice of Services given: path, operation, value, page, perPage
 	Filter(path, op, value string, page, perPage int) ([]Service, int, error)
+
+	// Variants of the above using a context for cancellation and deadlines
+	GetContext(ctx context.Context, id string) (*Service, error)
+	AddContext(ctx context.Context, s *Service) (string, error)
+	UpdateContext(ctx context.Context, id string, s *Service) error
+	DeleteContext(ctx context.Context, id string) error
+	HeartbeatContext(ctx context.Context, id string) error
+	ListContext(ctx context.Context, page, perPage int) ([]Service, int, error)
+	FilterContext(ctx context.Context, path, op, value string, page, perPage int) ([]Service, int, error)
+
+	// Watches the changes of services matching the filter until ctx is done
+	// Missed changes (e.g. during a disconnection) are recovered by listing the services
+	Watch(ctx context.Context, filter WatchFilter) (<-chan Event, error)
 }
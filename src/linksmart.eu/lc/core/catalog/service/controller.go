@@ -3,13 +3,16 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
-	avl "github.com/ancientlore/go-avltree"
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/metrics"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/sec/auth/validator"
 )
 
 type Controller struct {
@@ -18,23 +21,53 @@ type Controller struct {
 	storage     CatalogStorage
 	apiLocation string
 	listeners   []Listener
-	ticker      *time.Ticker
+	ttlPolicy   catalog.TTLPolicy
+	ownership   catalog.OwnershipPolicy
 
-	// startTime and counter for ID generation
-	startTime int64
-	counter   int64
+	// generator of the ids of services
+	idGenerator catalog.IDGenerator
 
-	// sorted expiryTime->serviceID maps
-	exp_sid *avl.Tree
+	// expiry times of services by storage key (see tenancy.Key)
+	expiry *catalog.ExpiryIndex
+	// removal times of stale services (expiry time + grace period) by storage key
+	staleExpiry *catalog.ExpiryIndex
+	// runs cleanExpired at the next expiry or removal time
+	expiryTimer *catalog.ExpiryTimer
+
+	// latest changes for watching clients
+	eventLog *catalog.EventLog
+}
+
+// ControllerOptions are the optional settings of a Controller
+type ControllerOptions struct {
+	// Policy for the TTL of the registrations
+	TTLPolicy catalog.TTLPolicy
+	// Policy for the modification of the registrations of other users
+	Ownership catalog.OwnershipPolicy
+	// Generator of the ids of services, by default a catalog.TimestampIDGenerator
+	IDGenerator catalog.IDGenerator
 }
 
 func NewController(storage CatalogStorage, apiLocation string, listeners ...Listener) (CatalogController, error) {
+	return NewControllerWithOptions(storage, apiLocation, ControllerOptions{}, listeners...)
+}
+
+// NewControllerWithOptions creates a Controller with the given options
+func NewControllerWithOptions(storage CatalogStorage, apiLocation string, options ControllerOptions, listeners ...Listener) (CatalogController, error) {
 	c := Controller{
 		storage:     storage,
 		apiLocation: apiLocation,
-		exp_sid:     avl.New(timeKeys, avl.AllowDuplicates), // allows more than one service with the same expiry time
-		startTime:   time.Now().UTC().Unix(),
+		ttlPolicy:   options.TTLPolicy,
+		ownership:   options.Ownership,
+		expiry:      catalog.NewExpiryIndex(),
+		staleExpiry: catalog.NewExpiryIndex(),
+		idGenerator: options.IDGenerator,
 		listeners:   listeners,
+		eventLog:    catalog.NewEventLog(catalog.DefaultEventLogSize),
+	}
+
+	if c.idGenerator == nil {
+		c.idGenerator = catalog.NewTimestampIDGenerator()
 	}
 
 	// Initialize secondary indices (if a persistent storage backend is present)
@@ -43,28 +76,45 @@ func NewController(storage CatalogStorage, apiLocation string, listeners ...List
 		return nil, err
 	}
 
-	c.ticker = time.NewTicker(5 * time.Second)
-	go c.cleanExpired()
+	c.expiryTimer = catalog.NewExpiryTimer(c.nextExpiry, c.cleanExpired)
+
+	metrics.NewGaugeFunc(metricPrefix+"registrations", "Number of registered services", func() float64 {
+		total, _ := c.total(tenancy.All)
+		return float64(total)
+	})
 
 	return &c, nil
 }
 
-func (c *Controller) add(s Service) (string, error) {
+func (c *Controller) add(s Service, user *validator.UserProfile) (id string, err error) {
+	defer func() { observeOperation("add", err) }()
+
 	if err := s.validate(); err != nil {
 		return "", &BadRequestError{err.Error()}
 	}
+	if err := c.applyTTLPolicy(&s); err != nil {
+		return "", err
+	}
+	s.Owner, s.OwnerGroups, err = c.ownership.Claim(user, s.Owner, s.OwnerGroups)
+	if err != nil {
+		return "", &ForbiddenError{err.Error()}
+	}
 
 	c.Lock()
 	defer c.Unlock()
 
 	if s.Id == "" {
 		// System generated id
-		s.Id = c.newURN()
+		s.Id, err = c.newID(s.Tenant)
+		if err != nil {
+			return "", err
+		}
 	}
 	s.URL = fmt.Sprintf("%s/%s", c.apiLocation, s.Id)
 	s.Type = ApiRegistrationType
 	s.Created = time.Now().UTC()
 	s.Updated = s.Created
+	s.Stale = false
 	if s.Ttl == 0 {
 		s.Expires = nil
 	} else {
@@ -72,7 +122,7 @@ func (c *Controller) add(s Service) (string, error) {
 		s.Expires = &expires
 	}
 
-	err := c.storage.add(&s)
+	err = c.storage.add(&s)
 	if err != nil {
 		return "", err
 	}
@@ -80,6 +130,9 @@ func (c *Controller) add(s Service) (string, error) {
 	// Add secondary indices
 	c.addIndices(&s)
 
+	added := s
+	c.eventLog.Append(catalog.EventAdded, s.Id, &added)
+
 	// notify listeners
 	for _, l := range c.listeners {
 		go l.added(s)
@@ -88,23 +141,35 @@ func (c *Controller) add(s Service) (string, error) {
 	return s.Id, nil
 }
 
-func (c *Controller) get(id string) (*Service, error) {
-	return c.storage.get(id)
+func (c *Controller) get(tenant, id string) (*Service, error) {
+	return c.storage.get(tenant, id)
 }
 
-func (c *Controller) update(id string, s Service) error {
+func (c *Controller) update(id string, s Service, user *validator.UserProfile) (err error) {
+	defer func() { observeOperation("update", err) }()
+
 	if err := s.validate(); err != nil {
 		return &BadRequestError{err.Error()}
 	}
+	if err := c.applyTTLPolicy(&s); err != nil {
+		return err
+	}
 
 	c.Lock()
 	defer c.Unlock()
 
 	// Get the stored service
-	ss, err := c.storage.get(id)
+	ss, err := c.storage.get(s.Tenant, id)
 	if err != nil {
 		return err
 	}
+	if err := c.ownership.CheckModify(user, ss.Owner, ss.OwnerGroups); err != nil {
+		return &ForbiddenError{err.Error()}
+	}
+	owner, ownerGroups, err := c.ownership.Transfer(user, ss.Owner, ss.OwnerGroups, s.Owner, s.OwnerGroups)
+	if err != nil {
+		return &ForbiddenError{err.Error()}
+	}
 
 	// Shallow copy
 	var cp Service = *ss
@@ -113,7 +178,10 @@ func (c *Controller) update(id string, s Service) error {
 	ss.Description = s.Description
 	ss.Meta = s.Meta
 	ss.Ttl = s.Ttl
+	ss.Owner = owner
+	ss.OwnerGroups = ownerGroups
 	ss.Updated = time.Now().UTC()
+	ss.Stale = false
 	if ss.Ttl == 0 {
 		ss.Expires = nil
 	} else {
@@ -130,6 +198,9 @@ func (c *Controller) update(id string, s Service) error {
 	c.removeIndices(&cp)
 	c.addIndices(ss)
 
+	updated := *ss
+	c.eventLog.Append(catalog.EventUpdated, id, &updated)
+
 	// notify listeners
 	for _, l := range c.listeners {
 		go l.updated(s)
@@ -138,16 +209,21 @@ func (c *Controller) update(id string, s Service) error {
 	return nil
 }
 
-func (c *Controller) delete(id string) error {
+func (c *Controller) delete(tenant, id string, user *validator.UserProfile) (err error) {
+	defer func() { observeOperation("delete", err) }()
+
 	c.Lock()
 	defer c.Unlock()
 
-	old, err := c.storage.get(id)
+	old, err := c.storage.get(tenant, id)
 	if err != nil {
 		return err
 	}
+	if err := c.ownership.CheckModify(user, old.Owner, old.OwnerGroups); err != nil {
+		return &ForbiddenError{err.Error()}
+	}
 
-	err = c.storage.delete(id)
+	err = c.storage.delete(tenant, id)
 	if err != nil {
 		return err
 	}
@@ -155,6 +231,8 @@ func (c *Controller) delete(id string) error {
 	// Remove secondary indices
 	c.removeIndices(old)
 
+	c.eventLog.Append(catalog.EventDeleted, id, old)
+
 	// notify listeners
 	for _, l := range c.listeners {
 		go l.deleted(old.Id)
@@ -163,18 +241,103 @@ func (c *Controller) delete(id string) error {
 	return nil
 }
 
-func (c *Controller) list(page, perPage int) ([]Service, int, error) {
-	return c.storage.list(page, perPage)
+// Renews the registration of a service by extending its expiry time by the TTL
+// Unlike update, the service is not validated and the listeners are not notified
+// No event is logged, unless the service was stale
+func (c *Controller) heartbeat(tenant, id string, user *validator.UserProfile) (err error) {
+	defer func() { observeOperation("heartbeat", err) }()
+
+	c.Lock()
+	defer c.Unlock()
+
+	s, err := c.storage.get(tenant, id)
+	if err != nil {
+		return err
+	}
+	if err := c.ownership.CheckModify(user, s.Owner, s.OwnerGroups); err != nil {
+		return &ForbiddenError{err.Error()}
+	}
+	if s.Ttl == 0 {
+		// Never expires
+		return nil
+	}
+
+	expires := time.Now().UTC().Add(time.Duration(s.Ttl) * time.Second)
+	s.Expires = &expires
+	stale := s.Stale
+	s.Stale = false
+
+	err = c.storage.update(id, s)
+	if err != nil {
+		return err
+	}
+
+	c.indexExpiry(s)
+
+	if stale {
+		updated := *s
+		c.eventLog.Append(catalog.EventUpdated, id, &updated)
+	}
+
+	return nil
+}
+
+// Returns the services which expire within the given duration (including the stale ones) in the order of expiry
+func (c *Controller) expiring(tenant string, within time.Duration, page, perPage int) ([]Service, int, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	// The stale services have expired already, followed by the others
+	until := time.Now().UTC().Add(within)
+	var keys []string
+	for _, key := range append(c.staleExpiry.Before(until.Add(c.ttlPolicy.Grace())), c.expiry.Before(until)...) {
+		if t, _ := tenancy.SplitKey(key); tenancy.Matches(tenant, t) {
+			keys = append(keys, key)
+		}
+	}
+
+	// Pagination
+	offset, limit, err := catalog.GetPagingAttr(len(keys), page, perPage, MaxPerPage)
+	if err != nil {
+		return nil, 0, &BadRequestError{fmt.Sprintf("Unable to paginate: %s", err)}
+	}
+	services := make([]Service, 0, limit)
+	for _, key := range keys[offset : offset+limit] {
+		s, err := c.storage.get(tenancy.SplitKey(key))
+		if err != nil {
+			return nil, 0, err
+		}
+		services = append(services, *s)
+	}
+	return services, len(keys), nil
+}
+
+// Checks that a user is allowed to register a service with the given ttl
+func (c *Controller) checkTTL(ttl int, user string) error {
+	if ttl < 0 {
+		// Rejected by applyTTLPolicy
+		return nil
+	}
+	if err := c.ttlPolicy.CheckUser(uint(ttl), user); err != nil {
+		return &BadRequestError{err.Error()}
+	}
+	return nil
+}
+
+func (c *Controller) list(tenant string, page, perPage int) ([]Service, int, error) {
+	return c.storage.list(tenant, page, perPage)
 }
 
-func (c *Controller) filter(path, op, value string, page, perPage int) ([]Service, int, error) {
+func (c *Controller) filter(tenant, path, op, value string, page, perPage int) ([]Service, int, error) {
+	defer metricFilterDuration.ObserveSince(time.Now())
+
 	c.RLock()
 	defer c.RUnlock()
 
 	matches := make([]Service, 0)
 	pp := MaxPerPage
 	for p := 1; ; p++ {
-		services, t, err := c.storage.list(p, pp)
+		services, t, err := c.storage.list(tenant, p, pp)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -202,68 +365,145 @@ func (c *Controller) filter(path, op, value string, page, perPage int) ([]Servic
 	return matches[offset : offset+limit], len(matches), nil
 }
 
-func (c *Controller) total() (int, error) {
-	return c.storage.total()
+func (c *Controller) total(tenant string) (int, error) {
+	return c.storage.total(tenant)
 }
 
-func (c *Controller) cleanExpired() {
-	for t := range c.ticker.C {
-		c.Lock()
-
-		var expiredList []Map
-		for m := range c.exp_sid.Iter() {
-			if !m.(Map).key.(time.Time).After(t.UTC()) {
-				expiredList = append(expiredList, m.(Map))
-			} else {
-				// exp_did is sorted by time ascendingly: its elements expire in order
-				break
-			}
+// Returns the events following a position in the event log, waiting for new ones if there are none
+// Only the events of the services of the given tenant (or all tenants) are returned
+func (c *Controller) events(ctx context.Context, tenant, epoch string, since uint64, wait time.Duration) (*EventCollection, error) {
+	logged, epoch, last, resync := c.eventLog.Since(ctx, epoch, since, wait)
+
+	events := make([]Event, 0, len(logged))
+	for _, e := range logged {
+		if !tenancy.Matches(tenant, e.Object.(*Service).Tenant) {
+			continue
 		}
+		events = append(events, Event{
+			Seq:     e.Seq,
+			Type:    e.Type,
+			Id:      e.Id,
+			Service: e.Object.(*Service),
+		})
+	}
+	return &EventCollection{
+		Type:   ApiEventCollectionType,
+		Epoch:  epoch,
+		Last:   last,
+		Resync: resync,
+		Events: events,
+	}, nil
+}
 
-		for _, m := range expiredList {
-			id := m.value.(string)
-			logger.Printf("cleanExpired() Registration %v has expired\n", id)
+// Handles the services which have expired at the given time: marks them as stale during the grace period
+// or removes them, and removes the stale services at the end of the grace period
+// Called by the expiry timer
+func (c *Controller) cleanExpired(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
 
-			old, err := c.storage.get(id)
-			if err != nil {
-				logger.Printf("cleanExpired() Error retrieving device %v: %v\n", id, err.Error())
-				break
-			}
+	for _, key := range c.expiry.PopExpired(now) {
+		tenant, id := tenancy.SplitKey(key)
+		s, err := c.storage.get(tenant, id)
+		if err != nil {
+			logger.Errorf("cleanExpired() Error retrieving service %v: %v", id, err.Error())
+			continue
+		}
 
-			err = c.storage.delete(id)
+		// Keep the service as stale during the grace period
+		if s.Expires.Add(c.ttlPolicy.Grace()).After(now) {
+			logger.Infof("cleanExpired() Registration %v has expired and is stale", id)
+			s.Stale = true
+			err = c.storage.update(id, s)
 			if err != nil {
-				logger.Printf("cleanExpired() Error removing device %v: %v\n", id, err.Error())
-				break
+				logger.Errorf("cleanExpired() Error updating service %v: %v", id, err.Error())
+				continue
 			}
-			// Remove secondary indices
-			c.removeIndices(old)
+			c.indexExpiry(s)
+			updated := *s
+			c.eventLog.Append(catalog.EventUpdated, id, &updated)
+			continue
 		}
+		c.removeExpired(s)
+	}
+
+	for _, key := range c.staleExpiry.PopExpired(now) {
+		tenant, id := tenancy.SplitKey(key)
+		s, err := c.storage.get(tenant, id)
+		if err != nil {
+			logger.Errorf("cleanExpired() Error retrieving service %v: %v", id, err.Error())
+			continue
+		}
+		c.removeExpired(s)
+	}
+}
 
-		c.Unlock()
+// Removes an expired service
+// WARNING: the caller must obtain the lock before calling
+func (c *Controller) removeExpired(s *Service) {
+	logger.Infof("cleanExpired() Registration %v has expired", s.Id)
+
+	err := c.storage.delete(s.Tenant, s.Id)
+	if err != nil {
+		logger.Errorf("cleanExpired() Error removing service %v: %v", s.Id, err.Error())
+		return
 	}
+	// Remove secondary indices
+	c.removeIndices(s)
+
+	c.eventLog.Append(catalog.EventDeleted, s.Id, s)
+	metricExpired.Inc()
+}
+
+// Returns the earliest expiry time of a service or removal time of a stale service
+func (c *Controller) nextExpiry() (time.Time, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	next, found := c.expiry.Next()
+	if removal, ok := c.staleExpiry.Next(); ok && (!found || removal.Before(next)) {
+		return removal, true
+	}
+	return next, found
 }
 
 // Stop the controller
 func (c *Controller) Stop() error {
-	c.ticker.Stop()
+	c.expiryTimer.Stop()
 	return c.storage.Close()
 }
 
 // UTILITY FUNCTIONS
 
-// Generate a new unique urn for service
-// Format: urn:ls_service:id, where id is the timestamp(s) of the controller startTime+counter in hex
+// Applies the TTL policy to a service: sets the default ttl and checks its bounds
+func (c *Controller) applyTTLPolicy(s *Service) error {
+	if s.Ttl < 0 {
+		return &BadRequestError{"ttl must not be negative"}
+	}
+	s.Ttl = int(c.ttlPolicy.TTL(uint(s.Ttl)))
+	if err := c.ttlPolicy.Check(uint(s.Ttl)); err != nil {
+		return &BadRequestError{err.Error()}
+	}
+	return nil
+}
+
+// Generate a new unique id for service, e.g. urn:ls_service:id (see catalog.IDGenerator)
 // WARNING: the caller must obtain the lock before calling
-func (c *Controller) newURN() string {
-	c.counter++
-	return fmt.Sprintf("urn:ls_service:%x", c.startTime+c.counter)
+func (c *Controller) newID(tenant string) (string, error) {
+	return catalog.NewUniqueID(c.idGenerator, "service", func(id string) (bool, error) {
+		_, err := c.storage.get(tenant, id)
+		if _, notFound := err.(*NotFoundError); notFound {
+			return false, nil
+		}
+		return err == nil, err
+	})
 }
 
 // Initialize secondary indices (from a persistent storage backend)
 func (c *Controller) initIndices() error {
 	perPage := MaxPerPage
 	for page := 1; ; page++ {
-		devices, total, err := c.storage.list(page, perPage)
+		devices, total, err := c.storage.list(tenancy.All, page, perPage)
 		if err != nil {
 			return err
 		}
@@ -284,9 +524,7 @@ func (c *Controller) initIndices() error {
 func (c *Controller) addIndices(s *Service) {
 
 	// Add expiry time index
-	if s.Ttl != 0 {
-		c.exp_sid.Add(Map{*s.Expires, s.Id})
-	}
+	c.indexExpiry(s)
 }
 
 // Removes secondary indices
@@ -294,48 +532,30 @@ func (c *Controller) addIndices(s *Service) {
 func (c *Controller) removeIndices(s *Service) {
 
 	// Remove the expiry time index
-	// INFO:
-	// More than one service can have the same expiry time (i.e. map's key)
-	//	which leads to non-unique keys in the maps.
-	// This code removes keys with that expiry time (keeping them in a temp) until the
-	// 	desired target is reached. It then adds the items in the temp back to the tree.
-	if s.Ttl != 0 {
-		var temp []Map
-		for m := range c.exp_sid.Iter() {
-			id := m.(Map).value.(string)
-			if id == s.Id {
-				for { // go through all duplicates (same expiry times)
-					r := c.exp_sid.Remove(m)
-					if r == nil {
-						break
-					}
-					if id != s.Id {
-						temp = append(temp, r.(Map))
-					}
-				}
-				break
-			}
-		}
-		for _, r := range temp {
-			c.exp_sid.Add(r)
-		}
-	}
+	key := tenancy.Key(s.Tenant, s.Id)
+	c.expiry.Remove(key)
+	c.staleExpiry.Remove(key)
 }
 
-// AVL Tree: sorted nodes according to keys
-//
-// A node of the AVL Tree (go-avltree)
-type Map struct {
-	key   interface{}
-	value interface{}
-}
+// Indexes the expiry time of a service, or its removal time if it is stale
+// WARNING: the caller must obtain the lock before calling
+func (c *Controller) indexExpiry(s *Service) {
+	key := tenancy.Key(s.Tenant, s.Id)
+	c.expiry.Remove(key)
+	c.staleExpiry.Remove(key)
+	if s.Ttl == 0 {
+		// Never expires
+		return
+	}
+
+	index, t := c.expiry, *s.Expires
+	if s.Stale {
+		index, t = c.staleExpiry, t.Add(c.ttlPolicy.Grace())
+	}
+	index.Set(key, t)
 
-// Operator for Time-type key
-func timeKeys(a interface{}, b interface{}) int {
-	if a.(Map).key.(time.Time).Before(b.(Map).key.(time.Time)) {
-		return -1
-	} else if a.(Map).key.(time.Time).After(b.(Map).key.(time.Time)) {
-		return 1
+	// Wake up the timer if the service is the next to expire (not started yet while initializing the indices)
+	if next, _ := index.Next(); next.Equal(t) && c.expiryTimer != nil {
+		c.expiryTimer.Reset()
 	}
-	return 0
 }
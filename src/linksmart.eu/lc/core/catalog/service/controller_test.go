@@ -3,6 +3,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -10,10 +11,16 @@ import (
 
 	"github.com/pborman/uuid"
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/sec/auth/validator"
 	"time"
 )
 
 func setup() (CatalogController, func(), error) {
+	return setupWithOptions(ControllerOptions{})
+}
+
+func setupWithOptions(options ControllerOptions) (CatalogController, func(), error) {
 	var (
 		storage CatalogStorage
 		err     error
@@ -30,7 +37,7 @@ func setup() (CatalogController, func(), error) {
 		}
 	}
 
-	controller, err := NewController(storage, TestApiLocation)
+	controller, err := NewControllerWithOptions(storage, TestApiLocation, options)
 	if err != nil {
 		storage.Close()
 		return nil, nil, err
@@ -58,7 +65,7 @@ func TestAddService(t *testing.T) {
 	r.Ttl = 30
 	r.Protocols = []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
 
-	id, err := controller.add(r)
+	id, err := controller.add(r, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error on add: %v", err.Error())
 	}
@@ -66,7 +73,7 @@ func TestAddService(t *testing.T) {
 		t.Fatalf("User defined ID is not returned. Getting %v instead of %v\n", id, r.Id)
 	}
 
-	_, err = controller.add(r)
+	_, err = controller.add(r, nil)
 	if err == nil {
 		t.Error("Didn't get any error when adding a service with non-unique id.")
 	}
@@ -76,7 +83,7 @@ func TestAddService(t *testing.T) {
 	r2.Name = "ServiceName"
 	r2.Protocols = []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
 
-	id, err = controller.add(r2)
+	id, err = controller.add(r2, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error on add: %v", err.Error())
 	}
@@ -100,18 +107,18 @@ func TestUpdateService(t *testing.T) {
 	r.Ttl = 30
 	r.Protocols = []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
 
-	_, err = controller.add(r)
+	_, err = controller.add(r, nil)
 	if err != nil {
 		t.Errorf("Unexpected error on add: %v", err.Error())
 	}
 	r.Name = "UpdatedName"
 
-	err = controller.update(r.Id, r)
+	err = controller.update(r.Id, r, nil)
 	if err != nil {
 		t.Errorf("Unexpected error on update: %v", err.Error())
 	}
 
-	rg, err := controller.get(r.Id)
+	rg, err := controller.get(tenancy.Default, r.Id)
 	if err != nil {
 		t.Error("Unexpected error on get: %v", err.Error())
 	}
@@ -138,12 +145,12 @@ func TestGetService(t *testing.T) {
 	r.Ttl = 30
 	r.Protocols = []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
 
-	_, err = controller.add(r)
+	_, err = controller.add(r, nil)
 	if err != nil {
 		t.Errorf("Unexpected error on add: %v", err.Error())
 	}
 
-	rg, err := controller.get(r.Id)
+	rg, err := controller.get(tenancy.Default, r.Id)
 	if err != nil {
 		t.Error("Unexpected error on get: %v", err.Error())
 	}
@@ -168,17 +175,17 @@ func TestDeleteService(t *testing.T) {
 	r.Ttl = 30
 	r.Protocols = []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
 
-	_, err = controller.add(r)
+	_, err = controller.add(r, nil)
 	if err != nil {
 		t.Errorf("Unexpected error on add: %v", err.Error())
 	}
 
-	err = controller.delete(r.Id)
+	err = controller.delete(tenancy.Default, r.Id, nil)
 	if err != nil {
 		t.Error("Unexpected error on delete: %v", err.Error())
 	}
 
-	err = controller.delete(r.Id)
+	err = controller.delete(tenancy.Default, r.Id, nil)
 	if err == nil {
 		t.Error("Didn't get any error when deleting a deleted service.")
 	}
@@ -200,14 +207,14 @@ func TestListServices(t *testing.T) {
 		r.Id = "TestID" + "/" + r.Name
 		r.Ttl = 30
 		r.Protocols = []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
-		_, err := controller.add(r)
+		_, err := controller.add(r, nil)
 
 		if err != nil {
 			t.Errorf("Unexpected error on add: %v", err.Error())
 		}
 	}
 
-	p1pp2, total, _ := controller.list(1, 2)
+	p1pp2, total, _ := controller.list(tenancy.Default, 1, 2)
 	if total != 11 {
 		t.Errorf("Expected total is 11, returned: %v", total)
 	}
@@ -216,17 +223,17 @@ func TestListServices(t *testing.T) {
 		t.Errorf("Wrong number of entries: requested page=1 , perPage=2. Expected: 2, returned: %v", len(p1pp2))
 	}
 
-	p2pp2, _, _ := controller.list(2, 2)
+	p2pp2, _, _ := controller.list(tenancy.Default, 2, 2)
 	if len(p2pp2) != 2 {
 		t.Errorf("Wrong number of entries: requested page=2 , perPage=2. Expected: 2, returned: %v", len(p2pp2))
 	}
 
-	p2pp5, _, _ := controller.list(2, 5)
+	p2pp5, _, _ := controller.list(tenancy.Default, 2, 5)
 	if len(p2pp5) != 5 {
 		t.Errorf("Wrong number of entries: requested page=2 , perPage=5. Expected: 5, returned: %v", len(p2pp5))
 	}
 
-	p4pp3, _, _ := controller.list(4, 3)
+	p4pp3, _, _ := controller.list(tenancy.Default, 4, 3)
 	if len(p4pp3) != 2 {
 		t.Errorf("Wrong number of entries: requested page=4 , perPage=3. Expected: 2, returned: %v", len(p4pp3))
 	}
@@ -244,7 +251,7 @@ func TestFilterService(t *testing.T) {
 		_, err := controller.add(Service{
 			Name:      fmt.Sprintf("boring_%d", i),
 			Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
-		})
+		}, nil)
 		if err != nil {
 			t.Fatal("Error adding a service:", err.Error())
 		}
@@ -253,13 +260,13 @@ func TestFilterService(t *testing.T) {
 	controller.add(Service{
 		Name:      "interesting_1",
 		Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
-	})
+	}, nil)
 	controller.add(Service{
 		Name:      "interesting_2",
 		Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
-	})
+	}, nil)
 
-	services, total, err := controller.filter("name", "prefix", "interesting", 1, 10)
+	services, total, err := controller.filter(tenancy.Default, "name", "prefix", "interesting", 1, 10)
 	if err != nil {
 		t.Fatal("Error filtering services:", err.Error())
 	}
@@ -287,7 +294,7 @@ func TestCleanExpired(t *testing.T) {
 		Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
 	}
 
-	id, err := controller.add(d)
+	id, err := controller.add(d, nil)
 	if err != nil {
 		t.Fatal("Error adding a service:", err.Error())
 	}
@@ -296,7 +303,7 @@ func TestCleanExpired(t *testing.T) {
 	time.Sleep(6 * time.Second)
 
 	checkingTime := time.Now()
-	dd, err := controller.get(id)
+	dd, err := controller.get(tenancy.Default, id)
 	if err != nil {
 		switch err.(type) {
 		case *NotFoundError:
@@ -314,3 +321,206 @@ func TestCleanExpired(t *testing.T) {
 		)
 	}
 }
+
+func TestHeartbeatService(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setup()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	var r = Service{
+		Name:      "my_service",
+		Ttl:       30,
+		Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
+	}
+	id, err := controller.add(r, nil)
+	if err != nil {
+		t.Fatal("Error adding a service:", err.Error())
+	}
+	added, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the service:", err.Error())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	err = controller.heartbeat(tenancy.Default, id, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error on heartbeat: %v", err)
+	}
+
+	renewed, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the service:", err.Error())
+	}
+	if !renewed.Expires.After(*added.Expires) {
+		t.Errorf("Expected the expiry time to be extended, got %v (was %v)", renewed.Expires, added.Expires)
+	}
+	if !renewed.Updated.Equal(added.Updated) {
+		t.Errorf("Expected the update time to remain %v, got %v", added.Updated, renewed.Updated)
+	}
+
+	// The expiry index holds the new expiry time only
+	c := controller.(*Controller)
+	if expires, _ := c.expiry.Get(id); c.expiry.Len() != 1 || !expires.Equal(*renewed.Expires) {
+		t.Errorf("Expected the expiry index to hold %v, got %v", renewed.Expires, expires)
+	}
+
+	err = controller.heartbeat(tenancy.Default, "unknown", nil)
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("Expected NotFoundError for an unknown service, got %v", err)
+	}
+}
+
+func TestTTLPolicyService(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{MinTTL: 10, MaxTTL: 100, DefaultTTL: 60, ForbidNoExpiry: []string{"*"}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	protocols := []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
+
+	// Default ttl
+	id, err := controller.add(Service{Name: "my_service", Protocols: protocols}, nil)
+	if err != nil {
+		t.Fatal("Error adding a service:", err.Error())
+	}
+	s, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the service:", err.Error())
+	}
+	if s.Ttl != 60 || s.Expires == nil {
+		t.Errorf("Expected the default ttl of 60 with an expiry time, got %d and %v", s.Ttl, s.Expires)
+	}
+
+	// Bounds
+	for _, ttl := range []int{-1, 5, 101} {
+		_, err = controller.add(Service{Name: "my_service", Ttl: ttl, Protocols: protocols}, nil)
+		if _, ok := err.(*BadRequestError); !ok {
+			t.Errorf("Expected BadRequestError for ttl %d, got %v", ttl, err)
+		}
+		err = controller.update(id, Service{Name: "my_service", Ttl: ttl, Protocols: protocols}, nil)
+		if _, ok := err.(*BadRequestError); !ok {
+			t.Errorf("Expected BadRequestError when updating to ttl %d, got %v", ttl, err)
+		}
+	}
+
+	// Non-expiring registrations are replaced by the default ttl
+	if err := controller.checkTTL(0, ""); err != nil {
+		t.Errorf("Expected the default ttl to be allowed, got %v", err)
+	}
+}
+
+func TestOwnershipService(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		Ownership: utils.OwnershipPolicy{Enabled: true, AdminUsers: []string{"root"}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	alice := &validator.UserProfile{Username: "alice"}
+	eve := &validator.UserProfile{Username: "eve"}
+	protocols := []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}}
+
+	id, err := controller.add(Service{Name: "my_service", Protocols: protocols}, alice)
+	if err != nil {
+		t.Fatal("Error adding a service:", err.Error())
+	}
+	if s, _ := controller.get(tenancy.Default, id); s.Owner != "alice" {
+		t.Errorf("Expected the service to be owned by alice, got %q", s.Owner)
+	}
+
+	err = controller.update(id, Service{Name: "updated", Protocols: protocols}, eve)
+	if _, ok := err.(*ForbiddenError); !ok {
+		t.Errorf("Expected ForbiddenError on update by another user, got %v", err)
+	}
+	err = controller.delete(tenancy.Default, id, eve)
+	if _, ok := err.(*ForbiddenError); !ok {
+		t.Errorf("Expected ForbiddenError on delete by another user, got %v", err)
+	}
+
+	// Transfer by an admin
+	err = controller.update(id, Service{Name: "my_service", Owner: "eve", Protocols: protocols}, &validator.UserProfile{Username: "root"})
+	if err != nil {
+		t.Fatal("Unexpected error on transfer:", err.Error())
+	}
+	if err := controller.heartbeat(tenancy.Default, id, alice); err == nil {
+		t.Error("Expected heartbeat by the previous owner to be forbidden")
+	}
+	if err := controller.delete(tenancy.Default, id, eve); err != nil {
+		t.Error("Unexpected error on delete by the new owner:", err.Error())
+	}
+}
+
+func TestStaleService(t *testing.T) {
+	t.Log(TestStorageType)
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{GracePeriod: 60},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	id, err := controller.add(Service{
+		Name:      "my_service",
+		Ttl:       1,
+		Protocols: []Protocol{Protocol{Type: "REST", Endpoint: map[string]interface{}{"url": "http://localhost:9000/api"}}},
+	}, nil)
+	if err != nil {
+		t.Fatal("Error adding a service:", err.Error())
+	}
+
+	time.Sleep(6 * time.Second)
+
+	s, err := controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatalf("Expected the expired service to be kept during the grace period, got %v", err)
+	}
+	if !s.Stale {
+		t.Error("Expected the expired service to be stale")
+	}
+	// Events following the registration
+	coll, _ := controller.events(context.Background(), tenancy.Default, "", 0, 0)
+	coll, _ = controller.events(context.Background(), tenancy.Default, coll.Epoch, 1, 0)
+	if len(coll.Events) != 1 || coll.Events[0].Type != utils.EventUpdated || !coll.Events[0].Service.Stale {
+		t.Errorf("Expected an update event of the stale service, got %+v", coll.Events)
+	}
+
+	// Expiring soon, as already expired
+	services, total, err := controller.expiring(tenancy.Default, 0, 1, MaxPerPage)
+	if err != nil {
+		t.Fatal("Error listing expiring services:", err.Error())
+	}
+	if total != 1 || services[0].Id != id {
+		t.Errorf("Expected the stale service to be listed as expiring, got %d: %v", total, services)
+	}
+
+	// Renewed by a heartbeat
+	err = controller.heartbeat(tenancy.Default, id, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error on heartbeat: %v", err)
+	}
+	s, err = controller.get(tenancy.Default, id)
+	if err != nil {
+		t.Fatal("Error getting the service:", err.Error())
+	}
+	if s.Stale {
+		t.Error("Expected the service to be no longer stale after a heartbeat")
+	}
+	services, total, err = controller.expiring(tenancy.Default, 0, 1, MaxPerPage)
+	if err != nil {
+		t.Fatal("Error listing expiring services:", err.Error())
+	}
+	if total != 0 {
+		t.Errorf("Expected no expiring services after a heartbeat, got %d: %v", total, services)
+	}
+}
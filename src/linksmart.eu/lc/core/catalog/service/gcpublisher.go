@@ -96,7 +96,7 @@ func tunneledServiceFromResponse(res *http.Response) (*TunneledService, error) {
 
 func (l *GCPublisher) added(s Service) {
 	if !s.isGCTunnelable() {
-		logger.Printf("Ignoring service that cannot be tunneled in GC: %v\n", s.Id)
+		logger.Warnf("Ignoring service that cannot be tunneled in GC: %v", s.Id)
 		return
 	}
 
@@ -113,7 +113,7 @@ func (l *GCPublisher) added(s Service) {
 	// create tunneled service
 	tsvc, err := NewTunneledService(&ssvc.service, "")
 	if err != nil {
-		logger.Printf("Error creating GC Tunneled Service from the given Service: %v\n", err.Error())
+		logger.Errorf("Error creating GC Tunneled Service from the given Service: %v", err.Error())
 		l.mutex.Unlock()
 		return
 	}
@@ -123,14 +123,14 @@ func (l *GCPublisher) added(s Service) {
 	res, err := http.Post(l.serviceEndpoint.String(), "application/json", bytes.NewReader(b))
 
 	if err != nil {
-		logger.Printf("Error publishing new Service in GC: %v\n", err.Error())
+		logger.Errorf("Error publishing new Service in GC: %v", err.Error())
 		l.mutex.Unlock()
 		return
 	}
 
 	// FIXME: should return http.StatusCreated (201)!
 	if res.StatusCode != http.StatusOK {
-		logger.Printf("Error publishing new Service in GC. Tunneling Service returns: %v\n", res.StatusCode)
+		logger.Errorf("Error publishing new Service in GC. Tunneling Service returns: %v", res.StatusCode)
 		l.mutex.Unlock()
 		return
 	}
@@ -141,12 +141,12 @@ func (l *GCPublisher) added(s Service) {
 	// Parse the response to retrieve VAD
 	ts, err := tunneledServiceFromResponse(res)
 	if err != nil {
-		logger.Printf("Error parsing the Tunneling Service response: %v\n", err.Error())
+		logger.Errorf("Error parsing the Tunneling Service response: %v", err.Error())
 		l.mutex.Unlock()
 		return
 	}
 	ssvc.vad = ts.VirtualAddress
-	logger.Printf("Published service %v in the GC, VAD: %v\n", s.Id, ssvc.vad)
+	logger.Infof("Published service %v in the GC, VAD: %v", s.Id, ssvc.vad)
 
 	l.services[s.Id] = ssvc
 	l.mutex.Unlock()
@@ -216,7 +216,7 @@ func (l *GCPublisher) deleted(id string) {
 	ssvc, ok := l.services[id]
 
 	if !ok {
-		logger.Printf("Asked to delete unknown (not tunnellable?) service %v **will do nothing**", id)
+		logger.Warnf("Asked to delete unknown (not tunnellable?) service %v **will do nothing**", id)
 		l.mutex.Unlock()
 		return
 	}
@@ -226,20 +226,20 @@ func (l *GCPublisher) deleted(id string) {
 	res, err := http.DefaultClient.Do(req)
 
 	if err != nil {
-		logger.Printf("Error deleting Service in GC: %v\n", err.Error())
+		logger.Errorf("Error deleting Service in GC: %v", err.Error())
 		delete(l.services, id)
 		l.mutex.Unlock()
 		return
 	}
 
 	if res.StatusCode != http.StatusOK {
-		logger.Printf("Error deleting Service in GC. Tunneling Service returns: %v\n", res.StatusCode)
+		logger.Errorf("Error deleting Service in GC. Tunneling Service returns: %v", res.StatusCode)
 		delete(l.services, id)
 		l.mutex.Unlock()
 		return
 	}
 
-	logger.Printf("Deleted service %v from the GC, VAD: %v\n", id, ssvc.vad)
+	logger.Infof("Deleted service %v from the GC, VAD: %v", id, ssvc.vad)
 
 	delete(l.services, id)
 	l.mutex.Unlock()
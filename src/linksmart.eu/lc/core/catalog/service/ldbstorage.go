@@ -10,7 +10,9 @@ import (
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
 )
 
 // LevelDB storage
@@ -42,14 +44,15 @@ func (ls *LevelDBStorage) add(s *Service) error {
 		return err
 	}
 
-	_, err = ls.db.Get([]byte(s.Id), nil)
+	key := []byte(tenancy.Key(s.Tenant, s.Id))
+	_, err = ls.db.Get(key, nil)
 	if err == nil {
 		return &ConflictError{"Service id is not unique."}
 	} else if err != leveldb.ErrNotFound {
 		return err
 	}
 
-	err = ls.db.Put([]byte(s.Id), bytes, nil)
+	err = ls.db.Put(key, bytes, nil)
 	if err != nil {
 		return err
 	}
@@ -57,9 +60,9 @@ func (ls *LevelDBStorage) add(s *Service) error {
 	return nil
 }
 
-func (ls *LevelDBStorage) get(id string) (*Service, error) {
+func (ls *LevelDBStorage) get(tenant, id string) (*Service, error) {
 
-	bytes, err := ls.db.Get([]byte(id), nil)
+	bytes, err := ls.db.Get([]byte(tenancy.Key(tenant, id)), nil)
 	if err == leveldb.ErrNotFound {
 		return nil, &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
 	} else if err != nil {
@@ -81,7 +84,7 @@ func (ls *LevelDBStorage) update(id string, s *Service) error {
 	if err != nil {
 		return err
 	}
-	err = ls.db.Put([]byte(id), bytes, nil)
+	err = ls.db.Put([]byte(tenancy.Key(s.Tenant, id)), bytes, nil)
 	if err == leveldb.ErrNotFound {
 		return &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
 	} else if err != nil {
@@ -91,9 +94,9 @@ func (ls *LevelDBStorage) update(id string, s *Service) error {
 	return nil
 }
 
-func (ls *LevelDBStorage) delete(id string) error {
+func (ls *LevelDBStorage) delete(tenant, id string) error {
 
-	err := ls.db.Delete([]byte(id), nil)
+	err := ls.db.Delete([]byte(tenancy.Key(tenant, id)), nil)
 	if err == leveldb.ErrNotFound {
 		return &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
 	} else if err != nil {
@@ -105,9 +108,9 @@ func (ls *LevelDBStorage) delete(id string) error {
 
 // Utilities
 
-func (ls *LevelDBStorage) list(page int, perPage int) ([]Service, int, error) {
+func (ls *LevelDBStorage) list(tenant string, page int, perPage int) ([]Service, int, error) {
 
-	total, err := ls.total()
+	total, err := ls.total(tenant)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -120,7 +123,7 @@ func (ls *LevelDBStorage) list(page int, perPage int) ([]Service, int, error) {
 	// github.com/syndtr/goleveldb/leveldb/iterator
 	services := make([]Service, limit)
 	ls.wg.Add(1)
-	iter := ls.db.NewIterator(nil, nil)
+	iter := ls.db.NewIterator(keyRange(tenant), nil)
 	i := 0
 	for iter.Next() {
 		var s Service
@@ -146,10 +149,10 @@ func (ls *LevelDBStorage) list(page int, perPage int) ([]Service, int, error) {
 	return services, total, nil
 }
 
-func (s *LevelDBStorage) total() (int, error) {
+func (s *LevelDBStorage) total(tenant string) (int, error) {
 	c := 0
 	s.wg.Add(1)
-	iter := s.db.NewIterator(nil, nil)
+	iter := s.db.NewIterator(keyRange(tenant), nil)
 	for iter.Next() {
 		c++
 	}
@@ -167,3 +170,9 @@ func (s *LevelDBStorage) Close() error {
 	s.wg.Wait()
 	return s.db.Close()
 }
+
+// Returns the range of the keys of a tenant (or all tenants)
+func keyRange(tenant string) *util.Range {
+	start, limit := tenancy.KeyRange(tenant)
+	return &util.Range{Start: start, Limit: limit}
+}
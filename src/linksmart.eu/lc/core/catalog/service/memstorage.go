@@ -4,22 +4,25 @@ package service
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	avl "github.com/ancientlore/go-avltree"
 
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
 )
 
 // In-memory storage
 type MemoryStorage struct {
 	sync.RWMutex
-	services *avl.Tree
+	// services of each tenant
+	services map[string]*avl.Tree
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	storage := &MemoryStorage{
-		services: avl.New(operator, 0),
+		services: make(map[string]*avl.Tree),
 	}
 
 	return storage
@@ -29,7 +32,12 @@ func (ms *MemoryStorage) add(s *Service) error {
 	ms.Lock()
 	defer ms.Unlock()
 
-	_, duplicate := ms.services.Add(*s)
+	services, found := ms.services[s.Tenant]
+	if !found {
+		services = avl.New(operator, 0)
+		ms.services[s.Tenant] = services
+	}
+	_, duplicate := services.Add(*s)
 	if duplicate {
 		return &ConflictError{fmt.Sprintf("Service id %s is not unique", s.Id)}
 	}
@@ -37,11 +45,15 @@ func (ms *MemoryStorage) add(s *Service) error {
 	return nil
 }
 
-func (ms *MemoryStorage) get(id string) (*Service, error) {
+func (ms *MemoryStorage) get(tenant, id string) (*Service, error) {
 	ms.RLock()
 	defer ms.RUnlock()
 
-	s := ms.services.Find(Service{Id: id})
+	services, found := ms.services[tenant]
+	if !found {
+		return nil, &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
+	}
+	s := services.Find(Service{Id: id})
 	if s == nil {
 		return nil, &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
 	}
@@ -54,33 +66,36 @@ func (ms *MemoryStorage) update(id string, s *Service) error {
 	ms.Lock()
 	defer ms.Unlock()
 
-	r := ms.services.Remove(Service{Id: id})
-	if r == nil {
+	services, found := ms.services[s.Tenant]
+	if !found || services.Remove(Service{Id: id}) == nil {
 		return &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
 	}
 
-	ms.services.Add(*s)
+	services.Add(*s)
 
 	return nil
 }
 
-func (ms *MemoryStorage) delete(id string) error {
+func (ms *MemoryStorage) delete(tenant, id string) error {
 	ms.Lock()
 	defer ms.Unlock()
 
-	r := ms.services.Remove(Service{Id: id})
-	if r == nil {
+	services, found := ms.services[tenant]
+	if !found || services.Remove(Service{Id: id}) == nil {
 		return &NotFoundError{fmt.Sprintf("Service with id %s is not found", id)}
 	}
+	if services.Len() == 0 {
+		delete(ms.services, tenant)
+	}
 
 	return nil
 }
 
-func (ms *MemoryStorage) list(page int, perPage int) ([]Service, int, error) {
+func (ms *MemoryStorage) list(tenant string, page int, perPage int) ([]Service, int, error) {
 	ms.RLock()
 	defer ms.RUnlock()
 
-	total := ms.services.Len()
+	total := ms.count(tenant)
 	offset, limit, err := catalog.GetPagingAttr(total, page, perPage, MaxPerPage)
 	if err != nil {
 		return nil, 0, &BadRequestError{fmt.Sprintf("Unable to paginate: %s", err)}
@@ -91,8 +106,12 @@ func (ms *MemoryStorage) list(page int, perPage int) ([]Service, int, error) {
 		return []Service{}, 0, nil
 	}
 
+	// Services ordered by tenant, then id
+	var data []interface{}
+	for _, t := range ms.tenants(tenant) {
+		data = append(data, ms.services[t].Data()...)
+	}
 	services := make([]Service, limit)
-	data := ms.services.Data()
 	for i := 0; i < limit; i++ {
 		services[i] = data[i+offset].(Service)
 	}
@@ -100,17 +119,44 @@ func (ms *MemoryStorage) list(page int, perPage int) ([]Service, int, error) {
 	return services, total, nil
 }
 
-func (ms *MemoryStorage) total() (int, error) {
+func (ms *MemoryStorage) total(tenant string) (int, error) {
 	ms.RLock()
 	defer ms.RUnlock()
 
-	return ms.services.Len(), nil
+	return ms.count(tenant), nil
 }
 
 func (ms *MemoryStorage) Close() error {
 	return nil
 }
 
+// Returns the number of services of a tenant (or all tenants)
+// WARNING: the caller must obtain the lock before calling
+func (ms *MemoryStorage) count(tenant string) int {
+	total := 0
+	for _, t := range ms.tenants(tenant) {
+		total += ms.services[t].Len()
+	}
+	return total
+}
+
+// Returns the sorted tenants with services selected by a tenant (or all tenants)
+// WARNING: the caller must obtain the lock before calling
+func (ms *MemoryStorage) tenants(tenant string) []string {
+	if tenant != tenancy.All {
+		if _, found := ms.services[tenant]; found {
+			return []string{tenant}
+		}
+		return nil
+	}
+	tenants := make([]string, 0, len(ms.services))
+	for t := range ms.services {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
 // Comparison operator for AVL Tree
 func operator(a interface{}, b interface{}) int {
 	if a.(Service).Id < b.(Service).Id {
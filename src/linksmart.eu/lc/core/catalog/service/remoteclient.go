@@ -3,7 +3,7 @@
 package service
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -16,10 +16,16 @@ import (
 
 type RemoteCatalogClient struct {
 	serverEndpoint *url.URL
-	ticket         *obtainer.Client
+	client         *catalog.HTTPClient
 }
 
 func NewRemoteCatalogClient(serverEndpoint string, ticket *obtainer.Client) (CatalogClient, error) {
+	return NewRemoteCatalogClientWithOptions(serverEndpoint, ticket, catalog.DefaultClientOptions())
+}
+
+// Creates a client with the given timeout, HTTP client and retry options
+func NewRemoteCatalogClientWithOptions(serverEndpoint string, ticket *obtainer.Client,
+	options catalog.ClientOptions) (CatalogClient, error) {
 	// Check if serverEndpoint is a correct URL
 	endpointUrl, err := url.Parse(serverEndpoint)
 	if err != nil {
@@ -28,17 +34,21 @@ func NewRemoteCatalogClient(serverEndpoint string, ticket *obtainer.Client) (Cat
 
 	return &RemoteCatalogClient{
 		serverEndpoint: endpointUrl,
-		ticket:         ticket,
+		client:         catalog.NewHTTPClient(ticket, options),
 	}, nil
 }
 
 // Retrieves a service
 func (c *RemoteCatalogClient) Get(id string) (*Service, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.GetContext(context.Background(), id)
+}
+
+// GetContext is like Get but uses ctx for the requests
+func (c *RemoteCatalogClient) GetContext(ctx context.Context, id string) (*Service, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v", c.serverEndpoint, id),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, err
@@ -54,7 +64,7 @@ func (c *RemoteCatalogClient) Get(id string) (*Service, error) {
 		return nil, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf(ErrorMsg(res))
+			return nil, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -70,6 +80,11 @@ func (c *RemoteCatalogClient) Get(id string) (*Service, error) {
 
 // Adds a service
 func (c *RemoteCatalogClient) Add(s *Service) (string, error) {
+	return c.AddContext(context.Background(), s)
+}
+
+// AddContext is like Add but uses ctx for the requests
+func (c *RemoteCatalogClient) AddContext(ctx context.Context, s *Service) (string, error) {
 	id := s.Id
 	service := *s
 	service.Id = ""
@@ -81,11 +96,10 @@ func (c *RemoteCatalogClient) Add(s *Service) (string, error) {
 	)
 
 	if id == "" { // Let the system generate an id
-		res, err = catalog.HTTPRequest("POST",
+		res, err = c.client.Do(ctx, "POST",
 			c.serverEndpoint.String()+"/",
 			map[string][]string{"Content-Type": []string{"application/ld+json"}},
-			bytes.NewReader(b),
-			c.ticket,
+			b,
 		)
 		if err != nil {
 			return "", err
@@ -95,11 +109,10 @@ func (c *RemoteCatalogClient) Add(s *Service) (string, error) {
 	} else { // User-defined id
 
 		// Check if id is unique
-		resGet, err := catalog.HTTPRequest("GET",
+		resGet, err := c.client.Do(ctx, "GET",
 			fmt.Sprintf("%v/%v", c.serverEndpoint, id),
 			nil,
 			nil,
-			c.ticket,
 		)
 		if err != nil {
 			return "", err
@@ -117,16 +130,15 @@ func (c *RemoteCatalogClient) Add(s *Service) (string, error) {
 			return "", &ConflictError{ErrorMsg(resGet)}
 		default:
 			if resGet.StatusCode != http.StatusNotFound {
-				return "", fmt.Errorf(ErrorMsg(resGet))
+				return "", &catalog.APIError{StatusCode: resGet.StatusCode, Message: ErrorMsg(resGet)}
 			}
 		}
 
 		// Now add
-		res, err = catalog.HTTPRequest("PUT",
+		res, err = c.client.Do(ctx, "PUT",
 			fmt.Sprintf("%v/%v", c.serverEndpoint, id),
 			map[string][]string{"Content-Type": []string{"application/ld+json"}},
-			bytes.NewReader(b),
-			c.ticket,
+			b,
 		)
 		if err != nil {
 			return "", err
@@ -143,7 +155,7 @@ func (c *RemoteCatalogClient) Add(s *Service) (string, error) {
 		return "", &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusCreated {
-			return "", fmt.Errorf(ErrorMsg(res))
+			return "", &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -158,12 +170,16 @@ func (c *RemoteCatalogClient) Add(s *Service) (string, error) {
 
 // Updates a service
 func (c *RemoteCatalogClient) Update(id string, s *Service) error {
+	return c.UpdateContext(context.Background(), id, s)
+}
+
+// UpdateContext is like Update but uses ctx for the requests
+func (c *RemoteCatalogClient) UpdateContext(ctx context.Context, id string, s *Service) error {
 	// Check if id is found
-	resGet, err := catalog.HTTPRequest("GET",
+	resGet, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v", c.serverEndpoint, id),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return err
@@ -179,16 +195,15 @@ func (c *RemoteCatalogClient) Update(id string, s *Service) error {
 		return &NotFoundError{ErrorMsg(resGet)}
 	default:
 		if resGet.StatusCode != http.StatusOK {
-			return fmt.Errorf(ErrorMsg(resGet))
+			return &catalog.APIError{StatusCode: resGet.StatusCode, Message: ErrorMsg(resGet)}
 		}
 	}
 
 	b, _ := json.Marshal(s)
-	res, err := catalog.HTTPRequest("PUT",
+	res, err := c.client.Do(ctx, "PUT",
 		fmt.Sprintf("%v/%v", c.serverEndpoint, id),
 		map[string][]string{"Content-Type": []string{"application/ld+json"}},
-		bytes.NewReader(b),
-		c.ticket,
+		b,
 	)
 	if err != nil {
 		return err
@@ -204,7 +219,7 @@ func (c *RemoteCatalogClient) Update(id string, s *Service) error {
 		return &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf(ErrorMsg(res))
+			return &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -213,11 +228,15 @@ func (c *RemoteCatalogClient) Update(id string, s *Service) error {
 
 // Deletes a service
 func (c *RemoteCatalogClient) Delete(id string) error {
-	res, err := catalog.HTTPRequest("DELETE",
+	return c.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is like Delete but uses ctx for the requests
+func (c *RemoteCatalogClient) DeleteContext(ctx context.Context, id string) error {
+	res, err := c.client.Do(ctx, "DELETE",
 		fmt.Sprintf("%v/%v", c.serverEndpoint, id),
 		nil,
-		bytes.NewReader([]byte{}),
-		c.ticket,
+		nil,
 	)
 	if err != nil {
 		return err
@@ -233,7 +252,36 @@ func (c *RemoteCatalogClient) Delete(id string) error {
 		return &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf(ErrorMsg(res))
+			return &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
+		}
+	}
+
+	return nil
+}
+
+// Renews the registration of a service, extending its expiry time by the TTL
+func (c *RemoteCatalogClient) Heartbeat(id string) error {
+	return c.HeartbeatContext(context.Background(), id)
+}
+
+// HeartbeatContext is like Heartbeat but uses ctx for the requests
+func (c *RemoteCatalogClient) HeartbeatContext(ctx context.Context, id string) error {
+	res, err := c.client.Do(ctx, "POST",
+		fmt.Sprintf("%v/%v/%v", c.serverEndpoint, id, catalog.HeartbeatPath),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return &NotFoundError{ErrorMsg(res)}
+	default:
+		if res.StatusCode != http.StatusOK {
+			return &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -242,12 +290,16 @@ func (c *RemoteCatalogClient) Delete(id string) error {
 
 // Retrieves a page from the service collection
 func (c *RemoteCatalogClient) List(page, perPage int) ([]Service, int, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.ListContext(context.Background(), page, perPage)
+}
+
+// ListContext is like List but uses ctx for the requests
+func (c *RemoteCatalogClient) ListContext(ctx context.Context, page, perPage int) ([]Service, int, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v?%v=%v&%v=%v",
 			c.serverEndpoint, catalog.GetParamPage, page, catalog.GetParamPerPage, perPage),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -263,7 +315,7 @@ func (c *RemoteCatalogClient) List(page, perPage int) ([]Service, int, error) {
 		return nil, 0, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, 0, fmt.Errorf(ErrorMsg(res))
+			return nil, 0, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -279,12 +331,16 @@ func (c *RemoteCatalogClient) List(page, perPage int) ([]Service, int, error) {
 
 // Filter services
 func (c *RemoteCatalogClient) Filter(path, op, value string, page, perPage int) ([]Service, int, error) {
-	res, err := catalog.HTTPRequest("GET",
+	return c.FilterContext(context.Background(), path, op, value, page, perPage)
+}
+
+// FilterContext is like Filter but uses ctx for the requests
+func (c *RemoteCatalogClient) FilterContext(ctx context.Context, path, op, value string, page, perPage int) ([]Service, int, error) {
+	res, err := c.client.Do(ctx, "GET",
 		fmt.Sprintf("%v/%v/%v/%v?%v=%v&%v=%v",
 			c.serverEndpoint, path, op, value, catalog.GetParamPage, page, catalog.GetParamPerPage, perPage),
 		nil,
 		nil,
-		c.ticket,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -300,7 +356,7 @@ func (c *RemoteCatalogClient) Filter(path, op, value string, page, perPage int)
 		return nil, 0, &NotFoundError{ErrorMsg(res)}
 	default:
 		if res.StatusCode != http.StatusOK {
-			return nil, 0, fmt.Errorf(ErrorMsg(res))
+			return nil, 0, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
 		}
 	}
 
@@ -314,6 +370,52 @@ func (c *RemoteCatalogClient) Filter(path, op, value string, page, perPage int)
 	return coll.Services, len(coll.Services), nil
 }
 
+// Watches services by polling the events of the catalog
+func (c *RemoteCatalogClient) Watch(ctx context.Context, filter WatchFilter) (<-chan Event, error) {
+	list := func(ctx context.Context, page, perPage int) ([]Service, int, error) {
+		if filter.Path != "" {
+			return c.FilterContext(ctx, filter.Path, filter.Op, filter.Value, page, perPage)
+		}
+		return c.ListContext(ctx, page, perPage)
+	}
+	return watch(ctx, filter, c.events, list), nil
+}
+
+// Retrieves the events following a position in the event log of the catalog
+func (c *RemoteCatalogClient) events(ctx context.Context, epoch string, since uint64) (*EventCollection, error) {
+	res, err := c.client.Do(ctx, "GET",
+		fmt.Sprintf("%v/%v?%v=%v&%v=%v&%v=%v", c.serverEndpoint, TypeEvents,
+			catalog.GetParamEpoch, url.QueryEscape(epoch), catalog.GetParamSince, since,
+			catalog.GetParamWait, int(c.client.EventWait().Seconds())),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusBadRequest:
+		return nil, &BadRequestError{ErrorMsg(res)}
+	case http.StatusNotFound:
+		return nil, &NotFoundError{ErrorMsg(res)}
+	default:
+		if res.StatusCode != http.StatusOK {
+			return nil, &catalog.APIError{StatusCode: res.StatusCode, Message: ErrorMsg(res)}
+		}
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	var coll EventCollection
+	err = decoder.Decode(&coll)
+	if err != nil {
+		return nil, err
+	}
+
+	return &coll, nil
+}
+
 // Returns the message field of a resource.Error response
 func ErrorMsg(res *http.Response) string {
 	decoder := json.NewDecoder(res.Body)
@@ -0,0 +1,202 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"linksmart.eu/lc/core/catalog"
+)
+
+func testClientOptions() catalog.ClientOptions {
+	return catalog.ClientOptions{
+		Timeout:    time.Second,
+		MaxRetries: 2,
+		Backoff:    time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	}
+}
+
+func TestRemoteClientRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			ErrorResponse(w, http.StatusServiceUnavailable, "Try again")
+			return
+		}
+		b, _ := json.Marshal(&Service{Id: "test"})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	client, _ := NewRemoteCatalogClientWithOptions(ts.URL, nil, testClientOptions())
+	s, err := client.Get("test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s.Id != "test" {
+		t.Errorf("Expected service test, got %v", s.Id)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 requests, got %d", calls)
+	}
+}
+
+func TestRemoteClientNoRetryOnPost(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		ErrorResponse(w, http.StatusServiceUnavailable, "Try again")
+	}))
+	defer ts.Close()
+
+	client, _ := NewRemoteCatalogClientWithOptions(ts.URL, nil, testClientOptions())
+	_, err := client.Add(&Service{Name: "test"})
+	apiErr, ok := err.(*catalog.APIError)
+	if !ok {
+		t.Fatalf("Expected *catalog.APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, apiErr.StatusCode)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 request, got %d", calls)
+	}
+}
+
+func TestRemoteClientNetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+
+	client, _ := NewRemoteCatalogClientWithOptions(url, nil, testClientOptions())
+	_, err := client.Get("test")
+	if _, ok := err.(*catalog.NetworkError); !ok {
+		t.Fatalf("Expected *catalog.NetworkError, got %T: %v", err, err)
+	}
+}
+
+func TestRemoteClientContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	client, _ := NewRemoteCatalogClientWithOptions(ts.URL, nil, catalog.ClientOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := client.ListContext(ctx, 1, 10)
+	if _, ok := err.(*catalog.NetworkError); !ok {
+		t.Fatalf("Expected *catalog.NetworkError, got %T: %v", err, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Request was not cancelled by the context deadline")
+	}
+}
+
+func TestRemoteClientWatch(t *testing.T) {
+	router, shutdown, err := setupRouter()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	defer shutdown()
+
+	client, _ := NewRemoteCatalogClientWithOptions(ts.URL+TestApiLocation, nil, testClientOptions())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.Watch(ctx, WatchFilter{"meta.test-id", catalog.FOpEquals, "1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// Let the watcher synchronize
+	time.Sleep(100 * time.Millisecond)
+
+	receive := func(eventType, id string) {
+		select {
+		case e := <-events:
+			if e.Type != eventType || e.Id != id {
+				t.Fatalf("Expected %s event of %s, got %s event of %s", eventType, id, e.Type, e.Id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for %s event of %s", eventType, id)
+		}
+	}
+
+	// Not matching
+	_, err = client.Add(mockedService("2"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s := mockedService("1")
+	_, err = client.Add(s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	receive(catalog.EventAdded, s.Id)
+
+	err = client.Delete(s.Id)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	receive(catalog.EventDeleted, s.Id)
+}
+
+func TestKeepAliveHeartbeat(t *testing.T) {
+	for _, supported := range []bool{true, false} {
+		var (
+			mutex    sync.Mutex
+			requests []string
+		)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mutex.Lock()
+			requests = append(requests, req.Method+" "+req.URL.Path)
+			mutex.Unlock()
+			switch req.Method {
+			case "POST":
+				if !supported {
+					// A catalog without the heartbeat endpoint
+					http.NotFound(w, req)
+				}
+			case "GET":
+				b, _ := json.Marshal(&Service{Id: "test"})
+				w.Write(b)
+			}
+		}))
+
+		client, _ := NewRemoteCatalogClientWithOptions(ts.URL, nil, testClientOptions())
+		sigCh := make(chan bool)
+		go keepAlive(client, &Service{Id: "test", Ttl: 1}, sigCh, make(chan error, 1))
+		// Renewed every 500ms
+		time.Sleep(1250 * time.Millisecond)
+		sigCh <- true
+		ts.Close()
+
+		expected := []string{"GET /test", "PUT /test", "POST /test/heartbeat"}
+		if supported {
+			expected = append(expected, "POST /test/heartbeat")
+		} else {
+			// Falls back to complete updates
+			expected = append(expected, "GET /test", "PUT /test", "GET /test", "PUT /test")
+		}
+		mutex.Lock()
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("Heartbeats supported: %v. Expected requests %v, got %v", supported, expected, requests)
+		}
+		mutex.Unlock()
+	}
+}
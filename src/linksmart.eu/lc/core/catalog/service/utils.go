@@ -3,6 +3,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,8 @@ import (
 
 const (
 	keepaliveRetries = 5
+	// Time limit for removing a registration on shutdown
+	deregistrationTimeout = 5 * time.Second
 )
 
 // Registers service given a configured Catalog Client
@@ -24,16 +27,16 @@ func RegisterService(client CatalogClient, s *Service) error {
 			// If not in the catalog - add
 			_, err = client.Add(s)
 			if err != nil {
-				logger.Printf("RegisterService() Error adding registration: %v", err)
+				logger.Errorf("RegisterService() Error adding registration: %v", err)
 				return err
 			}
-			logger.Printf("RegisterService() Added Service registration %v", s.Id)
+			logger.Infof("RegisterService() Added Service registration %v", s.Id)
 		default:
-			logger.Printf("RegisterService() Error updating registration: %v", err)
+			logger.Errorf("RegisterService() Error updating registration: %v", err)
 			return err
 		}
 	} else {
-		logger.Printf("RegisterService() Updated Service registration %v", s.Id)
+		logger.Infof("RegisterService() Updated Service registration %v", s.Id)
 	}
 	return nil
 }
@@ -45,42 +48,50 @@ func RegisterService(client CatalogClient, s *Service) error {
 // ticket: set to nil for no auth
 func RegisterServiceWithKeepalive(endpoint string, discover bool, s Service,
 	sigCh <-chan bool, wg *sync.WaitGroup, ticket *obtainer.Client) {
+	RegisterServiceWithKeepaliveOptions(endpoint, discover, s, sigCh, wg, ticket, utils.DefaultClientOptions())
+}
+
+// Registers service in the remote catalog using a client with the given options (e.g. TLS configuration)
+func RegisterServiceWithKeepaliveOptions(endpoint string, discover bool, s Service,
+	sigCh <-chan bool, wg *sync.WaitGroup, ticket *obtainer.Client, options utils.ClientOptions) {
 	defer wg.Done()
 	var err error
 	if discover {
 		endpoint, err = utils.DiscoverCatalogEndpoint(DNSSDServiceType)
 		if err != nil {
-			logger.Printf("RegisterServiceWithKeepalive() ERROR: Failed to discover the endpoint: %v", err.Error())
+			logger.Errorf("RegisterServiceWithKeepalive() Failed to discover the endpoint: %v", err.Error())
 			return
 		}
 	}
 
 	// Configure client
-	client, err := NewRemoteCatalogClient(endpoint, ticket)
+	client, err := NewRemoteCatalogClientWithOptions(endpoint, ticket, options)
 	if err != nil {
-		logger.Printf("RegisterServiceWithKeepalive() ERROR: Failed to create remote-catalog client: %v", err.Error())
+		logger.Errorf("RegisterServiceWithKeepalive() Failed to create remote-catalog client: %v", err.Error())
 		return
 	}
 
 	// Will not keepalive registration with a negative TTL
 	if s.Ttl <= 0 {
-		logger.Println("RegisterServiceWithKeepalive() WARNING: Registration has ttl <= 0. Will not start the keepalive routine")
+		logger.Warn("RegisterServiceWithKeepalive() Registration has ttl <= 0. Will not start the keepalive routine")
 		RegisterService(client, &s)
 
 		// catch a shutdown signal from the upstream
 		for _ = range sigCh {
-			logger.Printf("RegisterServiceWithKeepalive() Removing the registration %v/%v...", endpoint, s.Id)
-			client.Delete(s.Id)
+			logger.Infof("RegisterServiceWithKeepalive() Removing the registration %v/%v...", endpoint, s.Id)
+			ctx, cancel := context.WithTimeout(context.Background(), deregistrationTimeout)
+			client.DeleteContext(ctx, s.Id)
+			cancel()
 			if ticket != nil {
 				err := ticket.Delete()
 				if err != nil {
-					logger.Printf("RegisterServiceWithKeepalive() Error while deleting the TGT: %v", err.Error())
+					logger.Errorf("RegisterServiceWithKeepalive() Error while deleting the TGT: %v", err.Error())
 				}
 			}
 			return
 		}
 	}
-	logger.Printf("RegisterServiceWithKeepalive() Will register and update registration periodically: %v/%v", endpoint, s.Id)
+	logger.Infof("RegisterServiceWithKeepalive() Will register and update registration periodically: %v/%v", endpoint, s.Id)
 
 	// Configure & start the keepalive routine
 	ksigCh := make(chan bool)
@@ -91,39 +102,41 @@ func RegisterServiceWithKeepalive(endpoint string, discover bool, s Service,
 		select {
 		// catch an error from the keepAlive routine
 		case e := <-kerrCh:
-			logger.Println("RegisterServiceWithKeepalive() ERROR:", e)
+			logger.Error("RegisterServiceWithKeepalive()", e)
 			// Re-discover the endpoint if needed and start over
 			if discover {
 				endpoint, err = utils.DiscoverCatalogEndpoint(DNSSDServiceType)
 				if err != nil {
-					logger.Println("RegisterServiceWithKeepalive() ERROR:", err.Error())
+					logger.Error("RegisterServiceWithKeepalive()", err.Error())
 					return
 				}
 			}
-			logger.Println("RegisterServiceWithKeepalive() Will use the new endpoint: ", endpoint)
-			client, err := NewRemoteCatalogClient(endpoint, ticket)
+			logger.Info("RegisterServiceWithKeepalive() Will use the new endpoint: ", endpoint)
+			client, err := NewRemoteCatalogClientWithOptions(endpoint, ticket, options)
 			if err != nil {
-				logger.Printf("RegisterServiceWithKeepalive() ERROR: Failed to create remote-catalog client: %v", err.Error())
+				logger.Errorf("RegisterServiceWithKeepalive() Failed to create remote-catalog client: %v", err.Error())
 				return
 			}
 			go keepAlive(client, &s, ksigCh, kerrCh)
 
 		// catch a shutdown signal from the upstream
 		case <-sigCh:
-			logger.Printf("RegisterServiceWithKeepalive() Removing the registration %v/%v...", endpoint, s.Id)
+			logger.Infof("RegisterServiceWithKeepalive() Removing the registration %v/%v...", endpoint, s.Id)
 			// signal shutdown to the keepAlive routine & close channels
 			select {
 			case ksigCh <- true:
 				// delete entry in the remote catalog
-				client.Delete(s.Id)
+				ctx, cancel := context.WithTimeout(context.Background(), deregistrationTimeout)
+				client.DeleteContext(ctx, s.Id)
+				cancel()
 				if ticket != nil {
 					err := ticket.Delete()
 					if err != nil {
-						logger.Printf("RegisterServiceWithKeepalive() Error while deleting the TGT: %v", err.Error())
+						logger.Errorf("RegisterServiceWithKeepalive() Error while deleting the TGT: %v", err.Error())
 					}
 				}
 			case <-time.After(1 * time.Second):
-				logger.Printf("RegisterDeviceWithKeepalive(): timeout removing registration %v/%v: catalog unreachable", endpoint, s.Id)
+				logger.Errorf("RegisterDeviceWithKeepalive(): timeout removing registration %v/%v: catalog unreachable", endpoint, s.Id)
 			}
 
 			close(ksigCh)
@@ -142,6 +155,8 @@ func keepAlive(client CatalogClient, s *Service, sigCh <-chan bool, errCh chan<-
 	dur := (time.Duration(s.Ttl) * time.Second) / 2
 	ticker := time.NewTicker(dur)
 	errTries := 0
+	// Renew using heartbeats unless the catalog does not support them
+	heartbeats := true
 
 	// Register
 	RegisterService(client, s)
@@ -149,29 +164,50 @@ func keepAlive(client CatalogClient, s *Service, sigCh <-chan bool, errCh chan<-
 	for {
 		select {
 		case <-ticker.C:
-			err := client.Update(s.Id, s)
-			if err != nil {
+			update := !heartbeats
+			if heartbeats {
+				err := client.Heartbeat(s.Id)
 				switch err.(type) {
+				case nil:
+					logger.Debugf("keepAlive() Renewed Service registration %v", s.Id)
+					errTries = 0
 				case *NotFoundError:
-					// If not in the catalog - add
-					logger.Printf("keepAlive() ERROR: Registration %v not found in the remote catalog. TTL expired?", s.Id)
-					_, err = client.Add(s)
-					if err != nil {
-						logger.Printf("keepAlive() Error adding registration: %v", err)
-						errTries += 1
-					} else {
-						logger.Printf("keepAlive() Added Service registration %v", s.Id)
-						errTries = 0
-					}
+					// Expired registration or a catalog without heartbeats: update the complete registration
+					update = true
 				default:
-					logger.Printf("keepAlive() Error updating registration: %v", err)
+					logger.Errorf("keepAlive() Error renewing registration: %v", err)
 					errTries += 1
 				}
-			} else {
-				logger.Printf("keepAlive() Updated Service registration %v", s.Id)
-				errTries = 0
 			}
-
+			if update {
+				err := client.Update(s.Id, s)
+				if err != nil {
+					switch err.(type) {
+					case *NotFoundError:
+						// If not in the catalog - add
+						logger.Errorf("keepAlive() Registration %v not found in the remote catalog. TTL expired?", s.Id)
+						_, err = client.Add(s)
+						if err != nil {
+							logger.Errorf("keepAlive() Error adding registration: %v", err)
+							errTries += 1
+						} else {
+							logger.Infof("keepAlive() Added Service registration %v", s.Id)
+							errTries = 0
+						}
+					default:
+						logger.Errorf("keepAlive() Error updating registration: %v", err)
+						errTries += 1
+					}
+				} else {
+					if heartbeats {
+						// The registration exists but the heartbeat was not found
+						logger.Infof("keepAlive() Catalog does not support heartbeats. Will update the complete registration %v", s.Id)
+						heartbeats = false
+					}
+					logger.Debugf("keepAlive() Updated Service registration %v", s.Id)
+					errTries = 0
+				}
+			}
 			if errTries >= keepaliveRetries {
 				errCh <- fmt.Errorf("Number of retries exceeded")
 				ticker.Stop()
@@ -0,0 +1,208 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"linksmart.eu/lc/core/catalog"
+)
+
+// Event describes a change of a service registration
+type Event struct {
+	// Sequence number of the event in the catalog (zero for changes detected on resync)
+	Seq     uint64   `json:"seq,omitempty"`
+	Type    string   `json:"type"`
+	Id      string   `json:"id"`
+	Service *Service `json:"service"`
+}
+
+// WatchFilter selects the watched services using the path, operation and value of Filter
+// The zero value selects all services
+type WatchFilter struct {
+	Path  string
+	Op    string
+	Value string
+}
+
+func (f WatchFilter) match(s *Service) bool {
+	if f.Path == "" {
+		return true
+	}
+	matched, err := catalog.MatchObject(*s, strings.Split(f.Path, "."), f.Op, f.Value)
+	return err == nil && matched
+}
+
+// Polls the events following a position in the event log
+type eventPoller func(ctx context.Context, epoch string, since uint64) (*EventCollection, error)
+
+// Retrieves a page of the watched services
+type servicePager func(ctx context.Context, page, perPage int) ([]Service, int, error)
+
+// watcher delivers the changes of services matching a filter
+type watcher struct {
+	filter WatchFilter
+	out    chan Event
+	// last known state of the matching services
+	known map[string]*Service
+}
+
+// Starts a watcher and returns its channel of events
+// Events are polled continuously; on reconnection after failures or when events were missed,
+// the watcher resynchronizes by listing the services and emits the detected changes
+// The channel is closed when ctx is done
+func watch(ctx context.Context, filter WatchFilter, poll eventPoller, list servicePager) <-chan Event {
+	w := &watcher{
+		filter: filter,
+		out:    make(chan Event),
+		known:  make(map[string]*Service),
+	}
+	go w.run(ctx, poll, list)
+	return w.out
+}
+
+func (w *watcher) run(ctx context.Context, poll eventPoller, list servicePager) {
+	defer close(w.out)
+
+	var (
+		epoch    string
+		since    uint64
+		synced   bool
+		failures int
+	)
+	for {
+		coll, err := poll(ctx, epoch, since)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && coll.Resync {
+			epoch, since = coll.Epoch, coll.Last
+			// The initial listing only establishes the known state
+			err = w.resync(ctx, list, synced)
+			if err != nil {
+				// Force another resync
+				epoch = ""
+			} else {
+				synced = true
+			}
+		}
+		if err != nil {
+			delay := catalog.WatchBackoff(failures)
+			failures++
+			logger.Errorf("watch() Error: %v. Will retry in %v", err, delay)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		failures = 0
+		if coll.Resync {
+			continue
+		}
+
+		for _, e := range coll.Events {
+			if !w.emit(ctx, e) {
+				return
+			}
+		}
+		since = coll.Last
+	}
+}
+
+// Lists the matching services and emits the changes since the known state
+func (w *watcher) resync(ctx context.Context, list servicePager, emitChanges bool) error {
+	current := make(map[string]*Service)
+	for page := 1; ; page++ {
+		services, total, err := list(ctx, page, MaxPerPage)
+		if err != nil {
+			return err
+		}
+		for i := range services {
+			if w.filter.match(&services[i]) {
+				current[services[i].Id] = &services[i]
+			}
+		}
+		if page*MaxPerPage >= total {
+			break
+		}
+	}
+
+	known := w.known
+	w.known = current
+	if !emitChanges {
+		return nil
+	}
+
+	for id, s := range current {
+		prev, found := known[id]
+		switch {
+		case !found:
+			if !w.send(ctx, Event{Type: catalog.EventAdded, Id: id, Service: s}) {
+				return ctx.Err()
+			}
+		case !unchanged(prev, s):
+			if !w.send(ctx, Event{Type: catalog.EventUpdated, Id: id, Service: s}) {
+				return ctx.Err()
+			}
+		}
+	}
+	for id, s := range known {
+		if _, found := current[id]; !found {
+			if !w.send(ctx, Event{Type: catalog.EventDeleted, Id: id, Service: s}) {
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Emits an event if it concerns a matching service
+// Services that start or stop matching the filter are reported as added or deleted
+func (w *watcher) emit(ctx context.Context, e Event) bool {
+	prev, known := w.known[e.Id]
+
+	if e.Type == catalog.EventDeleted {
+		if !known && !w.filter.match(e.Service) {
+			return true
+		}
+		delete(w.known, e.Id)
+		return w.send(ctx, e)
+	}
+
+	matches := w.filter.match(e.Service)
+	switch {
+	case !matches && !known:
+		return true
+	case known && unchanged(prev, e.Service):
+		// Already delivered, e.g. by a resync
+		return true
+	case !matches:
+		delete(w.known, e.Id)
+		e.Type = catalog.EventDeleted
+	case !known:
+		w.known[e.Id] = e.Service
+		e.Type = catalog.EventAdded
+	default:
+		w.known[e.Id] = e.Service
+	}
+	return w.send(ctx, e)
+}
+
+// Checks whether a service is in the known state
+// Becoming stale or fresh again does not change the update time
+func unchanged(prev, s *Service) bool {
+	return prev.Updated.Equal(s.Updated) && prev.Stale == s.Stale
+}
+
+func (w *watcher) send(ctx context.Context, e Event) bool {
+	select {
+	case w.out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/tenancy"
+)
+
+func TestWatchStale(t *testing.T) {
+	controller, shutdown, err := setupWithOptions(ControllerOptions{
+		TTLPolicy: utils.TTLPolicy{GracePeriod: 60},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer shutdown()
+
+	poll := func(ctx context.Context, epoch string, since uint64) (*EventCollection, error) {
+		return controller.events(ctx, tenancy.Default, epoch, since, utils.DefaultEventWait)
+	}
+	list := func(ctx context.Context, page, perPage int) ([]Service, int, error) {
+		return controller.list(tenancy.Default, page, perPage)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := watch(ctx, WatchFilter{}, poll, list)
+	time.Sleep(100 * time.Millisecond)
+
+	receive := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for an event")
+		}
+		return Event{}
+	}
+
+	s := mockedService("1")
+	s.Ttl = 1
+	id, err := controller.add(*s, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if e := receive(); e.Type != utils.EventAdded || e.Id != id {
+		t.Fatalf("Expected added event of %s, got %s event of %s", id, e.Type, e.Id)
+	}
+
+	// Expired, kept during the grace period
+	if e := receive(); e.Type != utils.EventUpdated || e.Id != id || !e.Service.Stale {
+		t.Fatalf("Expected update of %s to stale, got %s event of %s: %+v", id, e.Type, e.Id, e.Service)
+	}
+
+	// Renewed by a heartbeat
+	err = controller.heartbeat(tenancy.Default, id, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if e := receive(); e.Type != utils.EventUpdated || e.Id != id || e.Service.Stale {
+		t.Fatalf("Expected update of %s to fresh, got %s event of %s: %+v", id, e.Type, e.Id, e.Service)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package tenancy
+
+// Sources of the tenant of a request
+const (
+	SourceUser  = "user"
+	SourceGroup = "group"
+	SourcePath  = "path"
+)
+
+const (
+	// Default is the namespace of requests without a tenant
+	Default = ""
+	// All selects the entries of all tenants in queries of administrators
+	All = "*"
+	// PathPrefix precedes the routes of the catalog APIs to select the tenant with the path source
+	PathPrefix = "/tenants/{tenant}"
+	// QueryParam selects another tenant, or all tenants, in requests of administrators
+	QueryParam   = "tenant"
+	logComponent = "tenancy"
+)
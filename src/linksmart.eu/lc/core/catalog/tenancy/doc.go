@@ -0,0 +1,11 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+// Package tenancy isolates the entries of the catalogs in tenant namespaces.
+//
+// The tenant of a request is the authenticated user, one of the groups of the user, or a path
+// prefix (/tenants/<tenant>/...). Requests without a tenant, e.g. anonymous ones, use the default
+// namespace, which also holds the entries registered with tenancy disabled. Authenticated users
+// without a tenant group are rejected with the group source, unless the default namespace is
+// configured as their fallback. Administrators may select another tenant, or all tenants in
+// queries, with the tenant query parameter.
+package tenancy
@@ -0,0 +1,218 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package tenancy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Config of the tenant namespaces
+type Config struct {
+	// Tenancy switch
+	Enabled bool `json:"enabled"`
+	// Source of the tenant of a request: user (default), group or path
+	Source string `json:"source"`
+	// Prefix of the groups which are tenants (group source), removed from the name of the tenant
+	// The first matching group of a user is the tenant; all groups are tenants if empty
+	GroupPrefix string `json:"groupPrefix"`
+	// Use the default namespace for authenticated users without a tenant group (group source)
+	// Their requests are rejected otherwise
+	DefaultFallback bool `json:"defaultFallback"`
+	// Users and groups allowed to select any tenant (or all tenants in queries) with the tenant query parameter
+	AdminUsers  []string `json:"adminUsers"`
+	AdminGroups []string `json:"adminGroups"`
+}
+
+// Validate checks the configuration
+func (c Config) Validate() error {
+	switch c.Source {
+	case "", SourceUser, SourceGroup, SourcePath:
+	default:
+		return fmt.Errorf("Unknown source %q: must be %s, %s or %s", c.Source, SourceUser, SourceGroup, SourcePath)
+	}
+	return nil
+}
+
+// ValidateName checks the name of a tenant
+func ValidateName(tenant string) error {
+	if tenant == All {
+		return fmt.Errorf("Tenant name %s is reserved", All)
+	}
+	for _, r := range tenant {
+		if r == '/' || r < ' ' || r == 0x7f {
+			return fmt.Errorf("Tenant name must not contain slashes or control characters. Given: %q", tenant)
+		}
+	}
+	return nil
+}
+
+// ErrorResponseFunc writes an error in the format of the API
+type ErrorResponseFunc func(w http.ResponseWriter, code int, msgs ...string)
+
+// Resolver determines the tenants of requests
+type Resolver struct {
+	config        Config
+	errorResponse ErrorResponseFunc
+}
+
+// NewResolver creates a Resolver with the given configuration
+// Rejected requests are answered using errorResponse
+func NewResolver(config Config, errorResponse ErrorResponseFunc) *Resolver {
+	return &Resolver{
+		config:        config,
+		errorResponse: errorResponse,
+	}
+}
+
+// Handler is a middleware making the tenant of requests available to subsequent handlers (see Get)
+// It must follow the ticket validator to derive the tenant from the authenticated user
+func (r *Resolver) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tenant, code, err := r.tenantOf(req)
+		if err != nil {
+			r.errorResponse(w, code, err.Error())
+			return
+		}
+		logger.With("tenant", tenant, "method", req.Method, "path", req.URL.Path).Debugf("Resolved tenant")
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), tenantKey, tenant)))
+	})
+}
+
+// Returns the tenant of a request, or an error with the status code of the response
+func (r *Resolver) tenantOf(req *http.Request) (string, int, error) {
+	profile := validator.GetUserProfile(req)
+
+	tenant := Default
+	noGroup := false
+	switch r.config.Source {
+	case SourcePath:
+		tenant = mux.Vars(req)["tenant"]
+	case SourceGroup:
+		if profile != nil {
+			noGroup = true
+			for _, group := range profile.Groups {
+				if strings.HasPrefix(group, r.config.GroupPrefix) {
+					tenant = strings.TrimPrefix(group, r.config.GroupPrefix)
+					noGroup = false
+					break
+				}
+			}
+		}
+	default:
+		if profile != nil {
+			tenant = profile.Username
+		}
+	}
+	if err := ValidateName(tenant); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	selected := req.URL.Query().Get(QueryParam)
+	if selected == "" {
+		if noGroup && !r.config.DefaultFallback {
+			return "", http.StatusForbidden, fmt.Errorf("User %s is not in a tenant group", profile.Username)
+		}
+		return tenant, http.StatusOK, nil
+	}
+	if !r.isAdmin(profile) {
+		return "", http.StatusForbidden, fmt.Errorf("Only administrators may select a tenant")
+	}
+	if selected == All {
+		if !isRead(req.Method) {
+			return "", http.StatusBadRequest, fmt.Errorf("All tenants (%s) may only be selected in queries", All)
+		}
+		return All, http.StatusOK, nil
+	}
+	if err := ValidateName(selected); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	return selected, http.StatusOK, nil
+}
+
+// Checks whether the authenticated user is an administrator
+func (r *Resolver) isAdmin(profile *validator.UserProfile) bool {
+	if profile == nil {
+		return false
+	}
+	for _, user := range r.config.AdminUsers {
+		if user == profile.Username {
+			return true
+		}
+	}
+	for _, admin := range r.config.AdminGroups {
+		for _, group := range profile.Groups {
+			if group == admin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isRead(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+type contextKey int
+
+const tenantKey contextKey = 0
+
+// Get returns the tenant of a request resolved by the Handler
+// Returns the Default namespace if tenancy is disabled
+func Get(req *http.Request) string {
+	tenant, _ := req.Context().Value(tenantKey).(string)
+	return tenant
+}
+
+// Key returns the storage key of an entry of a tenant
+// The keys of the default namespace are the ids, those of other tenants are prefixed
+// with the tenant between NUL characters, which are invalid in ids
+func Key(tenant, id string) string {
+	if tenant == Default {
+		return id
+	}
+	return "\x00" + tenant + "\x00" + id
+}
+
+// SplitKey returns the tenant and id of a storage key
+func SplitKey(key string) (string, string) {
+	if !strings.HasPrefix(key, "\x00") {
+		return Default, key
+	}
+	parts := strings.SplitN(key[1:], "\x00", 2)
+	if len(parts) != 2 {
+		return Default, key
+	}
+	return parts[0], parts[1]
+}
+
+// KeyRange returns the range [start, limit) of the storage keys of a tenant, nil meaning unbounded
+func KeyRange(tenant string) (start, limit []byte) {
+	switch tenant {
+	case All:
+		return nil, nil
+	case Default:
+		// After the prefixed keys of the other tenants
+		return []byte{1}, nil
+	}
+	prefix := Key(tenant, "")
+	// The prefix ends with NUL, which is incremented to get the upper bound
+	limit = []byte(prefix)
+	limit[len(limit)-1] = 1
+	return []byte(prefix), limit
+}
+
+// Matches checks whether an entry of a tenant is selected by the given tenant (or all tenants)
+func Matches(selected, tenant string) bool {
+	return selected == All || selected == tenant
+}
@@ -0,0 +1,190 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package tenancy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Validator driver accepting tokens of the form user:group1,group2
+type testDriver struct{}
+
+func (testDriver) Validate(serverAddr, serviceID, ticket string) (bool, *validator.UserProfile, error) {
+	parts := strings.SplitN(ticket, ":", 2)
+	profile := &validator.UserProfile{Username: parts[0]}
+	if len(parts) == 2 {
+		profile.Groups = strings.Split(parts[1], ",")
+	}
+	return true, profile, nil
+}
+
+func init() {
+	validator.Register("tenancy-test", testDriver{})
+}
+
+func errorResponse(w http.ResponseWriter, code int, msgs ...string) {
+	http.Error(w, strings.Join(msgs, " "), code)
+}
+
+// Returns a handler answering with the tenant of requests
+func setupResolver(t *testing.T, config Config) http.Handler {
+	v, err := validator.Setup("tenancy-test", "", "", false, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(Get(req)))
+	})
+	handler := NewResolver(config, errorResponse).Handler(echo)
+
+	r := mux.NewRouter()
+	for _, prefix := range []string{"", PathPrefix} {
+		r.Handle(prefix+"/rc/devices", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// Authenticate requests with a token, others are anonymous
+			if req.Header.Get("Authorization") != "" {
+				v.Handler(handler).ServeHTTP(w, req)
+				return
+			}
+			handler.ServeHTTP(w, req)
+		}))
+	}
+	return r
+}
+
+func request(h http.Handler, method, url, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestSources(t *testing.T) {
+	cases := []struct {
+		config Config
+		url    string
+		token  string
+		tenant string
+	}{
+		{Config{}, "/rc/devices", "alice:staff", "alice"},
+		{Config{}, "/rc/devices", "", Default},
+		{Config{Source: SourceGroup}, "/rc/devices", "alice:staff,admins", "staff"},
+		{Config{Source: SourceGroup, GroupPrefix: "tenant-"}, "/rc/devices", "alice:staff,tenant-site-a", "site-a"},
+		{Config{Source: SourceGroup, GroupPrefix: "tenant-", DefaultFallback: true}, "/rc/devices", "alice:staff", Default},
+		{Config{Source: SourceGroup, GroupPrefix: "tenant-"}, "/rc/devices", "", Default},
+		{Config{Source: SourcePath}, "/tenants/site-a/rc/devices", "alice:staff", "site-a"},
+		{Config{Source: SourcePath}, "/rc/devices", "alice:staff", Default},
+	}
+	for _, c := range cases {
+		w := request(setupResolver(t, c.config), "GET", c.url, c.token)
+		if w.Code != http.StatusOK || w.Body.String() != c.tenant {
+			t.Errorf("%+v %s %s: expected tenant %q, got %d %q", c.config, c.url, c.token, c.tenant, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNoTenantGroup(t *testing.T) {
+	h := setupResolver(t, Config{Source: SourceGroup, GroupPrefix: "tenant-", AdminUsers: []string{"root"}})
+
+	cases := []struct {
+		url    string
+		token  string
+		code   int
+		tenant string
+	}{
+		{"/rc/devices", "alice:staff", http.StatusForbidden, ""},
+		{"/rc/devices", "bob", http.StatusForbidden, ""},
+		{"/rc/devices?tenant=site-a", "root", http.StatusOK, "site-a"},
+		{"/rc/devices", "root", http.StatusForbidden, ""},
+	}
+	for _, c := range cases {
+		w := request(h, "GET", c.url, c.token)
+		if w.Code != c.code {
+			t.Errorf("%s %s: expected status %d, got %d", c.url, c.token, c.code, w.Code)
+			continue
+		}
+		if c.code == http.StatusOK && w.Body.String() != c.tenant {
+			t.Errorf("%s %s: expected tenant %q, got %q", c.url, c.token, c.tenant, w.Body.String())
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	h := setupResolver(t, Config{AdminUsers: []string{"root"}, AdminGroups: []string{"admins"}})
+
+	cases := []struct {
+		method string
+		url    string
+		token  string
+		code   int
+		tenant string
+	}{
+		{"GET", "/rc/devices?tenant=site-a", "root", http.StatusOK, "site-a"},
+		{"GET", "/rc/devices?tenant=site-a", "bob:admins", http.StatusOK, "site-a"},
+		{"GET", "/rc/devices?tenant=*", "root", http.StatusOK, All},
+		{"POST", "/rc/devices?tenant=site-a", "root", http.StatusOK, "site-a"},
+		{"POST", "/rc/devices?tenant=*", "root", http.StatusBadRequest, ""},
+		{"GET", "/rc/devices?tenant=site-a", "alice:staff", http.StatusForbidden, ""},
+		{"GET", "/rc/devices?tenant=*", "", http.StatusForbidden, ""},
+		{"GET", "/rc/devices?tenant=site%2Fa", "root", http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		w := request(h, c.method, c.url, c.token)
+		if w.Code != c.code {
+			t.Errorf("%s %s %s: expected status %d, got %d", c.method, c.url, c.token, c.code, w.Code)
+			continue
+		}
+		if c.code == http.StatusOK && w.Body.String() != c.tenant {
+			t.Errorf("%s %s %s: expected tenant %q, got %q", c.method, c.url, c.token, c.tenant, w.Body.String())
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for _, c := range []struct{ tenant, id string }{
+		{Default, "device_1"},
+		{"site-a", "device_1"},
+		{"site-a", "urn:ls_device:a/b"},
+	} {
+		tenant, id := SplitKey(Key(c.tenant, c.id))
+		if tenant != c.tenant || id != c.id {
+			t.Errorf("Expected %q and %q, got %q and %q", c.tenant, c.id, tenant, id)
+		}
+	}
+	if Key(Default, "device_1") != "device_1" {
+		t.Error("Expected the keys of the default namespace to be the ids")
+	}
+
+	// Key ranges in the order of the storage
+	keys := []string{Key(Default, "a"), Key("site-a", "a"), Key("site-ab", "a"), Key("site-b", "z"), Key(Default, "z")}
+	sort.Strings(keys)
+	inRange := func(tenant string) (matched []string) {
+		start, limit := KeyRange(tenant)
+		for _, key := range keys {
+			if (start == nil || key >= string(start)) && (limit == nil || key < string(limit)) {
+				matched = append(matched, key)
+			}
+		}
+		return matched
+	}
+	for tenant, expected := range map[string]int{Default: 2, "site-a": 1, "site-ab": 1, "site-b": 1, "site-c": 0, All: 5} {
+		matched := inRange(tenant)
+		if len(matched) != expected {
+			t.Errorf("Expected %d keys of %q, got %q", expected, tenant, matched)
+		}
+		for _, key := range matched {
+			if k, _ := SplitKey(key); !Matches(tenant, k) {
+				t.Errorf("Unexpected key %q in the range of %q", key, tenant)
+			}
+		}
+	}
+}
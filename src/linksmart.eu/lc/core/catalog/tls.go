@@ -0,0 +1,238 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Interval between checks for changes of certificate files
+const certReloadInterval = 10 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ServerTLSConfig configures the HTTPS listener of a component
+type ServerTLSConfig struct {
+	// TLS switch
+	Enabled bool `json:"enabled"`
+	// Paths to the PEM encoded certificate (chain) and private key of the server
+	// The files are reloaded when changed
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// Path to the PEM encoded CA certificates to verify client certificates
+	// Clients must present a valid certificate if set (mutual TLS)
+	ClientCAFile string `json:"clientCAFile"`
+	// Minimum TLS version: 1.0, 1.1, 1.2 (default) or 1.3
+	MinVersion string `json:"minVersion"`
+}
+
+// Validate checks the TLS configuration
+func (c ServerTLSConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("certFile and keyFile have to be defined")
+	}
+	if _, err := parseTLSVersion(c.MinVersion); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Check checks that the certificate and CA files can be loaded
+func (c ServerTLSConfig) Check() error {
+	if !c.Enabled {
+		return nil
+	}
+	_, err := c.TLSConfig()
+	return err
+}
+
+// TLSConfig creates the configuration of the server connections
+func (c ServerTLSConfig) TLSConfig() (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(c.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := newCertReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if c.ClientCAFile != "" {
+		pool, err := loadCertPool(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientTLSConfig configures the TLS connections of a client, e.g. to a remote catalog
+type ClientTLSConfig struct {
+	// Path to the PEM encoded CA certificates to verify the server (system CAs if not set)
+	CAFile string `json:"caFile"`
+	// Paths to the PEM encoded client certificate and private key (for mutual TLS)
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// Skip the verification of the server certificate (for testing only)
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+// Validate checks the TLS configuration
+func (c ClientTLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("certFile and keyFile have to be defined together")
+	}
+	return nil
+}
+
+// Check checks that the certificate and CA files can be loaded
+func (c ClientTLSConfig) Check() error {
+	_, err := c.TLSConfig()
+	return err
+}
+
+// TLSConfig creates the configuration of the client connections
+func (c ClientTLSConfig) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load the client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Returns the TLS version of the given name, TLS 1.2 if empty
+func parseTLSVersion(name string) (uint16, error) {
+	if name == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, found := tlsVersions[name]
+	if !found {
+		return 0, fmt.Errorf("Unsupported TLS version: %s", name)
+	}
+	return version, nil
+}
+
+// Loads PEM encoded CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the CA file: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("No certificates found in the CA file %s", path)
+	}
+	return pool, nil
+}
+
+// certReloader provides a certificate and reloads it when its files change
+type certReloader struct {
+	sync.Mutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	// modification time of the loaded files
+	loaded    time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	modTime, err := r.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, reloading the files if they have been modified
+// since the last check. The previous certificate is kept if the new files cannot be loaded
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if time.Since(r.lastCheck) < certReloadInterval {
+		return r.cert, nil
+	}
+	r.lastCheck = time.Now()
+
+	modTime, err := r.modTime()
+	if err != nil {
+		logger.Errorf("certReloader.GetCertificate() %s", err)
+		return r.cert, nil
+	}
+	if !modTime.Equal(r.loaded) {
+		if err := r.load(modTime); err != nil {
+			logger.Errorf("certReloader.GetCertificate() Failed to reload the certificate: %s", err)
+		} else {
+			logger.Infof("certReloader.GetCertificate() Reloaded the certificate %s", r.certFile)
+		}
+	}
+	return r.cert, nil
+}
+
+// Loads the certificate files
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("Failed to load the certificate: %s", err)
+	}
+	r.cert = &cert
+	r.loaded = modTime
+	r.lastCheck = time.Now()
+	return nil
+}
+
+// Returns the latest modification time of the certificate files
+func (r *certReloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
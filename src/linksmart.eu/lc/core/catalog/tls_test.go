@@ -0,0 +1,221 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPKI writes certificates signed by a test CA into a temporary directory
+type testPKI struct {
+	t      *testing.T
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "lc-tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	p := &testPKI{t: t, dir: dir}
+	p.caKey, p.ca = p.issue("ca", nil)
+	return p
+}
+
+// Issues a certificate signed by the CA (self-signed if the CA is nil)
+// The certificate and key are written to <name>.pem and <name>-key.pem
+func (p *testPKI) issue(name string, ca *x509.Certificate) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err.Error())
+	}
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, parentKey := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parent, parentKey = ca, p.caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		p.t.Fatal(err.Error())
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		p.t.Fatal(err.Error())
+	}
+	p.write(name+".pem", "CERTIFICATE", der)
+	p.write(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		p.t.Fatal(err.Error())
+	}
+	return key, cert
+}
+
+func (p *testPKI) write(name, blockType string, b []byte) {
+	err := ioutil.WriteFile(p.path(name), pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}), 0600)
+	if err != nil {
+		p.t.Fatal(err.Error())
+	}
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	pki.issue("server", pki.ca)
+	pki.issue("client", pki.ca)
+
+	serverConfig := ServerTLSConfig{
+		Enabled:      true,
+		CertFile:     pki.path("server.pem"),
+		KeyFile:      pki.path("server-key.pem"),
+		ClientCAFile: pki.path("ca.pem"),
+	}
+	if err := serverConfig.Validate(); err != nil {
+		t.Fatal(err.Error())
+	}
+	config, err := serverConfig.TLSConfig()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		TLSConfig: config,
+		ErrorLog:  log.New(ioutil.Discard, "", 0),
+	}
+	go server.ServeTLS(l, "", "")
+	defer server.Close()
+	url := "https://" + l.Addr().String()
+
+	get := func(clientConfig ClientTLSConfig) error {
+		tlsConfig, err := clientConfig.TLSConfig()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		client := NewHTTPClient(nil, ClientOptions{TLSConfig: tlsConfig})
+		res, err := client.Do(context.Background(), "GET", url, nil, nil)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	}
+
+	// Client without a certificate
+	if err := get(ClientTLSConfig{CAFile: pki.path("ca.pem")}); err == nil {
+		t.Error("Expected the request without a client certificate to fail")
+	}
+	// Client not trusting the server
+	err = get(ClientTLSConfig{CertFile: pki.path("client.pem"), KeyFile: pki.path("client-key.pem")})
+	if err == nil {
+		t.Error("Expected the request to a server signed by an unknown CA to fail")
+	}
+	err = get(ClientTLSConfig{
+		CAFile:   pki.path("ca.pem"),
+		CertFile: pki.path("client.pem"),
+		KeyFile:  pki.path("client-key.pem"),
+	})
+	if err != nil {
+		t.Errorf("Unexpected error with a client certificate: %s", err)
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	_, first := pki.issue("server", pki.ca)
+
+	r, err := newCertReloader(pki.path("server.pem"), pki.path("server-key.pem"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	serialOf := func() int64 {
+		cert, _ := r.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if serial := serialOf(); serial != first.SerialNumber.Int64() {
+		t.Fatalf("Expected certificate %d, got %d", first.SerialNumber, serial)
+	}
+
+	// Replace the files
+	_, second := pki.issue("server", pki.ca)
+	future := time.Now().Add(time.Minute)
+	for _, name := range []string{"server.pem", "server-key.pem"} {
+		if err := os.Chtimes(pki.path(name), future, future); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	// Files are checked once per interval
+	if serial := serialOf(); serial != first.SerialNumber.Int64() {
+		t.Errorf("Expected certificate %d within the check interval, got %d", first.SerialNumber, serial)
+	}
+	r.lastCheck = time.Now().Add(-certReloadInterval)
+	if serial := serialOf(); serial != second.SerialNumber.Int64() {
+		t.Errorf("Expected reloaded certificate %d, got %d", second.SerialNumber, serial)
+	}
+
+	// Invalid files keep the previous certificate
+	if err := ioutil.WriteFile(pki.path("server.pem"), []byte("invalid"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	r.lastCheck = time.Now().Add(-certReloadInterval)
+	if serial := serialOf(); serial != second.SerialNumber.Int64() {
+		t.Errorf("Expected certificate %d after a failed reload, got %d", second.SerialNumber, serial)
+	}
+}
+
+func TestTLSVersion(t *testing.T) {
+	config, err := ServerTLSConfig{MinVersion: "1.3"}.TLSConfig()
+	if err == nil {
+		t.Fatalf("Expected an error without certificate files, got %+v", config)
+	}
+	if err := (ServerTLSConfig{Enabled: true, CertFile: "c", KeyFile: "k", MinVersion: "1.4"}).Validate(); err == nil {
+		t.Error("Expected an error for an unsupported TLS version")
+	}
+	if version, _ := parseTLSVersion(""); version != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 by default, got %x", version)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TTLPolicy constrains the time-to-live (in seconds) of catalog entries
+// A zero value imposes no constraints: any ttl is accepted and expired entries are removed immediately
+type TTLPolicy struct {
+	// Bounds of the ttl of expiring entries (0 for no bound)
+	MinTTL uint `json:"minTTL"`
+	MaxTTL uint `json:"maxTTL"`
+	// Ttl of entries registered without one (0 to let them never expire)
+	DefaultTTL uint `json:"defaultTTL"`
+	// Users who are not allowed to register entries which never expire, "*" for all users
+	ForbidNoExpiry []string `json:"forbidNoExpiry"`
+	// Seconds during which expired entries are kept and flagged stale before being removed
+	GracePeriod uint `json:"gracePeriod"`
+}
+
+// Validate checks the policy for consistency
+func (p TTLPolicy) Validate() error {
+	var errs ConfigErrors
+	if p.MaxTTL != 0 && p.MinTTL > p.MaxTTL {
+		errs.Addf("minTTL (%d) must not be greater than maxTTL (%d)", p.MinTTL, p.MaxTTL)
+	}
+	if p.DefaultTTL != 0 {
+		if err := p.Check(p.DefaultTTL); err != nil {
+			errs.AddKey("defaultTTL", err)
+		}
+	}
+	for _, user := range p.ForbidNoExpiry {
+		if user == "" {
+			errs.Addf("forbidNoExpiry: user must not be empty")
+		}
+	}
+	return errs.Err()
+}
+
+// TTL returns the ttl of an entry registered with the given ttl, applying the default
+func (p TTLPolicy) TTL(ttl uint) uint {
+	if ttl == 0 {
+		return p.DefaultTTL
+	}
+	return ttl
+}
+
+// Check checks that a ttl is within the bounds of the policy
+func (p TTLPolicy) Check(ttl uint) error {
+	if ttl == 0 {
+		return nil
+	}
+	if ttl < p.MinTTL {
+		return fmt.Errorf("ttl %d is less than the minimum of %d", ttl, p.MinTTL)
+	}
+	if p.MaxTTL != 0 && ttl > p.MaxTTL {
+		return fmt.Errorf("ttl %d is greater than the maximum of %d", ttl, p.MaxTTL)
+	}
+	return nil
+}
+
+// CheckUser checks that a user is allowed to register an entry with the given ttl
+func (p TTLPolicy) CheckUser(ttl uint, user string) error {
+	if p.TTL(ttl) != 0 {
+		return nil
+	}
+	for _, u := range p.ForbidNoExpiry {
+		if u == "*" || u == user {
+			if user == "" {
+				return fmt.Errorf("Registrations must expire: ttl is required")
+			}
+			return fmt.Errorf("Registrations of user %s must expire: ttl is required", user)
+		}
+	}
+	return nil
+}
+
+// Grace returns the grace period as a duration
+func (p TTLPolicy) Grace() time.Duration {
+	return time.Duration(p.GracePeriod) * time.Second
+}
+
+// ParseExpiringParam parses the query parameter selecting entries which expire within the given seconds
+func ParseExpiringParam(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value for %s: %s", GetParamExpiring, s)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
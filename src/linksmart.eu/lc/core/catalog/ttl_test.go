@@ -0,0 +1,66 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLPolicy(t *testing.T) {
+	p := TTLPolicy{MinTTL: 10, MaxTTL: 100, ForbidNoExpiry: []string{"guest"}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Unexpected error validating the policy: %s", err)
+	}
+
+	for ttl, valid := range map[uint]bool{0: true, 5: false, 10: true, 100: true, 101: false} {
+		if err := p.Check(ttl); (err == nil) != valid {
+			t.Errorf("Expected ttl %d to be valid: %t, got %v", ttl, valid, err)
+		}
+	}
+
+	if err := p.CheckUser(0, "guest"); err == nil {
+		t.Error("Expected a non-expiring registration of guest to be forbidden")
+	}
+	if err := p.CheckUser(0, "admin"); err != nil {
+		t.Errorf("Expected a non-expiring registration of admin to be allowed, got %s", err)
+	}
+
+	// The default ttl replaces no expiry
+	p.DefaultTTL = 60
+	if p.TTL(0) != 60 || p.TTL(30) != 30 {
+		t.Errorf("Expected the default ttl to apply to 0 only, got %d and %d", p.TTL(0), p.TTL(30))
+	}
+	if err := p.CheckUser(0, "guest"); err != nil {
+		t.Errorf("Expected the default ttl to be allowed, got %s", err)
+	}
+
+	if p.Grace() != 0 {
+		t.Errorf("Expected no grace period, got %s", p.Grace())
+	}
+	p.GracePeriod = 30
+	if p.Grace() != 30*time.Second {
+		t.Errorf("Expected a grace period of 30s, got %s", p.Grace())
+	}
+}
+
+func TestTTLPolicyValidate(t *testing.T) {
+	p := TTLPolicy{MinTTL: 100, MaxTTL: 10, DefaultTTL: 5, ForbidNoExpiry: []string{""}}
+	err := p.Validate()
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 3 {
+		t.Errorf("Expected 3 errors, got %v", err)
+	}
+}
+
+func TestParseExpiringParam(t *testing.T) {
+	within, err := ParseExpiringParam("60")
+	if err != nil || within != time.Minute {
+		t.Errorf("Expected 1m, got %s (%v)", within, err)
+	}
+	for _, s := range []string{"-1", "soon", ""} {
+		if _, err := ParseExpiringParam(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
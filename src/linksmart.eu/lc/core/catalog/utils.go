@@ -19,6 +19,10 @@ const (
 	minKeepaliveSec     = 5
 	GetParamPage        = "page"
 	GetParamPerPage     = "per_page"
+	GetParamEpoch       = "epoch"
+	GetParamSince       = "since"
+	GetParamWait        = "wait"
+	GetParamExpiring    = "expiring"
 )
 
 // Discovers a catalog endpoint given the serviceType
@@ -34,17 +38,17 @@ func DiscoverCatalogEndpoint(serviceType string) (endpoint string, err error) {
 		// create resolver
 		resolver, err := bonjour.NewResolver(nil)
 		if err != nil {
-			logger.Println("Failed to initialize DNS-SD resolver:", err.Error())
+			logger.Error("Failed to initialize DNS-SD resolver:", err.Error())
 			break
 		}
 		// init the channel for results
 		results := make(chan *bonjour.ServiceEntry)
 
 		// send query and listen for answers
-		logger.Println("Browsing...")
+		logger.Debug("Browsing...")
 		err = resolver.Browse(serviceType, "", results)
 		if err != nil {
-			logger.Println("Unable to browse DNS-SD services: ", err)
+			logger.Error("Unable to browse DNS-SD services: ", err)
 			break
 		}
 
@@ -52,17 +56,17 @@ func DiscoverCatalogEndpoint(serviceType string) (endpoint string, err error) {
 		var foundService *bonjour.ServiceEntry
 		select {
 		case foundService = <-results:
-			logger.Printf("[DiscoverCatalogEndpoint] Discovered service: %v\n", foundService.ServiceInstanceName())
+			logger.Infof("[DiscoverCatalogEndpoint] Discovered service: %v", foundService.ServiceInstanceName())
 		case <-time.After(time.Duration(discoveryTimeoutSec) * time.Second):
-			logger.Println("[DiscoverCatalogEndpoint] Timeout looking for a service")
+			logger.Warn("[DiscoverCatalogEndpoint] Timeout looking for a service")
 		case <-sysSig:
-			logger.Println("[DiscoverCatalogEndpoint] System interrupt signal received. Aborting the discovery")
+			logger.Info("[DiscoverCatalogEndpoint] System interrupt signal received. Aborting the discovery")
 			return endpoint, fmt.Errorf("Aborted by system interrupt")
 		}
 
 		// check if something found
 		if foundService == nil {
-			logger.Printf("[DiscoverCatalogEndpoint] Could not discover a service %v withing the timeout. Starting from scratch...", serviceType)
+			logger.Warnf("[DiscoverCatalogEndpoint] Could not discover a service %v withing the timeout. Starting from scratch...", serviceType)
 			// stop resolver
 			resolver.Exit <- true
 			// start the new iteration
@@ -158,6 +162,34 @@ func ValidatePagingParams(page, perPage, maxPerPage int) error {
 	return nil
 }
 
+// PageFetcher returns a page of entries (pointers to them) and the total number of entries
+type PageFetcher func(page, perPage int) ([]interface{}, int, error)
+
+// FilterPage fetches all entries, keeps the ones allowed by the filter and returns
+// the requested page of them along with their total number
+func FilterPage(fetch PageFetcher, allowed func(entry interface{}) bool, page, perPage, maxPerPage int) ([]interface{}, int, error) {
+	matches := make([]interface{}, 0)
+	for p := 1; ; p++ {
+		entries, total, err := fetch(p, maxPerPage)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, entry := range entries {
+			if allowed(entry) {
+				matches = append(matches, entry)
+			}
+		}
+		if p*maxPerPage >= total {
+			break
+		}
+	}
+	offset, limit, err := GetPagingAttr(len(matches), page, perPage, maxPerPage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Unable to paginate: %s", err)
+	}
+	return matches[offset : offset+limit], len(matches), nil
+}
+
 // Parses string paging parameters to integers
 func ParsePagingParams(page, perPage string, maxPerPage int) (int, int, error) {
 	var parsedPage, parsedPerPage int
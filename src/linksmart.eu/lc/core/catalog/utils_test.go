@@ -0,0 +1,62 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFilterPage(t *testing.T) {
+	// Entries 1 to 25, fetched in pages of at most 10
+	var fetched []int
+	fetch := func(page, perPage int) ([]interface{}, int, error) {
+		fetched = append(fetched, page)
+		var entries []interface{}
+		for i := (page-1)*perPage + 1; i <= page*perPage && i <= 25; i++ {
+			v := i
+			entries = append(entries, &v)
+		}
+		return entries, 25, nil
+	}
+	even := func(entry interface{}) bool { return *entry.(*int)%2 == 0 }
+
+	cases := []struct {
+		page, perPage int
+		expected      []int
+	}{
+		{1, 5, []int{2, 4, 6, 8, 10}},
+		{3, 5, []int{22, 24}},
+		{1, 10, []int{2, 4, 6, 8, 10, 12, 14, 16, 18, 20}},
+		{4, 5, []int{}},
+	}
+	for _, c := range cases {
+		fetched = nil
+		entries, total, err := FilterPage(fetch, even, c.page, c.perPage, 10)
+		if err != nil {
+			t.Errorf("page %d of %d: unexpected error: %s", c.page, c.perPage, err)
+			continue
+		}
+		values := []int{}
+		for _, entry := range entries {
+			values = append(values, *entry.(*int))
+		}
+		if total != 12 || !reflect.DeepEqual(values, c.expected) {
+			t.Errorf("page %d of %d: expected %v of 12, got %v of %d", c.page, c.perPage, c.expected, values, total)
+		}
+		if !reflect.DeepEqual(fetched, []int{1, 2, 3}) {
+			t.Errorf("page %d of %d: expected all pages to be fetched, got %v", c.page, c.perPage, fetched)
+		}
+	}
+
+	if _, _, err := FilterPage(fetch, even, 1, 20, 10); err == nil {
+		t.Error("Expected an error for a page larger than the maximum")
+	}
+	failing := func(page, perPage int) ([]interface{}, int, error) {
+		return nil, 0, errors.New("storage error")
+	}
+	if _, _, err := FilterPage(failing, even, 1, 5, 10); err == nil {
+		t.Error("Expected the error of the fetcher")
+	}
+}
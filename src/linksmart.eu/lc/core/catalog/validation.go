@@ -0,0 +1,136 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// ConfigErrors collects all problems found while validating a configuration
+type ConfigErrors []error
+
+// multiError is implemented by errors collecting several problems, e.g. ConfigErrors or authz.Errors
+type multiError interface {
+	Errors() []error
+}
+
+// Add adds an error, or each error collected in it, ignoring nil
+func (e *ConfigErrors) Add(err error) {
+	if err == nil {
+		return
+	}
+	if errs, ok := err.(multiError); ok {
+		*e = append(*e, errs.Errors()...)
+		return
+	}
+	*e = append(*e, err)
+}
+
+// AddKey adds an error, or each error collected in it, prefixed with the configuration key it belongs to, ignoring nil
+func (e *ConfigErrors) AddKey(key string, err error) {
+	if err == nil {
+		return
+	}
+	if errs, ok := err.(multiError); ok {
+		for _, err := range errs.Errors() {
+			e.AddKey(key, err)
+		}
+		return
+	}
+	*e = append(*e, fmt.Errorf("%s: %s", key, err))
+}
+
+// Addf adds an error with the given format
+func (e *ConfigErrors) Addf(format string, a ...interface{}) {
+	*e = append(*e, fmt.Errorf(format, a...))
+}
+
+// Errors returns the collected errors
+func (e ConfigErrors) Errors() []error {
+	return e
+}
+
+// Err returns the collected errors, or nil if there are none
+func (e ConfigErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// CheckFile checks that a file exists and can be read
+func CheckFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// CheckDir checks that a directory exists
+func CheckDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// CheckListenAddr checks that a server can listen on the TCP address
+func CheckListenAddr(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Cannot listen on %s: %s", addr, err)
+	}
+	return l.Close()
+}
+
+// CheckDriver checks that a driver name is in the list of registered drivers
+func CheckDriver(kind, name string, drivers []string) error {
+	for _, d := range drivers {
+		if d == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown %s %q, available: %s", kind, name, strings.Join(drivers, ", "))
+}
+
+// WriteValidationReport writes the result of validating a configuration file (-validate flag)
+// and returns the exit status of the command: 0 if valid, 1 otherwise
+func WriteValidationReport(w io.Writer, path string, err error) int {
+	if err == nil {
+		fmt.Fprintf(w, "Configuration %s is valid\n", path)
+		return 0
+	}
+	var errs ConfigErrors
+	errs.Add(err)
+	fmt.Fprintf(w, "Configuration %s is invalid:\n", path)
+	for _, err := range errs {
+		fmt.Fprintf(w, "  - %s\n", err)
+	}
+	fmt.Fprintf(w, "%d error(s) found\n", len(errs))
+	return 1
+}
@@ -0,0 +1,72 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package catalog
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Errors collected by another package
+type testErrors []error
+
+func (e testErrors) Errors() []error { return e }
+func (e testErrors) Error() string   { return "test errors" }
+
+func TestConfigErrors(t *testing.T) {
+	var errs ConfigErrors
+	errs.Add(nil)
+	errs.AddKey("tls", nil)
+	if errs.Err() != nil {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+
+	errs.Addf("bindPort %d is invalid", -1)
+	errs.AddKey("tls", errors.New("certFile missing"))
+	errs.AddKey("catalog", ConfigErrors{errors.New("a"), errors.New("b")})
+	errs.Add(testErrors{errors.New("c"), errors.New("d")})
+	expected := "bindPort -1 is invalid; tls: certFile missing; catalog: a; catalog: b; c; d"
+	if errs.Err() == nil || errs.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, errs.Error())
+	}
+
+	var buf bytes.Buffer
+	if status := WriteValidationReport(&buf, "conf.json", errs.Err()); status != 1 {
+		t.Errorf("Expected status 1 for an invalid configuration, got %d", status)
+	}
+	if !strings.Contains(buf.String(), "  - tls: certFile missing\n") || !strings.Contains(buf.String(), "6 error(s)") {
+		t.Errorf("Unexpected report:\n%s", buf.String())
+	}
+	buf.Reset()
+	if status := WriteValidationReport(&buf, "conf.json", nil); status != 0 {
+		t.Errorf("Expected status 0 for a valid configuration, got %d", status)
+	}
+}
+
+func TestCheckListenAddr(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	addr := l.Addr().String()
+	if err := CheckListenAddr(addr); err == nil {
+		t.Error("Expected an error for an address in use")
+	}
+	l.Close()
+	if err := CheckListenAddr(addr); err != nil {
+		t.Errorf("Unexpected error for a free address: %s", err)
+	}
+}
+
+func TestCheckDriver(t *testing.T) {
+	drivers := []string{"cas", "keycloak"}
+	if err := CheckDriver("validator", "keycloak", drivers); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := CheckDriver("validator", "ldap", drivers); err == nil || !strings.Contains(err.Error(), "cas, keycloak") {
+		t.Errorf("Expected an error listing the available drivers, got %v", err)
+	}
+}
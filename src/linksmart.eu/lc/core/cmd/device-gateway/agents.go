@@ -35,12 +35,23 @@ type AgentResponse struct {
 	Cached     time.Time
 }
 
+//
+// A request to apply changed device configurations to the agents
+//
+type agentUpdate struct {
+	previous []Device
+	current  []Device
+	// Data upstream/publishing channel to be set (if not nil)
+	publishOutbox chan<- AgentResponse
+	done          chan struct{}
+}
+
 //
 // Manages agents, their executions and data caching and provisioning
 //
 type AgentManager struct {
 	config         *Config
-	timers         map[string]*time.Ticker
+	timers         map[string]*agentTimer
 	services       map[string]*exec.Cmd
 	serviceInpipes map[string]io.WriteCloser
 
@@ -55,6 +66,9 @@ type AgentManager struct {
 
 	// Data upstream/publishing channel
 	publishOutbox chan<- AgentResponse
+
+	// Agent updates inbox
+	updateInbox chan agentUpdate
 }
 
 //
@@ -63,12 +77,13 @@ type AgentManager struct {
 func newAgentManager(conf *Config) *AgentManager {
 	manager := &AgentManager{
 		config:           conf,
-		timers:           make(map[string]*time.Ticker),
+		timers:           make(map[string]*agentTimer),
 		services:         make(map[string]*exec.Cmd),
 		serviceInpipes:   make(map[string]io.WriteCloser),
 		dataCache:        make(map[string]AgentResponse),
 		agentInbox:       make(chan AgentResponse),
 		dataRequestInbox: make(chan DataRequest),
+		updateInbox:      make(chan agentUpdate),
 	}
 	return manager
 }
@@ -84,21 +99,11 @@ func (am *AgentManager) setPublishingChannel(ch chan<- AgentResponse) {
 // Creates all agents and start listening on the inbox channels
 //
 func (am *AgentManager) start() {
-	logger.Println("AgentManager.start()")
+	logger.Info("AgentManager.start()")
 
-	for _, d := range am.config.Devices {
+	for _, d := range am.config.devices() {
 		for _, r := range d.Resources {
-			rid := d.ResourceId(r.Name)
-			switch r.Agent.Type {
-			case ExecTypeTimer:
-				am.createTimer(rid, r.Agent)
-			case ExecTypeTask:
-				am.validateTask(rid, r.Agent)
-			case ExecTypeService:
-				am.createService(rid, r.Agent)
-			default:
-				logger.Printf("AgentManager.start() ERROR: Unsupported execution type %s for resource %s\n", r.Agent.Type, rid)
-			}
+			am.createAgent(d.ResourceId(r.Name), r.Agent)
 		}
 	}
 
@@ -106,10 +111,22 @@ func (am *AgentManager) start() {
 	for {
 		select {
 
+		case u := <-am.updateInbox:
+			// Replace the agents of changed resources
+			am.applyUpdate(u.previous, u.current)
+			if u.publishOutbox != nil {
+				am.publishOutbox = u.publishOutbox
+			}
+			close(u.done)
+
 		case resp := <-am.agentInbox:
 			// Receive data from agents and cache it
 			if resp.IsError {
-				logger.Printf("AgentManager.start() ERROR: Received from %s: %s", resp.ResourceId, string(resp.Payload))
+				logger.Errorf("AgentManager.start() Received from %s: %s", resp.ResourceId, string(resp.Payload))
+			}
+			resource, ok := am.config.FindResource(resp.ResourceId)
+			if ok && resource.Agent.Type == ExecTypeService {
+				metricAgentServiceOutputs.Inc(resultLabel(resp.IsError))
 			}
 
 			// Cache data
@@ -117,7 +134,6 @@ func (am *AgentManager) start() {
 
 			// Publish if required
 			if am.publishOutbox != nil {
-				resource, ok := am.config.FindResource(resp.ResourceId)
 				if !ok {
 					continue
 				}
@@ -131,7 +147,8 @@ func (am *AgentManager) start() {
 							//case <-time.Tick(time.Duration(2) * time.Second):
 							//	logger.Printf("AgentManager: WARNING timeout while publishing data to publishOutbox")
 							default:
-								logger.Printf("AgentManager.start() WARNING: publishOutbox is full. Skipping current value...")
+								logger.Warnf("AgentManager.start() publishOutbox is full. Skipping current value...")
+								metricPublishDropped.Inc()
 							}
 						}
 					}
@@ -141,11 +158,11 @@ func (am *AgentManager) start() {
 		case req := <-am.dataRequestInbox:
 			// Receive request from a service layer, check the cache hit and TTL.
 			// If not available execute the task or return not available error for timer/service
-			logger.Printf("AgentManager.start() Request for data from %s", req.ResourceId)
+			logger.Debugf("AgentManager.start() Request for data from %s", req.ResourceId)
 
 			resource, ok := am.config.FindResource(req.ResourceId)
 			if !ok {
-				logger.Printf("AgentManager.start() ERROR: resource %s not found!", req.ResourceId)
+				logger.Errorf("AgentManager.start() resource %s not found!", req.ResourceId)
 				if req.Reply != nil {
 					req.Reply <- AgentResponse{
 						ResourceId: req.ResourceId,
@@ -159,7 +176,7 @@ func (am *AgentManager) start() {
 			// For Write data requests
 			if req.Type == DataRequestTypeWrite {
 				if resource.Agent.Type == ExecTypeTimer || resource.Agent.Type == ExecTypeTask {
-					am.executeTask(req.ResourceId, resource.Agent, req.Arguments)
+					am.runTask(req.ResourceId, resource.Agent, req.Arguments)
 					// Respond only if the Reply channel is not nil
 					if req.Reply != nil {
 						req.Reply <- AgentResponse{
@@ -207,7 +224,7 @@ func (am *AgentManager) start() {
 					}
 
 				} else {
-					logger.Printf("AgentManager.start() ERROR: Unsupported execution type %s for resource %s!", resource.Agent.Type, req.ResourceId)
+					logger.Errorf("AgentManager.start() Unsupported execution type %s for resource %s!", resource.Agent.Type, req.ResourceId)
 					// Respond only if the Reply channel is not nil
 					if req.Reply != nil {
 						req.Reply <- AgentResponse{
@@ -223,19 +240,19 @@ func (am *AgentManager) start() {
 			// For Read data requests
 			resp, ok := am.dataCache[req.ResourceId]
 			if ok && (resource.Agent.Type != ExecTypeTask || time.Now().Sub(resp.Cached) <= AgentResponseCacheTTL) {
-				logger.Printf("AgentManager.start() Cache HIT for resource %s", req.ResourceId)
+				logger.Debugf("AgentManager.start() Cache HIT for resource %s", req.ResourceId)
 				req.Reply <- resp
 				continue
 			}
 			if resource.Agent.Type == ExecTypeTask {
 				// execute task, cache data and return
-				logger.Printf("AgentManager.start() Cache MISSED for resource %s", req.ResourceId)
-				resp := am.executeTask(req.ResourceId, resource.Agent, nil)
+				logger.Debugf("AgentManager.start() Cache MISSED for resource %s", req.ResourceId)
+				resp := am.runTask(req.ResourceId, resource.Agent, nil)
 				am.dataCache[resp.ResourceId] = resp
 				req.Reply <- resp
 				continue
 			}
-			logger.Printf("AgentManager.start() ERROR: Data for resource %s not available!", req.ResourceId)
+			logger.Errorf("AgentManager.start() Data for resource %s not available!", req.ResourceId)
 			req.Reply <- AgentResponse{
 				ResourceId: req.ResourceId,
 				Payload:    []byte("Data not available"),
@@ -250,21 +267,105 @@ func (am *AgentManager) start() {
 // Closes all channels.
 //
 func (am *AgentManager) stop() {
-	logger.Println("AgentManager.stop()")
+	logger.Info("AgentManager.stop()")
 
 	// Stop timers
 	for r, t := range am.timers {
-		logger.Printf("AgentManager.stop() Stopping %s's timer...", r)
+		logger.Infof("AgentManager.stop() Stopping %s's timer...", r)
 		t.Stop()
 	}
 
 	// Stop services
 	for r, s := range am.services {
-		logger.Printf("AgentManager.stop() Stopping %s's service...", r)
+		logger.Infof("AgentManager.stop() Stopping %s's service...", r)
 		am.stopService(s)
 	}
 }
 
+//
+// Applies changed device configurations: stops the agents of removed resources and
+// replaces the agents of resources with a changed agent configuration (blocking call)
+// The publishing channel is set if not nil
+//
+func (am *AgentManager) update(previous, current []Device, publishOutbox chan<- AgentResponse) {
+	u := agentUpdate{
+		previous:      previous,
+		current:       current,
+		publishOutbox: publishOutbox,
+		done:          make(chan struct{}),
+	}
+	am.updateInbox <- u
+	<-u.done
+}
+
+//
+// Stops and creates agents for the changes between two device configurations
+//
+func (am *AgentManager) applyUpdate(previous, current []Device) {
+	oldAgents := agentsOf(previous)
+	newAgents := agentsOf(current)
+
+	for rid, agent := range oldAgents {
+		if a, found := newAgents[rid]; found && a == agent {
+			continue
+		}
+		am.removeAgent(rid)
+	}
+	for rid, agent := range newAgents {
+		if a, found := oldAgents[rid]; found && a == agent {
+			continue
+		}
+		am.createAgent(rid, agent)
+	}
+}
+
+//
+// Returns the agents of the resources of given devices by resource id
+//
+func agentsOf(devices []Device) map[string]Agent {
+	agents := make(map[string]Agent)
+	for _, d := range devices {
+		for _, r := range d.Resources {
+			agents[d.ResourceId(r.Name)] = r.Agent
+		}
+	}
+	return agents
+}
+
+//
+// Creates the agent of a resource according to its execution type
+//
+func (am *AgentManager) createAgent(resourceId string, agent Agent) {
+	switch agent.Type {
+	case ExecTypeTimer:
+		am.createTimer(resourceId, agent)
+	case ExecTypeTask:
+		am.validateTask(resourceId, agent)
+	case ExecTypeService:
+		am.createService(resourceId, agent)
+	default:
+		logger.Errorf("AgentManager.createAgent() Unsupported execution type %s for resource %s", agent.Type, resourceId)
+	}
+}
+
+//
+// Stops the timer or service of a resource and removes its cached data
+//
+func (am *AgentManager) removeAgent(resourceId string) {
+	if t, ok := am.timers[resourceId]; ok {
+		t.Stop()
+		delete(am.timers, resourceId)
+	}
+	if s, ok := am.services[resourceId]; ok {
+		am.stopService(s)
+		delete(am.services, resourceId)
+		delete(am.serviceInpipes, resourceId)
+	}
+	delete(am.dataCache, resourceId)
+
+	logger.Infof("AgentManager.removeAgent() %s", resourceId)
+}
+
 //
 // Returns a write only data request inbox
 //
@@ -277,18 +378,39 @@ func (am *AgentManager) DataRequestInbox() chan<- DataRequest {
 //
 func (am *AgentManager) createTimer(resourceId string, agent Agent) {
 	if agent.Type != ExecTypeTimer {
-		logger.Printf("AgentManager.createTimer() ERROR: %s is not %s but %s", resourceId, ExecTypeTimer, agent.Type)
+		logger.Errorf("AgentManager.createTimer() %s is not %s but %s", resourceId, ExecTypeTimer, agent.Type)
 		return
 	}
-	ticker := time.NewTicker(agent.Interval * time.Second)
+	timer := &agentTimer{
+		Ticker: time.NewTicker(agent.Interval * time.Second),
+		quit:   make(chan struct{}),
+	}
 	go func(rid string, a Agent) {
-		for _ = range ticker.C {
-			am.agentInbox <- am.executeTask(rid, a, nil)
+		for {
+			select {
+			case <-timer.C:
+				am.agentInbox <- am.runTask(rid, a, nil)
+			case <-timer.quit:
+				return
+			}
 		}
 	}(resourceId, agent)
-	am.timers[resourceId] = ticker
+	am.timers[resourceId] = timer
+
+	logger.Infof("AgentManager.createTimer() %s", resourceId)
+}
+
+//
+// Ticker of a timer agent which also ends the executions when stopped
+//
+type agentTimer struct {
+	*time.Ticker
+	quit chan struct{}
+}
 
-	logger.Printf("AgentManager.createTimer() %s", resourceId)
+func (t *agentTimer) Stop() {
+	t.Ticker.Stop()
+	close(t.quit)
 }
 
 //
@@ -296,28 +418,39 @@ func (am *AgentManager) createTimer(resourceId string, agent Agent) {
 //
 func (am *AgentManager) validateTask(resourceId string, agent Agent) {
 	if agent.Type != ExecTypeTask {
-		logger.Printf("AgentManager.validateTask() ERROR: %s is not %s but %s", resourceId, ExecTypeTask, agent.Type)
+		logger.Errorf("AgentManager.validateTask() %s is not %s but %s", resourceId, ExecTypeTask, agent.Type)
 		return
 	}
 
 	go func() {
-		am.agentInbox <- am.executeTask(resourceId, agent, nil)
+		am.agentInbox <- am.runTask(resourceId, agent, nil)
 	}()
 
-	logger.Printf("AgentManager.validateTask() %s", resourceId)
+	logger.Infof("AgentManager.validateTask() %s", resourceId)
 }
 
 func (am *AgentManager) createService(resourceId string, agent Agent) {
 	if agent.Type != ExecTypeService {
-		logger.Printf("AgentManager.createService() ERROR: %s is not %s but %s", resourceId, ExecTypeService, agent.Type)
+		logger.Errorf("AgentManager.createService() %s is not %s but %s", resourceId, ExecTypeService, agent.Type)
 		return
 	}
 	service, err := am.executeService(resourceId, agent)
 	if err != nil {
-		logger.Printf("AgentManager.createService() ERROR: Failed to create service %s: %s", resourceId, err.Error())
+		logger.Errorf("AgentManager.createService() Failed to create service %s: %s", resourceId, err.Error())
 		return
 	}
 	am.services[resourceId] = service
 
-	logger.Printf("AgentManager.createService() %s", resourceId)
+	logger.Infof("AgentManager.createService() %s", resourceId)
+}
+
+//
+// Executes a task and records the execution metrics
+//
+func (am *AgentManager) runTask(resourceId string, agent Agent, input []byte) AgentResponse {
+	start := time.Now()
+	resp := am.executeTask(resourceId, agent, input)
+	metricAgentExecutionDuration.ObserveSince(start, string(agent.Type))
+	metricAgentExecutions.Inc(string(agent.Type), resultLabel(resp.IsError))
+	return resp
 }
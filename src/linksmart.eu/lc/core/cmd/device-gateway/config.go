@@ -11,9 +11,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/ratelimit"
+	"linksmart.eu/lc/core/logging"
+	"linksmart.eu/lc/sec/auth/validator"
 	"linksmart.eu/lc/sec/authz"
 )
 
@@ -21,10 +25,28 @@ import (
 // Loads a configuration form a given path
 //
 func loadConfig(confPath string) (*Config, error) {
+	config, err := parseConfig(confPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+//
+// Parses a configuration and the devices, applying the overrides from the environment
+//
+func parseConfig(confPath string) (*Config, error) {
 	file, err := ioutil.ReadFile(confPath)
 	if err != nil {
 		return nil, err
 	}
+	file, err = utils.ExpandEnv(file)
+	if err != nil {
+		return nil, err
+	}
 
 	rawConfig := new(struct {
 		*Config
@@ -76,6 +98,10 @@ func loadConfig(confPath string) (*Config, error) {
 		if err != nil {
 			return err
 		}
+		f, err = utils.ExpandEnv(f)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
 
 		device := new(Device)
 		err = json.Unmarshal(f, device)
@@ -91,7 +117,8 @@ func loadConfig(confPath string) (*Config, error) {
 		return nil, err
 	}
 
-	if err = config.Validate(); err != nil {
+	// Override the settings with environment variables and secret files
+	if err = utils.OverrideConfig(file, "DGW", config); err != nil {
 		return nil, err
 	}
 	return config, nil
@@ -101,91 +128,114 @@ func loadConfig(confPath string) (*Config, error) {
 // Main configuration container
 //
 type Config struct {
-	Id             string                       `json:"id"`
-	Description    string                       `json:"description"`
-	DnssdEnabled   bool                         `json:"dnssdEnabled"`
-	PublicEndpoint string                       `json:"publicEndpoint"`
-	StaticDir      string                       `json:"staticDir`
-	Catalog        []Catalog                    `json:"catalog"`
-	Http           HttpConfig                   `json:"http"`
-	Storage        StorageConfig                `json:"storage"`
-	Protocols      map[ProtocolType]interface{} `json:"protocols"`
-	Devices        []Device                     `json:"devices"`
-	Auth           ValidatorConf                `json:"auth"`
+	Id              string                       `json:"id"`
+	Description     string                       `json:"description"`
+	DnssdEnabled    bool                         `json:"dnssdEnabled"`
+	PublicEndpoint  string                       `json:"publicEndpoint"`
+	StaticDir       string                       `json:"staticDir`
+	Catalog         []Catalog                    `json:"catalog"`
+	Http            HttpConfig                   `json:"http"`
+	Storage         StorageConfig                `json:"storage"`
+	Protocols       map[ProtocolType]interface{} `json:"protocols"`
+	Devices         []Device                     `json:"devices"`
+	Auth            ValidatorConf                `json:"auth"`
+	Logging         logging.Config               `json:"logging"`
+	RateLimit       ratelimit.Config             `json:"rateLimit"`
+	ShutdownTimeout int                          `json:"shutdownTimeout"`
+
+	// guards Devices, which are replaced when the devices are reloaded
+	devicesMutex sync.RWMutex
 }
 
-// Validates the loaded configuration
+// Validates the loaded configuration, returning all problems found as utils.ConfigErrors
 func (c *Config) Validate() error {
+	var errs utils.ConfigErrors
+
 	// Check if PublicEndpoint is valid
 	if c.PublicEndpoint == "" {
-		return fmt.Errorf("PublicEndpoint has to be defined")
-	}
-	_, err := url.Parse(c.PublicEndpoint)
-	if err != nil {
-		return fmt.Errorf("PublicEndpoint should be a valid URL")
+		errs.Addf("PublicEndpoint has to be defined")
+	} else if _, err := url.Parse(c.PublicEndpoint); err != nil {
+		errs.Addf("PublicEndpoint should be a valid URL")
 	}
 
 	// Check if HTTP configuration is valid
-	err = c.Http.Validate()
-	if err != nil {
-		return err
-	}
+	errs.Add(c.Http.Validate())
 
 	// Check if Storage configuration is valid
-	err = c.Storage.Validate()
-	if err != nil {
-		return err
-	}
+	errs.Add(c.Storage.Validate())
 
-	_, ok := c.Protocols[ProtocolTypeREST]
 	// Check if REST configuration is valid
-	if ok {
-		restConf := c.Protocols[ProtocolTypeREST].(RestProtocol)
-		err := restConf.Validate()
-		if err != nil {
-			return err
-		}
+	if restConf, ok := c.Protocols[ProtocolTypeREST].(RestProtocol); ok {
+		errs.Add(restConf.Validate())
 	}
 
-	_, ok = c.Protocols[ProtocolTypeMQTT]
 	// Check if MQTT configuration is valid
-	if ok {
-		mqttConf := c.Protocols[ProtocolTypeMQTT].(MqttProtocol)
-		err := mqttConf.Validate()
-		if err != nil {
-			return err
-		}
+	if mqttConf, ok := c.Protocols[ProtocolTypeMQTT].(MqttProtocol); ok {
+		errs.Add(mqttConf.Validate())
 	}
 
 	// Check if remote catalogs configs are valid
 	for _, cat := range c.Catalog {
-		err := cat.Validate()
-		if err != nil {
-			return err
-		}
+		errs.Add(cat.Validate())
 		if cat.Auth != nil {
 			// Validate ticket obtainer config
-			err = cat.Auth.Validate()
-			if err != nil {
-				return err
+			errs.Add(cat.Auth.Validate())
+		}
+	}
+
+	// Check if SenML configs of resources are valid
+	for _, d := range c.Devices {
+		for _, r := range d.Resources {
+			if r.SenML == nil {
+				continue
 			}
+			errs.AddKey(d.ResourceId(r.Name), r.SenML.Validate())
 		}
 	}
 
 	if c.Auth.Enabled {
 		// Validate ticket validator config
-		err = c.Auth.Validate()
-		if err != nil {
-			return err
-		}
+		errs.Add(c.Auth.Validate())
 	}
 
-	return nil
+	// Check if logging configuration is valid
+	errs.AddKey("logging", c.Logging.Validate())
+
+	// Check if rate limiting configuration is valid
+	errs.AddKey("rateLimit", c.RateLimit.Validate())
+
+	if c.ShutdownTimeout < 0 {
+		errs.Addf("shutdownTimeout must not be negative")
+	}
+
+	return errs.Err()
+}
+
+// Returns the configured shutdown timeout, or else the default
+func (c *Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == 0 {
+		return utils.DefaultShutdownTimeout
+	}
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// Returns the configured devices
+func (c *Config) devices() []Device {
+	c.devicesMutex.RLock()
+	defer c.devicesMutex.RUnlock()
+	return c.Devices
+}
+
+// Replaces the configured devices
+func (c *Config) setDevices(devices []Device) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+	c.Devices = devices
 }
 
 // Finds resource record by given resource id
 func (c *Config) FindResource(resourceId string) (*Resource, bool) {
-	for _, d := range c.Devices {
+	for _, d := range c.devices() {
 		for _, r := range d.Resources {
 			if resourceId == d.ResourceId(r.Name) {
 				return &r, true
@@ -199,15 +249,21 @@ func (c *Config) FindResource(resourceId string) (*Resource, bool) {
 // Catalog config
 //
 type Catalog struct {
-	Discover bool          `json:"discover"`
-	Endpoint string        `json:"endpoint"`
-	Auth     *ObtainerConf `json:"auth"`
+	Discover bool                   `json:"discover"`
+	Endpoint string                 `json:"endpoint"`
+	Auth     *ObtainerConf          `json:"auth"`
+	TLS      *utils.ClientTLSConfig `json:"tls"`
 }
 
 func (c *Catalog) Validate() error {
 	if c.Endpoint == "" && c.Discover == false {
 		return fmt.Errorf("Catalog must have either endpoint or discovery flag defined")
 	}
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			return fmt.Errorf("Catalog tls: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -215,14 +271,18 @@ func (c *Catalog) Validate() error {
 // Http config (for protocols using it)
 //
 type HttpConfig struct {
-	BindAddr string `json:"bindAddr"`
-	BindPort int    `json:"bindPort"`
+	BindAddr string                `json:"bindAddr"`
+	BindPort int                   `json:"bindPort"`
+	TLS      utils.ServerTLSConfig `json:"tls"`
 }
 
 func (h *HttpConfig) Validate() error {
 	if h.BindAddr == "" || h.BindPort == 0 {
 		return fmt.Errorf("HTTP bindAddr and bindPort have to be defined")
 	}
+	if err := h.TLS.Validate(); err != nil {
+		return fmt.Errorf("HTTP tls: %s", err)
+	}
 	return nil
 }
 
@@ -334,6 +394,24 @@ type Resource struct {
 	Representation map[string]interface{}
 	Protocols      []SupportedProtocol
 	Agent          Agent
+	SenML          *SenMLConfig
+}
+
+//
+// SenML wrapping of the agent output (disabled if not set)
+//
+type SenMLConfig struct {
+	// Type of the value in agent output: number, string, boolean, data
+	// Detected from the output if not set
+	ValueType string `json:"valueType"`
+}
+
+func (c *SenMLConfig) Validate() error {
+	switch c.ValueType {
+	case SenMLValueTypeAuto, SenMLValueTypeNumber, SenMLValueTypeString, SenMLValueTypeBoolean, SenMLValueTypeData:
+		return nil
+	}
+	return fmt.Errorf("Unsupported SenML value type %s", c.ValueType)
 }
 
 //
@@ -382,37 +460,40 @@ type ValidatorConf struct {
 	BasicEnabled bool `json:"basicEnabled"`
 	// Authorization config
 	Authz *authz.Conf `json:"authorization"`
+	// Cache of validation results
+	Cache validator.CacheConfig `json:"cache"`
 }
 
+// Validate checks the ticket validator config, returning all problems found as utils.ConfigErrors
 func (c ValidatorConf) Validate() error {
+	var errs utils.ConfigErrors
 
 	// Validate Provider
 	if c.Provider == "" {
-		return errors.New("Ticket Validator: Auth provider name (provider) is not specified.")
+		errs.Addf("Ticket Validator: Auth provider name (provider) is not specified.")
 	}
 
 	// Validate ProviderURL
 	if c.ProviderURL == "" {
-		return errors.New("Ticket Validator: Auth provider URL (providerURL) is not specified.")
-	}
-	_, err := url.Parse(c.ProviderURL)
-	if err != nil {
-		return errors.New("Ticket Validator: Auth provider URL (providerURL) is invalid: " + err.Error())
+		errs.Addf("Ticket Validator: Auth provider URL (providerURL) is not specified.")
+	} else if _, err := url.Parse(c.ProviderURL); err != nil {
+		errs.Addf("Ticket Validator: Auth provider URL (providerURL) is invalid: %s", err)
 	}
 
 	// Validate ServiceID
 	if c.ServiceID == "" {
-		return errors.New("Ticket Validator: Auth Service ID (serviceID) is not specified.")
+		errs.Addf("Ticket Validator: Auth Service ID (serviceID) is not specified.")
 	}
 
 	// Validate Authorization
 	if c.Authz != nil {
-		if err := c.Authz.Validate(); err != nil {
-			return err
-		}
+		errs.Add(c.Authz.Validate())
 	}
 
-	return nil
+	// Validate Cache
+	errs.AddKey("Ticket Validator", c.Cache.Validate())
+
+	return errs.Err()
 }
 
 // Ticket Obtainer Client Config
@@ -3,18 +3,24 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"path/filepath"
+	"sync"
 
 	"github.com/codegangsta/negroni"
-	"github.com/gorilla/context"
+	gcontext "github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
+	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/metrics"
+	"linksmart.eu/lc/core/catalog/ratelimit"
 	catalog "linksmart.eu/lc/core/catalog/resource"
+	"linksmart.eu/lc/core/logging"
 
 	_ "linksmart.eu/lc/sec/auth/cas/validator"
 	"linksmart.eu/lc/sec/auth/validator"
@@ -29,11 +35,15 @@ type errorResponse struct {
 // RESTfulAPI contains all required configuration for running a RESTful API
 // for device gateway
 type RESTfulAPI struct {
-	config         *Config
-	restConfig     *RestProtocol
-	router         *mux.Router
-	dataCh         chan<- DataRequest
-	commonHandlers alice.Chain
+	config     *Config
+	restConfig *RestProtocol
+	// guards router, which is replaced when the devices are reloaded
+	routerMutex       sync.RWMutex
+	router            *mux.Router
+	dataCh            chan<- DataRequest
+	commonHandlers    alice.Chain
+	catalogController catalog.CatalogController
+	server            *utils.Server
 }
 
 // Constructs a RESTfulAPI data structure
@@ -42,7 +52,7 @@ func newRESTfulAPI(conf *Config, dataCh chan<- DataRequest) (*RESTfulAPI, error)
 
 	// Common handlers
 	commonHandlers := alice.New(
-		context.ClearHandler,
+		gcontext.ClearHandler,
 	)
 
 	// Append auth handler if enabled
@@ -57,39 +67,43 @@ func newRESTfulAPI(conf *Config, dataCh chan<- DataRequest) (*RESTfulAPI, error)
 		if err != nil {
 			return nil, err
 		}
+		if conf.Auth.Cache.Enabled {
+			v.EnableCache(conf.Auth.Cache, metrics.AuthCache)
+		}
 
 		commonHandlers = commonHandlers.Append(v.Handler)
 	}
 
+	// Append rate limiting handler if enabled
+	if conf.RateLimit.Enabled {
+		limiter := ratelimit.NewLimiter(conf.RateLimit, catalog.ErrorResponse)
+		commonHandlers = commonHandlers.Append(limiter.Handler)
+	}
+
 	api := &RESTfulAPI{
 		config:         conf,
 		restConfig:     &restConfig,
-		router:         mux.NewRouter().StrictSlash(true),
 		dataCh:         dataCh,
 		commonHandlers: commonHandlers,
 	}
 	return api, nil
 }
 
-// Setup all routers, handlers and start a HTTP server (blocking call)
-func (api *RESTfulAPI) start(catalogController catalog.CatalogController) {
-	api.mountCatalog(catalogController)
-	api.mountResources()
-
-	api.router.Methods("GET", "POST").Path("/dashboard").Handler(
-		api.commonHandlers.ThenFunc(api.dashboardHandler(*confPath)))
-	api.router.Methods("GET").Path(api.restConfig.Location).Handler(
-		api.commonHandlers.ThenFunc(api.indexHandler()))
+// Setup all routers, handlers and start a HTTP server
+func (api *RESTfulAPI) start(catalogController catalog.CatalogController) error {
+	api.catalogController = catalogController
+	api.router = api.newRouter()
 
 	err := mime.AddExtensionType(".jsonld", "application/ld+json")
 	if err != nil {
-		logger.Println("RESTfulAPI.start() ERROR:", err.Error())
+		logger.Error("RESTfulAPI.start()", err.Error())
 	}
 
 	// Configure the middleware
 	n := negroni.New(
 		negroni.NewRecovery(),
-		negroni.NewLogger(),
+		logging.NewRequestLogger("http"),
+		metrics.NewMiddleware("dgw"),
 		&negroni.Static{
 			Dir:       http.Dir(api.config.StaticDir),
 			Prefix:    StaticLocation,
@@ -97,12 +111,65 @@ func (api *RESTfulAPI) start(catalogController catalog.CatalogController) {
 		},
 	)
 	// Mount router
-	n.UseHandler(api.router)
+	n.UseHandler(api)
 
 	// Start the listener
 	addr := fmt.Sprintf("%v:%v", api.config.Http.BindAddr, api.config.Http.BindPort)
-	logger.Printf("RESTfulAPI.start() Starting server at http://%v%v", addr, api.restConfig.Location)
-	n.Run(addr)
+	server, err := utils.NewServer(addr, n, api.config.Http.TLS)
+	if err != nil {
+		return err
+	}
+	api.server = server
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil {
+			logger.Fatal("RESTfulAPI.start()", err.Error())
+		}
+	}()
+	scheme := "http"
+	if api.config.Http.TLS.Enabled {
+		scheme = "https"
+	}
+	logger.Infof("RESTfulAPI.start() Starting server at %s://%v%v", scheme, addr, api.restConfig.Location)
+	return nil
+}
+
+// Creates a router with all routes, including those of the currently configured resources
+func (api *RESTfulAPI) newRouter() *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+	api.mountCatalog(router)
+	api.mountResources(router)
+
+	router.Methods("GET", "POST").Path("/dashboard").Handler(
+		api.commonHandlers.ThenFunc(api.dashboardHandler(*confPath)))
+	router.Methods("GET").Path(api.restConfig.Location).Handler(
+		api.commonHandlers.ThenFunc(api.indexHandler()))
+	router.Methods("GET").Path(utils.MetricsLocation).Handler(
+		api.commonHandlers.Then(metrics.DefaultRegistry))
+	router.Methods("GET", "PUT").Path(utils.LoggingLocation).Handler(
+		api.commonHandlers.Then(logging.Handler(catalog.ErrorResponse)))
+	return router
+}
+
+// Routes a request using the current router
+func (api *RESTfulAPI) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	api.routerMutex.RLock()
+	router := api.router
+	api.routerMutex.RUnlock()
+	router.ServeHTTP(rw, req)
+}
+
+// Replaces the routes of the resources after the devices have been reloaded
+func (api *RESTfulAPI) remountResources() {
+	router := api.newRouter()
+	api.routerMutex.Lock()
+	api.router = router
+	api.routerMutex.Unlock()
+}
+
+// Stops accepting requests and waits for the in-flight ones until the context is done
+func (api *RESTfulAPI) stop(ctx context.Context) error {
+	return api.server.Shutdown(ctx)
 }
 
 // Create a HTTP handler to serve and update dashboard configuration
@@ -157,23 +224,23 @@ func (api *RESTfulAPI) indexHandler() http.HandlerFunc {
 	}
 }
 
-func (api *RESTfulAPI) mountResources() {
-	for _, device := range api.config.Devices {
+func (api *RESTfulAPI) mountResources(router *mux.Router) {
+	for _, device := range api.config.devices() {
 		for _, resource := range device.Resources {
 			for _, protocol := range resource.Protocols {
 				if protocol.Type != ProtocolTypeREST {
 					continue
 				}
 				uri := api.restConfig.Location + "/" + device.Name + "/" + resource.Name
-				logger.Println("RESTfulAPI.mountResources() Mounting resource:", uri)
+				logger.Info("RESTfulAPI.mountResources() Mounting resource:", uri)
 				rid := device.ResourceId(resource.Name)
 				for _, method := range protocol.Methods {
 					switch method {
 					case "GET":
-						api.router.Methods("GET").Path(uri).Handler(
+						router.Methods("GET").Path(uri).Handler(
 							api.commonHandlers.ThenFunc(api.createResourceGetHandler(rid)))
 					case "PUT":
-						api.router.Methods("PUT").Path(uri).Handler(
+						router.Methods("PUT").Path(uri).Handler(
 							api.commonHandlers.ThenFunc(api.createResourcePutHandler(rid)))
 					}
 				}
@@ -182,41 +249,51 @@ func (api *RESTfulAPI) mountResources() {
 	}
 }
 
-func (api *RESTfulAPI) mountCatalog(catalogController catalog.CatalogController) {
+func (api *RESTfulAPI) mountCatalog(router *mux.Router) {
 	catalogAPI := catalog.NewReadableCatalogAPI(
-		catalogController,
+		api.catalogController,
 		CatalogLocation,
 		StaticLocation,
 		fmt.Sprintf("Local catalog at %s", api.config.Description),
 	)
 
 	// Configure routers
-	api.router.Methods("GET").Path(CatalogLocation).Handler(api.commonHandlers.ThenFunc(catalogAPI.Index))
+	router.Methods("GET").Path(CatalogLocation).Handler(api.commonHandlers.ThenFunc(catalogAPI.Index))
 
 	// Devices
 	// CRUD
-	api.router.Methods("GET").Path(CatalogLocation + "/devices/{id}").Handler(
+	router.Methods("GET").Path(CatalogLocation + "/devices/{id}").Handler(
 		api.commonHandlers.ThenFunc(catalogAPI.Get))
 	// Listing, filtering
-	api.router.Methods("GET").Path(CatalogLocation + "/devices").Handler(
+	router.Methods("GET").Path(CatalogLocation + "/devices").Handler(
 		api.commonHandlers.ThenFunc(catalogAPI.List))
-	api.router.Methods("GET").Path(CatalogLocation + "/devices/{path}/{op}/{value:.*}").Handler(
+	router.Methods("GET").Path(CatalogLocation + "/devices/{id}/td").Handler(
+		api.commonHandlers.ThenFunc(catalogAPI.GetThingDescription))
+	router.Methods("GET").Path(CatalogLocation + "/devices/{path}/{op}/{value:.*}").Handler(
 		api.commonHandlers.ThenFunc(catalogAPI.Filter))
 
+	// Thing Descriptions
+	router.Methods("GET").Path(CatalogLocation + "/things").Handler(
+		api.commonHandlers.ThenFunc(catalogAPI.ListThingDescriptions))
+
 	// Resources
-	api.router.Methods("GET").Path(CatalogLocation + "/resources").Handler(
+	router.Methods("GET").Path(CatalogLocation + "/resources").Handler(
 		api.commonHandlers.ThenFunc(catalogAPI.ListResources))
-	api.router.Methods("GET").Path(CatalogLocation + "/resources/{id:[^/]+/?[^/]*}").Handler(
+	router.Methods("GET").Path(CatalogLocation + "/resources/{id:[^/]+/?[^/]*}").Handler(
 		api.commonHandlers.ThenFunc(catalogAPI.GetResource))
-	api.router.Methods("GET").Path(CatalogLocation + "/resources/{path}/{op}/{value:.*}").Handler(
+	router.Methods("GET").Path(CatalogLocation + "/resources/{path}/{op}/{value:.*}").Handler(
 		api.commonHandlers.ThenFunc(catalogAPI.FilterResources))
 
-	logger.Printf("RESTfulAPI.mountCatalog() Mounted local catalog at %v", CatalogLocation)
+	// Events
+	router.Methods("GET").Path(CatalogLocation + "/events").Handler(
+		api.commonHandlers.ThenFunc(catalogAPI.Events))
+
+	logger.Infof("RESTfulAPI.mountCatalog() Mounted local catalog at %v", CatalogLocation)
 }
 
 func (api *RESTfulAPI) createResourceGetHandler(resourceId string) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
-		logger.Printf("RESTfulAPI.createResourceGetHandler() %s %s", req.Method, req.RequestURI)
+		logger.Debugf("RESTfulAPI.createResourceGetHandler() %s %s", req.Method, req.RequestURI)
 
 		resource, found := api.config.FindResource(resourceId)
 		if !found {
@@ -225,11 +302,20 @@ func (api *RESTfulAPI) createResourceGetHandler(resourceId string) http.HandlerF
 		}
 
 		// Get the first content-type
+		// or the accepted one if the output is wrapped into SenML
+		contentType := ""
 		for _, p := range resource.Protocols {
-			if p.Type == ProtocolTypeREST && len(p.ContentTypes) > 0 {
-				rw.Header().Set("Content-Type", p.ContentTypes[0])
+			if p.Type == ProtocolTypeREST {
+				if resource.SenML != nil {
+					contentType = negotiateMediaType(req.Header.Get("Accept"), senmlContentTypes(&p))
+				} else if len(p.ContentTypes) > 0 {
+					contentType = p.ContentTypes[0]
+				}
 			}
 		}
+		if contentType != "" {
+			rw.Header().Set("Content-Type", contentType)
+		}
 
 		// Retrieve data
 		dr := DataRequest{
@@ -246,13 +332,22 @@ func (api *RESTfulAPI) createResourceGetHandler(resourceId string) http.HandlerF
 			api.respondWithInternalServerError(rw, string(repl.Payload))
 			return
 		}
+		if resource.SenML != nil && isSenMLMediaType(contentType) {
+			b, err := newSenMLEncoder(resourceId, resource).encode(repl, contentType)
+			if err != nil {
+				api.respondWithInternalServerError(rw, err.Error())
+				return
+			}
+			rw.Write(b)
+			return
+		}
 		rw.Write(repl.Payload)
 	}
 }
 
 func (api *RESTfulAPI) createResourcePutHandler(resourceId string) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
-		logger.Printf("RESTfulAPI.createResourcePutHandler() %s %s", req.Method, req.RequestURI)
+		logger.Debugf("RESTfulAPI.createResourcePutHandler() %s %s", req.Method, req.RequestURI)
 
 		// Resolve mediaType
 		v := req.Header.Get("Content-Type")
@@ -300,7 +395,7 @@ func (api *RESTfulAPI) createResourcePutHandler(resourceId string) http.HandlerF
 			Arguments:  body,
 			Reply:      make(chan AgentResponse),
 		}
-		logger.Printf("RESTfulAPI.createResourcePutHandler() Submitting data request %#v", dr)
+		logger.Debugf("RESTfulAPI.createResourcePutHandler() Submitting data request %#v", dr)
 		api.dataCh <- dr
 
 		// Wait for the response
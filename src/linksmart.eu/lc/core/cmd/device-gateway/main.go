@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -16,10 +17,12 @@ import (
 
 	utils "linksmart.eu/lc/core/catalog"
 	catalog "linksmart.eu/lc/core/catalog/resource"
+	"linksmart.eu/lc/core/logging"
 )
 
 var (
 	confPath = flag.String("conf", "conf/device-gateway.json", "Device gateway configuration file path")
+	validate = flag.Bool("validate", false, "Validate the configuration and exit without starting the gateway")
 )
 
 func main() {
@@ -30,9 +33,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *validate {
+		os.Exit(validateConfig(*confPath))
+	}
+
 	config, err := loadConfig(*confPath)
 	if err != nil {
-		logger.Printf("Failed to load configuration: %v\n", err)
+		logger.Errorf("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	err = logging.Configure(config.Logging)
+	if err != nil {
+		logger.Errorf("Failed to configure the logging: %v", err)
 		os.Exit(1)
 	}
 
@@ -52,7 +64,7 @@ func main() {
 	// Expose device's resources via REST (include statics and local catalog)
 	restServer, err := newRESTfulAPI(config, agentManager.DataRequestInbox())
 	if err != nil {
-		logger.Println(err.Error())
+		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
@@ -78,12 +90,15 @@ func main() {
 
 	catalogController, err := catalog.NewController(catalogStorage, CatalogLocation)
 	if err != nil {
-		logger.Printf("Failed to start the controller: %v", err.Error())
+		logger.Errorf("Failed to start the controller: %v", err.Error())
 		catalogStorage.Close()
 		os.Exit(1)
 	}
 
-	go restServer.start(catalogController)
+	err = restServer.start(catalogController)
+	if err != nil {
+		logger.Fatalf("Failed to start the REST API: %v", err.Error())
+	}
 
 	// Parse device configurations
 	devices := configureDevices(config)
@@ -93,7 +108,7 @@ func main() {
 		logger.Fatalf("Failed to register in local catalog: %v\n", err.Error())
 	}
 	// register in remote catalogs
-	regChannels, wg := registerInRemoteCatalog(devices, config)
+	registrations := registerInRemoteCatalog(devices, config)
 
 	// Register this gateway as a service via DNS-SD
 	var bonjourS *bonjour.Server
@@ -106,12 +121,22 @@ func main() {
 			[]string{fmt.Sprintf("uri=%s", restConfig.Location)},
 			nil)
 		if err != nil {
-			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
+			logger.Errorf("Failed to register DNS-SD service: %s", err.Error())
 		} else {
-			logger.Println("Registered service via DNS-SD using type", DNSSDServiceTypeDGW)
+			logger.Info("Registered service via DNS-SD using type", DNSSDServiceTypeDGW)
 		}
 	}
 
+	// Reload of the devices on SIGHUP
+	reloader := &deviceReloader{
+		config:            config,
+		agentManager:      agentManager,
+		mqttConnector:     mqttConnector,
+		restAPI:           restServer,
+		catalogController: catalogController,
+		registrations:     registrations,
+	}
+
 	// Ctrl+C handling
 	handler := make(chan os.Signal, 1)
 	signal.Notify(handler,
@@ -119,11 +144,20 @@ func main() {
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
-	for sig := range handler {
-		if sig == os.Interrupt {
-			logger.Println("Caught interrupt signal...")
-			break
-		}
+	sig := <-handler
+	for sig == syscall.SIGHUP {
+		logger.Info("Caught hangup signal. Reloading the devices...")
+		reloader.reload()
+		sig = <-handler
+	}
+	logger.Infof("Caught %v signal. Shutting down...", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout())
+	defer cancel()
+
+	// Stop accepting requests and wait for the in-flight ones
+	err = restServer.stop(ctx)
+	if err != nil {
+		logger.Errorf("Failed to complete the in-flight requests: %v", err)
 	}
 
 	// Stop bonjour registration
@@ -132,28 +166,24 @@ func main() {
 		time.Sleep(1e9)
 	}
 
+	// Unregister in the remote catalog(s)
+	err = registrations.stop(ctx)
+	if err != nil {
+		logger.Errorf("Failed to unregister in the remote catalogs: %v", err)
+	}
+
 	// Shutdown all
 	agentManager.stop()
-	if mqttConnector != nil {
-		mqttConnector.stop()
+	// the connector may have been created on reload
+	if reloader.mqttConnector != nil {
+		reloader.mqttConnector.stop()
 	}
 
 	// Shutdown catalog API
-	err = catalogStorage.Close()
+	err = catalogController.Stop()
 	if err != nil {
-		logger.Println(err.Error())
-	}
-
-	// Unregister in the remote catalog(s)
-	for _, sigCh := range regChannels {
-		// Notify if the routine hasn't returned already
-		select {
-		case sigCh <- true:
-		default:
-		}
+		logger.Error(err.Error())
 	}
-	wg.Wait()
 
-	logger.Println("Stopped")
-	os.Exit(0)
+	logger.Info("Stopped")
 }
@@ -0,0 +1,29 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import "linksmart.eu/lc/core/catalog/metrics"
+
+var (
+	metricAgentExecutions = metrics.NewCounter("dgw_agent_executions_total",
+		"Number of executions of task and timer agents by execution type and result (success, error)",
+		"type", "result")
+	metricAgentExecutionDuration = metrics.NewHistogram("dgw_agent_execution_duration_seconds",
+		"Duration of executions of task and timer agents by execution type", metrics.DefaultBuckets, "type")
+	metricAgentServiceOutputs = metrics.NewCounter("dgw_agent_service_outputs_total",
+		"Number of outputs received from service agents by result (success, error)", "result")
+	metricPublishDropped = metrics.NewCounter("dgw_publish_dropped_total",
+		"Number of agent outputs not published because the publishing channel was full")
+	metricMQTTConnected = metrics.NewGauge("dgw_mqtt_connected",
+		"Connection state of the MQTT broker (1 connected, 0 disconnected)")
+	metricMQTTPublishes = metrics.NewCounter("dgw_mqtt_publishes_total",
+		"Number of MQTT publications by result (success, error, discarded)", "result")
+)
+
+// Returns the result label of an agent response
+func resultLabel(isError bool) string {
+	if isError {
+		return "error"
+	}
+	return "success"
+}
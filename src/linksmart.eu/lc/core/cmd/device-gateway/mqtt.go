@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"sync"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/metrics"
 	"linksmart.eu/lc/core/catalog/service"
 )
 
@@ -23,11 +25,25 @@ type MQTTConnector struct {
 	pubCh           chan AgentResponse
 	offlineBufferCh chan AgentResponse
 	subCh           chan<- DataRequest
-	pubTopics       map[string]string
-	subTopicsRvsd   map[string]string // store SUB topics "reversed" to optimize lookup in messageHandler
+	// guards the topics and encoders, which are replaced when the devices are reloaded
+	topicsMutex   sync.RWMutex
+	pubTopics     map[string]string
+	subTopicsRvsd map[string]string // store SUB topics "reversed" to optimize lookup in messageHandler
+	// SenML wrapping of resources that have it enabled
+	pubEncoders map[string]*mqttSenMLEncoder
 }
 
-const defaultQoS = 1
+// mqttSenMLEncoder wraps published data into the SenML media type of the resource
+type mqttSenMLEncoder struct {
+	*senmlEncoder
+	mediaType string
+}
+
+const (
+	defaultQoS = 1
+	// Time to wait for the acknowledgement of a publication
+	publishTimeout = 30 * time.Second
+)
 
 func newMQTTConnector(conf *Config, dataReqCh chan<- DataRequest) *MQTTConnector {
 	// Check if we need to publish to MQTT
@@ -36,15 +52,38 @@ func newMQTTConnector(conf *Config, dataReqCh chan<- DataRequest) *MQTTConnector
 		return nil
 	}
 
-	// check whether MQTT is required at all and set pub/sub topics for each resource
-	pubTopics := make(map[string]string)
-	subTopicsRvsd := make(map[string]string)
-	requiresMqtt := false
-	for _, d := range conf.Devices {
+	// check whether MQTT is required at all
+	pubTopics, pubEncoders, subTopicsRvsd := resourceTopics(config, conf.devices())
+	if len(pubTopics) == 0 {
+		return nil
+	}
+
+	// Create and return connector
+	connector := &MQTTConnector{
+		config:          &config,
+		clientID:        fmt.Sprintf("%v-%v", conf.Id, time.Now().Unix()),
+		pubCh:           make(chan AgentResponse, 100), // buffer to compensate for pub latencies
+		offlineBufferCh: make(chan AgentResponse, config.OfflineBuffer),
+		subCh:           dataReqCh,
+		pubTopics:       pubTopics,
+		pubEncoders:     pubEncoders,
+		subTopicsRvsd:   subTopicsRvsd,
+	}
+
+	return connector
+}
+
+// returns the pub/sub topics and SenML encoders of the resources supporting MQTT
+func resourceTopics(config MqttProtocol, devices []Device) (pubTopics map[string]string,
+	pubEncoders map[string]*mqttSenMLEncoder, subTopicsRvsd map[string]string) {
+
+	pubTopics = make(map[string]string)
+	pubEncoders = make(map[string]*mqttSenMLEncoder)
+	subTopicsRvsd = make(map[string]string)
+	for _, d := range devices {
 		for _, r := range d.Resources {
 			for _, p := range r.Protocols {
 				if p.Type == ProtocolTypeMQTT {
-					requiresMqtt = true
 					rid := d.ResourceId(r.Name)
 					// if pub_topic is not provided - use default /prefix/<device_name>/<resource_name>
 					if p.PubTopic != "" {
@@ -52,6 +91,9 @@ func newMQTTConnector(conf *Config, dataReqCh chan<- DataRequest) *MQTTConnector
 					} else {
 						pubTopics[rid] = fmt.Sprintf("%s/%s", config.Prefix, rid)
 					}
+					if r.SenML != nil {
+						pubEncoders[rid] = &mqttSenMLEncoder{newSenMLEncoder(rid, &r), senmlContentTypes(&p)[0]}
+					}
 					// if sub_topic is not provided - **there will be NO** sub for this resource
 					if p.SubTopic != "" {
 						subTopicsRvsd[p.SubTopic] = rid
@@ -60,23 +102,49 @@ func newMQTTConnector(conf *Config, dataReqCh chan<- DataRequest) *MQTTConnector
 			}
 		}
 	}
+	return pubTopics, pubEncoders, subTopicsRvsd
+}
 
-	if !requiresMqtt {
-		return nil
-	}
+// replaces the topics of the resources after a change of the devices and updates the subscriptions
+func (c *MQTTConnector) update(devices []Device) {
+	pubTopics, pubEncoders, subTopicsRvsd := resourceTopics(*c.config, devices)
 
-	// Create and return connector
-	connector := &MQTTConnector{
-		config:          &config,
-		clientID:        fmt.Sprintf("%v-%v", conf.Id, time.Now().Unix()),
-		pubCh:           make(chan AgentResponse, 100), // buffer to compensate for pub latencies
-		offlineBufferCh: make(chan AgentResponse, config.OfflineBuffer),
-		subCh:           dataReqCh,
-		pubTopics:       pubTopics,
-		subTopicsRvsd:   subTopicsRvsd,
+	c.topicsMutex.Lock()
+	previous := c.subTopicsRvsd
+	c.pubTopics, c.pubEncoders, c.subTopicsRvsd = pubTopics, pubEncoders, subTopicsRvsd
+	c.topicsMutex.Unlock()
+
+	// otherwise subscribed on connect
+	if c.client == nil || !c.client.IsConnected() {
+		return
+	}
+	var unsubscribe []string
+	for topic := range previous {
+		if _, found := subTopicsRvsd[topic]; !found {
+			logger.Infof("MQTTConnector.update() will unsubscribe from topic %s", topic)
+			unsubscribe = append(unsubscribe, topic)
+		}
 	}
+	if len(unsubscribe) > 0 {
+		c.client.Unsubscribe(unsubscribe...)
+	}
+	topicFilters := make(map[string]byte)
+	for topic := range subTopicsRvsd {
+		if _, found := previous[topic]; !found {
+			logger.Infof("MQTTConnector.update() will subscribe to topic %s", topic)
+			topicFilters[topic] = defaultQoS
+		}
+	}
+	if len(topicFilters) > 0 {
+		c.client.SubscribeMultiple(topicFilters, c.messageHandler)
+	}
+}
 
-	return connector
+// returns the publishing topic of a resource
+func (c *MQTTConnector) pubTopic(resourceId string) string {
+	c.topicsMutex.RLock()
+	defer c.topicsMutex.RUnlock()
+	return c.pubTopics[resourceId]
 }
 
 func (c *MQTTConnector) dataInbox() chan<- AgentResponse {
@@ -84,12 +152,12 @@ func (c *MQTTConnector) dataInbox() chan<- AgentResponse {
 }
 
 func (c *MQTTConnector) start() {
-	logger.Println("MQTTConnector.start()")
+	logger.Info("MQTTConnector.start()")
 
 	if c.config.Discover && c.config.URL == "" {
 		err := c.discoverBrokerEndpoint()
 		if err != nil {
-			logger.Println("MQTTConnector.start() failed to start publisher:", err.Error())
+			logger.Error("MQTTConnector.start() failed to start publisher:", err.Error())
 			return
 		}
 	}
@@ -98,11 +166,18 @@ func (c *MQTTConnector) start() {
 	c.configureMqttConnection()
 
 	// start the connection routine
-	logger.Printf("MQTTConnector.start() Will connect to the broker %v\n", c.config.URL)
+	logger.Infof("MQTTConnector.start() Will connect to the broker %v", c.config.URL)
 	go c.connect(0)
 
 	// start the publisher routine
 	go c.publisher()
+
+	metrics.NewGaugeFunc("dgw_mqtt_publish_queue", "Number of messages waiting to be published", func() float64 {
+		return float64(len(c.pubCh))
+	})
+	metrics.NewGaugeFunc("dgw_mqtt_offline_buffer", "Number of messages buffered while disconnected from the broker", func() float64 {
+		return float64(len(c.offlineBufferCh))
+	})
 }
 
 // reads outgoing messages from the pubCh und publishes them to the broker
@@ -110,34 +185,66 @@ func (c *MQTTConnector) publisher() {
 	for resp := range c.pubCh {
 		if !c.client.IsConnected() {
 			if c.config.OfflineBuffer == 0 {
-				logger.Println("MQTTConnector.publisher() got data while not connected to the broker. **discarded**")
+				logger.Warn("MQTTConnector.publisher() got data while not connected to the broker. **discarded**")
+				metricMQTTPublishes.Inc("discarded")
 				continue
 			}
 			select {
 			case c.offlineBufferCh <- resp:
-				logger.Printf("MQTTConnector.publisher() got data while not connected to the broker. Keeping in buffer (%d/%d)", len(c.offlineBufferCh), c.config.OfflineBuffer)
+				logger.Debugf("MQTTConnector.publisher() got data while not connected to the broker. Keeping in buffer (%d/%d)", len(c.offlineBufferCh), c.config.OfflineBuffer)
 			default:
-				logger.Printf("MQTTConnector.publisher() got data while not connected to the broker. Buffer is full (%d/%d). **discarded**", len(c.offlineBufferCh), c.config.OfflineBuffer)
+				logger.Warnf("MQTTConnector.publisher() got data while not connected to the broker. Buffer is full (%d/%d). **discarded**", len(c.offlineBufferCh), c.config.OfflineBuffer)
+				metricMQTTPublishes.Inc("discarded")
 			}
 			continue
 		}
 		if resp.IsError {
-			logger.Println("MQTTConnector.publisher() data ERROR from agent manager:", string(resp.Payload))
+			logger.Error("MQTTConnector.publisher() error from agent manager:", string(resp.Payload))
+			continue
+		}
+		payload, err := c.payload(resp)
+		if err != nil {
+			logger.Error("MQTTConnector.publisher()", err.Error())
 			continue
 		}
-		topic := c.pubTopics[resp.ResourceId]
-		c.client.Publish(topic, byte(defaultQoS), false, resp.Payload)
-		logger.Println("MQTTConnector.publisher() published to", topic)
+		topic := c.pubTopic(resp.ResourceId)
+		c.publish(topic, payload)
+		logger.Debug("MQTTConnector.publisher() published to", topic)
 	}
 }
 
+// publishes a payload and counts the result once acknowledged
+func (c *MQTTConnector) publish(topic string, payload []byte) {
+	token := c.client.Publish(topic, byte(defaultQoS), false, payload)
+	go func() {
+		if !token.WaitTimeout(publishTimeout) || token.Error() != nil {
+			metricMQTTPublishes.Inc("error")
+			return
+		}
+		metricMQTTPublishes.Inc("success")
+	}()
+}
+
+// returns the payload to be published for an agent response
+func (c *MQTTConnector) payload(resp AgentResponse) ([]byte, error) {
+	c.topicsMutex.RLock()
+	e, ok := c.pubEncoders[resp.ResourceId]
+	c.topicsMutex.RUnlock()
+	if !ok {
+		return resp.Payload, nil
+	}
+	return e.encode(resp, e.mediaType)
+}
+
 // processes incoming messages from the broker and writes DataRequets to the subCh
 func (c *MQTTConnector) messageHandler(client MQTT.Client, msg MQTT.Message) {
-	logger.Printf("MQTTConnector.messageHandler() message received: topic: %v payload: %v\n", msg.Topic(), msg.Payload())
+	logger.Debugf("MQTTConnector.messageHandler() message received: topic: %v payload: %v", msg.Topic(), msg.Payload())
 
+	c.topicsMutex.RLock()
 	rid, ok := c.subTopicsRvsd[msg.Topic()]
+	c.topicsMutex.RUnlock()
 	if !ok {
-		logger.Println("The received message doesn't match any resource's configuration **discarded**")
+		logger.Warn("The received message doesn't match any resource's configuration **discarded**")
 		return
 	}
 
@@ -148,7 +255,7 @@ func (c *MQTTConnector) messageHandler(client MQTT.Client, msg MQTT.Message) {
 		Arguments:  msg.Payload(),
 		Reply:      nil, // there will be **no reply** on the request/command execution
 	}
-	logger.Printf("MQTTConnector.messageHandler() Submitting data request %#v", dr)
+	logger.Debugf("MQTTConnector.messageHandler() Submitting data request %#v", dr)
 	c.subCh <- dr
 	// no response - blocking on waiting for one
 }
@@ -194,7 +301,7 @@ func (c *MQTTConnector) discoverBrokerEndpoint() error {
 }
 
 func (c *MQTTConnector) stop() {
-	logger.Println("MQTTConnector.stop()")
+	logger.Info("MQTTConnector.stop()")
 	if c.client != nil && c.client.IsConnected() {
 		c.client.Disconnect(500)
 	}
@@ -202,11 +309,11 @@ func (c *MQTTConnector) stop() {
 
 func (c *MQTTConnector) connect(backOff int) {
 	if c.client == nil {
-		logger.Printf("MQTTConnector.connect() client is not configured")
+		logger.Errorf("MQTTConnector.connect() client is not configured")
 		return
 	}
 	for {
-		logger.Printf("MQTTConnector.connect() connecting to the broker %v, backOff: %v sec\n", c.config.URL, backOff)
+		logger.Infof("MQTTConnector.connect() connecting to the broker %v, backOff: %v sec", c.config.URL, backOff)
 		time.Sleep(time.Duration(backOff) * time.Second)
 		if c.client.IsConnected() {
 			break
@@ -216,7 +323,7 @@ func (c *MQTTConnector) connect(backOff int) {
 		if token.Error() == nil {
 			break
 		}
-		logger.Printf("MQTTConnector.connect() failed to connect: %v\n", token.Error().Error())
+		logger.Errorf("MQTTConnector.connect() failed to connect: %v", token.Error().Error())
 		if backOff == 0 {
 			backOff = 10
 		} else if backOff <= 600 {
@@ -224,36 +331,44 @@ func (c *MQTTConnector) connect(backOff int) {
 		}
 	}
 
-	logger.Printf("MQTTConnector.connect() connected to the broker %v", c.config.URL)
+	logger.Infof("MQTTConnector.connect() connected to the broker %v", c.config.URL)
 	return
 }
 
 func (c *MQTTConnector) onConnected(client MQTT.Client) {
-	logger.Printf("MQTTPulbisher.onConnected() Connected.")
+	logger.Infof("MQTTPulbisher.onConnected() Connected.")
+	metricMQTTConnected.Set(1)
 
 	// subscribe if there is at least one resource with SUB in MQTT protocol is configured
+	c.topicsMutex.RLock()
 	if len(c.subTopicsRvsd) > 0 {
-		logger.Println("MQTTPulbisher.onConnected() will (re-)subscribe to all configured SUB topics")
+		logger.Info("MQTTPulbisher.onConnected() will (re-)subscribe to all configured SUB topics")
 
 		topicFilters := make(map[string]byte)
 		for topic, _ := range c.subTopicsRvsd {
-			logger.Printf("MQTTPulbisher.onConnected() will subscribe to topic %s", topic)
+			logger.Infof("MQTTPulbisher.onConnected() will subscribe to topic %s", topic)
 			topicFilters[topic] = defaultQoS
 		}
 		client.SubscribeMultiple(topicFilters, c.messageHandler)
 	} else {
-		logger.Println("MQTTPulbisher.onConnected() no resources with SUB configured")
+		logger.Info("MQTTPulbisher.onConnected() no resources with SUB configured")
 	}
+	c.topicsMutex.RUnlock()
 
 	// publish buffered messages to the broker
 	for resp := range c.offlineBufferCh {
 		if resp.IsError {
-			logger.Println("MQTTConnector.onConnected() data ERROR from agent manager:", string(resp.Payload))
+			logger.Error("MQTTConnector.onConnected() error from agent manager:", string(resp.Payload))
+			continue
+		}
+		payload, err := c.payload(resp)
+		if err != nil {
+			logger.Error("MQTTConnector.onConnected()", err.Error())
 			continue
 		}
-		topic := c.pubTopics[resp.ResourceId]
-		c.client.Publish(topic, byte(defaultQoS), false, resp.Payload)
-		logger.Printf("MQTTConnector.onConnected() published buffered message to %s (%d/%d)", topic, len(c.offlineBufferCh)+1, c.config.OfflineBuffer)
+		topic := c.pubTopic(resp.ResourceId)
+		c.publish(topic, payload)
+		logger.Debugf("MQTTConnector.onConnected() published buffered message to %s (%d/%d)", topic, len(c.offlineBufferCh)+1, c.config.OfflineBuffer)
 		if len(c.offlineBufferCh) == 0 {
 			break
 		}
@@ -262,7 +377,8 @@ func (c *MQTTConnector) onConnected(client MQTT.Client) {
 }
 
 func (c *MQTTConnector) onConnectionLost(client MQTT.Client, reason error) {
-	logger.Println("MQTTPulbisher.onConnectionLost() lost connection to the broker: ", reason.Error())
+	logger.Warn("MQTTPulbisher.onConnectionLost() lost connection to the broker: ", reason.Error())
+	metricMQTTConnected.Set(0)
 
 	// Initialize a new client and re-connect
 	c.configureMqttConnection()
@@ -292,12 +408,12 @@ func (c *MQTTConnector) configureMqttConnection() {
 		if c.config.CaFile != "" {
 			caFile, err := ioutil.ReadFile(c.config.CaFile)
 			if err != nil {
-				logger.Printf("MQTTConnector.configureMqttConnection() ERROR: failed to read CA file %s:%s\n", c.config.CaFile, err.Error())
+				logger.Errorf("MQTTConnector.configureMqttConnection() failed to read CA file %s:%s", c.config.CaFile, err.Error())
 			} else {
 				tlsConfig.RootCAs = x509.NewCertPool()
 				ok := tlsConfig.RootCAs.AppendCertsFromPEM(caFile)
 				if !ok {
-					logger.Printf("MQTTConnector.configureMqttConnection() ERROR: failed to parse CA certificate %s\n", c.config.CaFile)
+					logger.Errorf("MQTTConnector.configureMqttConnection() failed to parse CA certificate %s", c.config.CaFile)
 				}
 			}
 		}
@@ -305,7 +421,7 @@ func (c *MQTTConnector) configureMqttConnection() {
 		if c.config.CertFile != "" && c.config.KeyFile != "" {
 			cert, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
 			if err != nil {
-				logger.Printf("MQTTConnector.configureMqttConnection() ERROR: failed to load client TLS credentials: %s\n",
+				logger.Errorf("MQTTConnector.configureMqttConnection() failed to load client TLS credentials: %s",
 					err.Error())
 			} else {
 				tlsConfig.Certificates = []tls.Certificate{cert}
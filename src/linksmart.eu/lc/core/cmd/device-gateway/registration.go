@@ -3,9 +3,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
+	utils "linksmart.eu/lc/core/catalog"
 	catalog "linksmart.eu/lc/core/catalog/resource"
 
 	_ "linksmart.eu/lc/sec/auth/cas/obtainer"
@@ -14,9 +16,10 @@ import (
 
 // Parses config into a slice of configured devices
 func configureDevices(config *Config) []catalog.Device {
-	devices := make([]catalog.Device, 0, len(config.Devices))
+	configured := config.devices()
+	devices := make([]catalog.Device, 0, len(configured))
 	restConfig, _ := config.Protocols[ProtocolTypeREST].(RestProtocol)
-	for _, device := range config.Devices {
+	for _, device := range configured {
 		r := new(catalog.Device)
 		r.Type = catalog.ApiDeviceType
 		r.Ttl = device.Ttl
@@ -39,6 +42,9 @@ func configureDevices(config *Config) []catalog.Device {
 				p.Type = string(proto.Type)
 				p.Methods = proto.Methods
 				p.ContentTypes = proto.ContentTypes
+				if resource.SenML != nil {
+					p.ContentTypes = senmlContentTypes(&proto)
+				}
 				p.Endpoint = map[string]interface{}{}
 				if proto.Type == ProtocolTypeREST {
 					p.Endpoint["url"] = fmt.Sprintf("%s%s/%s/%s",
@@ -84,12 +90,45 @@ func registerInLocalCatalog(devices []catalog.Device, controller catalog.Catalog
 	return nil
 }
 
-func registerInRemoteCatalog(devices []catalog.Device, config *Config) ([]chan<- bool, *sync.WaitGroup) {
-	regChannels := make([]chan<- bool, 0, len(config.Catalog))
-	var wg sync.WaitGroup
+// Registrations of devices in the remote catalogs, kept alive until removed
+type remoteRegistrations struct {
+	catalogs []remoteCatalog
+	// registrations in all catalogs by device id
+	registrations map[string][]*registration
+	wg            sync.WaitGroup
+}
+
+// A configured remote catalog
+type remoteCatalog struct {
+	Catalog
+	ticket  *obtainer.Client
+	options utils.ClientOptions
+}
+
+// A registration routine of a device in a remote catalog
+type registration struct {
+	sigCh chan bool
+	// closed when the routine has returned
+	done chan struct{}
+}
+
+// Signals the routine to remove the registration (non-blocking call)
+func (r *registration) stop() {
+	go func() {
+		select {
+		case r.sigCh <- true:
+		case <-r.done:
+		}
+	}()
+}
+
+func registerInRemoteCatalog(devices []catalog.Device, config *Config) *remoteRegistrations {
+	regs := &remoteRegistrations{
+		registrations: make(map[string][]*registration),
+	}
 
 	if len(config.Catalog) > 0 {
-		logger.Println("Will now register in the configured remote catalogs")
+		logger.Info("Will now register in the configured remote catalogs")
 
 		for _, cat := range config.Catalog {
 			var ticket *obtainer.Client
@@ -98,19 +137,77 @@ func registerInRemoteCatalog(devices []catalog.Device, config *Config) ([]chan<-
 				// Setup ticket client
 				ticket, err = obtainer.NewClient(cat.Auth.Provider, cat.Auth.ProviderURL, cat.Auth.Username, cat.Auth.Password, cat.Auth.ServiceID)
 				if err != nil {
-					logger.Println(err.Error())
+					logger.Error(err.Error())
 					continue
 				}
 			}
-
-			for _, d := range devices {
-				sigCh := make(chan bool)
-				wg.Add(1)
-				go catalog.RegisterDeviceWithKeepalive(cat.Endpoint, cat.Discover, d, sigCh, &wg, ticket)
-				regChannels = append(regChannels, sigCh)
+			options := utils.DefaultClientOptions()
+			if cat.TLS != nil {
+				// Setup client TLS
+				options.TLSConfig, err = cat.TLS.TLSConfig()
+				if err != nil {
+					logger.Error(err.Error())
+					continue
+				}
 			}
+			regs.catalogs = append(regs.catalogs, remoteCatalog{cat, ticket, options})
+		}
+
+		for _, d := range devices {
+			regs.add(d)
+		}
+	}
+
+	return regs
+}
+
+// Registers a device in all remote catalogs
+// The registration starts after the removal of a previous registration of the device
+func (regs *remoteRegistrations) add(d catalog.Device) {
+	previous := regs.registrations[d.Id]
+	current := make([]*registration, 0, len(regs.catalogs))
+	for i, cat := range regs.catalogs {
+		r := &registration{
+			sigCh: make(chan bool),
+			done:  make(chan struct{}),
 		}
+		var wait <-chan struct{}
+		if previous != nil {
+			wait = previous[i].done
+		}
+		regs.wg.Add(1)
+		go func(r *registration, cat remoteCatalog, wait <-chan struct{}) {
+			defer close(r.done)
+			if wait != nil {
+				<-wait
+			}
+			catalog.RegisterDeviceWithKeepaliveOptions(cat.Endpoint, cat.Discover, d, r.sigCh, &regs.wg, cat.ticket, cat.options)
+		}(r, cat, wait)
+		current = append(current, r)
 	}
+	regs.registrations[d.Id] = current
+}
+
+// Removes the registrations of a device from all remote catalogs
+func (regs *remoteRegistrations) remove(id string) {
+	for _, r := range regs.registrations[id] {
+		r.stop()
+	}
+	delete(regs.registrations, id)
+}
 
-	return regChannels, &wg
+// Registers a device in all remote catalogs, replacing its previous registrations
+func (regs *remoteRegistrations) update(d catalog.Device) {
+	for _, r := range regs.registrations[d.Id] {
+		r.stop()
+	}
+	regs.add(d)
+}
+
+// Removes all registrations and waits for the routines until the context is done
+func (regs *remoteRegistrations) stop(ctx context.Context) error {
+	for id := range regs.registrations {
+		regs.remove(id)
+	}
+	return utils.WaitContext(ctx, &regs.wg)
 }
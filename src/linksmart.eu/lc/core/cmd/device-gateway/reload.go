@@ -0,0 +1,117 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import (
+	"reflect"
+
+	catalog "linksmart.eu/lc/core/catalog/resource"
+)
+
+// Changes between two configurations of the devices
+type deviceChanges struct {
+	added   []Device
+	updated []Device
+	removed []Device
+}
+
+func diffDevices(previous, current []Device) deviceChanges {
+	var changes deviceChanges
+	previousByName := make(map[string]Device)
+	for _, d := range previous {
+		previousByName[d.Name] = d
+	}
+	currentByName := make(map[string]bool)
+	for _, d := range current {
+		currentByName[d.Name] = true
+		p, found := previousByName[d.Name]
+		if !found {
+			changes.added = append(changes.added, d)
+		} else if !reflect.DeepEqual(p, d) {
+			changes.updated = append(changes.updated, d)
+		}
+	}
+	for _, d := range previous {
+		if !currentByName[d.Name] {
+			changes.removed = append(changes.removed, d)
+		}
+	}
+	return changes
+}
+
+func (c deviceChanges) empty() bool {
+	return len(c.added) == 0 && len(c.updated) == 0 && len(c.removed) == 0
+}
+
+// deviceReloader applies changes of the device configurations to a running gateway
+type deviceReloader struct {
+	config            *Config
+	agentManager      *AgentManager
+	mqttConnector     *MQTTConnector
+	restAPI           *RESTfulAPI
+	catalogController catalog.CatalogController
+	registrations     *remoteRegistrations
+}
+
+// Loads the configuration and applies the changes of the devices
+// Only the devices are reloaded, changes of other settings require a restart
+func (r *deviceReloader) reload() {
+	loaded, err := loadConfig(*confPath)
+	if err != nil {
+		logger.Errorf("deviceReloader.reload() Failed to load configuration: %v. Keeping the current devices", err)
+		return
+	}
+
+	previous := r.config.devices()
+	changes := diffDevices(previous, loaded.Devices)
+	if changes.empty() {
+		logger.Info("deviceReloader.reload() No changes of the devices")
+		return
+	}
+	logger.Infof("deviceReloader.reload() Devices added: %d, updated: %d, removed: %d",
+		len(changes.added), len(changes.updated), len(changes.removed))
+	r.config.setDevices(loaded.Devices)
+
+	// Update MQTT topics and subscriptions, or connect if required by the new devices
+	var publishOutbox chan<- AgentResponse
+	if r.mqttConnector != nil {
+		r.mqttConnector.update(loaded.Devices)
+	} else {
+		r.mqttConnector = newMQTTConnector(r.config, r.agentManager.DataRequestInbox())
+		if r.mqttConnector != nil {
+			publishOutbox = r.mqttConnector.dataInbox()
+			go r.mqttConnector.start()
+		}
+	}
+
+	// Replace the agents of changed resources
+	r.agentManager.update(previous, loaded.Devices, publishOutbox)
+
+	// Mount the routes of the new resources
+	r.restAPI.remountResources()
+
+	// Update the registrations in local and remote catalogs
+	changed := make(map[string]bool)
+	for _, d := range append(changes.added, changes.updated...) {
+		changed[d.Name] = true
+	}
+	client := catalog.NewLocalCatalogClient(r.catalogController)
+	for _, d := range configureDevices(r.config) {
+		if !changed[d.Id] {
+			continue
+		}
+		r.registrations.update(d)
+		d.Ttl = 0
+		err := catalog.RegisterDevice(client, &d)
+		if err != nil {
+			logger.Errorf("deviceReloader.reload() Failed to register %s in local catalog: %v", d.Id, err)
+		}
+	}
+	for _, d := range changes.removed {
+		r.registrations.remove(d.Name)
+		err := client.Delete(d.Name)
+		if err != nil {
+			logger.Errorf("deviceReloader.reload() Failed to remove %s from local catalog: %v", d.Name, err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SenML media types (RFC 8428)
+const (
+	SenMLMediaTypeJSON = "application/senml+json"
+	SenMLMediaTypeCBOR = "application/senml+cbor"
+)
+
+// SenML value types
+const (
+	SenMLValueTypeAuto    = ""
+	SenMLValueTypeNumber  = "number"
+	SenMLValueTypeString  = "string"
+	SenMLValueTypeBoolean = "boolean"
+	SenMLValueTypeData    = "data"
+)
+
+// SenML labels for the CBOR representation (RFC 8428, Table 6)
+const (
+	senmlCBORBaseName    = -2
+	senmlCBORBaseTime    = -3
+	senmlCBORUnit        = 1
+	senmlCBORValue       = 2
+	senmlCBORStringValue = 3
+	senmlCBORBoolValue   = 4
+	senmlCBORDataValue   = 8
+)
+
+// SenMLRecord is a single SenML record
+type SenMLRecord struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	DataValue   []byte   `json:"-"`
+}
+
+// MarshalJSON encodes the data value as base64url as required by RFC 8428
+func (r SenMLRecord) MarshalJSON() ([]byte, error) {
+	type record SenMLRecord
+	if r.DataValue == nil {
+		return json.Marshal(record(r))
+	}
+	return json.Marshal(struct {
+		record
+		DataValue string `json:"vd"`
+	}{record(r), base64.RawURLEncoding.EncodeToString(r.DataValue)})
+}
+
+// Checks whether a media type is a SenML media type
+func isSenMLMediaType(mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+	return mediaType == SenMLMediaTypeJSON || mediaType == SenMLMediaTypeCBOR
+}
+
+// Returns the content-types of a protocol of a resource with SenML enabled
+// REST serves both SenML representations by default, MQTT publishes SenML JSON
+// unless another SenML media type is configured first
+func senmlContentTypes(p *SupportedProtocol) []string {
+	var contentTypes []string
+	switch p.Type {
+	case ProtocolTypeREST:
+		contentTypes = []string{SenMLMediaTypeJSON, SenMLMediaTypeCBOR}
+	case ProtocolTypeMQTT:
+		if len(p.ContentTypes) > 0 && isSenMLMediaType(p.ContentTypes[0]) {
+			return p.ContentTypes
+		}
+		contentTypes = []string{SenMLMediaTypeJSON}
+	default:
+		return p.ContentTypes
+	}
+	for _, ct := range p.ContentTypes {
+		if !isSenMLMediaType(ct) {
+			contentTypes = append(contentTypes, ct)
+		}
+	}
+	return contentTypes
+}
+
+// Selects the media type of a response based on the Accept header
+// The accepted media types are tried by descending quality (q parameter), media types with q=0 are excluded
+// Falls back to the first content-type if none of the accepted ones is supported
+func negotiateMediaType(accept string, contentTypes []string) string {
+	if len(contentTypes) == 0 {
+		return ""
+	}
+	type acceptedType struct {
+		mediaType string
+		quality   float64
+	}
+	var accepted []acceptedType
+	excluded := make(map[string]bool)
+	for _, a := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(a)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			excluded[mediaType] = true
+			continue
+		}
+		accepted = append(accepted, acceptedType{mediaType, quality})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+
+	for _, a := range accepted {
+		for _, ct := range contentTypes {
+			if !excluded[strings.ToLower(ct)] && matchMediaType(a.mediaType, strings.ToLower(ct)) {
+				return ct
+			}
+		}
+	}
+	return contentTypes[0]
+}
+
+// Checks whether a media type matches an accepted media range, e.g. */* or application/*
+func matchMediaType(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// senmlEncoder wraps agent responses of a resource into SenML
+type senmlEncoder struct {
+	baseName  string
+	unit      string
+	valueType string
+}
+
+func newSenMLEncoder(resourceId string, r *Resource) *senmlEncoder {
+	e := &senmlEncoder{
+		baseName:  resourceId,
+		valueType: r.SenML.ValueType,
+	}
+	if unit, ok := r.Meta["unit"].(string); ok {
+		e.unit = unit
+	}
+	return e
+}
+
+// Creates the SenML record of an agent response
+func (e *senmlEncoder) record(resp AgentResponse) (*SenMLRecord, error) {
+	r := &SenMLRecord{
+		BaseName: e.baseName,
+		Unit:     e.unit,
+	}
+	if !resp.Cached.IsZero() {
+		r.BaseTime = float64(resp.Cached.UnixNano()) / 1e9
+	}
+
+	payload := strings.TrimSpace(string(resp.Payload))
+	switch e.valueType {
+	case SenMLValueTypeNumber:
+		v, err := strconv.ParseFloat(payload, 64)
+		if err != nil {
+			return nil, fmt.Errorf("agent output is not a number: %s", payload)
+		}
+		r.Value = &v
+	case SenMLValueTypeBoolean:
+		v, err := strconv.ParseBool(payload)
+		if err != nil {
+			return nil, fmt.Errorf("agent output is not a boolean: %s", payload)
+		}
+		r.BoolValue = &v
+	case SenMLValueTypeString:
+		r.StringValue = &payload
+	case SenMLValueTypeData:
+		r.DataValue = resp.Payload
+	default:
+		if v, err := strconv.ParseFloat(payload, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			r.Value = &v
+		} else if payload == "true" || payload == "false" {
+			v := payload == "true"
+			r.BoolValue = &v
+		} else {
+			r.StringValue = &payload
+		}
+	}
+	return r, nil
+}
+
+// Encodes an agent response as a SenML pack in the given media type
+func (e *senmlEncoder) encode(resp AgentResponse, mediaType string) ([]byte, error) {
+	r, err := e.record(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(mediaType) {
+	case SenMLMediaTypeJSON:
+		return json.Marshal([]*SenMLRecord{r})
+	case SenMLMediaTypeCBOR:
+		return r.cborPack(), nil
+	}
+	return nil, fmt.Errorf("unsupported SenML media type %s", mediaType)
+}
+
+// Encodes the record as a single-record SenML CBOR pack
+func (r *SenMLRecord) cborPack() []byte {
+	var buf bytes.Buffer
+
+	fields := 0
+	for _, set := range []bool{r.BaseName != "", r.BaseTime != 0, r.Unit != "",
+		r.Value != nil, r.StringValue != nil, r.BoolValue != nil, r.DataValue != nil} {
+		if set {
+			fields++
+		}
+	}
+
+	cborHead(&buf, 4, 1) // array of one record
+	cborHead(&buf, 5, uint64(fields))
+	if r.BaseName != "" {
+		cborInt(&buf, senmlCBORBaseName)
+		cborText(&buf, r.BaseName)
+	}
+	if r.BaseTime != 0 {
+		cborInt(&buf, senmlCBORBaseTime)
+		cborFloat(&buf, r.BaseTime)
+	}
+	if r.Unit != "" {
+		cborInt(&buf, senmlCBORUnit)
+		cborText(&buf, r.Unit)
+	}
+	if r.Value != nil {
+		cborInt(&buf, senmlCBORValue)
+		cborFloat(&buf, *r.Value)
+	}
+	if r.StringValue != nil {
+		cborInt(&buf, senmlCBORStringValue)
+		cborText(&buf, *r.StringValue)
+	}
+	if r.BoolValue != nil {
+		cborInt(&buf, senmlCBORBoolValue)
+		if *r.BoolValue {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	}
+	if r.DataValue != nil {
+		cborInt(&buf, senmlCBORDataValue)
+		cborHead(&buf, 2, uint64(len(r.DataValue)))
+		buf.Write(r.DataValue)
+	}
+	return buf.Bytes()
+}
+
+// Writes a CBOR data item head (RFC 7049) of a given major type and argument
+func cborHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+func cborInt(buf *bytes.Buffer, v int64) {
+	if v < 0 {
+		cborHead(buf, 1, uint64(-1-v))
+		return
+	}
+	cborHead(buf, 0, uint64(v))
+}
+
+func cborText(buf *bytes.Buffer, s string) {
+	cborHead(buf, 3, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func cborFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(0xfb) // double-precision float
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
@@ -0,0 +1,152 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func float64Ptr(v float64) *float64 { return &v }
+func stringPtr(v string) *string    { return &v }
+func boolPtr(v bool) *bool          { return &v }
+
+func TestSenMLRecord(t *testing.T) {
+	cases := []struct {
+		valueType string
+		payload   string
+		expected  *SenMLRecord // nil if an error is expected
+	}{
+		// value type detection
+		{SenMLValueTypeAuto, "23.1", &SenMLRecord{BaseName: "r", Value: float64Ptr(23.1)}},
+		{SenMLValueTypeAuto, " 42\n", &SenMLRecord{BaseName: "r", Value: float64Ptr(42)}},
+		{SenMLValueTypeAuto, "true", &SenMLRecord{BaseName: "r", BoolValue: boolPtr(true)}},
+		{SenMLValueTypeAuto, "false", &SenMLRecord{BaseName: "r", BoolValue: boolPtr(false)}},
+		{SenMLValueTypeAuto, "on", &SenMLRecord{BaseName: "r", StringValue: stringPtr("on")}},
+		{SenMLValueTypeAuto, "NaN", &SenMLRecord{BaseName: "r", StringValue: stringPtr("NaN")}},
+		{SenMLValueTypeAuto, "Inf", &SenMLRecord{BaseName: "r", StringValue: stringPtr("Inf")}},
+		// explicit value types
+		{SenMLValueTypeNumber, "23.1", &SenMLRecord{BaseName: "r", Value: float64Ptr(23.1)}},
+		{SenMLValueTypeNumber, "on", nil},
+		{SenMLValueTypeBoolean, "1", &SenMLRecord{BaseName: "r", BoolValue: boolPtr(true)}},
+		{SenMLValueTypeBoolean, "maybe", nil},
+		{SenMLValueTypeString, "23.1", &SenMLRecord{BaseName: "r", StringValue: stringPtr("23.1")}},
+		{SenMLValueTypeData, "23.1\n", &SenMLRecord{BaseName: "r", DataValue: []byte("23.1\n")}},
+	}
+	for _, c := range cases {
+		e := &senmlEncoder{baseName: "r", valueType: c.valueType}
+		r, err := e.record(AgentResponse{Payload: []byte(c.payload)})
+		if c.expected == nil {
+			if err == nil {
+				t.Errorf("%q as %q: expected an error, got %+v", c.payload, c.valueType, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q as %q: unexpected error: %s", c.payload, c.valueType, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, c.expected) {
+			t.Errorf("%q as %q: expected %+v, got %+v", c.payload, c.valueType, c.expected, r)
+		}
+	}
+}
+
+func TestSenMLEncodeJSON(t *testing.T) {
+	cached := time.Unix(1276020076, 1000000)
+	cases := []struct {
+		encoder  senmlEncoder
+		resp     AgentResponse
+		expected string
+	}{
+		// RFC 8428, Section 5.1.1, with the name as base name and a base time
+		{senmlEncoder{baseName: "urn:dev:ow:10e2073a01080063", unit: "Cel"},
+			AgentResponse{Payload: []byte("23.1"), Cached: cached},
+			`[{"bn":"urn:dev:ow:10e2073a01080063","bt":1276020076.001,"u":"Cel","v":23.1}]`},
+		{senmlEncoder{baseName: "r"}, AgentResponse{Payload: []byte("on")}, `[{"bn":"r","vs":"on"}]`},
+		{senmlEncoder{baseName: "r"}, AgentResponse{Payload: []byte("false")}, `[{"bn":"r","vb":false}]`},
+		// base64url without padding
+		{senmlEncoder{baseName: "r", valueType: SenMLValueTypeData}, AgentResponse{Payload: []byte{0x01, 0x02, 0xff}},
+			`[{"bn":"r","vd":"AQL_"}]`},
+	}
+	for _, c := range cases {
+		b, err := c.encoder.encode(c.resp, SenMLMediaTypeJSON)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.resp.Payload, err)
+			continue
+		}
+		if string(b) != c.expected {
+			t.Errorf("%q: expected %s, got %s", c.resp.Payload, c.expected, b)
+		}
+	}
+
+	e := senmlEncoder{baseName: "r"}
+	if _, err := e.encode(AgentResponse{Payload: []byte("1")}, "application/json"); err == nil {
+		t.Error("Expected an error for an unsupported media type")
+	}
+	if _, err := e.encode(AgentResponse{Payload: []byte("1")}, strings.ToUpper(SenMLMediaTypeCBOR)); err != nil {
+		t.Errorf("Unexpected error for an upper case media type: %s", err)
+	}
+}
+
+func TestSenMLCBORPack(t *testing.T) {
+	cases := []struct {
+		record   SenMLRecord
+		expected string
+	}{
+		// Items encoded as in the example of RFC 8428, Section 6:
+		// bn, bt, u and v of the first record, in a pack of one record
+		{SenMLRecord{BaseName: "urn:dev:ow:10e2073a0108006:", BaseTime: 1.276020076001e+09, Unit: "V", Value: float64Ptr(120.1)},
+			"81 a4" +
+				" 21 78 1b 75 72 6e 3a 64 65 76 3a 6f 77 3a 31 30 65 32 30 37 33 61 30 31 30 38 30 30 36 3a" +
+				" 22 fb 41 d3 03 a1 5b 00 10 62" +
+				" 01 61 56" +
+				" 02 fb 40 5e 06 66 66 66 66 66"},
+		{SenMLRecord{BaseName: "r", StringValue: stringPtr("on")}, "81 a2 21 61 72 03 62 6f 6e"},
+		{SenMLRecord{BaseName: "r", BoolValue: boolPtr(true)}, "81 a2 21 61 72 04 f5"},
+		{SenMLRecord{BaseName: "r", BoolValue: boolPtr(false)}, "81 a2 21 61 72 04 f4"},
+		{SenMLRecord{BaseName: "r", DataValue: []byte{0x01, 0x02}}, "81 a2 21 61 72 08 42 01 02"},
+	}
+	for _, c := range cases {
+		expected, err := hex.DecodeString(strings.Replace(c.expected, " ", "", -1))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if b := c.record.cborPack(); !bytes.Equal(b, expected) {
+			t.Errorf("%+v: expected % x, got % x", c.record, expected, b)
+		}
+	}
+}
+
+func TestNegotiateMediaType(t *testing.T) {
+	contentTypes := []string{SenMLMediaTypeJSON, SenMLMediaTypeCBOR, "text/plain"}
+	cases := []struct {
+		accept   string
+		expected string
+	}{
+		{"", SenMLMediaTypeJSON},
+		{SenMLMediaTypeCBOR, SenMLMediaTypeCBOR},
+		{"APPLICATION/SENML+CBOR", SenMLMediaTypeCBOR},
+		{"application/senml+json;q=0.5, application/senml+cbor", SenMLMediaTypeCBOR},
+		{"application/senml+cbor;q=0.2, application/senml+json;q=0.8", SenMLMediaTypeJSON},
+		{"application/senml+json;q=0, */*;q=0.1", SenMLMediaTypeCBOR},
+		{"text/*", "text/plain"},
+		// unsupported types fall back to the first content-type
+		{"application/xml", SenMLMediaTypeJSON},
+		{"application/xml, application/senml+cbor;q=0.1", SenMLMediaTypeCBOR},
+		{";;invalid, application/senml+cbor", SenMLMediaTypeCBOR},
+	}
+	for _, c := range cases {
+		if mediaType := negotiateMediaType(c.accept, contentTypes); mediaType != c.expected {
+			t.Errorf("Accept %q: expected %s, got %s", c.accept, c.expected, mediaType)
+		}
+	}
+
+	if mediaType := negotiateMediaType(SenMLMediaTypeJSON, nil); mediaType != "" {
+		t.Errorf("Expected no media type without content-types, got %s", mediaType)
+	}
+}
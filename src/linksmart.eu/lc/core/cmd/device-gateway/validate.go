@@ -0,0 +1,97 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/sec/auth/obtainer"
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Validates the configuration and its environment without starting the gateway (-validate flag)
+// Prints a report and returns the exit status
+func validateConfig(path string) int {
+	config, err := parseConfig(path)
+	if err != nil {
+		return utils.WriteValidationReport(os.Stdout, path, err)
+	}
+	var errs utils.ConfigErrors
+	errs.Add(config.Validate())
+	errs.Add(config.check())
+	return utils.WriteValidationReport(os.Stdout, path, errs.Err())
+}
+
+// Checks the resources referenced by the configuration: files, agent executables, auth drivers
+// and the listening port. Neither DNS-SD nor the MQTT broker are contacted
+func (c *Config) check() error {
+	var errs utils.ConfigErrors
+	if c.StaticDir != "" {
+		errs.AddKey("staticDir", utils.CheckDir(c.StaticDir))
+	}
+	if c.Http.TLS.Validate() == nil {
+		errs.AddKey("http tls", c.Http.TLS.Check())
+	}
+	if c.Auth.Enabled && c.Auth.Provider != "" {
+		errs.AddKey("auth", utils.CheckDriver("validator", c.Auth.Provider, validator.Drivers()))
+	}
+	for i, cat := range c.Catalog {
+		key := fmt.Sprintf("catalog[%d]", i)
+		if cat.Auth != nil && cat.Auth.Provider != "" {
+			errs.AddKey(key+" auth", utils.CheckDriver("obtainer", cat.Auth.Provider, obtainer.Drivers()))
+		}
+		if cat.TLS != nil && cat.TLS.Validate() == nil {
+			errs.AddKey(key+" tls", cat.TLS.Check())
+		}
+	}
+	for _, d := range c.Devices {
+		for _, r := range d.Resources {
+			errs.AddKey(d.ResourceId(r.Name)+" agent", checkAgent(r.Agent))
+		}
+	}
+	if c.Http.BindPort != 0 {
+		errs.Add(utils.CheckListenAddr(net.JoinHostPort(c.Http.BindAddr, strconv.Itoa(c.Http.BindPort))))
+	}
+	return errs.Err()
+}
+
+// Checks that the working directory and the program of an agent exist
+// The program is the first word of the command, looked up in PATH unless it is a path
+func checkAgent(agent Agent) error {
+	if agent.Dir != "" {
+		if err := utils.CheckDir(agent.Dir); err != nil {
+			return err
+		}
+	}
+	fields := strings.Fields(agent.Exec)
+	if len(fields) == 0 {
+		return errors.New("Exec has to be defined")
+	}
+	program := fields[0]
+	if !strings.ContainsAny(program, `/\`) {
+		if _, err := exec.LookPath(program); err != nil {
+			return fmt.Errorf("Executable %s not found in PATH", program)
+		}
+		return nil
+	}
+	if !filepath.IsAbs(program) && agent.Dir != "" {
+		program = filepath.Join(agent.Dir, program)
+	}
+	info, err := os.Stat(program)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+		return fmt.Errorf("%s is not executable", program)
+	}
+	return nil
+}
@@ -3,35 +3,62 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"strings"
+	"time"
 
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/authzadmin"
+	"linksmart.eu/lc/core/catalog/ratelimit"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/core/logging"
+	"linksmart.eu/lc/sec/auth/validator"
 	"linksmart.eu/lc/sec/authz"
 )
 
 type Config struct {
-	Description    string           `json:"description"`
-	PublicEndpoint string           `json:"publicEndpoint"`
-	BindAddr       string           `json:"bindAddr"`
-	BindPort       int              `json:"bindPort"`
-	DnssdEnabled   bool             `json:"dnssdEnabled"`
-	StaticDir      string           `json:"staticDir"`
-	ApiLocation    string           `json:"apiLocation"`
-	Storage        StorageConfig    `json:"storage"`
-	ServiceCatalog []ServiceCatalog `json:"serviceCatalog"`
-	Auth           ValidatorConf    `json:"auth"`
+	Description     string                  `json:"description"`
+	PublicEndpoint  string                  `json:"publicEndpoint"`
+	BindAddr        string                  `json:"bindAddr"`
+	BindPort        int                     `json:"bindPort"`
+	DnssdEnabled    bool                    `json:"dnssdEnabled"`
+	StaticDir       string                  `json:"staticDir"`
+	ApiLocation     string                  `json:"apiLocation"`
+	Storage         StorageConfig           `json:"storage"`
+	TTLPolicy       utils.TTLPolicy         `json:"ttlPolicy"`
+	IDGenerator     utils.IDGeneratorConfig `json:"idGenerator"`
+	Ownership       utils.OwnershipPolicy   `json:"ownership"`
+	ServiceCatalog  []ServiceCatalog        `json:"serviceCatalog"`
+	Auth            ValidatorConf           `json:"auth"`
+	OpenAPI         OpenAPIConf             `json:"openapi"`
+	Logging         logging.Config          `json:"logging"`
+	RateLimit       ratelimit.Config        `json:"rateLimit"`
+	Tenancy         tenancy.Config          `json:"tenancy"`
+	AuthzAdmin      authzadmin.Config       `json:"authzAdmin"`
+	TLS             utils.ServerTLSConfig   `json:"tls"`
+	ShutdownTimeout int                     `json:"shutdownTimeout"`
 }
 
 type ServiceCatalog struct {
-	Discover bool          `json:"discover"`
-	Endpoint string        `json:"endpoint"`
-	Ttl      int           `json:"ttl"`
-	Auth     *ObtainerConf `json:"auth"`
+	Discover bool                   `json:"discover"`
+	Endpoint string                 `json:"endpoint"`
+	Ttl      int                    `json:"ttl"`
+	Auth     *ObtainerConf          `json:"auth"`
+	TLS      *utils.ClientTLSConfig `json:"tls"`
+}
+
+// OpenAPI specification config
+type OpenAPIConf struct {
+	// Path to the Swagger 2.0 document of the API
+	// The document is generated from the registered routes if not set
+	Spec string `json:"spec"`
+	// Reject requests that do not conform to the specification
+	Validation bool `json:"validation"`
+	// Also validate the bodies of JSON responses, answering with an error if they do not conform (for development)
+	StrictResponses bool `json:"strictResponses"`
 }
 
 type StorageConfig struct {
@@ -44,63 +71,109 @@ var supportedBackends = map[string]bool{
 	utils.CatalogBackendLevelDB: true,
 }
 
+// Validate checks the configuration, returning all problems found as utils.ConfigErrors
 func (c *Config) Validate() error {
-	var err error
+	var errs utils.ConfigErrors
 	if c.BindAddr == "" || c.BindPort == 0 || c.PublicEndpoint == "" {
-		err = fmt.Errorf("BindAddr, BindPort, and PublicEndpoint have to be defined")
+		errs.Addf("BindAddr, BindPort, and PublicEndpoint have to be defined")
 	}
-	_, err = url.Parse(c.PublicEndpoint)
-	if err != nil {
-		err = fmt.Errorf("PublicEndpoint should be a valid URL")
+	if _, err := url.Parse(c.PublicEndpoint); err != nil {
+		errs.Addf("PublicEndpoint should be a valid URL")
 	}
-	_, err = url.Parse(c.Storage.DSN)
-	if err != nil {
-		err = fmt.Errorf("storage DSN should be a valid URL")
+	if _, err := url.Parse(c.Storage.DSN); err != nil {
+		errs.Addf("storage DSN should be a valid URL")
 	}
 	if !supportedBackends[c.Storage.Type] {
-		err = fmt.Errorf("Unsupported storage backend")
+		errs.Addf("Unsupported storage backend")
 	}
 	if c.StaticDir == "" {
-		err = fmt.Errorf("staticDir must be defined")
+		errs.Addf("staticDir must be defined")
 	}
 	if strings.HasSuffix(c.StaticDir, "/") {
-		err = fmt.Errorf("staticDir must not have a trailing slash")
+		errs.Addf("staticDir must not have a trailing slash")
 	}
-	for _, cat := range c.ServiceCatalog {
+	for i, cat := range c.ServiceCatalog {
+		key := fmt.Sprintf("serviceCatalog[%d]", i)
 		if cat.Endpoint == "" && cat.Discover == false {
-			err = fmt.Errorf("All ServiceCatalog entries must have either endpoint or a discovery flag defined")
+			errs.AddKey(key, errors.New("either endpoint or discover has to be defined"))
 		}
 		if cat.Ttl <= 0 {
-			err = fmt.Errorf("All ServiceCatalog entries must have TTL >= 0")
+			errs.AddKey(key, errors.New("ttl must be greater than 0"))
 		}
 		if cat.Auth != nil {
 			// Validate ticket obtainer config
-			err = cat.Auth.Validate()
-			if err != nil {
-				return err
-			}
+			errs.AddKey(key, cat.Auth.Validate())
+		}
+		if cat.TLS != nil {
+			errs.AddKey(key+" tls", cat.TLS.Validate())
 		}
 	}
 
+	if c.OpenAPI.Validation && c.OpenAPI.Spec == "" {
+		errs.Addf("openapi spec must be defined to enable validation")
+	}
+	if c.OpenAPI.StrictResponses && !c.OpenAPI.Validation {
+		errs.Addf("openapi validation must be enabled for strictResponses")
+	}
+
 	if c.Auth.Enabled {
 		// Validate ticket validator config
-		err = c.Auth.Validate()
-		if err != nil {
-			return err
-		}
+		errs.Add(c.Auth.Validate())
 	}
 
-	return err
+	errs.AddKey("logging", c.Logging.Validate())
+	errs.AddKey("rateLimit", c.RateLimit.Validate())
+	errs.AddKey("ttlPolicy", c.TTLPolicy.Validate())
+	errs.AddKey("idGenerator", c.IDGenerator.Validate())
+	errs.AddKey("ownership", c.Ownership.Validate())
+	if c.Ownership.Enabled && !c.Auth.Enabled {
+		errs.Addf("ownership requires auth to be enabled")
+	}
+	errs.AddKey("tenancy", c.Tenancy.Validate())
+	if c.Tenancy.Enabled && c.Tenancy.Source != tenancy.SourcePath && !c.Auth.Enabled {
+		errs.Addf("tenancy requires auth to be enabled unless the tenants are taken from the path")
+	}
+	if c.AuthzAdmin.Enabled && (!c.Auth.Enabled || c.Auth.Authz == nil) {
+		errs.Addf("authzAdmin requires auth to be enabled with authorization rules")
+	}
+	errs.AddKey("tls", c.TLS.Validate())
+
+	if c.ShutdownTimeout < 0 {
+		errs.Addf("shutdownTimeout must not be negative")
+	}
+
+	return errs.Err()
 }
 
+// Returns the configured shutdown timeout, or else the default
+func (c *Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == 0 {
+		return utils.DefaultShutdownTimeout
+	}
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// Loads and validates a configuration
 func loadConfig(path string) (*Config, error) {
+	c, err := parseConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Parses a configuration file, applying the overrides from the environment
+func parseConfig(path string) (*Config, error) {
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
 	c := new(Config)
-	err = json.Unmarshal(file, c)
+	err = utils.UnmarshalConfig(file, "RC", c)
 	if err != nil {
 		return nil, err
 	}
@@ -108,10 +181,6 @@ func loadConfig(path string) (*Config, error) {
 	if strings.HasSuffix(c.ApiLocation, "/") {
 		c.ApiLocation = strings.TrimSuffix(c.ApiLocation, "/")
 	}
-
-	if err = c.Validate(); err != nil {
-		return nil, err
-	}
 	return c, nil
 }
 
@@ -129,37 +198,40 @@ type ValidatorConf struct {
 	BasicEnabled bool `json:"basicEnabled"`
 	// Authorization config
 	Authz *authz.Conf `json:"authorization"`
+	// Cache of validation results
+	Cache validator.CacheConfig `json:"cache"`
 }
 
+// Validate checks the ticket validator config, returning all problems found as utils.ConfigErrors
 func (c ValidatorConf) Validate() error {
+	var errs utils.ConfigErrors
 
 	// Validate Provider
 	if c.Provider == "" {
-		return errors.New("Ticket Validator: Auth provider name (provider) is not specified.")
+		errs.Addf("Ticket Validator: Auth provider name (provider) is not specified.")
 	}
 
 	// Validate ProviderURL
 	if c.ProviderURL == "" {
-		return errors.New("Ticket Validator: Auth provider URL (providerURL) is not specified.")
-	}
-	_, err := url.Parse(c.ProviderURL)
-	if err != nil {
-		return errors.New("Ticket Validator: Auth provider URL (providerURL) is invalid: " + err.Error())
+		errs.Addf("Ticket Validator: Auth provider URL (providerURL) is not specified.")
+	} else if _, err := url.Parse(c.ProviderURL); err != nil {
+		errs.Addf("Ticket Validator: Auth provider URL (providerURL) is invalid: %s", err)
 	}
 
 	// Validate ServiceID
 	if c.ServiceID == "" {
-		return errors.New("Ticket Validator: Auth Service ID (serviceID) is not specified.")
+		errs.Addf("Ticket Validator: Auth Service ID (serviceID) is not specified.")
 	}
 
 	// Validate Authorization
 	if c.Authz != nil {
-		if err := c.Authz.Validate(); err != nil {
-			return err
-		}
+		errs.Add(c.Authz.Validate())
 	}
 
-	return nil
+	// Validate Cache
+	errs.AddKey("Ticket Validator", c.Cache.Validate())
+
+	return errs.Err()
 }
 
 // Ticket Obtainer Client Config
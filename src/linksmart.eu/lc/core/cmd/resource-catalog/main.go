@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"mime"
@@ -15,12 +16,18 @@ import (
 	"time"
 
 	"github.com/codegangsta/negroni"
-	"github.com/gorilla/context"
+	gcontext "github.com/gorilla/context"
 	"github.com/justinas/alice"
 	"github.com/oleksandr/bonjour"
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/authzadmin"
+	"linksmart.eu/lc/core/catalog/metrics"
+	"linksmart.eu/lc/core/catalog/openapi"
+	"linksmart.eu/lc/core/catalog/ratelimit"
 	catalog "linksmart.eu/lc/core/catalog/resource"
 	sc "linksmart.eu/lc/core/catalog/service"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/core/logging"
 
 	_ "linksmart.eu/lc/sec/auth/cas/obtainer"
 	_ "linksmart.eu/lc/sec/auth/cas/validator"
@@ -32,15 +39,24 @@ import (
 
 var (
 	confPath = flag.String("conf", "conf/resource-catalog.json", "Resource catalog configuration file path")
+	validate = flag.Bool("validate", false, "Validate the configuration and exit without starting the catalog")
 )
 
 func main() {
 	flag.Parse()
 
+	if *validate {
+		os.Exit(validateConfig(*confPath))
+	}
+
 	config, err := loadConfig(*confPath)
 	if err != nil {
 		logger.Fatalf("Error reading config file %v: %v", *confPath, err)
 	}
+	err = logging.Configure(config.Logging)
+	if err != nil {
+		logger.Fatalf("Error configuring the logging: %v", err)
+	}
 
 	router, shutdownAPI, err := setupRouter(config)
 	if err != nil {
@@ -57,9 +73,9 @@ func main() {
 			[]string{fmt.Sprintf("uri=%s", config.ApiLocation)},
 			nil)
 		if err != nil {
-			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
+			logger.Errorf("Failed to register DNS-SD service: %s", err.Error())
 		} else {
-			logger.Println("Registered service via DNS-SD using type", catalog.DNSSDServiceType)
+			logger.Info("Registered service via DNS-SD using type", catalog.DNSSDServiceType)
 		}
 	}
 
@@ -67,29 +83,38 @@ func main() {
 	regChannels := make([]chan bool, 0, len(config.ServiceCatalog))
 	var wg sync.WaitGroup
 	if len(config.ServiceCatalog) > 0 {
-		logger.Println("Will now register in the configured Service Catalogs")
+		logger.Info("Will now register in the configured Service Catalogs")
 		service, err := registrationFromConfig(config)
 		if err != nil {
-			logger.Printf("Unable to parse Service registration: %v\n", err.Error())
+			logger.Errorf("Unable to parse Service registration: %v", err.Error())
 			return
 		}
 
 		for _, cat := range config.ServiceCatalog {
 			// Set TTL
 			service.Ttl = cat.Ttl
+			// Set client TLS
+			options := utils.DefaultClientOptions()
+			if cat.TLS != nil {
+				options.TLSConfig, err = cat.TLS.TLSConfig()
+				if err != nil {
+					logger.Error(err.Error())
+					continue
+				}
+			}
 			sigCh := make(chan bool)
 			wg.Add(1)
 			if cat.Auth == nil {
-				go sc.RegisterServiceWithKeepalive(cat.Endpoint, cat.Discover, *service, sigCh, &wg, nil)
+				go sc.RegisterServiceWithKeepaliveOptions(cat.Endpoint, cat.Discover, *service, sigCh, &wg, nil, options)
 			} else {
 				// Setup ticket client
 				ticket, err := obtainer.NewClient(cat.Auth.Provider, cat.Auth.ProviderURL, cat.Auth.Username, cat.Auth.Password, cat.Auth.ServiceID)
 				if err != nil {
-					logger.Println(err.Error())
+					logger.Error(err.Error())
 					continue
 				}
 				// Register with a ticket obtainer client
-				go sc.RegisterServiceWithKeepalive(cat.Endpoint, cat.Discover, *service, sigCh, &wg, ticket)
+				go sc.RegisterServiceWithKeepaliveOptions(cat.Endpoint, cat.Discover, *service, sigCh, &wg, ticket, options)
 			}
 			regChannels = append(regChannels, sigCh)
 		}
@@ -103,48 +128,17 @@ func main() {
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
-	go func() {
-		for _ = range c {
-			// sig is a ^C, handle it
-
-			//TODO: put here the last will logic
-
-			// Stop bonjour registration
-			if bonjourS != nil {
-				bonjourS.Shutdown()
-				time.Sleep(1e9)
-			}
-
-			// Unregister in the service catalog(s)
-			for _, sigCh := range regChannels {
-				// Notify if the routine hasn't returned already
-				select {
-				case sigCh <- true:
-				default:
-				}
-			}
-			wg.Wait()
-
-			// Shutdown catalog API
-			err := shutdownAPI()
-			if err != nil {
-				logger.Println(err.Error())
-			}
-
-			logger.Println("Stopped")
-			os.Exit(0)
-		}
-	}()
 
 	err = mime.AddExtensionType(".jsonld", "application/ld+json")
 	if err != nil {
-		logger.Println("ERROR: ", err.Error())
+		logger.Error(err.Error())
 	}
 
 	// Configure the middleware
 	n := negroni.New(
 		negroni.NewRecovery(),
-		negroni.NewLogger(),
+		logging.NewRequestLogger("http"),
+		metrics.NewMiddleware("rc"),
 		&negroni.Static{
 			Dir:       http.Dir(config.StaticDir),
 			Prefix:    utils.StaticLocation,
@@ -156,16 +150,81 @@ func main() {
 
 	// Start listener
 	endpoint := fmt.Sprintf("%s:%s", config.BindAddr, strconv.Itoa(config.BindPort))
-	logger.Printf("Starting standalone Resource Catalog at %v%v", endpoint, config.ApiLocation)
-	n.Run(endpoint)
+	server, err := utils.NewServer(endpoint, n, config.TLS)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+	}()
+	scheme := "http"
+	if config.TLS.Enabled {
+		scheme = "https"
+	}
+	logger.Infof("Starting standalone Resource Catalog at %s://%v%v", scheme, endpoint, config.ApiLocation)
+
+	sig := <-c
+	logger.Infof("Caught %v signal. Shutting down...", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout())
+	defer cancel()
+
+	// Stop accepting requests and wait for the in-flight ones
+	err = server.Shutdown(ctx)
+	if err != nil {
+		logger.Errorf("Failed to complete the in-flight requests: %v", err)
+	}
+
+	// Stop bonjour registration
+	if bonjourS != nil {
+		bonjourS.Shutdown()
+		time.Sleep(1e9)
+	}
+
+	// Unregister in the service catalog(s)
+	for _, sigCh := range regChannels {
+		// Notify if the routine hasn't returned already
+		select {
+		case sigCh <- true:
+		default:
+		}
+	}
+	err = utils.WaitContext(ctx, &wg)
+	if err != nil {
+		logger.Errorf("Failed to unregister in the service catalogs: %v", err)
+	}
+
+	// Shutdown catalog API
+	err = shutdownAPI()
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	logger.Info("Stopped")
 }
 
 func setupRouter(config *Config) (*router, func() error, error) {
+	// Load the API specification
+	var spec *openapi.Spec
+	if config.OpenAPI.Spec != "" {
+		var err error
+		spec, err = openapi.Load(config.OpenAPI.Spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to load the API specification: %v", err.Error())
+		}
+		spec.SetBasePath(config.ApiLocation)
+	}
+
+	// Setup the generator of ids
+	idGenerator, err := utils.NewIDGenerator(config.IDGenerator)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create the id generator: %v", err.Error())
+	}
+
 	// Setup API storage
-	var (
-		storage catalog.CatalogStorage
-		err     error
-	)
+	var storage catalog.CatalogStorage
 	switch config.Storage.Type {
 	case utils.CatalogBackendMemory:
 		storage = catalog.NewMemoryStorage()
@@ -178,7 +237,8 @@ func setupRouter(config *Config) (*router, func() error, error) {
 		return nil, nil, fmt.Errorf("Could not create catalog API storage. Unsupported type: %v", config.Storage.Type)
 	}
 
-	controller, err := catalog.NewController(storage, config.ApiLocation)
+	controller, err := catalog.NewControllerWithOptions(storage, config.ApiLocation,
+		catalog.ControllerOptions{TTLPolicy: config.TTLPolicy, Ownership: config.Ownership, IDGenerator: idGenerator})
 	if err != nil {
 		storage.Close()
 		return nil, nil, fmt.Errorf("Failed to start the controller: %v", err.Error())
@@ -193,7 +253,7 @@ func setupRouter(config *Config) (*router, func() error, error) {
 	)
 
 	commonHandlers := alice.New(
-		context.ClearHandler,
+		gcontext.ClearHandler,
 	)
 
 	// Append auth handler if enabled
@@ -208,27 +268,120 @@ func setupRouter(config *Config) (*router, func() error, error) {
 		if err != nil {
 			return nil, nil, err
 		}
+		if config.Auth.Cache.Enabled {
+			v.EnableCache(config.Auth.Cache, metrics.AuthCache)
+		}
 
 		commonHandlers = commonHandlers.Append(v.Handler)
 	}
 
+	// Setup the management of the authorization rules if enabled
+	// The rules are persisted next to the catalog entries
+	shutdown := controller.Stop
+	var authzAPI *authzadmin.API
+	if config.AuthzAdmin.Enabled {
+		var store authzadmin.Store
+		if config.Storage.Type == utils.CatalogBackendLevelDB {
+			store, err = authzadmin.NewLevelDBStore(config.Storage.DSN)
+			if err != nil {
+				controller.Stop()
+				return nil, nil, fmt.Errorf("Failed to start LevelDB storage of the authorization rules: %v", err.Error())
+			}
+		} else {
+			store = authzadmin.NewMemoryStore()
+		}
+		manager, err := authzadmin.NewManager(config.Auth.Authz, store)
+		if err != nil {
+			store.Close()
+			controller.Stop()
+			return nil, nil, err
+		}
+		authzAPI = authzadmin.NewAPI(manager, catalog.ErrorResponse)
+		shutdown = func() error {
+			if err := store.Close(); err != nil {
+				logger.Errorf("Failed to close the storage of the authorization rules: %v", err)
+			}
+			return controller.Stop()
+		}
+	}
+
+	// Append rate limiting handler if enabled
+	if config.RateLimit.Enabled {
+		limiter := ratelimit.NewLimiter(config.RateLimit, catalog.ErrorResponse)
+		commonHandlers = commonHandlers.Append(limiter.Handler)
+	}
+
+	// Append tenant resolution handler if enabled
+	if config.Tenancy.Enabled {
+		resolver := tenancy.NewResolver(config.Tenancy, catalog.ErrorResponse)
+		commonHandlers = commonHandlers.Append(resolver.Handler)
+	}
+
+	// Append request validation handler if enabled
+	if config.OpenAPI.Validation {
+		commonHandlers = commonHandlers.Append(spec.Validator(catalog.ErrorResponse, config.OpenAPI.StrictResponses))
+	}
+
 	// Configure http api router
 	r := newRouter()
-	// Index
-	r.get(config.ApiLocation, commonHandlers.ThenFunc(api.Index))
-	// Devices
-	r.post(config.ApiLocation+"/devices", commonHandlers.ThenFunc(api.Post))
-	r.get(config.ApiLocation+"/devices/{id}", commonHandlers.ThenFunc(api.Get))
-	r.put(config.ApiLocation+"/devices/{id}", commonHandlers.ThenFunc(api.Put))
-	r.delete(config.ApiLocation+"/devices/{id}", commonHandlers.ThenFunc(api.Delete))
-	r.get(config.ApiLocation+"/devices", commonHandlers.ThenFunc(api.List))
-	r.get(config.ApiLocation+"/devices/{path}/{op}/{value:.*}", commonHandlers.ThenFunc(api.Filter))
-	// Resources
-	r.get(config.ApiLocation+"/resources", commonHandlers.ThenFunc(api.ListResources))
-	// Accept an id with zero or one slash: [^/]+/?[^/]*
-	// -> [^/]+ one or more of anything but slashes /? optional slash [^/]* zero or more of anything but slashes
-	r.get(config.ApiLocation+"/resources/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.GetResource))
-	r.get(config.ApiLocation+"/resources/{path}/{op}/{value:.*}", commonHandlers.ThenFunc(api.FilterResources))
-
-	return r, controller.Stop, nil
+	// The catalog API is also served under the tenant path prefix if the tenants are taken from the path
+	prefixes := []string{""}
+	if config.Tenancy.Enabled && config.Tenancy.Source == tenancy.SourcePath {
+		prefixes = append(prefixes, tenancy.PathPrefix)
+	}
+	for _, prefix := range prefixes {
+		apiLocation := prefix + config.ApiLocation
+		// Index
+		r.get(apiLocation, commonHandlers.ThenFunc(api.Index))
+		// Devices
+		r.post(apiLocation+"/devices", commonHandlers.ThenFunc(api.Post))
+		r.get(apiLocation+"/devices/{id}", commonHandlers.ThenFunc(api.Get))
+		r.put(apiLocation+"/devices/{id}", commonHandlers.ThenFunc(api.Put))
+		r.delete(apiLocation+"/devices/{id}", commonHandlers.ThenFunc(api.Delete))
+		r.post(apiLocation+"/devices/{id}/"+utils.HeartbeatPath, commonHandlers.ThenFunc(api.Heartbeat))
+		r.get(apiLocation+"/devices", commonHandlers.ThenFunc(api.List))
+		r.get(apiLocation+"/devices/{id}/td", commonHandlers.ThenFunc(api.GetThingDescription))
+		r.get(apiLocation+"/devices/{path}/{op}/{value:.*}", commonHandlers.ThenFunc(api.Filter))
+		// Thing Descriptions directory
+		r.get(apiLocation+"/things", commonHandlers.ThenFunc(api.ListThingDescriptions))
+		r.post(apiLocation+"/things", commonHandlers.ThenFunc(api.ImportThingDescription))
+		// Resources
+		r.get(apiLocation+"/resources", commonHandlers.ThenFunc(api.ListResources))
+		// Accept an id with zero or one slash: [^/]+/?[^/]*
+		// -> [^/]+ one or more of anything but slashes /? optional slash [^/]* zero or more of anything but slashes
+		r.get(apiLocation+"/resources/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.GetResource))
+		r.get(apiLocation+"/resources/{path}/{op}/{value:.*}", commonHandlers.ThenFunc(api.FilterResources))
+		// Events
+		r.get(apiLocation+"/events", commonHandlers.ThenFunc(api.Events))
+	}
+
+	// OpenAPI specification
+	routes, err := openapi.RouterRoutes(r.Router, config.ApiLocation)
+	if err != nil {
+		return nil, nil, err
+	}
+	if spec == nil {
+		spec = openapi.Generate(config.Description, catalog.ApiVersion, config.ApiLocation, routes)
+	} else {
+		for _, problem := range spec.Check(routes) {
+			logger.Warnf("API specification mismatch: %s", problem)
+		}
+	}
+	r.get(utils.OpenAPILocation, commonHandlers.Then(spec))
+	// Metrics in Prometheus text format
+	r.get(utils.MetricsLocation, commonHandlers.Then(metrics.DefaultRegistry))
+	// Logging configuration
+	r.get(utils.LoggingLocation, commonHandlers.Then(logging.Handler(catalog.ErrorResponse)))
+	r.put(utils.LoggingLocation, commonHandlers.Then(logging.Handler(catalog.ErrorResponse)))
+	// Authorization rules
+	if authzAPI != nil {
+		r.get(authzadmin.Location+authzadmin.RulesPath, commonHandlers.ThenFunc(authzAPI.List))
+		r.post(authzadmin.Location+authzadmin.RulesPath, commonHandlers.ThenFunc(authzAPI.Post))
+		r.get(authzadmin.Location+authzadmin.RulesPath+"/{id}", commonHandlers.ThenFunc(authzAPI.Get))
+		r.put(authzadmin.Location+authzadmin.RulesPath+"/{id}", commonHandlers.ThenFunc(authzAPI.Put))
+		r.delete(authzadmin.Location+authzadmin.RulesPath+"/{id}", commonHandlers.ThenFunc(authzAPI.Delete))
+		r.get(authzadmin.Location+authzadmin.CheckPath, commonHandlers.ThenFunc(authzAPI.Check))
+	}
+
+	return r, shutdown, nil
 }
@@ -0,0 +1,63 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/openapi"
+	"linksmart.eu/lc/sec/auth/obtainer"
+	"linksmart.eu/lc/sec/auth/validator"
+)
+
+// Validates the configuration and its environment without starting the catalog (-validate flag)
+// Prints a report and returns the exit status
+func validateConfig(path string) int {
+	c, err := parseConfig(path)
+	if err != nil {
+		return utils.WriteValidationReport(os.Stdout, path, err)
+	}
+	var errs utils.ConfigErrors
+	errs.Add(c.Validate())
+	errs.Add(c.check())
+	return utils.WriteValidationReport(os.Stdout, path, errs.Err())
+}
+
+// Checks the resources referenced by the configuration: files, auth drivers and the listening port
+func (c *Config) check() error {
+	var errs utils.ConfigErrors
+	if c.StaticDir != "" {
+		errs.AddKey("staticDir", utils.CheckDir(c.StaticDir))
+	}
+	if c.IDGenerator.CounterFile != "" {
+		errs.AddKey("idGenerator", utils.CheckDir(filepath.Dir(c.IDGenerator.CounterFile)))
+	}
+	if c.OpenAPI.Spec != "" {
+		_, err := openapi.Load(c.OpenAPI.Spec)
+		errs.AddKey("openapi spec", err)
+	}
+	if c.TLS.Validate() == nil {
+		errs.AddKey("tls", c.TLS.Check())
+	}
+	if c.Auth.Enabled && c.Auth.Provider != "" {
+		errs.AddKey("auth", utils.CheckDriver("validator", c.Auth.Provider, validator.Drivers()))
+	}
+	for i, cat := range c.ServiceCatalog {
+		key := fmt.Sprintf("serviceCatalog[%d]", i)
+		if cat.Auth != nil && cat.Auth.Provider != "" {
+			errs.AddKey(key+" auth", utils.CheckDriver("obtainer", cat.Auth.Provider, obtainer.Drivers()))
+		}
+		if cat.TLS != nil && cat.TLS.Validate() == nil {
+			errs.AddKey(key+" tls", cat.TLS.Check())
+		}
+	}
+	if c.BindPort != 0 {
+		errs.Add(utils.CheckListenAddr(net.JoinHostPort(c.BindAddr, strconv.Itoa(c.BindPort))))
+	}
+	return errs.Err()
+}
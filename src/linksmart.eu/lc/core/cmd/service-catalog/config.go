@@ -3,28 +3,41 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/url"
 	"strings"
+	"time"
 
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/authzadmin"
+	"linksmart.eu/lc/core/catalog/ratelimit"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/core/logging"
 
+	"linksmart.eu/lc/sec/auth/validator"
 	"linksmart.eu/lc/sec/authz"
 )
 
 type Config struct {
-	Description  string        `json:"description"`
-	DnssdEnabled bool          `json:"dnssdEnabled"`
-	BindAddr     string        `json:"bindAddr"`
-	BindPort     int           `json:"bindPort"`
-	ApiLocation  string        `json:"apiLocation"`
-	StaticDir    string        `json:"staticDir"`
-	Storage      StorageConfig `json:"storage"`
-	GC           GCConfig      `js:"gc"`
-	Auth         ValidatorConf `json:"auth"`
+	Description     string                  `json:"description"`
+	DnssdEnabled    bool                    `json:"dnssdEnabled"`
+	BindAddr        string                  `json:"bindAddr"`
+	BindPort        int                     `json:"bindPort"`
+	ApiLocation     string                  `json:"apiLocation"`
+	StaticDir       string                  `json:"staticDir"`
+	Storage         StorageConfig           `json:"storage"`
+	TTLPolicy       utils.TTLPolicy         `json:"ttlPolicy"`
+	IDGenerator     utils.IDGeneratorConfig `json:"idGenerator"`
+	Ownership       utils.OwnershipPolicy   `json:"ownership"`
+	GC              GCConfig                `js:"gc"`
+	Auth            ValidatorConf           `json:"auth"`
+	OpenAPI         OpenAPIConf             `json:"openapi"`
+	Logging         logging.Config          `json:"logging"`
+	RateLimit       ratelimit.Config        `json:"rateLimit"`
+	Tenancy         tenancy.Config          `json:"tenancy"`
+	AuthzAdmin      authzadmin.Config       `json:"authzAdmin"`
+	TLS             utils.ServerTLSConfig   `json:"tls"`
+	ShutdownTimeout int                     `json:"shutdownTimeout"`
 }
 
 type StorageConfig struct {
@@ -43,49 +56,104 @@ type GCConfig struct {
 	TunnelingService string `json:"tunnelingService"`
 }
 
+// OpenAPI specification config
+type OpenAPIConf struct {
+	// Path to the Swagger 2.0 document of the API
+	// The document is generated from the registered routes if not set
+	Spec string `json:"spec"`
+	// Reject requests that do not conform to the specification
+	Validation bool `json:"validation"`
+	// Also validate the bodies of JSON responses, answering with an error if they do not conform (for development)
+	StrictResponses bool `json:"strictResponses"`
+}
+
+// Validate checks the configuration, returning all problems found as utils.ConfigErrors
 func (c *Config) Validate() error {
-	var err error
+	var errs utils.ConfigErrors
 	if c.BindAddr == "" || c.BindPort == 0 {
-		err = fmt.Errorf("Empty host or port")
+		errs.Addf("Empty host or port")
 	}
 	if !supportedBackends[c.Storage.Type] {
-		err = fmt.Errorf("Unsupported storage backend")
+		errs.Addf("Unsupported storage backend")
 	}
-	_, err = url.Parse(c.Storage.DSN)
-	if err != nil {
-		err = fmt.Errorf("storage DSN should be a valid URL")
+	if _, err := url.Parse(c.Storage.DSN); err != nil {
+		errs.Addf("storage DSN should be a valid URL")
 	}
 	if c.StaticDir == "" {
-		err = fmt.Errorf("staticDir must be defined")
+		errs.Addf("staticDir must be defined")
 	}
 	if strings.HasSuffix(c.StaticDir, "/") {
-		err = fmt.Errorf("staticDir must not have a trailing slash")
+		errs.Addf("staticDir must not have a trailing slash")
 	}
 	if c.GC.TunnelingService != "" {
-		_, err := url.Parse(c.GC.TunnelingService)
-		if err != nil {
-			err = fmt.Errorf("gc tunnelingService must be a valid URL")
+		if _, err := url.Parse(c.GC.TunnelingService); err != nil {
+			errs.Addf("gc tunnelingService must be a valid URL")
 		}
 	}
+	if c.OpenAPI.Validation && c.OpenAPI.Spec == "" {
+		errs.Addf("openapi spec must be defined to enable validation")
+	}
+	if c.OpenAPI.StrictResponses && !c.OpenAPI.Validation {
+		errs.Addf("openapi validation must be enabled for strictResponses")
+	}
 	if c.Auth.Enabled {
 		// Validate ticket validator config
-		err = c.Auth.Validate()
-		if err != nil {
-			return err
-		}
+		errs.Add(c.Auth.Validate())
+	}
+
+	errs.AddKey("logging", c.Logging.Validate())
+	errs.AddKey("rateLimit", c.RateLimit.Validate())
+	errs.AddKey("ttlPolicy", c.TTLPolicy.Validate())
+	errs.AddKey("idGenerator", c.IDGenerator.Validate())
+	errs.AddKey("ownership", c.Ownership.Validate())
+	if c.Ownership.Enabled && !c.Auth.Enabled {
+		errs.Addf("ownership requires auth to be enabled")
+	}
+	errs.AddKey("tenancy", c.Tenancy.Validate())
+	if c.Tenancy.Enabled && c.Tenancy.Source != tenancy.SourcePath && !c.Auth.Enabled {
+		errs.Addf("tenancy requires auth to be enabled unless the tenants are taken from the path")
+	}
+	if c.AuthzAdmin.Enabled && (!c.Auth.Enabled || c.Auth.Authz == nil) {
+		errs.Addf("authzAdmin requires auth to be enabled with authorization rules")
+	}
+	errs.AddKey("tls", c.TLS.Validate())
+
+	if c.ShutdownTimeout < 0 {
+		errs.Addf("shutdownTimeout must not be negative")
 	}
 
-	return err
+	return errs.Err()
 }
 
+// Returns the configured shutdown timeout, or else the default
+func (c *Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == 0 {
+		return utils.DefaultShutdownTimeout
+	}
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// Loads and validates a configuration
 func loadConfig(confPath string) (*Config, error) {
+	config, err := parseConfig(confPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Parses a configuration file, applying the overrides from the environment
+func parseConfig(confPath string) (*Config, error) {
 	file, err := ioutil.ReadFile(confPath)
 	if err != nil {
 		return nil, err
 	}
 
 	config := new(Config)
-	err = json.Unmarshal(file, config)
+	err = utils.UnmarshalConfig(file, "SC", config)
 	if err != nil {
 		return nil, err
 	}
@@ -93,10 +161,6 @@ func loadConfig(confPath string) (*Config, error) {
 	if strings.HasSuffix(config.ApiLocation, "/") {
 		config.ApiLocation = strings.TrimSuffix(config.ApiLocation, "/")
 	}
-
-	if err = config.Validate(); err != nil {
-		return nil, err
-	}
 	return config, nil
 }
 
@@ -114,35 +178,38 @@ type ValidatorConf struct {
 	BasicEnabled bool `json:"basicEnabled"`
 	// Authorization config
 	Authz *authz.Conf `json:"authorization"`
+	// Cache of validation results
+	Cache validator.CacheConfig `json:"cache"`
 }
 
+// Validate checks the ticket validator config, returning all problems found as utils.ConfigErrors
 func (c ValidatorConf) Validate() error {
+	var errs utils.ConfigErrors
 
 	// Validate Provider
 	if c.Provider == "" {
-		return errors.New("Ticket Validator: Auth provider name (provider) is not specified.")
+		errs.Addf("Ticket Validator: Auth provider name (provider) is not specified.")
 	}
 
 	// Validate ProviderURL
 	if c.ProviderURL == "" {
-		return errors.New("Ticket Validator: Auth provider URL (providerURL) is not specified.")
-	}
-	_, err := url.Parse(c.ProviderURL)
-	if err != nil {
-		return errors.New("Ticket Validator: Auth provider URL (providerURL) is invalid: " + err.Error())
+		errs.Addf("Ticket Validator: Auth provider URL (providerURL) is not specified.")
+	} else if _, err := url.Parse(c.ProviderURL); err != nil {
+		errs.Addf("Ticket Validator: Auth provider URL (providerURL) is invalid: %s", err)
 	}
 
 	// Validate ServiceID
 	if c.ServiceID == "" {
-		return errors.New("Ticket Validator: Auth Service ID (serviceID) is not specified.")
+		errs.Addf("Ticket Validator: Auth Service ID (serviceID) is not specified.")
 	}
 
 	// Validate Authorization
 	if c.Authz != nil {
-		if err := c.Authz.Validate(); err != nil {
-			return err
-		}
+		errs.Add(c.Authz.Validate())
 	}
 
-	return nil
+	// Validate Cache
+	errs.AddKey("Ticket Validator", c.Cache.Validate())
+
+	return errs.Err()
 }
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"mime"
@@ -15,11 +16,17 @@ import (
 	"time"
 
 	"github.com/codegangsta/negroni"
-	"github.com/gorilla/context"
+	gcontext "github.com/gorilla/context"
 	"github.com/justinas/alice"
 	"github.com/oleksandr/bonjour"
 	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/core/catalog/authzadmin"
+	"linksmart.eu/lc/core/catalog/metrics"
+	"linksmart.eu/lc/core/catalog/openapi"
+	"linksmart.eu/lc/core/catalog/ratelimit"
 	catalog "linksmart.eu/lc/core/catalog/service"
+	"linksmart.eu/lc/core/catalog/tenancy"
+	"linksmart.eu/lc/core/logging"
 
 	_ "linksmart.eu/lc/sec/auth/cas/validator"
 	_ "linksmart.eu/lc/sec/auth/keycloak/validator"
@@ -28,15 +35,24 @@ import (
 
 var (
 	confPath = flag.String("conf", "conf/service-catalog.json", "Service catalog configuration file path")
+	validate = flag.Bool("validate", false, "Validate the configuration and exit without starting the catalog")
 )
 
 func main() {
 	flag.Parse()
 
+	if *validate {
+		os.Exit(validateConfig(*confPath))
+	}
+
 	config, err := loadConfig(*confPath)
 	if err != nil {
 		logger.Fatalf("Error reading config file %v: %v", *confPath, err)
 	}
+	err = logging.Configure(config.Logging)
+	if err != nil {
+		logger.Fatalf("Error configuring the logging: %v", err)
+	}
 
 	r, shutdownAPI, err := setupRouter(config)
 	if err != nil {
@@ -53,9 +69,9 @@ func main() {
 			[]string{fmt.Sprintf("uri=%s", config.ApiLocation)},
 			nil)
 		if err != nil {
-			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
+			logger.Errorf("Failed to register DNS-SD service: %s", err.Error())
 		} else {
-			logger.Println("Registered service via DNS-SD using type", catalog.DNSSDServiceType)
+			logger.Info("Registered service via DNS-SD using type", catalog.DNSSDServiceType)
 		}
 	}
 
@@ -66,38 +82,17 @@ func main() {
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
-	go func() {
-		for _ = range c {
-			// sig is a ^C, handle it
-
-			//TODO: put here the last will logic
-
-			// Stop bonjour registration
-			if bonjourS != nil {
-				bonjourS.Shutdown()
-				time.Sleep(1e9)
-			}
-
-			// Shutdown catalog API
-			err := shutdownAPI()
-			if err != nil {
-				logger.Println(err.Error())
-			}
-
-			logger.Println("Stopped")
-			os.Exit(0)
-		}
-	}()
 
 	err = mime.AddExtensionType(".jsonld", "application/ld+json")
 	if err != nil {
-		logger.Println("ERROR: ", err.Error())
+		logger.Error(err.Error())
 	}
 
 	// Configure the middleware
 	n := negroni.New(
 		negroni.NewRecovery(),
-		negroni.NewLogger(),
+		logging.NewRequestLogger("http"),
+		metrics.NewMiddleware("sc"),
 		&negroni.Static{
 			Dir:       http.Dir(config.StaticDir),
 			Prefix:    utils.StaticLocation,
@@ -109,8 +104,46 @@ func main() {
 
 	// Start listener
 	endpoint := fmt.Sprintf("%s:%s", config.BindAddr, strconv.Itoa(config.BindPort))
-	logger.Printf("Starting standalone Service Catalog at %v%v", endpoint, config.ApiLocation)
-	n.Run(endpoint)
+	server, err := utils.NewServer(endpoint, n, config.TLS)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+	}()
+	scheme := "http"
+	if config.TLS.Enabled {
+		scheme = "https"
+	}
+	logger.Infof("Starting standalone Service Catalog at %s://%v%v", scheme, endpoint, config.ApiLocation)
+
+	sig := <-c
+	logger.Infof("Caught %v signal. Shutting down...", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout())
+	defer cancel()
+
+	// Stop accepting requests and wait for the in-flight ones
+	err = server.Shutdown(ctx)
+	if err != nil {
+		logger.Errorf("Failed to complete the in-flight requests: %v", err)
+	}
+
+	// Stop bonjour registration
+	if bonjourS != nil {
+		bonjourS.Shutdown()
+		time.Sleep(1e9)
+	}
+
+	// Shutdown catalog API
+	err = shutdownAPI()
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	logger.Info("Stopped")
 }
 
 func setupRouter(config *Config) (*router, func() error, error) {
@@ -121,11 +154,25 @@ func setupRouter(config *Config) (*router, func() error, error) {
 		listeners = append(listeners, catalog.NewGCPublisher(*endpoint))
 	}
 
+	// Load the API specification
+	var spec *openapi.Spec
+	if config.OpenAPI.Spec != "" {
+		var err error
+		spec, err = openapi.Load(config.OpenAPI.Spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to load the API specification: %v", err.Error())
+		}
+		spec.SetBasePath(config.ApiLocation)
+	}
+
+	// Setup the generator of ids
+	idGenerator, err := utils.NewIDGenerator(config.IDGenerator)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create the id generator: %v", err.Error())
+	}
+
 	// Setup API storage
-	var (
-		storage catalog.CatalogStorage
-		err     error
-	)
+	var storage catalog.CatalogStorage
 	switch config.Storage.Type {
 	case utils.CatalogBackendMemory:
 		storage = catalog.NewMemoryStorage()
@@ -138,7 +185,8 @@ func setupRouter(config *Config) (*router, func() error, error) {
 		return nil, nil, fmt.Errorf("Could not create catalog API storage. Unsupported type: %v", config.Storage.Type)
 	}
 
-	controller, err := catalog.NewController(storage, config.ApiLocation, listeners...)
+	controller, err := catalog.NewControllerWithOptions(storage, config.ApiLocation,
+		catalog.ControllerOptions{TTLPolicy: config.TTLPolicy, Ownership: config.Ownership, IDGenerator: idGenerator}, listeners...)
 	if err != nil {
 		storage.Close()
 		return nil, nil, fmt.Errorf("Failed to start the controller: %v", err.Error())
@@ -153,7 +201,7 @@ func setupRouter(config *Config) (*router, func() error, error) {
 	)
 
 	commonHandlers := alice.New(
-		context.ClearHandler,
+		gcontext.ClearHandler,
 	)
 
 	// Append auth handler if enabled
@@ -168,21 +216,110 @@ func setupRouter(config *Config) (*router, func() error, error) {
 		if err != nil {
 			return nil, nil, err
 		}
+		if config.Auth.Cache.Enabled {
+			v.EnableCache(config.Auth.Cache, metrics.AuthCache)
+		}
 
 		commonHandlers = commonHandlers.Append(v.Handler)
 	}
 
+	// Setup the management of the authorization rules if enabled
+	// The rules are persisted next to the catalog entries
+	shutdown := controller.Stop
+	var authzAPI *authzadmin.API
+	if config.AuthzAdmin.Enabled {
+		var store authzadmin.Store
+		if config.Storage.Type == utils.CatalogBackendLevelDB {
+			store, err = authzadmin.NewLevelDBStore(config.Storage.DSN)
+			if err != nil {
+				controller.Stop()
+				return nil, nil, fmt.Errorf("Failed to start LevelDB storage of the authorization rules: %v", err.Error())
+			}
+		} else {
+			store = authzadmin.NewMemoryStore()
+		}
+		manager, err := authzadmin.NewManager(config.Auth.Authz, store)
+		if err != nil {
+			store.Close()
+			controller.Stop()
+			return nil, nil, err
+		}
+		authzAPI = authzadmin.NewAPI(manager, catalog.ErrorResponse)
+		shutdown = func() error {
+			if err := store.Close(); err != nil {
+				logger.Errorf("Failed to close the storage of the authorization rules: %v", err)
+			}
+			return controller.Stop()
+		}
+	}
+
+	// Append rate limiting handler if enabled
+	if config.RateLimit.Enabled {
+		limiter := ratelimit.NewLimiter(config.RateLimit, catalog.ErrorResponse)
+		commonHandlers = commonHandlers.Append(limiter.Handler)
+	}
+
+	// Append tenant resolution handler if enabled
+	if config.Tenancy.Enabled {
+		resolver := tenancy.NewResolver(config.Tenancy, catalog.ErrorResponse)
+		commonHandlers = commonHandlers.Append(resolver.Handler)
+	}
+
+	// Append request validation handler if enabled
+	if config.OpenAPI.Validation {
+		commonHandlers = commonHandlers.Append(spec.Validator(catalog.ErrorResponse, config.OpenAPI.StrictResponses))
+	}
+
 	// Configure http api router
 	r := newRouter()
-	// Handlers
-	r.get(config.ApiLocation, commonHandlers.ThenFunc(api.List))
-	r.post(config.ApiLocation, commonHandlers.ThenFunc(api.Post))
-	// Accept an id with zero or one slash: [^/]+/?[^/]*
-	// -> [^/]+ one or more of anything but slashes /? optional slash [^/]* zero or more of anything but slashes
-	r.get(config.ApiLocation+"/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.Get))
-	r.put(config.ApiLocation+"/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.Put))
-	r.delete(config.ApiLocation+"/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.Delete))
-	r.get(config.ApiLocation+"/{path}/{op}/{value:.*}", commonHandlers.ThenFunc(api.Filter))
-
-	return r, controller.Stop, nil
+	// The catalog API is also served under the tenant path prefix if the tenants are taken from the path
+	prefixes := []string{""}
+	if config.Tenancy.Enabled && config.Tenancy.Source == tenancy.SourcePath {
+		prefixes = append(prefixes, tenancy.PathPrefix)
+	}
+	for _, prefix := range prefixes {
+		apiLocation := prefix + config.ApiLocation
+		// Handlers
+		r.get(apiLocation, commonHandlers.ThenFunc(api.List))
+		r.post(apiLocation, commonHandlers.ThenFunc(api.Post))
+		// Registered before the services to take precedence over an id "events"
+		r.get(apiLocation+"/events", commonHandlers.ThenFunc(api.Events))
+		// Accept an id with zero or one slash: [^/]+/?[^/]*
+		// -> [^/]+ one or more of anything but slashes /? optional slash [^/]* zero or more of anything but slashes
+		r.get(apiLocation+"/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.Get))
+		r.put(apiLocation+"/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.Put))
+		r.delete(apiLocation+"/{id:[^/]+/?[^/]*}", commonHandlers.ThenFunc(api.Delete))
+		r.post(apiLocation+"/{id:[^/]+/?[^/]*}/"+utils.HeartbeatPath, commonHandlers.ThenFunc(api.Heartbeat))
+		r.get(apiLocation+"/{path}/{op}/{value:.*}", commonHandlers.ThenFunc(api.Filter))
+	}
+
+	// OpenAPI specification
+	routes, err := openapi.RouterRoutes(r.Router, config.ApiLocation)
+	if err != nil {
+		return nil, nil, err
+	}
+	if spec == nil {
+		spec = openapi.Generate(config.Description, catalog.ApiVersion, config.ApiLocation, routes)
+	} else {
+		for _, problem := range spec.Check(routes) {
+			logger.Warnf("API specification mismatch: %s", problem)
+		}
+	}
+	r.get(utils.OpenAPILocation, commonHandlers.Then(spec))
+	// Metrics in Prometheus text format
+	r.get(utils.MetricsLocation, commonHandlers.Then(metrics.DefaultRegistry))
+	// Logging configuration
+	r.get(utils.LoggingLocation, commonHandlers.Then(logging.Handler(catalog.ErrorResponse)))
+	r.put(utils.LoggingLocation, commonHandlers.Then(logging.Handler(catalog.ErrorResponse)))
+	// Authorization rules
+	if authzAPI != nil {
+		r.get(authzadmin.Location+authzadmin.RulesPath, commonHandlers.ThenFunc(authzAPI.List))
+		r.post(authzadmin.Location+authzadmin.RulesPath, commonHandlers.ThenFunc(authzAPI.Post))
+		r.get(authzadmin.Location+authzadmin.RulesPath+"/{id}", commonHandlers.ThenFunc(authzAPI.Get))
+		r.put(authzadmin.Location+authzadmin.RulesPath+"/{id}", commonHandlers.ThenFunc(authzAPI.Put))
+		r.delete(authzadmin.Location+authzadmin.RulesPath+"/{id}", commonHandlers.ThenFunc(authzAPI.Delete))
+		r.get(authzadmin.Location+authzadmin.CheckPath, commonHandlers.ThenFunc(authzAPI.Check))
+	}
+
+	return r, shutdown, nil
 }
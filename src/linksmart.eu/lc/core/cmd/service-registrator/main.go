@@ -3,7 +3,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -12,6 +11,7 @@ import (
 	"strings"
 	"sync"
 
+	utils "linksmart.eu/lc/core/catalog"
 	catalog "linksmart.eu/lc/core/catalog/service"
 
 	_ "linksmart.eu/lc/sec/auth/cas/obtainer"
@@ -22,11 +22,13 @@ var (
 	confPath = flag.String("conf", "", "Path to the service configuration file")
 	endpoint = flag.String("endpoint", "", "Service Catalog endpoint")
 	discover = flag.Bool("discover", false, "Use DNS-SD service discovery to find Service Catalog endpoint")
+	validate = flag.Bool("validate", false, "Validate the configuration and flags and exit without registering")
 	// Authentication configuration
 	authProvider    = flag.String("authProvider", "", "Authentication provider name")
 	authProviderURL = flag.String("authProviderURL", "", "Authentication provider url")
 	authUser        = flag.String("authUser", "", "Auth. server username")
 	authPass        = flag.String("authPass", "", "Auth. server password")
+	authPassFile    = flag.String("authPassFile", "", "Path to a file containing the auth. server password")
 	serviceID       = flag.String("serviceID", "", "Service ID at the auth. server")
 )
 
@@ -38,11 +40,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *validate {
+		os.Exit(validateConfig(*confPath))
+	}
+
 	// requiresAuth if authProvider is specified
 	var requiresAuth bool = (*authProvider != "")
 
 	if *endpoint == "" && !*discover {
-		logger.Println("ERROR: -endpoint was not provided and discover flag not set.")
+		logger.Error("-endpoint was not provided and discover flag not set.")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -59,6 +65,13 @@ func main() {
 	if !requiresAuth {
 		go catalog.RegisterServiceWithKeepalive(*endpoint, *discover, *service, regCh, &wg, nil)
 	} else {
+		if *authPassFile != "" {
+			b, err := ioutil.ReadFile(*authPassFile)
+			if err != nil {
+				logger.Fatal("Unable to read the auth. server password: ", err)
+			}
+			*authPass = strings.TrimRight(string(b), "\r\n")
+		}
 		// Setup ticket client
 		ticket, err := obtainer.NewClient(*authProvider, *authProviderURL, *authUser, *authPass, *serviceID)
 		if err != nil {
@@ -74,7 +87,7 @@ func main() {
 	signal.Notify(handler, os.Interrupt)
 	for sig := range handler {
 		if sig == os.Interrupt {
-			logger.Println("Caught interrupt signal...")
+			logger.Info("Caught interrupt signal...")
 			break
 		}
 	}
@@ -86,7 +99,7 @@ func main() {
 	}
 	wg.Wait()
 
-	logger.Println("Stopped")
+	logger.Info("Stopped")
 	os.Exit(0)
 }
 
@@ -101,9 +114,9 @@ func LoadConfigFromFile(confPath string) (*catalog.Service, error) {
 	}
 
 	config := &catalog.ServiceConfig{}
-	err = json.Unmarshal(f, config)
+	err = utils.UnmarshalConfig(f, "REGISTRATOR", config)
 	if err != nil {
-		return nil, fmt.Errorf("Error parsing config")
+		return nil, fmt.Errorf("Error parsing config: %s", err)
 	}
 
 	service, err := config.GetService()
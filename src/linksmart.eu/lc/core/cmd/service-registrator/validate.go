@@ -0,0 +1,32 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package main
+
+import (
+	"os"
+
+	utils "linksmart.eu/lc/core/catalog"
+	"linksmart.eu/lc/sec/auth/obtainer"
+)
+
+// Validates the service configuration and the flags without registering the service (-validate flag)
+// Prints a report and returns the exit status
+func validateConfig(path string) int {
+	var errs utils.ConfigErrors
+	if _, err := LoadConfigFromFile(path); err != nil {
+		errs.Add(err)
+	}
+	if *endpoint == "" && !*discover {
+		errs.Addf("-endpoint was not provided and discover flag not set")
+	}
+	if *authProvider != "" {
+		errs.AddKey("authProvider", utils.CheckDriver("obtainer", *authProvider, obtainer.Drivers()))
+		if *authProviderURL == "" {
+			errs.Addf("-authProviderURL has to be provided with -authProvider")
+		}
+	}
+	if *authPassFile != "" {
+		errs.AddKey("authPassFile", utils.CheckFile(*authPassFile))
+	}
+	return utils.WriteValidationReport(os.Stdout, path, errs.Err())
+}
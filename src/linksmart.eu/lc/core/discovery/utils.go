@@ -6,8 +6,6 @@
 package discovery
 
 import (
-	"log"
-
 	"github.com/oleksandr/bonjour"
 )
 
@@ -17,18 +15,18 @@ type DiscoverHandler func(service *bonjour.ServiceEntry)
 // Runs DNS-SD discover of a service by a given type, calls given handler
 // on the first result, stops discovery afterwards
 func DiscoverAndExecute(serviceType string, handler DiscoverHandler) {
-	log.Println("Discovering catalog via DNS-SD...")
+	logger.Info("Discovering catalog via DNS-SD...")
 
 	services := make(chan *bonjour.ServiceEntry)
 	resolver, err := bonjour.NewResolver(nil)
 	if err != nil {
-		log.Println("Failed to create DNS-SD resolver:", err.Error())
+		logger.Error("Failed to create DNS-SD resolver:", err.Error())
 		return
 	}
 
 	go func(services chan *bonjour.ServiceEntry, exitCh chan<- bool) {
 		for service := range services {
-			log.Println("Catalog discovered:", service.ServiceInstanceName())
+			logger.Info("Catalog discovered:", service.ServiceInstanceName())
 
 			// stop resolver
 			exitCh <- true
@@ -42,6 +40,6 @@ func DiscoverAndExecute(serviceType string, handler DiscoverHandler) {
 	}(services, resolver.Exit)
 
 	if err := resolver.Browse(serviceType, "", services); err != nil {
-		log.Printf("Failed to browse services using type %s", serviceType)
+		logger.Errorf("Failed to browse services using type %s", serviceType)
 	}
 }
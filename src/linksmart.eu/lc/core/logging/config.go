@@ -0,0 +1,78 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+import (
+	"fmt"
+)
+
+// Config of the logging, e.g. the "logging" section of a configuration file
+type Config struct {
+	// Default level of the components: debug, info (default, or debug if DEBUG=1), warn or error
+	Level string `json:"level,omitempty"`
+	// Output format: logfmt (default) or json
+	Format string `json:"format,omitempty"`
+	// Levels of individual components, e.g. {"rc": "debug"}
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// Validate checks the levels and the format
+func (c Config) Validate() error {
+	if c.Level != "" {
+		if _, err := ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	switch c.Format {
+	case "", FormatLogfmt, FormatJSON:
+	default:
+		return fmt.Errorf("unsupported log format: %s", c.Format)
+	}
+	for component, level := range c.Components {
+		if _, err := ParseLevel(level); err != nil {
+			return fmt.Errorf("component %s: %s", component, err)
+		}
+	}
+	return nil
+}
+
+// Configure applies the configuration to all loggers
+// Levels of components that are not configured are reset to the default level
+func Configure(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	settings.Lock()
+	defer settings.Unlock()
+
+	settings.level = baseLevel
+	if c.Level != "" {
+		settings.level, _ = ParseLevel(c.Level)
+	}
+	settings.format = DefaultFormat
+	if c.Format != "" {
+		settings.format = c.Format
+	}
+	settings.components = make(map[string]Level, len(c.Components))
+	for component, name := range c.Components {
+		settings.components[component], _ = ParseLevel(name)
+	}
+	return nil
+}
+
+// CurrentConfig returns the configuration in effect
+func CurrentConfig() Config {
+	settings.RLock()
+	defer settings.RUnlock()
+
+	c := Config{
+		Level:      settings.level.String(),
+		Format:     settings.format,
+		Components: make(map[string]string, len(settings.components)),
+	}
+	for component, level := range settings.components {
+		c.Components[component] = level.String()
+	}
+	return c
+}
@@ -0,0 +1,18 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+// Output formats
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+const (
+	// Level of components without a configured level
+	DefaultLevel = InfoLevel
+	// Format used unless configured otherwise
+	DefaultFormat = FormatLogfmt
+	// Layout of the time of entries
+	timeLayout = "2006-01-02T15:04:05.000Z07:00"
+)
@@ -0,0 +1,12 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+// Package logging provides levelled, structured loggers for the components of Local Connect.
+//
+// Each package creates a Logger for its component (e.g. rc, sc, discovery). Log entries are
+// written in the logfmt or JSON format and are discarded if their level is below the level
+// configured for the component. The levels can be set using a Config (e.g. from the "logging"
+// section of a configuration file) and changed at runtime using the HTTP Handler.
+//
+// Setting the environment variable DEBUG=1 enables the debug level by default and adds the
+// location of the logging call to the entries.
+package logging
@@ -0,0 +1,105 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+)
+
+// entry is a log entry ready to be formatted
+type entry struct {
+	time      time.Time
+	level     Level
+	component string
+	msg       string
+	caller    string
+	// key-value pairs
+	fields []interface{}
+}
+
+// Formats the entry as a logfmt line, e.g.
+// time=2016-05-01T10:00:00.000Z level=info component=rc msg="Device added" id=d1
+func (e *entry) logfmt() []byte {
+	var b bytes.Buffer
+	writePair := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	}
+
+	writePair("time", e.time.Format(timeLayout))
+	writePair("level", e.level.String())
+	writePair("component", e.component)
+	writePair("msg", e.msg)
+	if e.caller != "" {
+		writePair("caller", e.caller)
+	}
+	for i := 0; i+1 < len(e.fields); i += 2 {
+		writePair(fmt.Sprint(e.fields[i]), fmt.Sprint(e.fields[i+1]))
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// Quotes the value if needed
+func logfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// Formats the entry as a JSON object in a single line, e.g.
+// {"time":"2016-05-01T10:00:00.000Z","level":"info","component":"rc","msg":"Device added","id":"d1"}
+func (e *entry) json() []byte {
+	var b bytes.Buffer
+	writePair := func(key string, value interface{}) {
+		if b.Len() == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(v)
+	}
+
+	writePair("time", e.time.Format(timeLayout))
+	writePair("level", e.level.String())
+	writePair("component", e.component)
+	writePair("msg", e.msg)
+	if e.caller != "" {
+		writePair("caller", e.caller)
+	}
+	for i := 0; i+1 < len(e.fields); i += 2 {
+		value := e.fields[i+1]
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case fmt.Stringer:
+			// e.g. durations
+			value = v.String()
+		}
+		writePair(fmt.Sprint(e.fields[i]), value)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
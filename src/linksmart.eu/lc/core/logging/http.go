@@ -0,0 +1,85 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/codegangsta/negroni"
+)
+
+// ErrorResponseFunc writes an error in the format of the API
+type ErrorResponseFunc func(w http.ResponseWriter, code int, msgs ...string)
+
+// Handler serves the logging configuration to change it at runtime
+// GET returns the configuration in effect, PUT replaces it
+func Handler(errorResponse ErrorResponseFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+		case "PUT":
+			body, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			var c Config
+			if err := json.Unmarshal(body, &c); err != nil {
+				errorResponse(w, http.StatusBadRequest, "Error processing the request:", err.Error())
+				return
+			}
+			if err := Configure(c); err != nil {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			logger.Infof("Logging reconfigured: level=%s format=%s components=%v", c.Level, c.Format, c.Components)
+		default:
+			errorResponse(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s is not allowed", req.Method))
+			return
+		}
+
+		b, err := json.Marshal(CurrentConfig())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// RequestLogger is a negroni handler logging the completed HTTP requests at the debug level,
+// or at the warn and error levels for responses with 4xx and 5xx status codes
+type RequestLogger struct {
+	logger *Logger
+}
+
+// NewRequestLogger creates a RequestLogger writing entries of the given component
+func NewRequestLogger(component string) *RequestLogger {
+	return &RequestLogger{New(component)}
+}
+
+func (l *RequestLogger) ServeHTTP(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	next(rw, req)
+
+	status := http.StatusOK
+	if res, ok := rw.(negroni.ResponseWriter); ok && res.Written() {
+		status = res.Status()
+	}
+	logger := l.logger.With("method", req.Method, "path", req.URL.Path, "status", status,
+		"duration", time.Since(start))
+	switch {
+	case status >= 500:
+		logger.Errorf("Completed %d %s", status, http.StatusText(status))
+	case status >= 400:
+		logger.Warnf("Completed %d %s", status, http.StatusText(status))
+	default:
+		logger.Debugf("Completed %d %s", status, http.StatusText(status))
+	}
+}
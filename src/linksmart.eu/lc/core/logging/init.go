@@ -0,0 +1,9 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+var logger *Logger
+
+func init() {
+	logger = New("logging")
+}
@@ -0,0 +1,249 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if name, found := levelNames[l]; found {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel returns the level of the given name (debug, info, warn or error)
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return 0, fmt.Errorf("unknown log level: %s", name)
+}
+
+// Process-wide settings shared by all loggers
+var settings = struct {
+	sync.RWMutex
+	out    io.Writer
+	format string
+	level  Level
+	// levels of components overriding the default level
+	components map[string]Level
+	// add the location of the logging call to entries
+	caller bool
+	// names of the components with loggers
+	known map[string]bool
+	// serializes the writing of entries
+	outMu sync.Mutex
+}{
+	out:        os.Stdout,
+	format:     DefaultFormat,
+	level:      DefaultLevel,
+	components: make(map[string]Level),
+	known:      make(map[string]bool),
+}
+
+// Level of components if neither they nor the default level are configured
+var baseLevel = DefaultLevel
+
+func init() {
+	v, err := strconv.Atoi(os.Getenv("DEBUG"))
+	if err == nil && v == 1 {
+		baseLevel = DebugLevel
+		settings.level = baseLevel
+		settings.caller = true
+	}
+}
+
+// SetOutput sets the writer of the entries of all loggers (stdout by default)
+func SetOutput(w io.Writer) {
+	settings.Lock()
+	settings.out = w
+	settings.Unlock()
+}
+
+// SetLevel sets the level of a component, or the default level if the component is empty
+func SetLevel(component string, level Level) {
+	settings.Lock()
+	defer settings.Unlock()
+	if component == "" {
+		settings.level = level
+		return
+	}
+	settings.components[component] = level
+}
+
+// Components returns the names of the components with loggers
+func Components() []string {
+	settings.RLock()
+	defer settings.RUnlock()
+	names := make([]string, 0, len(settings.known))
+	for name := range settings.known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Logger writes the entries of a component
+type Logger struct {
+	component string
+	// key-value pairs added to all entries
+	fields []interface{}
+}
+
+// New creates a logger for the given component
+func New(component string) *Logger {
+	settings.Lock()
+	settings.known[component] = true
+	settings.Unlock()
+	return &Logger{component: component}
+}
+
+// With returns a logger adding the given key-value pairs to all entries
+// e.g. logger.With("resource", id).Debugf("Cache hit")
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(missing)")
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{component: l.component, fields: fields}
+}
+
+// Enabled checks whether entries of the given level are written
+// It can be used to avoid expensive computations of discarded entries
+func (l *Logger) Enabled(level Level) bool {
+	settings.RLock()
+	defer settings.RUnlock()
+	return level >= l.level()
+}
+
+// Returns the level of the component
+// WARNING: the caller must obtain the read lock before calling
+func (l *Logger) level() Level {
+	if level, found := settings.components[l.component]; found {
+		return level
+	}
+	return settings.level
+}
+
+// Debug logs the operands at the debug level, separated by spaces
+func (l *Logger) Debug(args ...interface{}) {
+	l.output(DebugLevel, fmt.Sprintln(args...))
+}
+
+// Debugf logs a formatted message at the debug level
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.output(DebugLevel, fmt.Sprintf(format, args...))
+}
+
+// Info logs the operands at the info level, separated by spaces
+func (l *Logger) Info(args ...interface{}) {
+	l.output(InfoLevel, fmt.Sprintln(args...))
+}
+
+// Infof logs a formatted message at the info level
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.output(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+// Warn logs the operands at the warn level, separated by spaces
+func (l *Logger) Warn(args ...interface{}) {
+	l.output(WarnLevel, fmt.Sprintln(args...))
+}
+
+// Warnf logs a formatted message at the warn level
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.output(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+// Error logs the operands at the error level, separated by spaces
+func (l *Logger) Error(args ...interface{}) {
+	l.output(ErrorLevel, fmt.Sprintln(args...))
+}
+
+// Errorf logs a formatted message at the error level
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.output(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+// Fatal logs the operands at the error level and exits the process
+func (l *Logger) Fatal(args ...interface{}) {
+	l.output(ErrorLevel, fmt.Sprintln(args...))
+	os.Exit(1)
+}
+
+// Fatalf logs a formatted message at the error level and exits the process
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.output(ErrorLevel, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Writes an entry if its level is enabled
+// Must be called directly by the exported logging methods to report their caller
+func (l *Logger) output(level Level, msg string) {
+	settings.RLock()
+	if level < l.level() {
+		settings.RUnlock()
+		return
+	}
+	out, format, caller := settings.out, settings.format, settings.caller
+	settings.RUnlock()
+
+	e := entry{
+		time:      time.Now(),
+		level:     level,
+		component: l.component,
+		msg:       strings.TrimRight(msg, "\n"),
+		fields:    l.fields,
+	}
+	if caller {
+		if _, file, line, ok := runtime.Caller(2); ok {
+			e.caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		}
+	}
+
+	var line []byte
+	if format == FormatJSON {
+		line = e.json()
+	} else {
+		line = e.logfmt()
+	}
+	settings.outMu.Lock()
+	out.Write(line)
+	settings.outMu.Unlock()
+}
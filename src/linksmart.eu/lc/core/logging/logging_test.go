@@ -0,0 +1,142 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Redirects the output to a buffer and resets the configuration after the test
+func setup(t *testing.T) *bytes.Buffer {
+	var b bytes.Buffer
+	SetOutput(&b)
+	err := Configure(Config{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return &b
+}
+
+func teardown() {
+	SetOutput(os.Stdout)
+	Configure(Config{})
+}
+
+// Removes the time from entries
+var timePattern = regexp.MustCompile(`time=\S+ |"time":"[^"]+",`)
+
+func TestLogfmt(t *testing.T) {
+	b := setup(t)
+	defer teardown()
+
+	logger := New("test")
+	logger.Infof("Added %s\n", "d1")
+	logger.With("id", "d 2", "err", errors.New("not found")).Error("Failed", "to add")
+	logger.Warn("")
+
+	expected := `level=info component=test msg="Added d1"
+level=error component=test msg="Failed to add" id="d 2" err="not found"
+level=warn component=test msg=""
+`
+	if out := timePattern.ReplaceAllString(b.String(), ""); out != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b := setup(t)
+	defer teardown()
+
+	err := Configure(Config{Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	New("test").With("status", 404, "path", `/a"b`).Warnf("Not found")
+
+	expected := `{"level":"warn","component":"test","msg":"Not found","status":404,"path":"/a\"b"}` + "\n"
+	if out := timePattern.ReplaceAllString(b.String(), ""); out != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	b := setup(t)
+	defer teardown()
+
+	err := Configure(Config{Level: "warn", Components: map[string]string{"verbose": "debug"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	quiet, verbose := New("quiet"), New("verbose")
+	quiet.Info("discarded")
+	quiet.Warn("written")
+	verbose.Debug("written")
+	if !verbose.Enabled(DebugLevel) || quiet.Enabled(InfoLevel) {
+		t.Errorf("Unexpected enabled levels")
+	}
+
+	out := b.String()
+	if strings.Contains(out, "discarded") || strings.Count(out, "written") != 2 {
+		t.Errorf("Unexpected entries:\n%s", out)
+	}
+
+	// Unconfigured components fall back to the default level
+	err = Configure(Config{Level: "error"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if verbose.Enabled(WarnLevel) {
+		t.Errorf("Expected the component level to be reset")
+	}
+
+	for _, c := range []Config{{Level: "verbose"}, {Format: "xml"}, {Components: map[string]string{"rc": ""}}} {
+		if err := Configure(c); err == nil {
+			t.Errorf("Expected an error for the invalid config %+v", c)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	var errorCode int
+	handler := Handler(func(w http.ResponseWriter, code int, msgs ...string) {
+		errorCode = code
+		w.WriteHeader(code)
+	})
+
+	body := `{"level":"debug","format":"json","components":{"sc":"error"}}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/logging", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !New("sc").Enabled(ErrorLevel) || New("sc").Enabled(WarnLevel) || !New("rc").Enabled(DebugLevel) {
+		t.Errorf("Configuration was not applied")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/logging", nil))
+	var c Config
+	if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.Level != "debug" || c.Format != FormatJSON || c.Components["sc"] != "error" {
+		t.Errorf("Unexpected configuration: %+v", c)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/logging", strings.NewReader(`{"level":"loud"}`)))
+	if errorCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid level, got %d", http.StatusBadRequest, errorCode)
+	}
+}
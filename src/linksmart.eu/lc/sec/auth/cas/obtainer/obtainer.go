@@ -5,13 +5,11 @@ package obtainer
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
-	"strconv"
 
+	"linksmart.eu/lc/core/logging"
 	"linksmart.eu/lc/sec/auth/obtainer"
 )
 
@@ -22,15 +20,11 @@ const (
 
 type CASObtainer struct{}
 
-var logger *log.Logger
+var logger *logging.Logger
 
 func init() {
 	// Initialize the logger
-	logger = log.New(os.Stdout, fmt.Sprintf("[%s] ", driverName), 0)
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(driverName)
 
 	// Register the driver as a auth/obtainer
 	obtainer.Register(driverName, &CASObtainer{})
@@ -46,7 +40,7 @@ func (o *CASObtainer) Login(serverAddr, username, password, _ string) (string, e
 		return "", err
 	}
 	defer res.Body.Close()
-	logger.Println("Login()", res.Status)
+	logger.Debug("Login()", res.Status)
 
 	// Check for credentials
 	if res.StatusCode != http.StatusCreated {
@@ -70,7 +64,7 @@ func (o *CASObtainer) RequestTicket(serverAddr, TGT, serviceID string) (string,
 		return "", err
 	}
 	defer res.Body.Close()
-	logger.Println("RequestTicket()", res.Status)
+	logger.Debug("RequestTicket()", res.Status)
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -96,7 +90,7 @@ func (o *CASObtainer) Logout(serverAddr, TGT string) error {
 		return err
 	}
 	defer res.Body.Close()
-	logger.Println("Logout()", res.Status)
+	logger.Debug("Logout()", res.Status)
 
 	// Check for server errors
 	if res.StatusCode != http.StatusOK {
@@ -5,12 +5,10 @@ package validator
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
 
+	"linksmart.eu/lc/core/logging"
 	"linksmart.eu/lc/sec/auth/validator"
 	"github.com/kylewolfe/simplexml"
 )
@@ -23,15 +21,11 @@ const (
 
 type CASValidator struct{}
 
-var logger *log.Logger
+var logger *logging.Logger
 
 func init() {
 	// Initialize the logger
-	logger = log.New(os.Stdout, fmt.Sprintf("[%s] ", driverName), 0)
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(driverName)
 
 	// Register the driver as a auth/validator
 	validator.Register(driverName, &CASValidator{})
@@ -83,7 +77,7 @@ func (v *CASValidator) Validate(serverAddr, serviceID, ticket string) (bool, *va
 		return false, &profile, nil
 	}
 	// Token is valid
-	logger.Println("Validate()", res.Status, "Valid ticket.")
+	logger.Debug("Validate()", res.Status, "Valid ticket.")
 
 	// Extract username
 	userTag := doc.Root().Search().ByName("authenticationSuccess").ByName("user").One()
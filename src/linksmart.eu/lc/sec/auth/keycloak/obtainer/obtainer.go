@@ -7,14 +7,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"linksmart.eu/lc/core/logging"
 	"linksmart.eu/lc/sec/auth/obtainer"
 )
 
@@ -25,15 +23,11 @@ const (
 
 type KeycloakObtainer struct{}
 
-var logger *log.Logger
+var logger *logging.Logger
 
 func init() {
 	// Initialize the logger
-	logger = log.New(os.Stdout, fmt.Sprintf("[%s] ", DriverName), 0)
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(DriverName)
 
 	// Register the driver as a auth/obtainer
 	obtainer.Register(DriverName, &KeycloakObtainer{})
@@ -57,7 +51,7 @@ func (o *KeycloakObtainer) Login(serverAddr, username, password, clientID string
 		return "", err
 	}
 	defer res.Body.Close()
-	logger.Println("Login()", res.Status)
+	logger.Debug("Login()", res.Status)
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -96,7 +90,7 @@ func (o *KeycloakObtainer) RequestTicket(serverAddr, sToken, clientID string) (s
 	json.Unmarshal(decoded, &idToken)
 	// if id_token is still valid, no need to request a new one
 	if int64(idToken["exp"].(float64)) > time.Now().Unix() {
-		logger.Println("RequestTicket() Using the newly acquired token.")
+		logger.Debug("RequestTicket() Using the newly acquired token.")
 		return token.IdToken, nil
 	}
 
@@ -110,7 +104,7 @@ func (o *KeycloakObtainer) RequestTicket(serverAddr, sToken, clientID string) (s
 		return "", err
 	}
 	defer res.Body.Close()
-	logger.Println("RequestTicket()", res.Status)
+	logger.Debug("RequestTicket()", res.Status)
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
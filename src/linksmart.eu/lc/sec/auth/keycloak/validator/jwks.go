@@ -0,0 +1,282 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package validator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Path of the JWKS endpoint of a realm
+	certsPath = "/protocol/openid-connect/certs"
+	// Interval after which the keys are refreshed
+	refreshInterval = 10 * time.Minute
+	// Minimum interval between the refreshes, e.g. those caused by tokens with unknown key ids
+	minRefreshInterval = 10 * time.Second
+	// Timeout of the requests to the authentication server
+	fetchTimeout = 10 * time.Second
+)
+
+// Client of the authentication server
+var client = &http.Client{Timeout: fetchTimeout}
+
+// Set of the public keys of a realm, fetched from its JWKS endpoint
+// Servers without JWKS endpoint provide the single public key of the realm
+type keySet struct {
+	sync.Mutex
+	serverAddr string
+	// keys by their ids
+	keys map[string]interface{}
+	// public key of the realm, used if the keys could not be fetched from the JWKS endpoint
+	realmKey interface{}
+	// time of the last successful and the last attempted refresh
+	fetched   time.Time
+	attempted time.Time
+	// closed when the refresh in progress, if any, completes
+	refreshing chan struct{}
+	// error of the last refresh
+	refreshErr error
+	now        func() time.Time
+}
+
+func newKeySet(serverAddr string) *keySet {
+	return &keySet{
+		serverAddr: serverAddr,
+		now:        time.Now,
+	}
+}
+
+// Error fetching the keys from the authentication server
+type fetchError struct{ s string }
+
+func (e *fetchError) Error() string { return e.s }
+
+// Returns the key with the given id, or the only key if the id is empty
+// The keys are refreshed when they are stale or the id is unknown. The keys are fetched without holding the lock,
+// and concurrent requests for unknown keys wait for the refresh in progress rather than starting another one
+func (s *keySet) key(kid string) (interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	key, found := s.lookup(kid)
+	stale := now.Sub(s.fetched) >= refreshInterval
+	var done chan struct{}
+	if (stale || !found) && s.refreshing == nil && now.Sub(s.attempted) >= minRefreshInterval {
+		done = make(chan struct{})
+		s.refreshing, s.attempted = done, now
+		s.Unlock()
+		keys, realmKey, err := fetchKeys(s.serverAddr)
+		s.Lock()
+		if err == nil {
+			s.keys, s.realmKey, s.fetched = keys, realmKey, now
+		} else if !s.fetched.IsZero() {
+			logger.Warnf("Using the previous keys: %s", err)
+		}
+		s.refreshing, s.refreshErr = nil, err
+		close(done)
+	} else if !found && s.refreshing != nil {
+		done = s.refreshing
+		s.Unlock()
+		<-done
+		s.Lock()
+	}
+	if done != nil {
+		if s.fetched.IsZero() {
+			return nil, s.refreshErr
+		}
+		key, found = s.lookup(kid)
+	}
+
+	if !found {
+		if kid == "" {
+			return nil, fmt.Errorf("The token has no key id (kid)")
+		}
+		return nil, fmt.Errorf("Unknown key id (kid) %s", kid)
+	}
+	return key, nil
+}
+
+func (s *keySet) lookup(kid string) (interface{}, bool) {
+	if s.realmKey != nil {
+		return s.realmKey, true
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, found := s.keys[kid]
+	return key, found
+}
+
+// Fetches the keys from the JWKS endpoint of a realm, or its public key if the endpoint is not available
+func fetchKeys(serverAddr string) (map[string]interface{}, interface{}, error) {
+	jwksURL := serverAddr
+	if !strings.HasSuffix(jwksURL, certsPath) {
+		jwksURL = strings.TrimSuffix(jwksURL, "/") + certsPath
+	}
+	keys, err := fetchJWKS(jwksURL)
+	if err == nil {
+		logger.Debugf("Fetched %d keys from %s", len(keys), jwksURL)
+		return keys, nil, nil
+	}
+	if jwksURL == serverAddr {
+		return nil, nil, &fetchError{err.Error()}
+	}
+
+	realmKey, realmErr := fetchRealmKey(serverAddr)
+	if realmErr != nil {
+		return nil, nil, &fetchError{fmt.Sprintf("%s; %s", err, realmErr)}
+	}
+	logger.Debugf("Using the public key of the realm: %s", err)
+	return nil, realmKey, nil
+}
+
+// JSON Web Key (RFC 7517) with the parameters of RSA and EC public keys (RFC 7518)
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Returns the signature verification keys of a JWKS endpoint by their ids
+// Keys of other uses or unsupported types are skipped
+func fetchJWKS(url string) (map[string]interface{}, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the keys from the authentication server: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error getting the keys from the authentication server: %s", res.Status)
+	}
+
+	var body struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Error decoding the keys of the authentication server: %s", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range body.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logger.Warnf("Skipping key %s: %s", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("The authentication server provides no signature keys")
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid modulus: %s", err)
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("Invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve %s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid x coordinate: %s", err)
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid y coordinate: %s", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("The point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type %s", k.Kty)
+	}
+}
+
+// Decodes an unsigned integer in unpadded base64url
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Returns the public key of a realm, provided by older servers without JWKS endpoint
+func fetchRealmKey(serverAddr string) (interface{}, error) {
+	res, err := client.Get(serverAddr)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the public key from the authentication server: %s", err)
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		PublicKey string `json:"public_key"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the public key from the authentication server response: %s", err)
+	}
+
+	// Decode the public key
+	decoded, err := base64.StdEncoding.DecodeString(body.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding the authentication server public key: %s", err)
+	}
+
+	// Parse the public key
+	parsed, err := x509.ParsePKIXPublicKey(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the authentication server public key: %s", err)
+	}
+	switch parsed.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return parsed, nil
+	default:
+		return nil, fmt.Errorf("The authentication server's public key type is neither RSA nor EC.")
+	}
+}
@@ -4,36 +4,32 @@ package validator
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"sync"
 
+	"crypto/ecdsa"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/json"
-	"net/http"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"linksmart.eu/lc/core/logging"
 	"linksmart.eu/lc/sec/auth/validator"
 )
 
 const DriverName = "keycloak"
 
-type KeycloakValidator struct{}
+// KeycloakValidator validates the ID tokens issued by Keycloak
+// The tokens are verified with the keys of the realm (the server address), selected by their key ids (kid)
+// and fetched from its JWKS endpoint. The keys are refreshed periodically and when a token has an unknown key id.
+type KeycloakValidator struct {
+	sync.Mutex
+	// keys of each realm
+	keySets map[string]*keySet
+}
 
-var (
-	logger    *log.Logger
-	publicKey *rsa.PublicKey
-)
+var logger *logging.Logger
 
 func init() {
 	// Initialize the logger
-	logger = log.New(os.Stdout, fmt.Sprintf("[%s] ", DriverName), 0)
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(DriverName)
 
 	// Register the driver as a auth/validator
 	validator.Register(DriverName, &KeycloakValidator{})
@@ -41,96 +37,125 @@ func init() {
 
 // Validate validates the token
 func (v *KeycloakValidator) Validate(serverAddr, clientID, ticket string) (bool, *validator.UserProfile, error) {
-
-	if publicKey == nil {
-		// Get the public key
-		res, err := http.Get(serverAddr)
-		if err != nil {
-			return false, nil, fmt.Errorf("Error getting the public key from the authentication server: %s", err)
-		}
-		defer res.Body.Close()
-
-		var body struct {
-			PublicKey string `json:"public_key"`
-		}
-		err = json.NewDecoder(res.Body).Decode(&body)
-		if err != nil {
-			return false, nil, fmt.Errorf("Error getting the public key from the authentication server response: %s", err)
-		}
-
-		// Decode the public key
-		decoded, err := base64.StdEncoding.DecodeString(body.PublicKey)
-		if err != nil {
-			return false, nil, fmt.Errorf("Error decoding the authentication server public key: %s", err)
-		}
-
-		// Parse the public key
-		parsed, err := x509.ParsePKIXPublicKey(decoded)
-		if err != nil {
-			return false, nil, fmt.Errorf("Error pasring the authentication server public key: %s", err)
-		}
-
-		var ok bool
-		if publicKey, ok = parsed.(*rsa.PublicKey); !ok {
-			return false, nil, fmt.Errorf("The authentication server's public key type is not RSA.")
-		}
-	}
+	keys := v.keySet(serverAddr)
 
 	// Parse the jwt id_token
+	var serverErr error
 	token, err := jwt.Parse(ticket, func(token *jwt.Token) (interface{}, error) {
-		// Make sure that the algorithm is RS256
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, err := keys.key(kid)
+		if err != nil {
+			if _, ok := err.(*fetchError); ok {
+				serverErr = err
+			}
+			return nil, err
+		}
+		// Make sure that the algorithm matches the key
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := key.(*rsa.PublicKey); !ok {
+				return nil, fmt.Errorf("Unexpected signing method %v for a non-RSA key", token.Header["alg"])
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := key.(*ecdsa.PublicKey); !ok {
+				return nil, fmt.Errorf("Unexpected signing method %v for a non-EC key", token.Header["alg"])
+			}
+		default:
 			return nil, fmt.Errorf("Unable to validate authentication token. Unexpected signing method: %v", token.Header["alg"])
 		}
-		return publicKey, nil
+		return key, nil
 	})
-	if err != nil {
-		return false, &validator.UserProfile{Status: fmt.Sprintf("Invalid token: %s", err)}, nil
+	if serverErr != nil {
+		return false, nil, serverErr
 	}
 
 	// Check the validation errors
-	if !token.Valid {
+	if err != nil {
 		if ve, ok := err.(*jwt.ValidationError); ok {
 			if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-				return false, &validator.UserProfile{Status: fmt.Sprintf("Invalid token.")}, nil
+				return false, &validator.UserProfile{Status: "Invalid token."}, nil
 			} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
-				return false, &validator.UserProfile{Status: fmt.Sprintf("Token is either expired or not active yet")}, nil
-			} else {
-				return false, &validator.UserProfile{Status: fmt.Sprintf("Error validating the token: %s", err)}, nil
+				return false, &validator.UserProfile{Status: "Token is either expired or not active yet"}, nil
 			}
-		} else {
-			return false, &validator.UserProfile{Status: fmt.Sprintf("Invalid token: %s", err)}, nil
 		}
+		return false, &validator.UserProfile{Status: fmt.Sprintf("Invalid token: %s", err)}, nil
 	}
 
 	// Get the claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if claims["typ"].(string) != "ID" {
-			return false, &validator.UserProfile{Status: fmt.Sprintf("Wrong token type `%s` for accessing resource. Expecting type `ID`.", claims["typ"])}, nil
-		}
-		// Check if audience matches the client id
-		if claims["aud"].(string) != clientID {
-			return false, &validator.UserProfile{Status: fmt.Sprintf("The token is issued for client `%s` rather than `%s`.", claims["aud"], clientID)}, nil
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false, nil, fmt.Errorf("Unable to extract claims from the jwt id_token.")
+	}
+	profile, status := userProfile(claims, clientID)
+	if profile == nil {
+		return false, &validator.UserProfile{Status: status}, nil
+	}
+	return true, profile, nil
+}
 
-		// Get the user data
-		groupInts, ok := claims["groups"].([]interface{})
-		if !ok {
-			return false, nil, fmt.Errorf("Unable to get the user's group membership")
-		}
-		// convert []interface{} to []string
-		groups := make([]string, len(groupInts))
+// Returns the keys of a realm
+func (v *KeycloakValidator) keySet(serverAddr string) *keySet {
+	v.Lock()
+	defer v.Unlock()
+	if v.keySets == nil {
+		v.keySets = make(map[string]*keySet)
+	}
+	keys, found := v.keySets[serverAddr]
+	if !found {
+		keys = newKeySet(serverAddr)
+		v.keySets[serverAddr] = keys
+	}
+	return keys
+}
+
+// Returns the profile of the user from the claims of a token issued for the client,
+// or the reason why the claims are not accepted
+func userProfile(claims jwt.MapClaims, clientID string) (*validator.UserProfile, string) {
+	if typ, _ := claims["typ"].(string); typ != "ID" {
+		return nil, fmt.Sprintf("Wrong token type `%v` for accessing resource. Expecting type `ID`.", claims["typ"])
+	}
+	// Check if audience matches the client id
+	if !hasAudience(claims["aud"], clientID) {
+		return nil, fmt.Sprintf("The token is issued for client `%v` rather than `%s`.", claims["aud"], clientID)
+	}
+
+	// Get the user data
+	username, _ := claims["preferred_username"].(string)
+	if username == "" {
+		return nil, "The token has no username (preferred_username)."
+	}
+	// Users without groups may have no groups claim
+	var groups []string
+	switch groupInts := claims["groups"].(type) {
+	case nil:
+	case []interface{}:
 		for i := range groupInts {
-			groups[i] = groupInts[i].(string)
+			group, ok := groupInts[i].(string)
+			if !ok {
+				return nil, fmt.Sprintf("Invalid group `%v` in the token.", groupInts[i])
+			}
+			groups = append(groups, group)
 		}
-		username, ok := claims["preferred_username"].(string)
-		if !ok {
-			return false, nil, fmt.Errorf("Unable to get the user's username.")
+	default:
+		return nil, "Invalid group membership (groups) in the token."
+	}
+	return &validator.UserProfile{
+		Username: username,
+		Groups:   groups,
+	}, ""
+}
+
+// Checks whether the audience of a token, a string or an array of strings, contains the client id
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
 		}
-		return true, &validator.UserProfile{
-			Username: username,
-			Groups:   groups,
-		}, nil
 	}
-	return false, nil, fmt.Errorf("Unable to extract claims from the jwt id_token.")
+	return false
 }
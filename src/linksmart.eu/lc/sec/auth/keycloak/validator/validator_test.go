@@ -0,0 +1,269 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package validator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const testClient = "test-client"
+
+// Realm serving its keys at the JWKS endpoint, or its public key only if legacy
+type testRealm struct {
+	sync.Mutex
+	keys     map[string]interface{}
+	legacy   bool
+	requests int
+	// blocks the responses until closed, if set
+	block chan struct{}
+}
+
+func (r *testRealm) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	block := r.block
+	r.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.requests++
+
+	if req.URL.Path == certsPath && !r.legacy {
+		var body struct {
+			Keys []jwk `json:"keys"`
+		}
+		for kid, key := range r.keys {
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				body.Keys = append(body.Keys, jwk{Kid: kid, Kty: "RSA", Use: "sig",
+					N: encodeInt(key.N), E: encodeInt(big.NewInt(int64(key.E)))})
+			case *ecdsa.PrivateKey:
+				body.Keys = append(body.Keys, jwk{Kid: kid, Kty: "EC", Use: "sig", Crv: "P-256",
+					X: encodeInt(key.X), Y: encodeInt(key.Y)})
+			}
+		}
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+	if req.URL.Path == "/" && r.legacy {
+		for _, key := range r.keys {
+			der, _ := x509.MarshalPKIXPublicKey(&key.(*rsa.PrivateKey).PublicKey)
+			json.NewEncoder(w).Encode(map[string]string{"public_key": base64.StdEncoding.EncodeToString(der)})
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+func (r *testRealm) setKeys(keys map[string]interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	r.keys = keys
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"typ":                "ID",
+		"aud":                testClient,
+		"preferred_username": "alice",
+		"groups":             []string{"staff"},
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	realm := &testRealm{keys: map[string]interface{}{"rsa": rsaKey, "ec": ecKey}}
+	server := httptest.NewServer(realm)
+	defer server.Close()
+	v := &KeycloakValidator{}
+
+	validate := func(token string) (bool, string) {
+		valid, profile, err := v.Validate(server.URL, testClient, token)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if valid {
+			if profile.Username != "alice" || len(profile.Groups) != 1 || profile.Groups[0] != "staff" {
+				t.Fatalf("Unexpected profile %+v", profile)
+			}
+			return true, ""
+		}
+		return false, profile.Status
+	}
+
+	if valid, status := validate(sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims())); !valid {
+		t.Errorf("Expected a valid RSA token: %s", status)
+	}
+	if valid, status := validate(sign(t, jwt.SigningMethodES256, "ec", ecKey, validClaims())); !valid {
+		t.Errorf("Expected a valid EC token: %s", status)
+	}
+	// Key of another type
+	if valid, _ := validate(sign(t, jwt.SigningMethodES256, "rsa", ecKey, validClaims())); valid {
+		t.Error("Expected a token signed with another key type to be invalid")
+	}
+
+	// Missing and mistyped claims
+	for name, change := range map[string]func(jwt.MapClaims){
+		"no type":          func(c jwt.MapClaims) { delete(c, "typ") },
+		"numeric type":     func(c jwt.MapClaims) { c["typ"] = 1 },
+		"other audience":   func(c jwt.MapClaims) { c["aud"] = "other" },
+		"no audience":      func(c jwt.MapClaims) { delete(c, "aud") },
+		"no username":      func(c jwt.MapClaims) { delete(c, "preferred_username") },
+		"numeric groups":   func(c jwt.MapClaims) { c["groups"] = []interface{}{1} },
+		"string groups":    func(c jwt.MapClaims) { c["groups"] = "staff" },
+		"expired":          func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"numeric username": func(c jwt.MapClaims) { c["preferred_username"] = 42 },
+	} {
+		claims := validClaims()
+		change(claims)
+		if valid, status := validate(sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims)); valid || status == "" {
+			t.Errorf("%s: expected an invalid token with a status", name)
+		}
+	}
+	claims := validClaims()
+	claims["aud"] = []string{"other", testClient}
+	if valid, status := validate(sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims)); !valid {
+		t.Errorf("Expected a valid token with multiple audiences: %s", status)
+	}
+
+	// Rotation: unknown key ids cause a refresh, at most every minRefreshInterval
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	realm.setKeys(map[string]interface{}{"rotated": rotated})
+	keys := v.keySet(server.URL)
+	now := keys.attempted
+	keys.now = func() time.Time { return now }
+	token := sign(t, jwt.SigningMethodRS256, "rotated", rotated, validClaims())
+	if valid, _ := validate(token); valid {
+		t.Error("Expected no refresh within the minimum interval")
+	}
+	now = now.Add(minRefreshInterval)
+	if valid, status := validate(token); !valid {
+		t.Errorf("Expected a valid token signed with the rotated key: %s", status)
+	}
+	// Periodic refresh removes the previous keys
+	now = now.Add(refreshInterval)
+	if valid, _ := validate(sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims())); valid {
+		t.Error("Expected the previous key to be removed after a refresh")
+	}
+}
+
+func TestValidateLegacy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	realm := &testRealm{keys: map[string]interface{}{"": key}, legacy: true}
+	server := httptest.NewServer(realm)
+	defer server.Close()
+	v := &KeycloakValidator{}
+
+	// Tokens are verified with the public key of the realm if there is no JWKS endpoint
+	valid, profile, err := v.Validate(server.URL+"/", testClient, sign(t, jwt.SigningMethodRS256, "", key, validClaims()))
+	if err != nil || !valid {
+		t.Fatalf("Expected a valid token: %v %+v", err, profile)
+	}
+
+	// Server errors are reported as errors
+	server.Close()
+	if _, _, err := (&KeycloakValidator{}).Validate(server.URL, testClient, sign(t, jwt.SigningMethodRS256, "", key, validClaims())); err == nil {
+		t.Error("Expected an error without authentication server")
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	realm := &testRealm{keys: map[string]interface{}{"rsa": key}}
+	server := httptest.NewServer(realm)
+	defer server.Close()
+
+	keys := newKeySet(server.URL)
+	if _, err := keys.key("rsa"); err != nil {
+		t.Fatal(err.Error())
+	}
+	now := keys.now().Add(minRefreshInterval)
+	keys.now = func() time.Time { return now }
+
+	// Hang the authentication server and request unknown keys concurrently
+	block := make(chan struct{})
+	realm.Lock()
+	realm.block = block
+	requests := realm.requests
+	realm.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys.key("unknown")
+		}()
+	}
+
+	// Known keys are available during the refresh
+	result := make(chan error)
+	go func() {
+		_, err := keys.key("rsa")
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Unexpected error for a known key: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Known keys are blocked by the refresh")
+	}
+
+	close(block)
+	wg.Wait()
+	realm.Lock()
+	defer realm.Unlock()
+	if realm.requests != requests+1 {
+		t.Fatalf("Expected a single refresh, got %d requests", realm.requests-requests)
+	}
+}
@@ -4,10 +4,10 @@ package obtainer
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"sort"
 	"sync"
+
+	"linksmart.eu/lc/core/logging"
 )
 
 // Interface methods to login, obtain Service Ticket, and logout
@@ -23,7 +23,7 @@ type Driver interface {
 var (
 	driversMu sync.Mutex
 	drivers   = make(map[string]Driver)
-	logger    *log.Logger
+	logger    *logging.Logger
 )
 
 // Register registers a driver (called by a the driver package)
@@ -36,6 +36,18 @@ func Register(name string, driver Driver) {
 	drivers[name] = driver
 }
 
+// Drivers returns the sorted names of the registered drivers
+func Drivers() []string {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Setup configures and returns the Obtainer
 func Setup(name, serverAddr string) (*Obtainer, error) {
 	driversMu.Lock()
@@ -46,11 +58,7 @@ func Setup(name, serverAddr string) (*Obtainer, error) {
 	}
 
 	// Initialize the logger
-	logger = log.New(os.Stdout, fmt.Sprintf("[%s] ", name), 0)
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(name)
 
 	return &Obtainer{
 		driver:     driveri,
@@ -0,0 +1,197 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package validator
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the cache of validation results
+const (
+	DefaultCacheTTL        = 60
+	DefaultCacheMaxEntries = 1000
+)
+
+// CacheMetrics receives the events of the cache of validation results, e.g. to expose them as metrics
+type CacheMetrics interface {
+	// Lookup counts a lookup of a token, found in the cache (hit) or not
+	Lookup(hit bool)
+	// Evicted counts a result evicted from the cache to respect its size
+	Evicted()
+	// Entries reports the number of cached results
+	Entries(n int)
+}
+
+// Ignores the events of the cache
+type noCacheMetrics struct{}
+
+func (noCacheMetrics) Lookup(hit bool) {}
+func (noCacheMetrics) Evicted()        {}
+func (noCacheMetrics) Entries(n int)   {}
+
+// CacheConfig configures the cache of the results of successful validations
+// Tokens are looked up in the cache before being validated by the driver, e.g. by the authentication server
+type CacheConfig struct {
+	// Cache switch
+	Enabled bool `json:"enabled"`
+	// Time in seconds a result is cached (default 60). Results of JWT tokens are never cached beyond their expiry (exp)
+	TTL int `json:"ttl"`
+	// Maximum number of cached results (default 1000), the least recently used are evicted first
+	MaxEntries int `json:"maxEntries"`
+}
+
+// Validate checks the configuration
+func (c CacheConfig) Validate() error {
+	if c.TTL < 0 {
+		return errors.New("cache ttl must not be negative")
+	}
+	if c.MaxEntries < 0 {
+		return errors.New("cache maxEntries must not be negative")
+	}
+	return nil
+}
+
+// Cache of the profiles of validated tokens, safe for concurrent use
+// The tokens are identified by their hashes
+type cache struct {
+	sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	// recently used entries first
+	lru     *list.List
+	now     func() time.Time
+	metrics CacheMetrics
+}
+
+type cacheEntry struct {
+	key     string
+	profile *UserProfile
+	expires time.Time
+}
+
+func newCache(c CacheConfig, m CacheMetrics) *cache {
+	if m == nil {
+		m = noCacheMetrics{}
+	}
+	ttl, maxEntries := c.TTL, c.MaxEntries
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	if maxEntries == 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &cache{
+		ttl:        time.Duration(ttl) * time.Second,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+		metrics:    m,
+	}
+}
+
+// Returns the cached profile of a token, or nil if it is not cached or expired
+func (c *cache) get(token string) *UserProfile {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, found := c.entries[hash(token)]
+	if !found {
+		c.metrics.Lookup(false)
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		c.metrics.Lookup(false)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	c.metrics.Lookup(true)
+	return entry.profile
+}
+
+// Caches the profile of a validated token
+func (c *cache) add(token string, profile *UserProfile) {
+	now := c.now()
+	expires := now.Add(c.ttl)
+	if exp, ok := expiry(token); ok && exp.Before(expires) {
+		expires = exp
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	key := hash(token)
+	if elem, found := c.entries[key]; found {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, profile: profile, expires: expires})
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.metrics.Evicted()
+	}
+	c.metrics.Entries(c.lru.Len())
+}
+
+// Removes the result of a token
+func (c *cache) invalidate(token string) {
+	c.Lock()
+	defer c.Unlock()
+	if elem, found := c.entries[hash(token)]; found {
+		c.remove(elem)
+	}
+}
+
+// Removes all results
+func (c *cache) purge() {
+	c.Lock()
+	defer c.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.metrics.Entries(0)
+}
+
+// Must be called with the lock held
+func (c *cache) remove(elem *list.Element) {
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+	c.lru.Remove(elem)
+	c.metrics.Entries(c.lru.Len())
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the expiry (exp claim) of a JWT token, if the token is a JWT with an expiry
+// The token is not verified, which is the job of the driver
+func expiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(*claims.Exp), 0), true
+}
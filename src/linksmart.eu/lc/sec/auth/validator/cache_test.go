@@ -0,0 +1,146 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package validator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Counts the validations of tickets of the form user or user:invalid
+type countingDriver struct {
+	validations int
+}
+
+func (d *countingDriver) Validate(serverAddr, serviceID, ticket string) (bool, *UserProfile, error) {
+	d.validations++
+	if ticket == "invalid" {
+		return false, &UserProfile{Status: "invalid ticket"}, nil
+	}
+	return true, &UserProfile{Username: ticket}, nil
+}
+
+// Records the events reported by the cache
+type countingMetrics struct {
+	hits, misses, evictions, entries int
+}
+
+func (m *countingMetrics) Lookup(hit bool) {
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func (m *countingMetrics) Evicted()      { m.evictions++ }
+func (m *countingMetrics) Entries(n int) { m.entries = n }
+
+func setupCached(t *testing.T, c CacheConfig) (*Validator, *countingDriver, func(time.Duration)) {
+	return setupCachedMetrics(t, c, nil)
+}
+
+func setupCachedMetrics(t *testing.T, c CacheConfig, m CacheMetrics) (*Validator, *countingDriver, func(time.Duration)) {
+	driver := &countingDriver{}
+	Register("cache-test", driver)
+	v, err := Setup("cache-test", "", "", false, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	v.EnableCache(c, m)
+	now := time.Now()
+	v.cache.now = func() time.Time { return now }
+	return v, driver, func(d time.Duration) { now = now.Add(d) }
+}
+
+func jwt(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+	return "eyJhbGciOiJSUzI1NiJ9." + payload + ".signature"
+}
+
+func TestCache(t *testing.T) {
+	v, driver, advance := setupCached(t, CacheConfig{Enabled: true, TTL: 60, MaxEntries: 2})
+
+	validate := func(ticket string, validations int) {
+		valid, profile, err := v.Validate(ticket)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if valid != (ticket != "invalid") || (valid && profile.Username != ticket) {
+			t.Fatalf("Unexpected result for %s: %t %+v", ticket, valid, profile)
+		}
+		if driver.validations != validations {
+			t.Fatalf("Expected %d validations by the driver after %s, got %d", validations, ticket, driver.validations)
+		}
+	}
+
+	validate("alice", 1)
+	validate("alice", 1)
+	// Invalid tickets are not cached
+	validate("invalid", 2)
+	validate("invalid", 3)
+
+	// Expiry
+	advance(59 * time.Second)
+	validate("alice", 3)
+	advance(time.Second)
+	validate("alice", 4)
+
+	// Eviction of the least recently used
+	validate("bob", 5)
+	validate("alice", 5)
+	validate("eve", 6)
+	validate("alice", 6)
+	validate("bob", 7)
+
+	// Explicit invalidation
+	v.Invalidate("bob")
+	validate("bob", 8)
+	v.Purge()
+	validate("alice", 9)
+	validate("bob", 10)
+}
+
+func TestCacheJWT(t *testing.T) {
+	v, driver, advance := setupCached(t, CacheConfig{Enabled: true})
+
+	now := v.cache.now()
+	token := jwt(now.Add(10 * time.Second))
+	v.Validate(token)
+	v.Validate(token)
+	if driver.validations != 1 {
+		t.Fatalf("Expected the token to be cached, got %d validations", driver.validations)
+	}
+	// Cached until the expiry of the token rather than the ttl
+	advance(10 * time.Second)
+	v.Validate(token)
+	if driver.validations != 2 {
+		t.Fatalf("Expected the token to expire from the cache, got %d validations", driver.validations)
+	}
+
+	// Expired tokens are not cached
+	expired := jwt(now.Add(-time.Second))
+	v.Validate(expired)
+	v.Validate(expired)
+	if driver.validations != 4 {
+		t.Fatalf("Expected expired tokens to be validated each time, got %d validations", driver.validations)
+	}
+}
+
+func TestCacheMetrics(t *testing.T) {
+	m := &countingMetrics{}
+	v, _, _ := setupCachedMetrics(t, CacheConfig{Enabled: true, TTL: 60, MaxEntries: 1}, m)
+
+	v.Validate("alice")
+	v.Validate("alice")
+	v.Validate("bob")
+	if m.hits != 1 || m.misses != 2 || m.evictions != 1 || m.entries != 1 {
+		t.Fatalf("Unexpected cache metrics: %+v", *m)
+	}
+	v.Purge()
+	if m.entries != 0 {
+		t.Fatalf("Expected no entries after purge, got %d", m.entries)
+	}
+}
@@ -4,11 +4,10 @@ package validator
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"sort"
 	"sync"
 
+	"linksmart.eu/lc/core/logging"
 	"linksmart.eu/lc/sec/authz"
 )
 
@@ -23,7 +22,7 @@ type Driver interface {
 var (
 	driversMu sync.Mutex
 	drivers   = make(map[string]Driver)
-	logger    *log.Logger
+	logger    *logging.Logger
 )
 
 // Register registers a driver (called by a the driver package)
@@ -36,6 +35,18 @@ func Register(name string, driver Driver) {
 	drivers[name] = driver
 }
 
+// Drivers returns the sorted names of the registered drivers
+func Drivers() []string {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Setup configures and returns the Validator
 // 	parameter authz is optional and can be set to nil
 func Setup(name, serverAddr, serviceID string, basicEnabled bool, authz *authz.Conf) (*Validator, error) {
@@ -47,11 +58,7 @@ func Setup(name, serverAddr, serviceID string, basicEnabled bool, authz *authz.C
 	}
 
 	// Initialize the logger
-	logger = log.New(os.Stdout, fmt.Sprintf("[%s] ", name), 0)
-	v, err := strconv.Atoi(os.Getenv("DEBUG"))
-	if err == nil && v == 1 {
-		logger.SetFlags(log.Ltime | log.Lshortfile)
-	}
+	logger = logging.New(name)
 
 	return &Validator{
 		driver:       driveri,
@@ -72,13 +79,46 @@ type Validator struct {
 	basicEnabled bool
 	// Authorization is optional
 	authz *authz.Conf
+	// Cache of validation results is optional
+	cache *cache
+}
+
+// EnableCache caches the results of successful validations with the given configuration
+// The events of the cache are reported to m, if not nil
+// Must be called before the Validator is used
+func (v *Validator) EnableCache(c CacheConfig, m CacheMetrics) {
+	v.cache = newCache(c, m)
+}
+
+// Invalidate removes the cached validation result of a ticket, e.g. after a logout
+func (v *Validator) Invalidate(ticket string) {
+	if v.cache != nil {
+		v.cache.invalidate(ticket)
+	}
+}
+
+// Purge removes all cached validation results, e.g. after the users or their groups have changed
+func (v *Validator) Purge() {
+	if v.cache != nil {
+		v.cache.purge()
+	}
 }
 
 // Validate validates a ticket
 //	When ticket is valid, it returns true together with the UserProfile
 //	When ticket is invalid, it returns false and provide the reason in the UserProfile.Status
+//	The results of successful validations are cached if enabled (see EnableCache)
 func (v *Validator) Validate(ticket string) (bool, *UserProfile, error) {
-	return v.driver.Validate(v.serverAddr, v.serviceID, ticket)
+	if v.cache != nil {
+		if profile := v.cache.get(ticket); profile != nil {
+			return true, profile, nil
+		}
+	}
+	valid, profile, err := v.driver.Validate(v.serverAddr, v.serviceID, ticket)
+	if err == nil && valid && v.cache != nil {
+		v.cache.add(ticket, profile)
+	}
+	return valid, profile, err
 }
 
 // UserProfile is the profile of user that is returned by the Validator
@@ -2,51 +2,165 @@
 
 package authz
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
 
 // Authorized checks whether a user/group is authorized to access resource using a specific method
+// The matching rules of the highest priority decide: access is denied if one of them is a deny rule
+// and granted otherwise. Access is denied if no rule matches
+// Allow rules with conditions match as the entries are checked by the service (see AuthorizedEntry),
+// deny rules with conditions are ignored
 func (authz *Conf) Authorized(resource, method, user string, groups []string) bool {
-	// Create a tree of paths
-	// e.g. parses /path1/path2/path3 to [/path1/path2/path3 /path1/path2 /path1]
-	// e.g. parses / to [/]
-	resource_split := strings.Split(resource, "/")
-	resource_split = resource_split[1:len(resource_split)] // truncate the first slash
-	var resource_tree []string
-	// construct tree from longest to shortest (/path1) path
-	for i := len(resource_split); i >= 1; i-- {
-		resource_tree = append(resource_tree, "/"+strings.Join(resource_split[0:i], "/"))
-	}
-	//fmt.Println(len(resource_split), resource_split)
-	//fmt.Println(len(resource_tree), resource_tree)
-
-	// Check whether a is in slice
-	inSlice := func(a string, slice []string) bool {
-		for _, b := range slice {
-			if b == a {
-				return true
+	return authz.decide(resource, method, user, groups, func(rule *Rule) bool {
+		return !rule.Deny
+	})
+}
+
+// AuthorizedEntry checks whether a user/group is authorized to access an entry of a resource using a specific method
+// Unlike Authorized, the rules with conditions only match if their conditions hold for the entry
+func (authz *Conf) AuthorizedEntry(resource, method, user string, groups []string, entry interface{}) bool {
+	attributes := attributes(entry)
+	return authz.decide(resource, method, user, groups, func(rule *Rule) bool {
+		return rule.holds(attributes, user, groups)
+	})
+}
+
+// Conditional checks whether the access of a user/group to the entries of a resource depends on the entries,
+// i.e. whether a matching rule has conditions
+func (authz *Conf) Conditional(resource, method, user string, groups []string) bool {
+	authz.rlock()
+	defer authz.mu.RUnlock()
+
+	for i := range authz.Rules {
+		if len(authz.Rules[i].Conditions) > 0 && authz.Rules[i].matches(authz.patterns[i], resource, method, user, groups) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decides on the access by the matching rules, with conditional deciding whether the rules with conditions match
+func (authz *Conf) decide(resource, method, user string, groups []string, conditional func(rule *Rule) bool) bool {
+	authz.rlock()
+	defer authz.mu.RUnlock()
+
+	var allowed, denied bool
+	var allowPriority, denyPriority int
+	for i := range authz.Rules {
+		rule := &authz.Rules[i]
+		if !rule.matches(authz.patterns[i], resource, method, user, groups) {
+			continue
+		}
+		if len(rule.Conditions) > 0 && !conditional(rule) {
+			continue
+		}
+		if rule.Deny {
+			if !denied || rule.Priority > denyPriority {
+				denied, denyPriority = true, rule.Priority
+			}
+		} else {
+			if !allowed || rule.Priority > allowPriority {
+				allowed, allowPriority = true, rule.Priority
 			}
 		}
-		return false
 	}
-	// Check whether there is a match between two slices
-	inSliceM := func(slice1 []string, slice2 []string) bool {
-		for _, a := range slice1 {
-			for _, b := range slice2 {
-				if b == a {
-					return true
-				}
+	return allowed && (!denied || allowPriority > denyPriority)
+}
+
+// Locks the rules for reading, compiling their resource patterns first if needed
+func (authz *Conf) rlock() {
+	authz.mu.RLock()
+	if authz.compiled {
+		return
+	}
+	authz.mu.RUnlock()
+	authz.mu.Lock()
+	if !authz.compiled {
+		authz.compile()
+	}
+	authz.mu.Unlock()
+	authz.mu.RLock()
+}
+
+// Compiles the resource patterns of the rules, ignoring the invalid ones (see Validate)
+// Resources which are neither paths nor regular expressions match no request, as in previous versions
+// Must be called with the write lock held
+func (authz *Conf) compile() {
+	authz.compiled = true
+	authz.patterns = make([][]*regexp.Regexp, len(authz.Rules))
+	for i, rule := range authz.Rules {
+		for _, res := range rule.Resources {
+			if !strings.HasPrefix(res, "/") && !strings.HasPrefix(res, "^") {
+				continue
+			}
+			if re, err := compilePattern(res); err == nil {
+				authz.patterns[i] = append(authz.patterns[i], re)
 			}
 		}
+	}
+}
+
+// Checks whether a rule with the given compiled resource patterns applies to a request
+func (rule *Rule) matches(patterns []*regexp.Regexp, resource, method, user string, groups []string) bool {
+	if !inSlice(method, rule.Methods) && !inSlice(AnyMethod, rule.Methods) {
 		return false
 	}
+	if !inSlice(user, rule.Users) && !inSliceM(groups, rule.Groups) {
+		return false
+	}
+	for _, re := range patterns {
+		if re.MatchString(resource) {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, rule := range authz.Rules {
-		for _, res := range resource_tree {
-			// Return true if user or group matches a rule
-			if inSlice(res, rule.Resources) && inSlice(method, rule.Methods) &&
-				(inSlice(user, rule.Users) || inSliceM(groups, rule.Groups)) {
-				return true
-			}
+// Compiles a resource pattern into a regular expression
+// Patterns starting with ^ are regular expressions matching the whole path
+// Other patterns are paths matching themselves and their sub-paths, e.g. /rc matches /rc and /rc/devices
+// In these, * matches any characters except slashes, ** any characters and ? a single character except slashes
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "^") {
+		return regexp.Compile(pattern)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("(/.*)?$")
+	return regexp.Compile(expr.String())
+}
+
+// Check whether a is in slice
+func inSlice(a string, slice []string) bool {
+	for _, b := range slice {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether there is a match between two slices
+func inSliceM(slice1 []string, slice2 []string) bool {
+	for _, a := range slice1 {
+		if inSlice(a, slice2) {
+			return true
 		}
 	}
 	return false
@@ -0,0 +1,173 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authz
+
+import "testing"
+
+func TestAuthorized(t *testing.T) {
+	authz := &Conf{Rules: []Rule{
+		// Exact paths match themselves and their sub-paths
+		{Resources: []string{"/sc"}, Methods: []string{"GET"}, Users: []string{"alice"}},
+		// Wildcards
+		{Resources: []string{"/rc/devices/*/resources"}, Methods: []string{"GET", "PUT"}, Groups: []string{"staff"}},
+		{Resources: []string{"/dgw/**/value"}, Methods: []string{AnyMethod}, Users: []string{"bob"}},
+		// Regular expressions match the whole path
+		{Resources: []string{"^/rc/devices/urn:dev:[0-9]+$"}, Methods: []string{"DELETE"}, Groups: []string{"staff"}},
+		// Deny overrides allow of the same priority
+		{Resources: []string{"/sc"}, Methods: []string{AnyMethod}, Users: []string{"alice"}},
+		{Resources: []string{"/sc/private"}, Methods: []string{AnyMethod}, Users: []string{"alice"}, Deny: true},
+		// Allow of a higher priority overrides deny
+		{Resources: []string{"/sc/private/shared"}, Methods: []string{"GET"}, Users: []string{"alice"}, Priority: 1},
+		// Deny of a higher priority overrides allow
+		{Resources: []string{"/sc/locked"}, Methods: []string{"GET"}, Users: []string{"alice"}, Deny: true, Priority: -1},
+		{Resources: []string{"/sc/locked"}, Methods: []string{"PUT"}, Users: []string{"alice"}, Deny: true, Priority: 1},
+	}}
+	if err := authz.Validate(); err != nil {
+		t.Fatalf("Unexpected error validating the rules: %s", err)
+	}
+
+	cases := []struct {
+		resource, method, user string
+		groups                 []string
+		authorized             bool
+	}{
+		{"/sc", "GET", "alice", nil, true},
+		{"/sc/service_1", "GET", "alice", nil, true},
+		{"/scx", "GET", "alice", nil, false},
+		{"/sc", "GET", "eve", nil, false},
+		{"/rc/devices/d1/resources", "GET", "eve", []string{"staff"}, true},
+		{"/rc/devices/d1/resources/r1", "PUT", "eve", []string{"staff"}, true},
+		{"/rc/devices/d1/d2/resources", "GET", "eve", []string{"staff"}, false},
+		{"/rc/devices/d1/resources", "DELETE", "eve", []string{"staff"}, false},
+		{"/dgw/rest/device_1/value", "POST", "bob", nil, true},
+		{"/dgw/value", "POST", "bob", nil, false},
+		{"/rc/devices/urn:dev:42", "DELETE", "eve", []string{"staff"}, true},
+		{"/rc/devices/urn:dev:42/x", "DELETE", "eve", []string{"staff"}, false},
+		{"/sc/private", "GET", "alice", nil, false},
+		{"/sc/private/other", "PUT", "alice", nil, false},
+		{"/sc/private/shared", "GET", "alice", nil, true},
+		{"/sc/private/shared", "PUT", "alice", nil, false},
+		{"/sc/locked", "GET", "alice", nil, true},
+		{"/sc/locked", "PUT", "alice", nil, false},
+	}
+	for _, c := range cases {
+		if authorized := authz.Authorized(c.resource, c.method, c.user, c.groups); authorized != c.authorized {
+			t.Errorf("%s %s by %s %v: expected authorized %t, got %t", c.method, c.resource, c.user, c.groups, c.authorized, authorized)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	authz := &Conf{Rules: []Rule{
+		{Resources: []string{"/rc/devices"}, Methods: []string{"GET"}, Groups: []string{"building-3"},
+			Conditions: []Condition{{Field: "meta.building", Op: OpEquals, Value: "3"}}},
+		{Resources: []string{"/rc/devices"}, Methods: []string{"GET"}, Groups: []string{"staff"},
+			Conditions: []Condition{{Field: "meta.owners", Op: OpEquals, Value: "{user}"}}},
+		{Resources: []string{"/rc/devices"}, Methods: []string{"GET"}, Groups: []string{"staff"},
+			Conditions: []Condition{{Field: "meta.team", Op: OpPrefix, Value: "{group}"}}},
+		{Resources: []string{"/rc/devices"}, Methods: []string{AnyMethod}, Users: []string{"admin"}},
+		{Resources: []string{"/rc/devices"}, Methods: []string{AnyMethod}, Users: []string{"admin"}, Deny: true,
+			Conditions: []Condition{{Field: "meta.locked", Op: OpEquals, Value: "true"}}},
+	}}
+	if err := authz.Validate(); err != nil {
+		t.Fatalf("Unexpected error validating the rules: %s", err)
+	}
+	device := func(meta map[string]interface{}) interface{} {
+		return map[string]interface{}{"id": "device_1", "meta": meta}
+	}
+
+	cases := []struct {
+		user       string
+		groups     []string
+		entry      interface{}
+		authorized bool
+	}{
+		{"alice", []string{"building-3"}, device(map[string]interface{}{"building": 3}), true},
+		{"alice", []string{"building-3"}, device(map[string]interface{}{"building": 4}), false},
+		{"alice", []string{"building-3"}, device(nil), false},
+		{"alice", []string{"staff"}, device(map[string]interface{}{"owners": []string{"bob", "alice"}}), true},
+		{"alice", []string{"staff"}, device(map[string]interface{}{"owners": []string{"bob"}}), false},
+		{"alice", []string{"x", "staff"}, device(map[string]interface{}{"team": "staff/devices"}), true},
+		{"admin", nil, device(map[string]interface{}{"building": 4}), true},
+		{"admin", nil, device(map[string]interface{}{"locked": true}), false},
+	}
+	for _, c := range cases {
+		if authorized := authz.AuthorizedEntry("/rc/devices/device_1", "GET", c.user, c.groups, c.entry); authorized != c.authorized {
+			t.Errorf("%s %v %v: expected authorized %t, got %t", c.user, c.groups, c.entry, c.authorized, authorized)
+		}
+	}
+
+	// Paths are accessible with conditional allow rules, conditional deny rules are checked on the entries
+	if !authz.Authorized("/rc/devices", "GET", "alice", []string{"building-3"}) || !authz.Conditional("/rc/devices", "GET", "alice", []string{"building-3"}) {
+		t.Error("Expected conditional access to the devices")
+	}
+	if !authz.Authorized("/rc/devices", "DELETE", "admin", nil) || !authz.Conditional("/rc/devices", "DELETE", "admin", nil) {
+		t.Error("Expected conditional access of admin to the devices")
+	}
+	if authz.Conditional("/rc/devices", "DELETE", "alice", []string{"building-3"}) {
+		t.Error("Expected unconditional access without matching rules")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, rule := range []Rule{
+		{Methods: []string{"GET"}, Users: []string{"alice"}},
+		{Resources: []string{"^/rc/(devices"}, Methods: []string{"GET"}, Users: []string{"alice"}},
+		{Resources: []string{"/rc"}, Users: []string{"alice"}},
+		{Resources: []string{"/rc"}, Methods: []string{"GET"}},
+		{Resources: []string{"/rc"}, Methods: []string{"GET"}, Users: []string{"alice"}, Conditions: []Condition{{Op: OpEquals}}},
+		{Resources: []string{"/rc"}, Methods: []string{"GET"}, Users: []string{"alice"}, Conditions: []Condition{{Field: "id", Op: "in"}}},
+	} {
+		authz := &Conf{Rules: []Rule{rule}}
+		if err := authz.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", rule)
+		}
+	}
+
+	// All problems are reported
+	authz := &Conf{Rules: []Rule{
+		{Id: "a", Resources: []string{"^/rc/(devices"}, Methods: []string{"GET"}, Users: []string{"alice"}},
+		{Id: "a"},
+	}}
+	errs, ok := authz.Validate().(Errors)
+	if !ok || len(errs) != 5 {
+		t.Errorf("Expected 5 errors, got %v", errs)
+	}
+
+	// Resources which are not paths are accepted as before, but match no request
+	authz = &Conf{Rules: []Rule{{Resources: []string{"rc"}, Methods: []string{"GET"}, Users: []string{"alice"}}}}
+	if err := authz.Validate(); err != nil {
+		t.Errorf("Unexpected error for a resource which is not a path: %s", err)
+	}
+	if authz.Authorized("/rc", "GET", "alice", nil) || authz.Authorized("rc", "GET", "alice", nil) {
+		t.Error("Expected a resource which is not a path to match no request")
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	authz := &Conf{Rules: []Rule{{Id: "a", Resources: []string{"/rc"}, Methods: []string{"GET"}, Users: []string{"alice"}}}}
+	if !authz.Authorized("/rc/devices", "GET", "alice", nil) {
+		t.Fatal("Expected access by the initial rules")
+	}
+
+	err := authz.SetRules([]Rule{
+		{Id: "a", Resources: []string{"/rc"}, Methods: []string{"GET"}, Users: []string{"bob"}},
+		{Id: "a", Resources: []string{"/sc"}, Methods: []string{"GET"}, Users: []string{"bob"}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for duplicate rule ids")
+	}
+	if !authz.Authorized("/rc/devices", "GET", "alice", nil) {
+		t.Fatal("Expected the initial rules to be kept after an error")
+	}
+
+	if err := authz.SetRules([]Rule{{Id: "b", Resources: []string{"/rc"}, Methods: []string{"GET"}, Users: []string{"bob"}}}); err != nil {
+		t.Fatalf("Unexpected error setting the rules: %s", err)
+	}
+	if authz.Authorized("/rc/devices", "GET", "alice", nil) || !authz.Authorized("/rc/devices", "GET", "bob", nil) {
+		t.Fatal("Expected access by the new rules")
+	}
+	if rules := authz.GetRules(); len(rules) != 1 || rules[0].Id != "b" {
+		t.Fatalf("Expected the new rules, got %+v", rules)
+	}
+}
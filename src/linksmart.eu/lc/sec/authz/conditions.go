@@ -0,0 +1,127 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Operators of conditions
+const (
+	OpEquals   = "equals"
+	OpPrefix   = "prefix"
+	OpSuffix   = "suffix"
+	OpContains = "contains"
+)
+
+// Placeholders in the values of conditions referring to the authenticated user
+const (
+	PlaceholderUser  = "{user}"
+	PlaceholderGroup = "{group}"
+)
+
+// Condition on an attribute of the accessed entry (e.g. a catalog registration)
+// Rules with conditions apply to the entries fulfilling all of them. The services check these when accessing
+// the entries, e.g. by filtering the entries they return; the paths themselves are accessible if the rule is an allow rule
+type Condition struct {
+	// Dot-separated path of the attribute in the JSON representation of the entry, e.g. meta.building
+	// The condition holds for an array if it holds for one of its elements
+	Field string `json:"field"`
+	// Operator: equals, prefix, suffix or contains
+	Op string `json:"op"`
+	// Value to compare the attribute with. {user} is replaced by the name of the authenticated user;
+	// with {group}, the condition holds if it holds for one of the groups of the user
+	Value string `json:"value"`
+}
+
+// Validate checks the condition
+func (c *Condition) Validate() error {
+	if c.Field == "" {
+		return fmt.Errorf("Authz: No field in a condition.")
+	}
+	switch c.Op {
+	case OpEquals, OpPrefix, OpSuffix, OpContains:
+	default:
+		return fmt.Errorf("Authz: Unknown operator %s in a condition, must be %s, %s, %s or %s.", c.Op, OpEquals, OpPrefix, OpSuffix, OpContains)
+	}
+	return nil
+}
+
+// Checks whether the condition holds for the attributes of an entry accessed by the given user
+func (c *Condition) holds(attributes interface{}, user string, groups []string) bool {
+	value := strings.Replace(c.Value, PlaceholderUser, user, -1)
+	attribute := lookup(attributes, strings.Split(c.Field, "."))
+	if !strings.Contains(value, PlaceholderGroup) {
+		return compare(attribute, c.Op, value)
+	}
+	for _, group := range groups {
+		if compare(attribute, c.Op, strings.Replace(value, PlaceholderGroup, group, -1)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether the conditions of a rule hold for the attributes of an entry
+func (rule *Rule) holds(attributes interface{}, user string, groups []string) bool {
+	for i := range rule.Conditions {
+		if !rule.Conditions[i].holds(attributes, user, groups) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the JSON representation of an entry as generic maps and arrays
+func attributes(entry interface{}) interface{} {
+	var attributes interface{}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil
+	}
+	json.Unmarshal(b, &attributes)
+	return attributes
+}
+
+// Returns the attribute at the given path, or nil if it does not exist
+func lookup(attributes interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return attributes
+	}
+	if m, ok := attributes.(map[string]interface{}); ok {
+		return lookup(m[path[0]], path[1:])
+	}
+	return nil
+}
+
+// Compares an attribute (a single value or an array) with a value
+func compare(attribute interface{}, op, value string) bool {
+	switch attribute := attribute.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, element := range attribute {
+			if compare(element, op, value) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		return false
+	}
+
+	s := fmt.Sprint(attribute)
+	switch op {
+	case OpEquals:
+		return s == value
+	case OpPrefix:
+		return strings.HasPrefix(s, value)
+	case OpSuffix:
+		return strings.HasSuffix(s, value)
+	case OpContains:
+		return strings.Contains(s, value)
+	}
+	return false
+}
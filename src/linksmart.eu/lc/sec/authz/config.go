@@ -2,37 +2,121 @@
 
 package authz
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// AnyMethod in the methods of a rule matches all methods
+const AnyMethod = "*"
 
 // Authorization struct
 type Conf struct {
 	// Authorization rules
 	Rules []Rule `json:"rules"`
+
+	// guards the rules, which may be replaced at runtime (see SetRules), and their compiled resource patterns
+	mu       sync.RWMutex
+	compiled bool
+	patterns [][]*regexp.Regexp
 }
 
 // Authorization rule
 type Rule struct {
+	// Optional unique id, used to manage the rules at runtime
+	Id string `json:"id,omitempty"`
+	// Resource patterns: paths with optional wildcards (*, **, ?) or regular expressions starting with ^
 	Resources []string `json:"resources"`
-	Methods   []string `json:"methods"`
-	Users     []string `json:"users"`
-	Groups    []string `json:"groups"`
+	// Methods, or * for all methods
+	Methods []string `json:"methods"`
+	Users   []string `json:"users"`
+	Groups  []string `json:"groups"`
+	// Deny rules forbid the access granted by the allow rules of the same or a lower priority
+	Deny bool `json:"deny"`
+	// Priority of the rule, rules of a higher priority override those of a lower one (default 0)
+	Priority int `json:"priority"`
+	// Conditions on the accessed entries, see Condition
+	Conditions []Condition `json:"conditions"`
+}
+
+// Errors collects all problems found in the authorization rules
+type Errors []error
+
+// Errors returns the collected errors
+func (e Errors) Errors() []error {
+	return e
 }
 
-// Validate authorization config
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate authorization config, returning all problems found as Errors
 func (authz *Conf) Validate() error {
+	var errs Errors
 
 	// Check each authorization rule
+	ids := make(map[string]bool)
 	for _, rule := range authz.Rules {
+		if rule.Id != "" {
+			if ids[rule.Id] {
+				errs = append(errs, fmt.Errorf("Authz: Duplicate rule id %s.", rule.Id))
+			}
+			ids[rule.Id] = true
+		}
 		if len(rule.Resources) == 0 {
-			return errors.New("Authz: No resources in an authorization rule.")
+			errs = append(errs, errors.New("Authz: No resources in an authorization rule."))
+		}
+		for _, res := range rule.Resources {
+			if !strings.HasPrefix(res, "/") && !strings.HasPrefix(res, "^") {
+				// Accepted as before, although such a resource matches no request
+				logger.Warnf("Authz: Resource %s does not start with / or ^ and matches no request.", res)
+			}
+			if _, err := compilePattern(res); err != nil {
+				errs = append(errs, fmt.Errorf("Authz: Invalid resource pattern %s: %s", res, err))
+			}
 		}
 		if len(rule.Methods) == 0 {
-			return errors.New("Authz: No methods in an authorization rule.")
+			errs = append(errs, errors.New("Authz: No methods in an authorization rule."))
 		}
 		if len(rule.Users) == 0 && len(rule.Groups) == 0 {
-			return errors.New("Authz: At least one user or group must be assigned to each authorization rule.")
+			errs = append(errs, errors.New("Authz: At least one user or group must be assigned to each authorization rule."))
+		}
+		for _, c := range rule.Conditions {
+			if err := c.Validate(); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
 
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// GetRules returns a copy of the rules in effect
+func (authz *Conf) GetRules() []Rule {
+	authz.mu.RLock()
+	defer authz.mu.RUnlock()
+	return append([]Rule(nil), authz.Rules...)
+}
+
+// SetRules validates and replaces the rules at runtime
+func (authz *Conf) SetRules(rules []Rule) error {
+	if err := (&Conf{Rules: rules}).Validate(); err != nil {
+		return err
+	}
+	authz.mu.Lock()
+	defer authz.mu.Unlock()
+	authz.Rules = append([]Rule(nil), rules...)
+	authz.compile()
 	return nil
 }
@@ -0,0 +1,15 @@
+// Copyright 2014-2016 Fraunhofer Institute for Applied Information Technology FIT
+
+package authz
+
+import (
+	"linksmart.eu/lc/core/logging"
+)
+
+const logComponent = "authz"
+
+var logger *logging.Logger
+
+func init() {
+	logger = logging.New(logComponent)
+}